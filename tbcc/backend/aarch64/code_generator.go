@@ -0,0 +1,553 @@
+// Package aarch64 translates TACKY programs to A64 assembly for Linux.
+// Function calls follow the AAPCS64 procedure call standard.
+package aarch64
+
+import (
+	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/tacky"
+	"strings"
+)
+
+const (
+	numArgRegisters = 8
+	// Variadic functions save x0-x7 in the general register save area,
+	// so that va_arg can fetch the unnamed arguments passed in registers
+	grSaveArea     = "gr_save_area"
+	grSaveAreaSize = 8 * numArgRegisters
+	// vaListSize is the size of the va_list structure of the AAPCS64
+	//
+	//	struct { void *__stack; void *__gr_top; void *__vr_top; int __gr_offs; int __vr_offs; }
+	vaListSize = 32
+)
+
+// CodeGenerator translates TACKY to A64 assembly. Every variable lives
+// in a stack slot; instructions load their operands into the scratch
+// registers x9-x11 and store the result back. x16 and x17 hold
+// addresses.
+type CodeGenerator struct {
+	code strings.Builder
+	// staticVars holds the names of the variables with static storage
+	// duration, ownStatics the ones defined in the program
+	staticVars   map[string]bool
+	ownStatics   map[string]bool
+	ownFunctions map[string]bool
+	labelCounter int
+	// state of the current function
+	slots     map[string]int
+	numParams int
+}
+
+func NewCodeGenerator() *CodeGenerator {
+	return &CodeGenerator{}
+}
+
+func (cg *CodeGenerator) GenerateCode(program *tacky.Program) string {
+	cg.code.Reset()
+	cg.staticVars = make(map[string]bool)
+	cg.ownStatics = make(map[string]bool)
+	cg.ownFunctions = make(map[string]bool)
+	for _, staticVar := range program.StaticVars {
+		cg.staticVars[staticVar.Ident] = true
+		cg.ownStatics[staticVar.Ident] = staticVar.Defined
+	}
+	for _, fun := range program.Funs {
+		cg.ownFunctions[fun.Ident] = true
+	}
+
+	for i := range program.Funs {
+		cg.generateFunction(&program.Funs[i])
+	}
+	for _, staticVar := range program.StaticVars {
+		if staticVar.Defined {
+			cg.generateStaticVariable(&staticVar)
+		}
+	}
+	cg.writeln("\t.section .note.GNU-stack,\"\",@progbits")
+	return cg.code.String()
+}
+
+func (cg *CodeGenerator) generateStaticVariable(s *tacky.StaticVariable) {
+	size := frontend.SizeOf(s.Type)
+	if s.Global {
+		cg.writeln("\t.globl " + s.Ident)
+	}
+	if s.Init == 0 {
+		cg.writeln("\t.bss")
+	} else {
+		cg.writeln("\t.data")
+	}
+	cg.writeln(fmt.Sprintf("\t.balign %d", frontend.AlignmentOf(s.Type)))
+	cg.writeln(s.Ident + ":")
+	switch {
+	case s.Init == 0:
+		cg.writeln(fmt.Sprintf("\t.zero %d", size))
+	case size == 8:
+		cg.writeln(fmt.Sprintf("\t.xword %d", s.Init))
+	default:
+		cg.writeln(fmt.Sprintf("\t.word %d", s.Init))
+	}
+}
+
+// generateFunction emits the function with the frame
+//
+//	x29 + 16 ...   stack arguments of the caller
+//	x29            saved x29 and x30
+//	sp + outArgs   stack slots of the variables
+//	sp             outgoing stack arguments
+func (cg *CodeGenerator) generateFunction(f *tacky.Function) {
+	cg.numParams = len(f.Parameters)
+	frameSize := cg.allocateSlots(f)
+
+	cg.writeln("\t.text")
+	cg.writeln("\t.globl " + f.Ident)
+	cg.writeln("\t.type " + f.Ident + ", %function")
+	cg.writeln(f.Ident + ":")
+	cg.writeln("\tstp x29, x30, [sp, #-16]!")
+	cg.writeln("\tmov x29, sp")
+	if frameSize > 0 {
+		cg.addImmediate("sp", "sp", -frameSize)
+	}
+
+	if f.Variadic {
+		for i := 0; i < numArgRegisters; i++ {
+			cg.writeln(fmt.Sprintf("\tstr x%d, %s", i, cg.slot(grSaveArea, 8*i, 8)))
+		}
+	}
+	for i, param := range f.Parameters {
+		size := tacky.SizeOf(param.Type, vaListSize)
+		if i < numArgRegisters {
+			cg.writeln(fmt.Sprintf("\tstr %s, %s", register(i, size), cg.slot(param.Ident, 0, size)))
+		} else {
+			cg.writeln(fmt.Sprintf("\tldr %s, [x29, #%d]", register(9, size), 16+8*(i-numArgRegisters)))
+			cg.store(param, 9)
+		}
+	}
+
+	for _, instr := range f.Body {
+		cg.generateInstruction(instr)
+	}
+	cg.writeln("\t.size " + f.Ident + ", .-" + f.Ident)
+}
+
+// allocateSlots assigns a stack slot to every variable of the function
+// and returns the size of the frame below the saved registers
+func (cg *CodeGenerator) allocateSlots(f *tacky.Function) int {
+	outArgs := 0
+	for _, instr := range f.Body {
+		var args []tacky.Value
+		switch call := instr.(type) {
+		case *tacky.FunctionCall:
+			args = call.Args
+		case *tacky.IndirectCall:
+			args = call.Args
+		}
+		outArgs = max(outArgs, 8*(len(args)-numArgRegisters))
+	}
+	outArgs = tacky.AlignTo(outArgs, 16)
+
+	cg.slots = make(map[string]int)
+	offset := outArgs
+	allocate := func(name string, size, alignment int) {
+		offset = tacky.AlignTo(offset, alignment)
+		cg.slots[name] = offset
+		offset += size
+	}
+	if f.Variadic {
+		allocate(grSaveArea, grSaveAreaSize, 8)
+	}
+	for _, v := range tacky.Variables(f) {
+		if cg.staticVars[v.Ident] || v.Type.GetTypeId() == frontend.TypeFunc {
+			continue
+		}
+		allocate(v.Ident, tacky.SizeOf(v.Type, vaListSize), tacky.AlignmentOf(v.Type))
+	}
+	return tacky.AlignTo(offset, 16)
+}
+
+func (cg *CodeGenerator) generateInstruction(instr tacky.Instruction) {
+	switch i := instr.(type) {
+	case *tacky.Return:
+		if i.Val != nil {
+			cg.load(i.Val, 0, tacky.SizeOfValue(i.Val, vaListSize))
+		}
+		cg.writeln("\tmov sp, x29")
+		cg.writeln("\tldp x29, x30, [sp], #16")
+		cg.writeln("\tret")
+	case *tacky.Unary:
+		size := tacky.SizeOfValue(i.Src, vaListSize)
+		cg.load(i.Src, 9, size)
+		switch i.Op.GetType() {
+		case tacky.TacNegate:
+			cg.writeln("\tneg w9, w9")
+		case tacky.TacComplement:
+			cg.writeln("\tmvn w9, w9")
+		case tacky.TacNot:
+			cg.writeln(fmt.Sprintf("\tcmp %s, #0", register(9, size)))
+			cg.writeln("\tcset w9, eq")
+		default:
+			panic("unsupported unary operator")
+		}
+		cg.store(i.Dst, 9)
+	case *tacky.Binary:
+		cg.generateBinary(i)
+	case *tacky.Copy:
+		if tacky.IsAggregate(i.Dst) {
+			cg.address(i.Src, 16)
+			cg.address(i.Dst, 17)
+			cg.copyBytes(tacky.SizeOfValue(i.Dst, vaListSize), "x16", "x17")
+			return
+		}
+		cg.load(i.Src, 9, tacky.SizeOfValue(i.Dst, vaListSize))
+		cg.store(i.Dst, 9)
+	case *tacky.Jump:
+		cg.writeln("\tb .L" + i.Target)
+	case *tacky.JumpIfZero:
+		size := tacky.SizeOfValue(i.Condition, vaListSize)
+		cg.load(i.Condition, 9, size)
+		cg.writeln(fmt.Sprintf("\tcbz %s, .L%s", register(9, size), i.Target))
+	case *tacky.JumpIfNotZero:
+		size := tacky.SizeOfValue(i.Condition, vaListSize)
+		cg.load(i.Condition, 9, size)
+		cg.writeln(fmt.Sprintf("\tcbnz %s, .L%s", register(9, size), i.Target))
+	case *tacky.CompareAndJump:
+		unsigned := cg.compare(i.Src1, i.Src2)
+		cg.writeln(fmt.Sprintf("\tb.%s .L%s", conditionCode(i.Op, unsigned), i.Target))
+	case *tacky.Label:
+		cg.writeln(".L" + i.Name + ":")
+	case *tacky.FunctionCall:
+		cg.passArguments(i.Args)
+		cg.writeln("\tbl " + i.Name)
+		cg.storeResult(i.Dst)
+	case *tacky.IndirectCall:
+		cg.passArguments(i.Args)
+		cg.load(i.FunPtr, 16, 8)
+		cg.writeln("\tblr x16")
+		cg.storeResult(i.Dst)
+	case *tacky.GetAddress:
+		cg.address(i.Src, 9)
+		cg.store(i.Dst, 9)
+	case *tacky.Load:
+		cg.load(i.SrcPtr, 16, 8)
+		if tacky.IsAggregate(i.Dst) {
+			cg.address(i.Dst, 17)
+			cg.copyBytes(tacky.SizeOfValue(i.Dst, vaListSize), "x16", "x17")
+			return
+		}
+		size := tacky.SizeOfValue(i.Dst, vaListSize)
+		cg.writeln(fmt.Sprintf("\tldr %s, [x16]", register(9, size)))
+		cg.store(i.Dst, 9)
+	case *tacky.Store:
+		// the pointer determines the size (the source may be a null pointer constant)
+		referenced := i.DstPtr.(*tacky.Var).Type.(*frontend.PointerInfo).Referenced
+		if tacky.IsAggregate(i.Src) {
+			// loading a static pointer uses x16
+			cg.load(i.DstPtr, 17, 8)
+			cg.address(i.Src, 16)
+			cg.copyBytes(tacky.SizeOf(referenced, vaListSize), "x16", "x17")
+			return
+		}
+		size := tacky.SizeOf(referenced, vaListSize)
+		cg.load(i.Src, 9, size)
+		cg.load(i.DstPtr, 16, 8)
+		cg.writeln(fmt.Sprintf("\tstr %s, [x16]", register(9, size)))
+	case *tacky.AddOffset:
+		cg.load(i.Ptr, 9, 8)
+		cg.addImmediate("x9", "x9", i.Offset)
+		cg.store(i.Dst, 9)
+	case *tacky.SignExtend:
+		cg.load(i.Src, 9, 4)
+		cg.writeln("\tsxtw x9, w9")
+		cg.store(i.Dst, 9)
+	case *tacky.Truncate:
+		// little endian: the low bytes come first
+		cg.load(i.Src, 9, 4)
+		cg.store(i.Dst, 9)
+	case *tacky.VaStart:
+		cg.generateVaStart(i)
+	case *tacky.VaArg:
+		cg.generateVaArg(i)
+	default:
+		panic(fmt.Sprintf("unsupported instruction type: %T", instr))
+	}
+}
+
+func (cg *CodeGenerator) generateBinary(b *tacky.Binary) {
+	if _, ok := conditionCodes[b.Op.GetType()]; ok {
+		unsigned := cg.compare(b.Src1, b.Src2)
+		cg.writeln("\tcset w9, " + conditionCode(b.Op, unsigned))
+		cg.store(b.Dst, 9)
+		return
+	}
+
+	size := tacky.SizeOfValue(b.Dst, vaListSize)
+	cg.load(b.Src1, 9, size)
+	cg.load(b.Src2, 10, size)
+	r9, r10, r11 := register(9, size), register(10, size), register(11, size)
+	var mnemonic string
+	switch b.Op.GetType() {
+	case tacky.TacAdd:
+		mnemonic = "add"
+	case tacky.TacSub:
+		mnemonic = "sub"
+	case tacky.TacMul:
+		mnemonic = "mul"
+	case tacky.TacDiv:
+		mnemonic = "sdiv"
+	case tacky.TacRemainder:
+		// a % b = a - (a / b) * b
+		cg.writeln(fmt.Sprintf("\tsdiv %s, %s, %s", r11, r9, r10))
+		cg.writeln(fmt.Sprintf("\tmsub %s, %s, %s, %s", r9, r11, r10, r9))
+		cg.store(b.Dst, 9)
+		return
+	case tacky.TacBitAnd:
+		mnemonic = "and"
+	case tacky.TacBitOr:
+		mnemonic = "orr"
+	case tacky.TacBitXor:
+		mnemonic = "eor"
+	case tacky.TacBitShiftLeft:
+		mnemonic = "lsl"
+	case tacky.TacBitShiftRight:
+		mnemonic = "asr"
+	default:
+		panic("unsupported binary operator")
+	}
+	cg.writeln(fmt.Sprintf("\t%s %s, %s, %s", mnemonic, r9, r9, r10))
+	cg.store(b.Dst, 9)
+}
+
+// compare sets the flags for the relation "src1 op src2" and returns
+// whether the operands are pointers, which are compared as unsigned 64
+// bit values
+func (cg *CodeGenerator) compare(src1, src2 tacky.Value) bool {
+	size := max(tacky.SizeOfValue(src1, vaListSize), tacky.SizeOfValue(src2, vaListSize))
+	cg.load(src1, 9, size)
+	cg.load(src2, 10, size)
+	cg.writeln(fmt.Sprintf("\tcmp %s, %s", register(9, size), register(10, size)))
+	return size == 8
+}
+
+var conditionCodes = map[tacky.TacType]string{
+	tacky.TacEq:    "eq",
+	tacky.TacNotEq: "ne",
+	tacky.TacGt:    "gt",
+	tacky.TacGtEq:  "ge",
+	tacky.TacLt:    "lt",
+	tacky.TacLtEq:  "le",
+}
+
+var unsignedConditionCodes = map[string]string{
+	"gt": "hi",
+	"ge": "hs",
+	"lt": "lo",
+	"le": "ls",
+}
+
+func conditionCode(op tacky.BinaryOp, unsigned bool) string {
+	cc, ok := conditionCodes[op.GetType()]
+	if !ok {
+		panic("not a relational operator")
+	}
+	if unsignedCc, ok := unsignedConditionCodes[cc]; unsigned && ok {
+		return unsignedCc
+	}
+	return cc
+}
+
+// passArguments passes the first eight arguments in x0-x7 and the
+// remaining ones in 8 byte slots at the bottom of the stack
+func (cg *CodeGenerator) passArguments(args []tacky.Value) {
+	for i := numArgRegisters; i < len(args); i++ {
+		size := tacky.SizeOfValue(args[i], vaListSize)
+		cg.load(args[i], 9, size)
+		cg.writeln(fmt.Sprintf("\tstr %s, [sp, #%d]", register(9, size), 8*(i-numArgRegisters)))
+	}
+	for i := 0; i < min(len(args), numArgRegisters); i++ {
+		cg.load(args[i], i, tacky.SizeOfValue(args[i], vaListSize))
+	}
+}
+
+func (cg *CodeGenerator) storeResult(dst tacky.Value) {
+	if dst != nil {
+		cg.store(dst, 0)
+	}
+}
+
+// generateVaStart initializes the va_list so that the next argument is
+// the first one after the named parameters
+func (cg *CodeGenerator) generateVaStart(vaStart *tacky.VaStart) {
+	namedInRegisters := min(cg.numParams, numArgRegisters)
+	namedOnStack := cg.numParams - namedInRegisters
+
+	cg.load(vaStart.VaList, 16, 8)
+	cg.addImmediate("x9", "x29", 16+8*namedOnStack)
+	cg.writeln("\tstr x9, [x16]")
+	cg.addImmediate("x9", "sp", cg.slots[grSaveArea]+grSaveAreaSize)
+	cg.writeln("\tstr x9, [x16, #8]")
+	cg.writeln("\tstr xzr, [x16, #16]")
+	cg.loadImmediate("w9", -8*(numArgRegisters-namedInRegisters))
+	cg.writeln("\tstr w9, [x16, #24]")
+	cg.writeln("\tstr wzr, [x16, #28]")
+}
+
+// generateVaArg fetches the next argument from the register save area
+// as long as __gr_offs is negative and from the stack otherwise
+func (cg *CodeGenerator) generateVaArg(vaArg *tacky.VaArg) {
+	stackLabel := cg.createLabelName("va_arg.stack")
+	endLabel := cg.createLabelName("va_arg.end")
+
+	cg.load(vaArg.VaList, 16, 8)
+	cg.writeln("\tldr w9, [x16, #24]")
+	cg.writeln("\ttbz w9, #31, .L" + stackLabel)
+	cg.writeln("\tadd w10, w9, #8")
+	cg.writeln("\tstr w10, [x16, #24]")
+	cg.writeln("\tldr x11, [x16, #8]")
+	cg.writeln("\tadd x11, x11, w9, sxtw")
+	cg.writeln("\tb .L" + endLabel)
+	cg.writeln(".L" + stackLabel + ":")
+	// every argument on the stack takes 8 bytes
+	cg.writeln("\tldr x11, [x16]")
+	cg.writeln("\tadd x10, x11, #8")
+	cg.writeln("\tstr x10, [x16]")
+	cg.writeln(".L" + endLabel + ":")
+	size := tacky.SizeOfValue(vaArg.Dst, vaListSize)
+	cg.writeln(fmt.Sprintf("\tldr %s, [x11]", register(9, size)))
+	cg.store(vaArg.Dst, 9)
+}
+
+// load loads the value into register xN (or wN for 4 byte values)
+func (cg *CodeGenerator) load(value tacky.Value, n int, size int) {
+	switch v := value.(type) {
+	case *tacky.IntConstant:
+		cg.loadImmediate(register(n, size), v.Val)
+	case *tacky.Var:
+		cg.writeln(fmt.Sprintf("\tldr %s, %s", register(n, size), cg.memory(v, size)))
+	default:
+		panic("unsupported value type")
+	}
+}
+
+func (cg *CodeGenerator) store(v tacky.Value, n int) {
+	size := tacky.SizeOfValue(v, vaListSize)
+	cg.writeln(fmt.Sprintf("\tstr %s, %s", register(n, size), cg.memory(v.(*tacky.Var), size)))
+}
+
+// memory returns the memory operand of the variable. Static variables
+// are addressed through x16.
+func (cg *CodeGenerator) memory(v *tacky.Var, size int) string {
+	if cg.staticVars[v.Ident] {
+		cg.symbolAddress(16, v.Ident, cg.ownStatics[v.Ident])
+		return "[x16]"
+	}
+	return cg.slot(v.Ident, 0, size)
+}
+
+// slot returns the memory operand of the stack slot at the given offset.
+// Offsets which cannot be encoded in a load or store are computed in x17.
+func (cg *CodeGenerator) slot(name string, offset int, size int) string {
+	offset += cg.slots[name]
+	if offset%size == 0 && offset/size < 4096 {
+		return fmt.Sprintf("[sp, #%d]", offset)
+	}
+	cg.addImmediate("x17", "sp", offset)
+	return "[x17]"
+}
+
+// address loads the address of the variable (or function) into xN
+func (cg *CodeGenerator) address(value tacky.Value, n int) {
+	v := value.(*tacky.Var)
+	switch {
+	case v.Type.GetTypeId() == frontend.TypeFunc:
+		cg.symbolAddress(n, v.Ident, cg.ownFunctions[v.Ident])
+	case cg.staticVars[v.Ident]:
+		cg.symbolAddress(n, v.Ident, cg.ownStatics[v.Ident])
+	default:
+		cg.addImmediate(fmt.Sprintf("x%d", n), "sp", cg.slots[v.Ident])
+	}
+}
+
+// symbolAddress loads the address of a symbol into xN. Symbols defined
+// elsewhere are looked up in the global offset table.
+func (cg *CodeGenerator) symbolAddress(n int, name string, own bool) {
+	if own {
+		cg.writeln(fmt.Sprintf("\tadrp x%d, %s", n, name))
+		cg.writeln(fmt.Sprintf("\tadd x%d, x%d, :lo12:%s", n, n, name))
+	} else {
+		cg.writeln(fmt.Sprintf("\tadrp x%d, :got:%s", n, name))
+		cg.writeln(fmt.Sprintf("\tldr x%d, [x%d, :got_lo12:%s]", n, n, name))
+	}
+}
+
+// copyBytes copies size bytes from the memory src points to to the
+// memory dst points to
+func (cg *CodeGenerator) copyBytes(size int, src, dst string) {
+	offset := 0
+	for ; offset+8 <= size; offset += 8 {
+		cg.writeln(fmt.Sprintf("\tldr x9, [%s, #%d]", src, offset))
+		cg.writeln(fmt.Sprintf("\tstr x9, [%s, #%d]", dst, offset))
+	}
+	// the remaining bytes of structures without named members are padding
+	if offset+4 <= size {
+		cg.writeln(fmt.Sprintf("\tldr w9, [%s, #%d]", src, offset))
+		cg.writeln(fmt.Sprintf("\tstr w9, [%s, #%d]", dst, offset))
+	}
+}
+
+// loadImmediate moves a constant into a register 16 bits at a time
+func (cg *CodeGenerator) loadImmediate(reg string, value int) {
+	size := 4
+	if strings.HasPrefix(reg, "x") {
+		size = 8
+	}
+	if value >= -65536 && value < 65536 {
+		cg.writeln(fmt.Sprintf("\tmov %s, #%d", reg, value))
+		return
+	}
+	bits := uint64(value)
+	cg.writeln(fmt.Sprintf("\tmovz %s, #%d", reg, bits&0xffff))
+	for shift := 16; shift < 8*size; shift += 16 {
+		if chunk := (bits >> shift) & 0xffff; chunk != 0 {
+			cg.writeln(fmt.Sprintf("\tmovk %s, #%d, lsl #%d", reg, chunk, shift))
+		}
+	}
+}
+
+// addImmediate emits dst = src + value for 64 bit registers (or sp).
+// Large values are moved into dst first or, if that is not possible,
+// into x17.
+func (cg *CodeGenerator) addImmediate(dst, src string, value int) {
+	mnemonic := "add"
+	if value < 0 {
+		mnemonic, value = "sub", -value
+	}
+	if value < 4096 {
+		cg.writeln(fmt.Sprintf("\t%s %s, %s, #%d", mnemonic, dst, src, value))
+		return
+	}
+	scratch := dst
+	if dst == src || dst == "sp" {
+		scratch = "x17"
+	}
+	cg.loadImmediate(scratch, value)
+	cg.writeln(fmt.Sprintf("\t%s %s, %s, %s", mnemonic, dst, src, scratch))
+}
+
+func (cg *CodeGenerator) createLabelName(prefix string) string {
+	name := fmt.Sprintf("%s.%d", prefix, cg.labelCounter)
+	cg.labelCounter++
+	return name
+}
+
+func (cg *CodeGenerator) writeln(line string) {
+	cg.code.WriteString(line)
+	cg.code.WriteString("\n")
+}
+
+// register returns the name of register N for values of the given size
+func register(n int, size int) string {
+	if size == 8 {
+		return fmt.Sprintf("x%d", n)
+	}
+	return fmt.Sprintf("w%d", n)
+}
@@ -0,0 +1,113 @@
+package aarch64
+
+import (
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/internal/backendtest"
+	"strings"
+	"testing"
+)
+
+func TestCodeGenerator_GenerateCode(t *testing.T) {
+	code := `
+	int sum(int a, int b, int c, int d, int e, int f, int g, int h, int i, int j) {
+		return a / b + c % d + j;
+	}
+
+	int main(void) {
+		int i = 0;
+		while (i < 10)
+			i++;
+		return sum(1, 2, 3, 4, 5, 6, 7, 8, 9, i) + (i == 3);
+	}`
+
+	asm := generate(t, code)
+
+	for _, want := range []string{
+		"\t.globl main\n\t.type main, %function\nmain:\n\tstp x29, x30, [sp, #-16]!\n\tmov x29, sp\n",
+		"\tmov sp, x29\n\tldp x29, x30, [sp], #16\n\tret\n",
+		"\tsdiv w9, w9, w10\n",
+		"\tsdiv w11, w9, w10\n\tmsub w9, w11, w10, w9\n",
+		// the 10th argument is passed on the stack
+		"\tldr w9, [x29, #24]\n",
+		"\tstr w9, [sp, #8]\n",
+		"\tb.ge .Lloop.0.break\n",
+		"\tcset w9, eq\n",
+		"\tbl sum\n",
+		".section .note.GNU-stack",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+}
+
+func TestCodeGenerator_GenerateCode_Variadic(t *testing.T) {
+	code := `
+	int first(int count, ...) {
+		__builtin_va_list ap;
+		__builtin_va_start(ap, count);
+		int x = __builtin_va_arg(ap, int);
+		__builtin_va_end(ap);
+		return x;
+	}`
+
+	asm := generate(t, code)
+
+	for _, want := range []string{
+		// register save area
+		"\tstr x7, [sp, #56]\n",
+		// __stack, __gr_top, __gr_offs
+		"\tadd x9, x29, #16\n\tstr x9, [x16]\n",
+		"\tadd x9, sp, #64\n\tstr x9, [x16, #8]\n",
+		"\tmov w9, #-56\n\tstr w9, [x16, #24]\n",
+		"\ttbz w9, #31, .Lva_arg.stack.",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+}
+
+func TestCodeGenerator_GenerateCode_StaticVariables(t *testing.T) {
+	code := `
+	int counter = 5;
+	static int *last;
+
+	int next(void) {
+		extern int external;
+		last = &external;
+		return ++counter;
+	}`
+
+	asm := generate(t, code)
+
+	for _, want := range []string{
+		"counter:\n\t.word 5\n",
+		"last:\n\t.zero 8\n",
+		"adrp x16, counter\n\tadd x16, x16, :lo12:counter\n",
+		"adrp x9, :got:external\n\tldr x9, [x9, :got_lo12:external]\n",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+	if strings.Contains(asm, ".globl last") {
+		t.Errorf("unexpected .globl last in generated code:\n%s", asm)
+	}
+}
+
+// TestCodeGenerator_GenerateCode_Execute runs the generated code with
+// qemu. It is skipped if the cross compiler or qemu are missing.
+func TestCodeGenerator_GenerateCode_Execute(t *testing.T) {
+	backendtest.RequireTools(t, "aarch64-linux-gnu-gcc", "qemu-aarch64")
+	asmFile := backendtest.WriteFile(t, "program.s", generate(t, backendtest.ExecuteCode))
+	executable := strings.TrimSuffix(asmFile, ".s")
+	backendtest.Run(t, "aarch64-linux-gnu-gcc", "-static", asmFile, "-o", executable)
+	if got := backendtest.ExitStatus(t, "qemu-aarch64", executable); got != backendtest.ExecuteStatus {
+		t.Errorf("exit status = %d, want %d", got, backendtest.ExecuteStatus)
+	}
+}
+
+func generate(t *testing.T, code string) string {
+	program, _ := backendtest.FrontEnd(t, code)
+	return NewCodeGenerator().GenerateCode(program)
+}
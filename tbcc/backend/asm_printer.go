@@ -2,16 +2,23 @@ package backend
 
 import (
 	"fmt"
+	"io"
+	"os"
 )
 
 type AsmPrinter struct {
 	offset          int
 	delta           int
 	suppressPadding bool
+	out             io.Writer
 }
 
 func NewAsmPrinter(delta int) *AsmPrinter {
-	return &AsmPrinter{0, delta, false}
+	return NewAsmPrinterWithWriter(delta, os.Stdout)
+}
+
+func NewAsmPrinterWithWriter(delta int, out io.Writer) *AsmPrinter {
+	return &AsmPrinter{0, delta, false, out}
 }
 
 func (ap *AsmPrinter) VisitProgram(p *Program) {
@@ -20,6 +27,21 @@ func (ap *AsmPrinter) VisitProgram(p *Program) {
 	for _, funcDef := range p.FuncDefs {
 		funcDef.Accept(ap)
 	}
+	for _, staticVar := range p.StaticVars {
+		staticVar.Accept(ap)
+	}
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AsmPrinter) VisitStaticVariable(s *StaticVariable) {
+	ap.println("StaticVariable(")
+	ap.indent()
+	ap.println("name=\"" + s.Name + "\"")
+	ap.println(fmt.Sprintf("global=%t", s.Global))
+	ap.println(fmt.Sprintf("size=%d", s.Size))
+	ap.println(fmt.Sprintf("alignment=%d", s.Alignment))
+	ap.println(fmt.Sprintf("init=%d", s.Init))
 	ap.dedent()
 	ap.println(")")
 }
@@ -42,6 +64,7 @@ func (ap *AsmPrinter) VisitFunctionDef(f *FunctionDef) {
 func (ap *AsmPrinter) VisitMov(m *Mov) {
 	ap.println("Mov(")
 	ap.indent()
+	ap.println("type=" + m.Type.String())
 	ap.print("src=")
 	ap.suppressPadding = true
 	m.Src.Accept(ap)
@@ -55,6 +78,7 @@ func (ap *AsmPrinter) VisitMov(m *Mov) {
 func (ap *AsmPrinter) VisitUnary(u *Unary) {
 	ap.println("Unary(")
 	ap.indent()
+	ap.println("type=" + u.Type.String())
 	ap.print("op=")
 	ap.suppressPadding = true
 	u.Op.Accept(ap)
@@ -68,6 +92,7 @@ func (ap *AsmPrinter) VisitUnary(u *Unary) {
 func (ap *AsmPrinter) VisitBinary(b *Binary) {
 	ap.println("Binary(")
 	ap.indent()
+	ap.println("type=" + b.Type.String())
 	ap.print("op=")
 	ap.suppressPadding = true
 	b.Op.Accept(ap)
@@ -84,6 +109,7 @@ func (ap *AsmPrinter) VisitBinary(b *Binary) {
 func (ap *AsmPrinter) VisitCmp(c *Cmp) {
 	ap.println("Cmp(")
 	ap.indent()
+	ap.println("type=" + c.Type.String())
 	ap.print("left=")
 	ap.suppressPadding = true
 	c.Left.Accept(ap)
@@ -97,6 +123,7 @@ func (ap *AsmPrinter) VisitCmp(c *Cmp) {
 func (ap *AsmPrinter) VisitIDiv(i *IDiv) {
 	ap.println("IDiv(")
 	ap.indent()
+	ap.println("type=" + i.Type.String())
 	ap.print("operand=")
 	ap.suppressPadding = true
 	i.Operand.Accept(ap)
@@ -104,8 +131,34 @@ func (ap *AsmPrinter) VisitIDiv(i *IDiv) {
 	ap.println(")")
 }
 
-func (ap *AsmPrinter) VisitCdq(*Cdq) {
-	ap.println("Cdq")
+func (ap *AsmPrinter) VisitMovsx(m *Movsx) {
+	ap.println("Movsx(")
+	ap.indent()
+	ap.print("src=")
+	ap.suppressPadding = true
+	m.Src.Accept(ap)
+	ap.print("dst=")
+	ap.suppressPadding = true
+	m.Dst.Accept(ap)
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AsmPrinter) VisitLea(l *Lea) {
+	ap.println("Lea(")
+	ap.indent()
+	ap.print("src=")
+	ap.suppressPadding = true
+	l.Src.Accept(ap)
+	ap.print("dst=")
+	ap.suppressPadding = true
+	l.Dst.Accept(ap)
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AsmPrinter) VisitCdq(c *Cdq) {
+	ap.println(fmt.Sprintf("Cdq(%s)", c.Type))
 }
 
 func (ap *AsmPrinter) VisitJump(j *Jump) {
@@ -136,6 +189,10 @@ func (ap *AsmPrinter) VisitLabel(l *Label) {
 	ap.println(fmt.Sprintf("Label(name=\"%s\")", l.Identifier))
 }
 
+func (ap *AsmPrinter) VisitLocation(l *Location) {
+	ap.println(fmt.Sprintf("Location(line=%d, col=%d)", l.Pos.Line, l.Pos.Col))
+}
+
 func (ap *AsmPrinter) VisitAllocStack(a *AllocStack) {
 	ap.println(fmt.Sprintf("AllocStack(%d)", a.N))
 }
@@ -156,6 +213,14 @@ func (ap *AsmPrinter) VisitCall(c *Call) {
 	ap.println(fmt.Sprintf("Call(%s)", c.Identifier))
 }
 
+func (ap *AsmPrinter) VisitIndirectCall(i *IndirectCall) {
+	ap.println("IndirectCall(")
+	ap.indent()
+	i.Operand.Accept(ap)
+	ap.dedent()
+	ap.println(")")
+}
+
 func (ap *AsmPrinter) VisitReturn() {
 	ap.println("Ret")
 }
@@ -207,7 +272,12 @@ func (ap *AsmPrinter) VisitRegister(r *Register) {
 }
 
 func (ap *AsmPrinter) VisitPseudoReg(p *PseudoReg) {
-	text := fmt.Sprintf("PseudoReg(%s)", p.Ident)
+	text := fmt.Sprintf("PseudoReg(%s, %s)", p.Ident, p.Type)
+	ap.println(text)
+}
+
+func (ap *AsmPrinter) VisitPseudoMem(p *PseudoMem) {
+	text := fmt.Sprintf("PseudoMem(%s, %d, %d)", p.Ident, p.Size, p.Offset)
 	ap.println(text)
 }
 
@@ -216,6 +286,15 @@ func (ap *AsmPrinter) VisitStack(s *Stack) {
 	ap.println(text)
 }
 
+func (ap *AsmPrinter) VisitMemory(m *Memory) {
+	text := fmt.Sprintf("Memory(%s, %d)", m.Reg, m.Offset)
+	ap.println(text)
+}
+
+func (ap *AsmPrinter) VisitData(d *Data) {
+	ap.println("Data(" + d.Name + ")")
+}
+
 func (ap *AsmPrinter) indent() {
 	ap.offset += ap.delta
 }
@@ -226,7 +305,7 @@ func (ap *AsmPrinter) dedent() {
 
 func (ap *AsmPrinter) print(text string) {
 	if ap.suppressPadding {
-		fmt.Print(text)
+		_, _ = fmt.Fprint(ap.out, text)
 		ap.suppressPadding = false
 		return
 	}
@@ -234,7 +313,7 @@ func (ap *AsmPrinter) print(text string) {
 	for i := 0; i < ap.offset; i++ {
 		leftPadding += " "
 	}
-	fmt.Printf("%s%s", leftPadding, text)
+	_, _ = fmt.Fprintf(ap.out, "%s%s", leftPadding, text)
 }
 
 func (ap *AsmPrinter) println(text string) {
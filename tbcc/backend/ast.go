@@ -1,11 +1,16 @@
 package backend
 
+import "github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+
 type AsmAstType int
 
 const (
 	AsmProgram AsmAstType = iota
 	AsmFunctionDef
+	AsmStaticVariable
 	AsmMov
+	AsmMovsx
+	AsmLea
 	AsmUnary
 	AsmBinary
 	AsmCmp
@@ -19,7 +24,9 @@ const (
 	AsmDeAllocStack
 	AsmPush
 	AsmCall
+	AsmIndirectCall
 	AsmReturn
+	AsmLocation
 	AsmNeg
 	AsmNot
 	AsmAdd
@@ -33,9 +40,27 @@ const (
 	AsmImmediate
 	AsmRegister
 	AsmPseudoReg
+	AsmPseudoMem
 	AsmStack
+	AsmMemory
+	AsmData
+)
+
+// AsmType is the operand size of an instruction
+type AsmType int
+
+const (
+	Longword AsmType = iota // 4 bytes
+	Quadword                // 8 bytes
 )
 
+func (t AsmType) String() string {
+	if t == Quadword {
+		return "Quadword"
+	}
+	return "Longword"
+}
+
 type ConditionCode uint
 
 const (
@@ -45,6 +70,11 @@ const (
 	CcGtEq
 	CcLt
 	CcLtEq
+	// the unsigned relations, used for pointers
+	CcAbove
+	CcAboveEq
+	CcBelow
+	CcBelowEq
 )
 
 const (
@@ -67,7 +97,10 @@ type AST interface {
 type AsmVisitor interface {
 	VisitProgram(p *Program)
 	VisitFunctionDef(f *FunctionDef)
+	VisitStaticVariable(s *StaticVariable)
 	VisitMov(m *Mov)
+	VisitMovsx(m *Movsx)
+	VisitLea(l *Lea)
 	VisitUnary(u *Unary)
 	VisitBinary(b *Binary)
 	VisitCmp(c *Cmp)
@@ -81,7 +114,9 @@ type AsmVisitor interface {
 	VisitDeAllocStack(d *DeAllocStack)
 	VisitPush(p *Push)
 	VisitCall(c *Call)
+	VisitIndirectCall(i *IndirectCall)
 	VisitReturn()
+	VisitLocation(l *Location)
 	VisitNeg(n *Neg)
 	VisitNot(n *Not)
 	VisitAdd(a *Add)
@@ -91,15 +126,19 @@ type AsmVisitor interface {
 	VisitImmediate(i *Immediate)
 	VisitRegister(r *Register)
 	VisitPseudoReg(p *PseudoReg)
+	VisitPseudoMem(p *PseudoMem)
 	VisitStack(s *Stack)
+	VisitMemory(m *Memory)
+	VisitData(d *Data)
 }
 
 type Program struct {
-	FuncDefs []FunctionDef
+	FuncDefs   []FunctionDef
+	StaticVars []StaticVariable
 }
 
 func NewProgram(funcDefs []FunctionDef) *Program {
-	return &Program{funcDefs}
+	return &Program{funcDefs, nil}
 }
 
 func (p *Program) GetType() AsmAstType {
@@ -126,17 +165,40 @@ func (f *FunctionDef) Accept(visitor AsmVisitor) {
 	visitor.VisitFunctionDef(f)
 }
 
+// StaticVariable is a variable with static storage duration that is
+// defined in the program
+type StaticVariable struct {
+	Name      string
+	Global    bool
+	Size      int
+	Alignment int
+	Init      int
+}
+
+func NewStaticVariable(name string, global bool, size, alignment, init int) *StaticVariable {
+	return &StaticVariable{name, global, size, alignment, init}
+}
+
+func (s *StaticVariable) GetType() AsmAstType {
+	return AsmStaticVariable
+}
+
+func (s *StaticVariable) Accept(visitor AsmVisitor) {
+	visitor.VisitStaticVariable(s)
+}
+
 type Instruction interface {
 	AST
 }
 
 type Mov struct {
-	Src Operand
-	Dst Operand
+	Type AsmType
+	Src  Operand
+	Dst  Operand
 }
 
-func NewMov(src, dst Operand) *Mov {
-	return &Mov{Src: src, Dst: dst}
+func NewMov(asmType AsmType, src, dst Operand) *Mov {
+	return &Mov{Type: asmType, Src: src, Dst: dst}
 }
 
 func (m *Mov) GetType() AsmAstType {
@@ -147,13 +209,49 @@ func (m *Mov) Accept(visitor AsmVisitor) {
 	visitor.VisitMov(m)
 }
 
+// Movsx sign extends a longword source to a quadword destination
+type Movsx struct {
+	Src Operand
+	Dst Operand
+}
+
+func NewMovsx(src, dst Operand) *Movsx {
+	return &Movsx{Src: src, Dst: dst}
+}
+
+func (m *Movsx) GetType() AsmAstType {
+	return AsmMovsx
+}
+
+func (m *Movsx) Accept(visitor AsmVisitor) {
+	visitor.VisitMovsx(m)
+}
+
+type Lea struct {
+	Src Operand
+	Dst Operand
+}
+
+func NewLea(src, dst Operand) *Lea {
+	return &Lea{Src: src, Dst: dst}
+}
+
+func (l *Lea) GetType() AsmAstType {
+	return AsmLea
+}
+
+func (l *Lea) Accept(visitor AsmVisitor) {
+	visitor.VisitLea(l)
+}
+
 type Unary struct {
+	Type    AsmType
 	Op      UnaryOp
 	Operand Operand
 }
 
-func NewUnary(op UnaryOp, operand Operand) *Unary {
-	return &Unary{op, operand}
+func NewUnary(asmType AsmType, op UnaryOp, operand Operand) *Unary {
+	return &Unary{asmType, op, operand}
 }
 
 func (u *Unary) GetType() AsmAstType {
@@ -165,13 +263,14 @@ func (u *Unary) Accept(visitor AsmVisitor) {
 }
 
 type Binary struct {
+	Type     AsmType
 	Op       BinaryOp
 	Operand1 Operand
 	Operand2 Operand
 }
 
-func NewBinary(op BinaryOp, operand1 Operand, operand2 Operand) *Binary {
-	return &Binary{op, operand1, operand2}
+func NewBinary(asmType AsmType, op BinaryOp, operand1 Operand, operand2 Operand) *Binary {
+	return &Binary{asmType, op, operand1, operand2}
 }
 
 func (b *Binary) GetType() AsmAstType {
@@ -183,12 +282,13 @@ func (b *Binary) Accept(visitor AsmVisitor) {
 }
 
 type Cmp struct {
+	Type  AsmType
 	Left  Operand
 	Right Operand
 }
 
-func NewCmp(left Operand, right Operand) *Cmp {
-	return &Cmp{left, right}
+func NewCmp(asmType AsmType, left Operand, right Operand) *Cmp {
+	return &Cmp{asmType, left, right}
 }
 
 func (c *Cmp) GetType() AsmAstType {
@@ -200,11 +300,12 @@ func (c *Cmp) Accept(visitor AsmVisitor) {
 }
 
 type IDiv struct {
+	Type    AsmType
 	Operand Operand
 }
 
-func NewIDiv(operand Operand) *IDiv {
-	return &IDiv{operand}
+func NewIDiv(asmType AsmType, operand Operand) *IDiv {
+	return &IDiv{asmType, operand}
 }
 
 func (i *IDiv) GetType() AsmAstType {
@@ -215,10 +316,12 @@ func (i *IDiv) Accept(visitor AsmVisitor) {
 	visitor.VisitIDiv(i)
 }
 
-type Cdq struct{}
+type Cdq struct {
+	Type AsmType
+}
 
-func NewCdq() *Cdq {
-	return &Cdq{}
+func NewCdq(asmType AsmType) *Cdq {
+	return &Cdq{asmType}
 }
 
 func (c *Cdq) GetType() AsmAstType {
@@ -295,6 +398,24 @@ func (l *Label) Accept(visitor AsmVisitor) {
 	visitor.VisitLabel(l)
 }
 
+// Location marks the start of the instructions for the statement at Pos
+// (only emitted if debug information is requested)
+type Location struct {
+	Pos frontend.Position
+}
+
+func NewLocation(pos frontend.Position) *Location {
+	return &Location{pos}
+}
+
+func (l *Location) GetType() AsmAstType {
+	return AsmLocation
+}
+
+func (l *Location) Accept(visitor AsmVisitor) {
+	visitor.VisitLocation(l)
+}
+
 type AllocStack struct {
 	N int
 }
@@ -359,6 +480,23 @@ func (c *Call) Accept(visitor AsmVisitor) {
 	visitor.VisitCall(c)
 }
 
+// IndirectCall calls the function whose address is in Operand
+type IndirectCall struct {
+	Operand Operand
+}
+
+func NewIndirectCall(operand Operand) *IndirectCall {
+	return &IndirectCall{operand}
+}
+
+func (i *IndirectCall) GetType() AsmAstType {
+	return AsmIndirectCall
+}
+
+func (i *IndirectCall) Accept(visitor AsmVisitor) {
+	visitor.VisitIndirectCall(i)
+}
+
 type Return struct{}
 
 func NewReturn() *Return {
@@ -559,10 +697,11 @@ func (r *Register) Accept(visitor AsmVisitor) {
 
 type PseudoReg struct {
 	Ident string
+	Type  AsmType
 }
 
-func NewPseudoReg(ident string) *PseudoReg {
-	return &PseudoReg{ident}
+func NewPseudoReg(ident string, asmType AsmType) *PseudoReg {
+	return &PseudoReg{ident, asmType}
 }
 
 func (p *PseudoReg) GetType() AsmAstType {
@@ -573,6 +712,26 @@ func (p *PseudoReg) Accept(visitor AsmVisitor) {
 	visitor.VisitPseudoReg(p)
 }
 
+// PseudoMem addresses the bytes at Offset within an object of Size bytes
+// (e.g. a va_list) that has not been assigned a stack slot yet
+type PseudoMem struct {
+	Ident  string
+	Size   int
+	Offset int
+}
+
+func NewPseudoMem(ident string, size, offset int) *PseudoMem {
+	return &PseudoMem{ident, size, offset}
+}
+
+func (p *PseudoMem) GetType() AsmAstType {
+	return AsmPseudoMem
+}
+
+func (p *PseudoMem) Accept(visitor AsmVisitor) {
+	visitor.VisitPseudoMem(p)
+}
+
 type Stack struct {
 	N int
 }
@@ -588,3 +747,39 @@ func (s *Stack) GetType() AsmAstType {
 func (s *Stack) Accept(visitor AsmVisitor) {
 	visitor.VisitStack(s)
 }
+
+// Memory addresses the value at a given offset from the address in a register
+type Memory struct {
+	Reg    string
+	Offset int
+}
+
+func NewMemory(reg string, offset int) *Memory {
+	return &Memory{reg, offset}
+}
+
+func (m *Memory) GetType() AsmAstType {
+	return AsmMemory
+}
+
+func (m *Memory) Accept(visitor AsmVisitor) {
+	visitor.VisitMemory(m)
+}
+
+// Data addresses a symbol relative to the instruction pointer.
+// It is used to take the address of functions.
+type Data struct {
+	Name string
+}
+
+func NewData(name string) *Data {
+	return &Data{name}
+}
+
+func (d *Data) GetType() AsmAstType {
+	return AsmData
+}
+
+func (d *Data) Accept(visitor AsmVisitor) {
+	visitor.VisitData(d)
+}
@@ -15,141 +15,274 @@ const (
 
 var registerNames = map[string]map[regByteMode]string{
 	RegAX: {
-		regByteMode8: "%rax",
-		regByteMode4: "%eax",
-		regByteMode1: "%al"},
+		regByteMode8: "rax",
+		regByteMode4: "eax",
+		regByteMode1: "al"},
 	RegCX: {
-		regByteMode8: "%rcx",
-		regByteMode4: "%ecx",
-		regByteMode1: "%cl"},
+		regByteMode8: "rcx",
+		regByteMode4: "ecx",
+		regByteMode1: "cl"},
 	RegDX: {
-		regByteMode8: "%rdx",
-		regByteMode4: "%edx",
-		regByteMode1: "%dl"},
+		regByteMode8: "rdx",
+		regByteMode4: "edx",
+		regByteMode1: "dl"},
 	RegDI: {
-		regByteMode8: "%rdi",
-		regByteMode4: "%edi",
-		regByteMode1: "%dil"},
+		regByteMode8: "rdi",
+		regByteMode4: "edi",
+		regByteMode1: "dil"},
 	RegSI: {
-		regByteMode8: "%rsi",
-		regByteMode4: "%esi",
-		regByteMode1: "%sil"},
+		regByteMode8: "rsi",
+		regByteMode4: "esi",
+		regByteMode1: "sil"},
 	RegR8: {
-		regByteMode8: "%r8",
-		regByteMode4: "%r8d",
-		regByteMode1: "%r8b"},
+		regByteMode8: "r8",
+		regByteMode4: "r8d",
+		regByteMode1: "r8b"},
 	RegR9: {
-		regByteMode8: "%r9",
-		regByteMode4: "%r9d",
-		regByteMode1: "%r9b"},
+		regByteMode8: "r9",
+		regByteMode4: "r9d",
+		regByteMode1: "r9b"},
 	RegR10: {
-		regByteMode8: "%r10",
-		regByteMode4: "%r10d",
-		regByteMode1: "%r10b"},
+		regByteMode8: "r10",
+		regByteMode4: "r10d",
+		regByteMode1: "r10b"},
 	RegR11: {
-		regByteMode8: "%r11",
-		regByteMode4: "%r11d",
-		regByteMode1: "%r11b"},
+		regByteMode8: "r11",
+		regByteMode4: "r11d",
+		regByteMode1: "r11b"},
+	regBP: {regByteMode8: "rbp"},
+	regSP: {regByteMode8: "rsp"},
+}
+
+// frame and stack pointer are only used in prologue and epilogue
+const (
+	regBP = "BP"
+	regSP = "SP"
+)
+
+var memorySizes = map[regByteMode]string{
+	regByteMode1: "BYTE",
+	regByteMode4: "DWORD",
+	regByteMode8: "QWORD",
 }
 
 type CodeGenerator struct {
-	code   string
-	rbmode regByteMode
-	env    *frontend.Environment
+	code    string
+	rbmode  regByteMode
+	asmType AsmType
+	dialect dialect
+	// addressOnly is set while the source operand of a lea is generated
+	addressOnly bool
+	// debug is nil unless debug information is requested
+	debug *debugWriter
+	// pic is set for position-independent code
+	pic bool
+	env *frontend.Environment
+	// ownStatics holds the names of the static variables defined in the program
+	ownStatics map[string]bool
 }
 
 func NewCodeGenerator(env *frontend.Environment) *CodeGenerator {
+	return NewCodeGeneratorWithSyntax(env, SyntaxAtt)
+}
+
+func NewCodeGeneratorWithSyntax(env *frontend.Environment, syntax Syntax) *CodeGenerator {
 	return &CodeGenerator{
-		code:   "",
-		rbmode: regByteMode4,
-		env:    env,
+		code:    "",
+		rbmode:  regByteMode4,
+		asmType: Longword,
+		dialect: newDialect(syntax),
+		env:     env,
 	}
 }
 
+// SetDebugInfo makes the code generator emit line information, call
+// frame information and the DWARF description of functions and variables
+func (cg *CodeGenerator) SetDebugInfo(info *DebugInfo) {
+	cg.debug = newDebugWriter(info, cg.env)
+}
+
+// SetPIC makes the code generator emit position-independent code: calls
+// and addresses of symbols that may be preempted go through the PLT and
+// the GOT even if the symbols are defined in the program
+func (cg *CodeGenerator) SetPIC() {
+	cg.pic = true
+}
+
 func (cg *CodeGenerator) GenerateCode(program Program) string {
 	cg.code = ""
+	for _, line := range cg.dialect.header() {
+		cg.writeln(line)
+	}
+	if cg.debug != nil {
+		cg.writeln(cg.debug.fileDirective())
+		cg.writeln("\t.text")
+		cg.writeln(".Ltext0:")
+	}
 	program.Accept(cg)
+	if cg.debug != nil {
+		cg.write(cg.debug.sections())
+	}
 	cg.writeln(".section .note.GNU-stack,\"\",@progbits")
 	return cg.code
 }
 
 func (cg *CodeGenerator) VisitProgram(p *Program) {
+	cg.ownStatics = make(map[string]bool)
+	for _, staticVar := range p.StaticVars {
+		cg.ownStatics[staticVar.Name] = true
+	}
 	for _, funcDef := range p.FuncDefs {
 		funcDef.Accept(cg)
 	}
+	if cg.debug != nil {
+		cg.writeln(".Letext0:")
+	}
+	for _, staticVar := range p.StaticVars {
+		staticVar.Accept(cg)
+	}
+}
+
+// VisitStaticVariable emits the definition of a static variable. Variables
+// initialized to zero go to the BSS section.
+func (cg *CodeGenerator) VisitStaticVariable(s *StaticVariable) {
+	if s.Global {
+		cg.writeln("\t.globl " + s.Name)
+		cg.visibility(s.Name)
+	}
+	if s.Init == 0 {
+		cg.writeln("\t.bss")
+	} else {
+		cg.writeln("\t.data")
+	}
+	cg.writeln(fmt.Sprintf("\t.balign %d", s.Alignment))
+	if cg.emitsSymbolTypes() {
+		cg.writeln(fmt.Sprintf("\t.type %s, @object", s.Name))
+		cg.writeln(fmt.Sprintf("\t.size %s, %d", s.Name, s.Size))
+	}
+	cg.writeln(s.Name + ":")
+	switch {
+	case s.Init == 0:
+		cg.writeln(fmt.Sprintf("\t.zero %d", s.Size))
+	case s.Size == 8:
+		cg.writeln(fmt.Sprintf("\t.quad %d", s.Init))
+	default:
+		cg.writeln(fmt.Sprintf("\t.long %d", s.Init))
+	}
+}
+
+// emitsSymbolTypes tells whether the types and sizes of symbols are
+// emitted. Debuggers need them as well as the dynamic linker for the
+// symbols of shared libraries.
+func (cg *CodeGenerator) emitsSymbolTypes() bool {
+	return cg.debug != nil || cg.pic
 }
 
 func (cg *CodeGenerator) VisitFunctionDef(f *FunctionDef) {
-	funcName := cg.getFunctionName(f.Name)
+	funcName := f.Name
 	cg.writeln("\t.globl " + funcName)
+	cg.visibility(funcName)
+	if cg.emitsSymbolTypes() {
+		cg.writeln(fmt.Sprintf("\t.type %s, @function", funcName))
+	}
 	cg.writeln(funcName + ":")
-	cg.writeln("\tpushq %rbp")
-	cg.writeln("\tmovq %rsp, %rbp")
+	cg.cfi(".cfi_startproc")
+	if cg.debug != nil {
+		// debuggers place breakpoints after the prologue, i.e. at the second line entry
+		if pos, ok := cg.debug.functionPos(f.Name); ok {
+			cg.VisitLocation(NewLocation(pos))
+		}
+	}
+	cg.instruction(cg.dialect.sized("push", Quadword), cg.register(regBP))
+	cg.cfi(".cfi_def_cfa_offset 16", ".cfi_offset 6, -16")
+	cg.instruction(cg.dialect.sized("mov", Quadword), cg.register(regSP), cg.register(regBP))
+	cg.cfi(".cfi_def_cfa_register 6")
 	for _, instr := range f.Instructions {
 		instr.Accept(cg)
 	}
+	if cg.debug != nil {
+		cg.writeln("\t.cfi_endproc")
+		cg.writeln(cg.debug.addFunction(funcName) + ":")
+	}
+	if cg.emitsSymbolTypes() {
+		cg.writeln(fmt.Sprintf("\t.size %s, .-%s", funcName, funcName))
+	}
 }
 
 func (cg *CodeGenerator) VisitMov(m *Mov) {
-	cg.write("\tmovl ")
-	m.Src.Accept(cg)
-	cg.write(", ")
-	m.Dst.Accept(cg)
-	cg.writeln("")
+	cg.setAsmType(m.Type)
+	cg.instruction(cg.dialect.sized("mov", m.Type), cg.operand(m.Src), cg.operand(m.Dst))
+}
+
+func (cg *CodeGenerator) VisitMovsx(m *Movsx) {
+	cg.setAsmType(Longword)
+	src := cg.operand(m.Src)
+	cg.setAsmType(Quadword)
+	cg.instruction(cg.dialect.signExtend(), src, cg.operand(m.Dst))
+}
+
+func (cg *CodeGenerator) VisitLea(l *Lea) {
+	cg.setAsmType(Quadword)
+	if data, ok := l.Src.(*Data); ok && !cg.bindsLocally(data.Name) {
+		// the address of an external symbol is taken from the Global Offset Table
+		cg.instruction(cg.dialect.sized("mov", Quadword),
+			cg.dialect.ripRelative(data.Name+"@GOTPCREL", memorySizes[regByteMode8]),
+			cg.operand(l.Dst))
+		return
+	}
+	cg.addressOnly = true
+	src := cg.operand(l.Src)
+	cg.addressOnly = false
+	cg.instruction(cg.dialect.sized("lea", Quadword), src, cg.operand(l.Dst))
 }
 
 func (cg *CodeGenerator) VisitUnary(u *Unary) {
-	cg.write("\t")
-	u.Op.Accept(cg)
-	cg.write(" ")
-	u.Operand.Accept(cg)
-	cg.writeln("")
+	cg.setAsmType(u.Type)
+	cg.instruction(cg.operand(u.Op), cg.operand(u.Operand))
 }
 
 func (cg *CodeGenerator) VisitBinary(b *Binary) {
-	cg.write("\t")
-	b.Op.Accept(cg)
-	cg.write(" ")
-	b.Operand1.Accept(cg)
-	cg.write(", ")
-	b.Operand2.Accept(cg)
-	cg.writeln("")
+	cg.setAsmType(b.Type)
+	mnemonic := cg.operand(b.Op)
+	if b.Op.GetType() == AsmBitShiftLeft || b.Op.GetType() == AsmBitShiftRight {
+		// shift count register is always %cl
+		cg.rbmode = regByteMode1
+	}
+	operand1 := cg.operand(b.Operand1)
+	cg.setAsmType(b.Type)
+	cg.instruction(mnemonic, operand1, cg.operand(b.Operand2))
 }
 
 func (cg *CodeGenerator) VisitCmp(c *Cmp) {
-	cg.write("\tcmpl ")
-	c.Left.Accept(cg)
-	cg.write(", ")
-	c.Right.Accept(cg)
-	cg.writeln("")
+	cg.setAsmType(c.Type)
+	cg.instruction(cg.dialect.sized("cmp", c.Type), cg.operand(c.Left), cg.operand(c.Right))
 }
 
 func (cg *CodeGenerator) VisitIDiv(i *IDiv) {
-	cg.write("\tidivl ")
-	i.Operand.Accept(cg)
-	cg.writeln("")
+	cg.setAsmType(i.Type)
+	cg.instruction(cg.dialect.sized("idiv", i.Type), cg.operand(i.Operand))
 }
 
-func (cg *CodeGenerator) VisitCdq(*Cdq) {
-	cg.writeln("\tcdq")
+func (cg *CodeGenerator) VisitCdq(c *Cdq) {
+	if c.Type == Quadword {
+		cg.instruction("cqo")
+	} else {
+		cg.instruction("cdq")
+	}
 }
 
 func (cg *CodeGenerator) VisitJump(j *Jump) {
-	cg.writeln(fmt.Sprintf("\tjmp .L%s", j.Identifier))
+	cg.instruction("jmp", ".L"+j.Identifier)
 }
 
 func (cg *CodeGenerator) VisitJumpCC(j *JumpCC) {
-	cg.writeln(fmt.Sprintf("\tj%s .L%s",
-		cg.getCondInstrSuffix(j.CondCode),
-		j.Identifier))
+	cg.instruction("j"+cg.getCondInstrSuffix(j.CondCode), ".L"+j.Identifier)
 }
 
 func (cg *CodeGenerator) VisitSetCC(s *SetCC) {
 	savedRegByteMode := cg.rbmode
 	cg.rbmode = regByteMode1
-	cg.write(fmt.Sprintf("\tset%s ", cg.getCondInstrSuffix(s.CondCode)))
-	s.Op.Accept(cg)
-	cg.writeln("")
+	cg.instruction("set"+cg.getCondInstrSuffix(s.CondCode), cg.operand(s.Op))
 	cg.rbmode = savedRegByteMode
 }
 
@@ -158,93 +291,185 @@ func (cg *CodeGenerator) VisitLabel(l *Label) {
 }
 
 func (cg *CodeGenerator) VisitAllocStack(a *AllocStack) {
-	cg.writeln(fmt.Sprintf("\tsubq $%d, %%rsp", a.N))
+	cg.instruction(cg.dialect.sized("sub", Quadword), cg.dialect.immediate(a.N), cg.register(regSP))
 }
 
 func (cg *CodeGenerator) VisitDeAllocStack(d *DeAllocStack) {
-	cg.writeln(fmt.Sprintf("\taddq $%d, %%rsp", d.N))
+	cg.instruction(cg.dialect.sized("add", Quadword), cg.dialect.immediate(d.N), cg.register(regSP))
 }
 
 func (cg *CodeGenerator) VisitPush(p *Push) {
 	savedRegByteMode := cg.rbmode
 	cg.rbmode = regByteMode8
-	cg.write("\tpushq ")
-	p.Op.Accept(cg)
-	cg.writeln("")
+	cg.instruction(cg.dialect.sized("push", Quadword), cg.operand(p.Op))
 	cg.rbmode = savedRegByteMode
 }
 
 func (cg *CodeGenerator) VisitCall(c *Call) {
-	funcName := cg.getFunctionName(c.Identifier)
-	cg.writeln(fmt.Sprintf("\tcall %s", funcName))
+	cg.instruction("call", cg.getFunctionName(c.Identifier))
+}
+
+func (cg *CodeGenerator) VisitIndirectCall(i *IndirectCall) {
+	cg.setAsmType(Quadword)
+	cg.instruction("call", cg.dialect.indirectCall(cg.operand(i.Operand)))
 }
 
 func (cg *CodeGenerator) VisitReturn() {
-	cg.writeln("\tmovq %rbp, %rsp")
-	cg.writeln("\tpopq %rbp")
-	cg.writeln("\tret")
+	// the frame is still set up for the code following the return
+	cg.cfi(".cfi_remember_state")
+	cg.instruction(cg.dialect.sized("mov", Quadword), cg.register(regBP), cg.register(regSP))
+	cg.instruction(cg.dialect.sized("pop", Quadword), cg.register(regBP))
+	cg.cfi(".cfi_def_cfa 7, 8")
+	cg.instruction("ret")
+	cg.cfi(".cfi_restore_state")
+}
+
+func (cg *CodeGenerator) VisitLocation(l *Location) {
+	if cg.debug != nil {
+		for _, line := range cg.debug.location(l.Pos) {
+			cg.writeln(line)
+		}
+	}
 }
 
 func (cg *CodeGenerator) VisitNeg(*Neg) {
-	cg.write("negl")
+	cg.write(cg.dialect.sized("neg", cg.asmType))
 }
 
 func (cg *CodeGenerator) VisitNot(*Not) {
-	cg.write("notl")
+	cg.write(cg.dialect.sized("not", cg.asmType))
 }
 
 func (cg *CodeGenerator) VisitAdd(*Add) {
-	cg.write("addl")
+	cg.write(cg.dialect.sized("add", cg.asmType))
 }
 
 func (cg *CodeGenerator) VisitSub(*Sub) {
-	cg.write("subl")
+	cg.write(cg.dialect.sized("sub", cg.asmType))
 }
 
 func (cg *CodeGenerator) VisitMul(*Mul) {
-	cg.write("imull")
+	cg.write(cg.dialect.sized("imul", cg.asmType))
 }
 
 func (cg *CodeGenerator) VisitBitOp(op BinaryOp) {
 	switch op.GetType() {
 	case AsmBitAnd:
-		cg.write("and")
+		cg.write(cg.dialect.sized("and", cg.asmType))
 	case AsmBitOr:
-		cg.write("or")
+		cg.write(cg.dialect.sized("or", cg.asmType))
 	case AsmBitXor:
-		cg.write("xor")
+		cg.write(cg.dialect.sized("xor", cg.asmType))
 	case AsmBitShiftLeft:
-		cg.write("shl")
+		cg.write(cg.dialect.sized("shl", cg.asmType))
 	case AsmBitShiftRight:
-		cg.write("shr")
+		// int is signed, so the shift is arithmetic
+		cg.write(cg.dialect.sized("sar", cg.asmType))
 	default:
 		panic(fmt.Sprintf("unknown op type: %v", op.GetType()))
 	}
 }
 
 func (cg *CodeGenerator) VisitImmediate(i *Immediate) {
-	cg.write(fmt.Sprintf("$%d", i.Value))
+	cg.write(cg.dialect.immediate(i.Value))
 }
 
 func (cg *CodeGenerator) VisitRegister(r *Register) {
-	cg.write(registerNames[r.Name][cg.rbmode])
+	cg.write(cg.dialect.register(registerNames[r.Name][cg.rbmode]))
 }
 
 func (cg *CodeGenerator) VisitPseudoReg(*PseudoReg) {
 	panic("this should not be called")
 }
 
+func (cg *CodeGenerator) VisitPseudoMem(*PseudoMem) {
+	panic("this should not be called")
+}
+
 func (cg *CodeGenerator) VisitStack(s *Stack) {
-	cg.write(fmt.Sprintf("%d(%%rbp)", s.N))
+	cg.write(cg.dialect.memory(registerNames[regBP][regByteMode8], s.N, cg.memorySize()))
+}
+
+func (cg *CodeGenerator) VisitMemory(m *Memory) {
+	cg.write(cg.dialect.memory(registerNames[m.Reg][regByteMode8], m.Offset, cg.memorySize()))
+}
+
+func (cg *CodeGenerator) VisitData(d *Data) {
+	cg.write(cg.dialect.ripRelative(d.Name, cg.memorySize()))
+}
+
+// setAsmType sets the operand size for the instruction being generated
+func (cg *CodeGenerator) setAsmType(asmType AsmType) {
+	cg.asmType = asmType
+	if asmType == Quadword {
+		cg.rbmode = regByteMode8
+	} else {
+		cg.rbmode = regByteMode4
+	}
+}
+
+// memorySize is the size of a memory operand as far as the dialect needs it
+func (cg *CodeGenerator) memorySize() string {
+	if cg.addressOnly {
+		return ""
+	}
+	return memorySizes[cg.rbmode]
+}
+
+// operand returns the text of an operand (or operator) in the current dialect
+func (cg *CodeGenerator) operand(node AST) string {
+	saved := cg.code
+	cg.code = ""
+	node.Accept(cg)
+	text := cg.code
+	cg.code = saved
+	return text
+}
+
+func (cg *CodeGenerator) register(name string) string {
+	return cg.dialect.register(registerNames[name][regByteMode8])
+}
+
+// cfi emits call frame information directives if debug information is
+// requested. The DWARF register numbers are 6 for %rbp and 7 for %rsp.
+func (cg *CodeGenerator) cfi(directives ...string) {
+	if cg.debug == nil {
+		return
+	}
+	for _, directive := range directives {
+		cg.writeln("\t" + directive)
+	}
+}
+
+func (cg *CodeGenerator) instruction(mnemonic string, operands ...string) {
+	cg.writeln(cg.dialect.instruction(mnemonic, operands...))
 }
 
 func (cg *CodeGenerator) getFunctionName(funcName string) string {
-	if cg.isOwnFunction(funcName) {
+	if cg.bindsLocally(funcName) {
 		return funcName
 	}
 	return funcName + "@PLT" // Linux specific: Procedure Linkage Table
 }
 
+// bindsLocally tells whether references to a symbol can be resolved at
+// link time. Otherwise, they go through the PLT or the GOT.
+func (cg *CodeGenerator) bindsLocally(name string) bool {
+	if cg.pic {
+		return !isPreemptible(cg.env, name)
+	}
+	return cg.isOwnFunction(name) || cg.ownStatics[name]
+}
+
+// visibility emits the visibility directive of a global symbol unless
+// it has the default visibility
+func (cg *CodeGenerator) visibility(name string) {
+	entry, _ := cg.env.Get(name)
+	if entry != nil && entry.GetVisibility() != frontend.VisibilityDefault {
+		cg.writeln(fmt.Sprintf("\t.%s %s", entry.GetVisibility(), name))
+	}
+}
+
 func (cg *CodeGenerator) isOwnFunction(funcName string) bool {
 
 	entry, _ := cg.env.Get(funcName)
@@ -276,6 +501,14 @@ func (cg *CodeGenerator) getCondInstrSuffix(conditionCode ConditionCode) string
 		return "g"
 	case CcGtEq:
 		return "ge"
+	case CcAbove:
+		return "a"
+	case CcAboveEq:
+		return "ae"
+	case CcBelow:
+		return "b"
+	case CcBelowEq:
+		return "be"
 	default:
 		panic(fmt.Sprintf("unknown condition code: %v", conditionCode))
 	}
@@ -1,9 +1,12 @@
 package backend
 
 import (
+	"bytes"
+	"debug/elf"
 	"fmt"
 	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
-	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/tacky"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/internal/backendtest"
+	"strings"
 	"testing"
 )
 
@@ -12,8 +15,7 @@ func TestCodeGenerator_GenerateCode(t *testing.T) {
 int main(void) {
 	return ~(-42);
 }`
-	asmProgram := codeToAsm(code)
-	env := frontend.NewEnvironment(nil)
+	asmProgram, env := codeToAsm(t, code)
 	asm := NewCodeGenerator(env).GenerateCode(*asmProgram)
 
 	fmt.Print(asm)
@@ -24,8 +26,7 @@ func TestCodeGenerator_GenerateCode_Associativity(t *testing.T) {
 int main(void) {
     return (3 / 2 * 4) + (5 - 4 + 3);
 }`
-	asmProgram := codeToAsm(code)
-	env := frontend.NewEnvironment(nil)
+	asmProgram, env := codeToAsm(t, code)
 	asm := NewCodeGenerator(env).GenerateCode(*asmProgram)
 
 	fmt.Print(asm)
@@ -36,8 +37,7 @@ func TestCodeGenerator_GenerateCode_BitAnd(t *testing.T) {
 int main(void) {
     return 3 & 5;
 }`
-	asmProgram := codeToAsm(code)
-	env := frontend.NewEnvironment(nil)
+	asmProgram, env := codeToAsm(t, code)
 	asm := NewCodeGenerator(env).GenerateCode(*asmProgram)
 
 	fmt.Print(asm)
@@ -48,8 +48,7 @@ func TestCodeGenerator_GenerateCode_AndFalse(t *testing.T) {
     	return (10 && 0) + (0 && 4) + (0 && 0);
 	}`
 
-	asmProgram := codeToAsm(code)
-	env := frontend.NewEnvironment(nil)
+	asmProgram, env := codeToAsm(t, code)
 	asm := NewCodeGenerator(env).GenerateCode(*asmProgram)
 
 	fmt.Print(asm)
@@ -60,8 +59,7 @@ func TestCodeGenerator_GenerateCode_SimpleFunction(t *testing.T) {
 		return param;
 	}`
 
-	asmProgram := codeToAsm(code)
-	env := frontend.NewEnvironment(nil)
+	asmProgram, env := codeToAsm(t, code)
 	asm := NewCodeGenerator(env).GenerateCode(*asmProgram)
 
 	fmt.Print(asm)
@@ -77,18 +75,277 @@ func TestCodeGenerator_GenerateCode_ManyArgsFunction(t *testing.T) {
 		return mult_many(1, 2, 3, 4, 5, 6, 7, 8);
 	}`
 
-	asmProgram := codeToAsm(code)
-	env := frontend.NewEnvironment(nil)
+	asmProgram, env := codeToAsm(t, code)
 	asm := NewCodeGenerator(env).GenerateCode(*asmProgram)
 
 	fmt.Print(asm)
 
 }
 
-func codeToAsm(code string) *Program {
-	tokens, _ := frontend.Tokenize(code)
-	ast, _ := frontend.NewParser(tokens).ParseProgram()
-	nameCreator := frontend.NewNameCreator()
-	tackyAst := tacky.NewTranslator(nameCreator).Translate(ast)
-	return NewTranslator().Translate(tackyAst)
+func TestCodeGenerator_GenerateCode_FunctionPointers(t *testing.T) {
+	code := `
+	int abs(int x);
+	int twice(int x) { return 2 * x; }
+
+	int main(void) {
+		int (*f)(int) = abs;
+		int (*g)(int) = twice;
+		return f(-1) + g(2);
+	}`
+
+	asmProgram, env := codeToAsm(t, code)
+	asm := NewCodeGenerator(env).GenerateCode(*asmProgram)
+
+	for _, want := range []string{
+		"movq abs@GOTPCREL(%rip), %r11",
+		"leaq twice(%rip), %r11",
+		"call *%r11",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+}
+
+func TestCodeGenerator_GenerateCode_Variadic(t *testing.T) {
+	code := `
+	int printf(void *format, ...);
+
+	int first(int count, ...) {
+		__builtin_va_list ap;
+		__builtin_va_start(ap, count);
+		int x = __builtin_va_arg(ap, int);
+		__builtin_va_end(ap);
+		return x;
+	}
+
+	int main(void) {
+		return printf(&first, first(1, 42));
+	}`
+
+	asmProgram, env := codeToAsm(t, code)
+	asm := NewCodeGenerator(env).GenerateCode(*asmProgram)
+
+	for _, want := range []string{
+		// register save area
+		"movq %r9, -8(%rbp)",
+		// gp_offset and fp_offset
+		"movl $8, 0(%rax)",
+		"movl $176, 4(%rax)",
+		"movl $0, %eax\n\tcall printf@PLT",
+		"movl $0, %eax\n\tcall first",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+}
+
+func TestCodeGenerator_GenerateCode_Conditions(t *testing.T) {
+	code := `
+	int count(int n) {
+		int i = 0;
+		while (i < n && i != 42)
+			i++;
+		return i;
+	}`
+
+	asmProgram, env := codeToAsm(t, code)
+	asm := NewCodeGenerator(env).GenerateCode(*asmProgram)
+
+	if strings.Contains(asm, "set") {
+		t.Errorf("conditions must be compiled to jumps without setCC:\n%s", asm)
+	}
+	for _, want := range []string{"\tjge .Lloop", "\tcmpl $42, ", "\tje .Lloop"} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+}
+
+func TestCodeGenerator_GenerateCode_StaticVariables(t *testing.T) {
+	code := `
+	int counter = 5;
+	static int *last;
+
+	int next(void) {
+		extern int external;
+		static int calls;
+		calls = calls + external;
+		last = &counter;
+		return ++calls;
+	}`
+
+	asmProgram, env := codeToAsm(t, code)
+	asm := NewCodeGenerator(env).GenerateCode(*asmProgram)
+
+	for _, want := range []string{
+		"\t.globl counter\n\t.data\n\t.balign 4\ncounter:\n\t.long 5\n",
+		"\t.bss\n\t.balign 8\nlast:\n\t.zero 8\n",
+		"\t.bss\n\t.balign 4\ncalls.0:\n\t.zero 4\n",
+		"external(%rip)",
+		"leaq counter(%rip)",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+	for _, unwanted := range []string{".globl last", ".globl calls", "external:"} {
+		if strings.Contains(asm, unwanted) {
+			t.Errorf("unexpected %q in generated code:\n%s", unwanted, asm)
+		}
+	}
+}
+
+func TestCodeGenerator_GenerateCode_Structs(t *testing.T) {
+	code := `
+	struct pair {
+		int *first;
+		int second;
+	};
+
+	static struct pair saved;
+
+	int swap(struct pair *p) {
+		struct pair old = *p;
+		*p = saved;
+		saved = old;
+		return p->second >> 1;
+	}`
+
+	asmProgram, env := codeToAsm(t, code)
+	asm := NewCodeGenerator(env).GenerateCode(*asmProgram)
+
+	for _, want := range []string{
+		"\t.bss\n\t.balign 8\nsaved:\n\t.zero 16\n",
+		"leaq saved(%rip), %rdx",
+		// the padding is copied along with the members
+		"\tmovq 8(%rax), %r10\n\tmovq %r10, 8(%rdx)\n",
+		"\tmovq 8(%rdx), %r10\n\tmovq %r10, 8(%rax)\n",
+		"leaq 8(%rax), %r11",
+		"sarl $1, ",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+}
+
+// codeToAsm translates the code to verified assembly. It returns the
+// environment of the semantic analysis for the code generator.
+func codeToAsm(t *testing.T, code string) (*Program, *frontend.Environment) {
+	t.Helper()
+	program, env := backendtest.FrontEnd(t, code)
+	asmProgram := NewTranslator().Translate(program)
+	if err := Verify(asmProgram); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	return asmProgram, env
+}
+
+func TestCodeGenerator_GenerateCode_IntelSyntax(t *testing.T) {
+	code := `
+	int abs(int x);
+
+	int main(void) {
+		int (*f)(int) = abs;
+		int a = 7;
+		return f(a / 2) == 3;
+	}`
+
+	asmProgram, env := codeToAsm(t, code)
+	asm := NewCodeGeneratorWithSyntax(env, SyntaxIntel).GenerateCode(*asmProgram)
+
+	for _, want := range []string{
+		"\t.intel_syntax noprefix\n",
+		"\tpush rbp\n\tmov rbp, rsp\n",
+		"\tmov r11, QWORD PTR abs@GOTPCREL[rip]\n",
+		"\tmov DWORD PTR [rbp-",
+		"\tcdq\n",
+		"\tidiv r10d\n",
+		"\tcall r11\n",
+		"\tsete BYTE PTR [rbp-",
+		"\tmov rsp, rbp\n\tpop rbp\n\tret\n",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+	if strings.Contains(asm, "%") || strings.Contains(asm, "$") {
+		t.Errorf("AT&T operand in generated code:\n%s", asm)
+	}
+}
+
+// TestCodeGenerator_GenerateCode_IntelSyntaxAssembles checks that both
+// syntaxes are assembled to the same machine code. It is skipped if as
+// is missing.
+func TestCodeGenerator_GenerateCode_IntelSyntaxAssembles(t *testing.T) {
+	backendtest.RequireTools(t, "as")
+	code := `
+	struct pair {
+		int *first;
+		int second;
+	};
+
+	static struct pair saved;
+	int counter = 5;
+	int abs(int x);
+
+	int first(int count, ...) {
+		__builtin_va_list ap;
+		__builtin_va_start(ap, count);
+		int x = __builtin_va_arg(ap, int);
+		__builtin_va_end(ap);
+		return x;
+	}
+
+	int swap(struct pair *p) {
+		struct pair old = *p;
+		*p = saved;
+		saved = old;
+		return p->second >> 1;
+	}
+
+	int main(void) {
+		int (*f)(int) = abs;
+		int a = 7;
+		struct pair p;
+		p.first = &counter;
+		p.second = a % 3 << 2;
+		if (p.first != &a && a > 2)
+			counter = -counter;
+		return f(a / 2) == 3 ^ swap(&p) & first(1, ~a, 8, 9, 10, 11, 12, 13);
+	}`
+
+	asmProgram, env := codeToAsm(t, code)
+	att := NewCodeGenerator(env).GenerateCode(*asmProgram)
+	intel := NewCodeGeneratorWithSyntax(env, SyntaxIntel).GenerateCode(*asmProgram)
+
+	attText := assembleText(t, "att.s", att)
+	intelText := assembleText(t, "intel.s", intel)
+	if len(attText) == 0 || !bytes.Equal(attText, intelText) {
+		t.Errorf("the .text sections differ:\nAT&T:\n%s\nIntel:\n%s", att, intel)
+	}
+}
+
+// assembleText assembles the code with as and returns the content of
+// the .text section of the object file
+func assembleText(t *testing.T, name, asm string) []byte {
+	asmFile := backendtest.WriteFile(t, name, asm)
+	objectFile := strings.TrimSuffix(asmFile, ".s") + ".o"
+	backendtest.Run(t, "as", asmFile, "-o", objectFile)
+	file, err := elf.Open(objectFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	text := file.Section(".text")
+	if text == nil {
+		t.Fatalf("%s has no .text section", objectFile)
+	}
+	content, err := text.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
 }
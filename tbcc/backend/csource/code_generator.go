@@ -0,0 +1,611 @@
+// Package csource prints TACKY programs as portable C99. Every TACKY
+// variable becomes a local variable of the C function, labels and jumps
+// become labels and gotos. Arithmetic is done on uint32_t so that
+// overflows wrap around like on x86-64, shift counts are masked to five
+// bits like by the shift instructions.
+//
+// Data pointers are void *, function pointers the generic type
+// tbcc_function. Structures are byte buffers which are copied with
+// tbcc_copy, va_lists are C va_lists.
+package csource
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/tacky"
+	"sort"
+	"strings"
+)
+
+const prelude = `#include <stdarg.h>
+#include <stdint.h>
+
+typedef void (*tbcc_function)(void);
+`
+
+// copyFunction is only emitted if structures are copied
+const copyFunction = `
+static void tbcc_copy(void *dst, const void *src, int32_t size) {
+    unsigned char *d = dst;
+    const unsigned char *s = src;
+    while (size-- > 0)
+        *d++ = *s++;
+}
+`
+
+// kind classifies values by their representation in C
+type kind int
+
+const (
+	kindInt kind = iota
+	kindPointer
+	kindFunction
+	kindAggregate
+	kindVaList
+)
+
+type CodeGenerator struct {
+	globalEnv    *frontend.Environment
+	code         strings.Builder
+	staticVars   map[string]bool
+	ownFunctions map[string]*tacky.Function
+	copiesBytes  bool
+	// state of the current function
+	function *tacky.Function
+}
+
+func NewCodeGenerator(globalEnv *frontend.Environment) *CodeGenerator {
+	return &CodeGenerator{globalEnv: globalEnv}
+}
+
+func (cg *CodeGenerator) GenerateCode(program *tacky.Program) (string, error) {
+	cg.code.Reset()
+	cg.staticVars = make(map[string]bool)
+	cg.ownFunctions = make(map[string]*tacky.Function)
+	cg.copiesBytes = false
+	for _, staticVar := range program.StaticVars {
+		cg.staticVars[staticVar.Ident] = true
+	}
+	for i := range program.Funs {
+		cg.ownFunctions[program.Funs[i].Ident] = &program.Funs[i]
+	}
+
+	prototypes, err := cg.prototypes(program)
+	if err != nil {
+		return "", err
+	}
+
+	// the functions are generated first as they tell if tbcc_copy is needed
+	for i := range program.Funs {
+		if err := cg.generateFunction(&program.Funs[i]); err != nil {
+			return "", err
+		}
+	}
+	functions := cg.code.String()
+	cg.code.Reset()
+
+	cg.code.WriteString(prelude)
+	if cg.copiesBytes {
+		cg.code.WriteString(copyFunction)
+	}
+	if len(prototypes) > 0 {
+		cg.writeln("")
+	}
+	for _, prototype := range prototypes {
+		cg.writeln(prototype + ";")
+	}
+
+	if len(program.StaticVars) > 0 {
+		cg.writeln("")
+	}
+	for _, staticVar := range program.StaticVars {
+		cg.generateStaticVariable(&staticVar)
+	}
+	cg.code.WriteString(functions)
+	return cg.code.String(), nil
+}
+
+// prototypes returns the prototypes of the functions of the program
+// and of all functions they call or take the address of
+func (cg *CodeGenerator) prototypes(program *tacky.Program) ([]string, error) {
+	used := make(map[string]bool)
+	for _, f := range program.Funs {
+		used[f.Ident] = true
+		for _, instr := range f.Body {
+			switch i := instr.(type) {
+			case *tacky.FunctionCall:
+				used[i.Name] = true
+			case *tacky.GetAddress:
+				if v := i.Src.(*tacky.Var); v.Type.GetTypeId() == frontend.TypeFunc {
+					used[v.Ident] = true
+				}
+			}
+		}
+	}
+	var names []string
+	for name := range used {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var prototypes []string
+	for _, name := range names {
+		funcInfo := cg.lookupFunction(name)
+		if funcInfo == nil {
+			return nil, errors.New(fmt.Sprintf("no prototype for function %s", name))
+		}
+		if funcInfo.Unprototyped {
+			// the parameters of an implicitly declared function are unknown
+			prototypes = append(prototypes, fmt.Sprintf("%s %s()", typeNames[kindOf(funcInfo.ReturnType)], name))
+			continue
+		}
+		var params []string
+		for _, paramType := range funcInfo.ParamTypes {
+			params = append(params, paramDeclaration(paramType, ""))
+		}
+		prototypes = append(prototypes, functionDeclaration(funcInfo.ReturnType, name, params, funcInfo.Variadic))
+	}
+	return prototypes, nil
+}
+
+func (cg *CodeGenerator) generateStaticVariable(s *tacky.StaticVariable) {
+	declaration := declaration(s.Type, identifier(s.Ident))
+	switch {
+	case !s.Defined:
+		cg.writeln(fmt.Sprintf("extern %s;", declaration))
+	case kindOf(s.Type) == kindInt:
+		cg.writeln(fmt.Sprintf("%s%s = %s;", storageClass(s.Global), declaration, intLiteral(s.Init)))
+	default:
+		cg.writeln(fmt.Sprintf("%s%s;", storageClass(s.Global), declaration))
+	}
+}
+
+func (cg *CodeGenerator) generateFunction(f *tacky.Function) error {
+	cg.function = f
+	funcInfo := cg.lookupFunction(f.Ident)
+
+	var params []string
+	for _, param := range f.Parameters {
+		params = append(params, paramDeclaration(param.Type, identifier(param.Ident)+vaListSuffix(param)))
+	}
+	cg.writeln("")
+	cg.writeln(functionDeclaration(funcInfo.ReturnType, f.Ident, params, f.Variadic) + " {")
+
+	isParam := make(map[string]bool)
+	for _, param := range f.Parameters {
+		isParam[param.Ident] = true
+	}
+	for _, v := range tacky.Variables(f) {
+		if isParam[v.Ident] || cg.staticVars[v.Ident] || v.Type.GetTypeId() == frontend.TypeFunc {
+			continue
+		}
+		cg.emit(declaration(v.Type, identifier(v.Ident)) + ";")
+	}
+	// the va_list of the caller is copied, the parameter points to the copy
+	for _, param := range f.Parameters {
+		if suffix := vaListSuffix(param); suffix != "" {
+			name := identifier(param.Ident)
+			cg.emit(fmt.Sprintf("va_list %s_copy;", name))
+			cg.emit(fmt.Sprintf("void *%s = &%s_copy;", name, name))
+			cg.emit(fmt.Sprintf("va_copy(%s_copy, %s%s);", name, name, suffix))
+		}
+	}
+
+	for _, instr := range f.Body {
+		if err := cg.generateInstruction(instr); err != nil {
+			return err
+		}
+	}
+	cg.writeln("}")
+	return nil
+}
+
+func (cg *CodeGenerator) generateInstruction(instr tacky.Instruction) error {
+	switch i := instr.(type) {
+	case *tacky.Label:
+		// the empty statement allows labels before declarations and "}"
+		cg.writeln(identifier(i.Name) + ": ;")
+	case *tacky.Return:
+		if i.Val == nil || cg.lookupFunction(cg.function.Ident).ReturnType.GetTypeId() == frontend.TypeVoid {
+			cg.emit("return;")
+		} else {
+			returnType := cg.lookupFunction(cg.function.Ident).ReturnType
+			cg.emit(fmt.Sprintf("return %s;", cg.operand(i.Val, kindOf(returnType))))
+		}
+	case *tacky.Unary:
+		var expr string
+		switch i.Op.GetType() {
+		case tacky.TacNegate:
+			expr = fmt.Sprintf("(int32_t)(0u - (uint32_t)%s)", cg.operand(i.Src, kindInt))
+		case tacky.TacComplement:
+			expr = "~" + cg.operand(i.Src, kindInt)
+		case tacky.TacNot:
+			expr = "!" + cg.value(i.Src)
+		default:
+			return errors.New(fmt.Sprintf("unsupported unary operator %T", i.Op))
+		}
+		cg.assign(i.Dst, expr, kindInt)
+	case *tacky.Binary:
+		expr, err := cg.binary(i.Op, i.Src1, i.Src2, valueKind(i.Dst))
+		if err != nil {
+			return err
+		}
+		cg.assign(i.Dst, expr, valueKind(i.Dst))
+	case *tacky.Copy:
+		if valueKind(i.Dst) == kindAggregate {
+			cg.copyBytes(cg.value(i.Dst), cg.value(i.Src), sizeOf(i.Dst))
+			return nil
+		}
+		cg.assign(i.Dst, cg.operand(i.Src, valueKind(i.Dst)), valueKind(i.Dst))
+	case *tacky.Jump:
+		cg.emit(fmt.Sprintf("goto %s;", identifier(i.Target)))
+	case *tacky.JumpIfZero:
+		cg.emit(fmt.Sprintf("if (!%s) goto %s;", cg.value(i.Condition), identifier(i.Target)))
+	case *tacky.JumpIfNotZero:
+		cg.emit(fmt.Sprintf("if (%s) goto %s;", cg.value(i.Condition), identifier(i.Target)))
+	case *tacky.CompareAndJump:
+		cond, err := cg.binary(i.Op, i.Src1, i.Src2, kindInt)
+		if err != nil {
+			return err
+		}
+		cg.emit(fmt.Sprintf("if (%s) goto %s;", cond, identifier(i.Target)))
+	case *tacky.FunctionCall:
+		funcInfo := cg.lookupFunction(i.Name)
+		if funcInfo == nil {
+			return errors.New(fmt.Sprintf("no prototype for function %s", i.Name))
+		}
+		cg.generateCall(funcInfo, i.Name, i.Args, i.Dst)
+	case *tacky.IndirectCall:
+		funcInfo := i.FunPtr.(*tacky.Var).Type.(*frontend.PointerInfo).Referenced.(*frontend.FuncInfo)
+		callee := fmt.Sprintf("((%s)%s)", typeName(i.FunPtr.(*tacky.Var).Type), cg.value(i.FunPtr))
+		cg.generateCall(funcInfo, callee, i.Args, i.Dst)
+	case *tacky.GetAddress:
+		v := i.Src.(*tacky.Var)
+		switch {
+		case v.Type.GetTypeId() == frontend.TypeFunc:
+			cg.assign(i.Dst, "(tbcc_function)"+identifier(v.Ident), kindFunction)
+		case valueKind(v) == kindAggregate:
+			cg.assign(i.Dst, "(void *)"+identifier(v.Ident), kindPointer)
+		default:
+			cg.assign(i.Dst, "(void *)&"+identifier(v.Ident), kindPointer)
+		}
+	case *tacky.Load:
+		if valueKind(i.Dst) == kindAggregate {
+			cg.copyBytes(cg.value(i.Dst), cg.operand(i.SrcPtr, kindPointer), sizeOf(i.Dst))
+			return nil
+		}
+		cg.assign(i.Dst, dereference(cg.operand(i.SrcPtr, kindPointer), valueKind(i.Dst)), valueKind(i.Dst))
+	case *tacky.Store:
+		if valueKind(i.Src) == kindAggregate {
+			cg.copyBytes(cg.operand(i.DstPtr, kindPointer), cg.value(i.Src), sizeOf(i.Src))
+			return nil
+		}
+		cg.emit(fmt.Sprintf("%s = %s;", dereference(cg.operand(i.DstPtr, kindPointer), valueKind(i.Src)),
+			cg.value(i.Src)))
+	case *tacky.AddOffset:
+		cg.assign(i.Dst, fmt.Sprintf("(void *)((char *)%s + %d)", cg.operand(i.Ptr, kindPointer), i.Offset),
+			kindPointer)
+	case *tacky.SignExtend:
+		cg.assign(i.Dst, cg.operand(i.Src, valueKind(i.Dst)), valueKind(i.Dst))
+	case *tacky.Truncate:
+		cg.assign(i.Dst, cg.operand(i.Src, valueKind(i.Dst)), valueKind(i.Dst))
+	case *tacky.VaStart:
+		params := cg.function.Parameters
+		if len(params) == 0 {
+			return errors.New(fmt.Sprintf("va_start in function %s without named parameters", cg.function.Ident))
+		}
+		last := params[len(params)-1]
+		cg.emit(fmt.Sprintf("va_start(%s, %s%s);", dereference(cg.operand(i.VaList, kindPointer), kindVaList),
+			identifier(last.Ident), vaListSuffix(last)))
+	case *tacky.VaArg:
+		typ := typeNames[valueKind(i.Dst)]
+		cg.assign(i.Dst, fmt.Sprintf("va_arg(%s, %s)", dereference(cg.operand(i.VaList, kindPointer), kindVaList),
+			typ), valueKind(i.Dst))
+	case *tacky.Location:
+		// the C compiler has no use for the positions of the TACKY source
+	default:
+		return errors.New(fmt.Sprintf("unsupported instruction type: %T", instr))
+	}
+	return nil
+}
+
+// generateCall converts the named arguments to the parameter types, the
+// unnamed ones are passed as they are
+func (cg *CodeGenerator) generateCall(funcInfo *frontend.FuncInfo, callee string, args []tacky.Value,
+	dst tacky.Value) {
+	var operands []string
+	for k, arg := range args {
+		switch {
+		case k >= len(funcInfo.ParamTypes):
+			operands = append(operands, cg.value(arg))
+		case isVaList(funcInfo.ParamTypes[k]):
+			operands = append(operands, dereference(cg.operand(arg, kindPointer), kindVaList))
+		default:
+			operands = append(operands, cg.operand(arg, kindOf(funcInfo.ParamTypes[k])))
+		}
+	}
+	call := fmt.Sprintf("%s(%s)", callee, strings.Join(operands, ", "))
+	if dst == nil || funcInfo.ReturnType.GetTypeId() == frontend.TypeVoid {
+		cg.emit(call + ";")
+		return
+	}
+	cg.assign(dst, call, kindOf(funcInfo.ReturnType))
+}
+
+// binary returns the expression for a binary operation, the result is
+// of the given kind
+func (cg *CodeGenerator) binary(op tacky.BinaryOp, src1, src2 tacky.Value, resultKind kind) (string, error) {
+	if operator, ok := comparisons[op.GetType()]; ok {
+		// pointers are compared as unsigned addresses
+		if valueKind(src1) != kindInt || valueKind(src2) != kindInt {
+			return fmt.Sprintf("%s %s %s", cg.address(src1), operator, cg.address(src2)), nil
+		}
+		return fmt.Sprintf("%s %s %s", cg.value(src1), operator, cg.value(src2)), nil
+	}
+	if resultKind != kindInt {
+		operator, ok := wrappingOperators[op.GetType()]
+		if !ok {
+			return "", errors.New(fmt.Sprintf("unsupported operator %T for pointers", op))
+		}
+		return fmt.Sprintf("(%s)(%s %s %s)", typeNames[resultKind], cg.address(src1), operator, cg.address(src2)),
+			nil
+	}
+
+	a, b := cg.operand(src1, kindInt), cg.operand(src2, kindInt)
+	if operator, ok := wrappingOperators[op.GetType()]; ok {
+		return fmt.Sprintf("(int32_t)((uint32_t)%s %s (uint32_t)%s)", a, operator, b), nil
+	}
+	switch op.GetType() {
+	case tacky.TacDiv:
+		return fmt.Sprintf("%s / %s", a, b), nil
+	case tacky.TacRemainder:
+		return fmt.Sprintf("%s %% %s", a, b), nil
+	case tacky.TacBitAnd:
+		return fmt.Sprintf("%s & %s", a, b), nil
+	case tacky.TacBitOr:
+		return fmt.Sprintf("%s | %s", a, b), nil
+	case tacky.TacBitXor:
+		return fmt.Sprintf("%s ^ %s", a, b), nil
+	case tacky.TacBitShiftLeft:
+		return fmt.Sprintf("(int32_t)((uint32_t)%s << (%s & 31))", a, b), nil
+	case tacky.TacBitShiftRight:
+		// the right shift of negative values is implementation defined
+		return fmt.Sprintf("(%s < 0 ? ~(~%s >> (%s & 31)) : %s >> (%s & 31))", a, a, b, a, b), nil
+	default:
+		return "", errors.New(fmt.Sprintf("unsupported binary operator %T", op))
+	}
+}
+
+var comparisons = map[tacky.TacType]string{
+	tacky.TacEq:    "==",
+	tacky.TacNotEq: "!=",
+	tacky.TacLt:    "<",
+	tacky.TacLtEq:  "<=",
+	tacky.TacGt:    ">",
+	tacky.TacGtEq:  ">=",
+}
+
+var wrappingOperators = map[tacky.TacType]string{
+	tacky.TacAdd: "+",
+	tacky.TacSub: "-",
+	tacky.TacMul: "*",
+}
+
+func (cg *CodeGenerator) copyBytes(dst, src string, size int) {
+	cg.copiesBytes = true
+	cg.emit(fmt.Sprintf("tbcc_copy(%s, %s, %d);", dst, src, size))
+}
+
+// assign converts the expression of the given kind to the kind of dst
+// and assigns it
+func (cg *CodeGenerator) assign(dst tacky.Value, expr string, exprKind kind) {
+	cg.emit(fmt.Sprintf("%s = %s;", cg.value(dst), convert(expr, exprKind, valueKind(dst))))
+}
+
+// operand returns the value converted to the given kind
+func (cg *CodeGenerator) operand(value tacky.Value, to kind) string {
+	if c, ok := value.(*tacky.IntConstant); ok && c.Val == 0 && to != kindInt {
+		// null pointer constant
+		return "0"
+	}
+	return convert(cg.value(value), valueKind(value), to)
+}
+
+// address returns the value as uintptr_t
+func (cg *CodeGenerator) address(value tacky.Value) string {
+	if valueKind(value) == kindInt {
+		return fmt.Sprintf("(uintptr_t)(intptr_t)%s", cg.value(value))
+	}
+	return "(uintptr_t)" + cg.value(value)
+}
+
+func (cg *CodeGenerator) value(value tacky.Value) string {
+	switch v := value.(type) {
+	case *tacky.IntConstant:
+		return intLiteral(v.Val)
+	case *tacky.Var:
+		return identifier(v.Ident)
+	default:
+		panic("unsupported value type")
+	}
+}
+
+func (cg *CodeGenerator) lookupFunction(name string) *frontend.FuncInfo {
+	if cg.globalEnv == nil {
+		return nil
+	}
+	entry, _ := cg.globalEnv.Get(name)
+	if entry == nil || entry.GetTypeInfo() == nil {
+		return nil
+	}
+	funcInfo, _ := entry.GetTypeInfo().(*frontend.FuncInfo)
+	return funcInfo
+}
+
+// convert converts between integers and pointers via intptr_t
+func convert(expr string, from, to kind) string {
+	switch {
+	case from == to:
+		return expr
+	case from == kindInt:
+		return fmt.Sprintf("(%s)(intptr_t)%s", typeNames[to], expr)
+	case to == kindInt:
+		return fmt.Sprintf("(int32_t)(intptr_t)%s", expr)
+	default:
+		return fmt.Sprintf("(%s)(intptr_t)%s", typeNames[to], expr)
+	}
+}
+
+// dereference returns the lvalue of the given kind ptr points to
+func dereference(ptr string, to kind) string {
+	return fmt.Sprintf("*(%s)%s", withName(typeNames[to], "*"), ptr)
+}
+
+var typeNames = map[kind]string{
+	kindInt:      "int32_t",
+	kindPointer:  "void *",
+	kindFunction: "tbcc_function",
+	kindVaList:   "va_list",
+}
+
+func kindOf(typeInfo frontend.TypeInfo) kind {
+	switch {
+	case frontend.IsFunctionPointer(typeInfo):
+		return kindFunction
+	case frontend.IsPointer(typeInfo):
+		return kindPointer
+	case typeInfo.GetTypeId() == frontend.TypeStruct:
+		return kindAggregate
+	case typeInfo.GetTypeId() == frontend.TypeVaList:
+		return kindVaList
+	default:
+		return kindInt
+	}
+}
+
+func valueKind(value tacky.Value) kind {
+	if v, ok := value.(*tacky.Var); ok {
+		return kindOf(v.Type)
+	}
+	return kindInt
+}
+
+// typeName returns the C type of scalars and va_lists. Function
+// pointers get their full type so that they can be called.
+func typeName(typeInfo frontend.TypeInfo) string {
+	switch typeInfo.GetTypeId() {
+	case frontend.TypeVoid:
+		return "void"
+	case frontend.TypePointer:
+		if funcInfo, ok := typeInfo.(*frontend.PointerInfo).Referenced.(*frontend.FuncInfo); ok {
+			var params []string
+			for _, paramType := range funcInfo.ParamTypes {
+				params = append(params, paramDeclaration(paramType, ""))
+			}
+			return functionDeclaration(funcInfo.ReturnType, "(*)", params, funcInfo.Variadic)
+		}
+	}
+	return typeNames[kindOf(typeInfo)]
+}
+
+// declaration declares a variable. Structures are arrays of their
+// alignment unit.
+func declaration(typeInfo frontend.TypeInfo, name string) string {
+	switch kindOf(typeInfo) {
+	case kindAggregate:
+		unit := "int64_t"
+		alignment := frontend.AlignmentOf(typeInfo)
+		switch alignment {
+		case 1:
+			unit = "unsigned char"
+		case 2:
+			unit = "int16_t"
+		case 4:
+			unit = "int32_t"
+		}
+		size := frontend.SizeOf(typeInfo)
+		return fmt.Sprintf("%s %s[%d]", unit, name, max((size+alignment-1)/alignment, 1))
+	default:
+		return withName(typeNames[kindOf(typeInfo)], name)
+	}
+}
+
+func paramDeclaration(typeInfo frontend.TypeInfo, name string) string {
+	typ := typeNames[kindOf(typeInfo)]
+	if isVaList(typeInfo) {
+		typ = "va_list"
+	}
+	return withName(typ, name)
+}
+
+// withName appends the name to the type, "void *" becomes "void *name"
+func withName(typ, name string) string {
+	if name == "" || strings.HasSuffix(typ, "*") {
+		return typ + name
+	}
+	return typ + " " + name
+}
+
+func functionDeclaration(returnType frontend.TypeInfo, name string, params []string, variadic bool) string {
+	if variadic {
+		params = append(params[:len(params):len(params)], "...")
+	}
+	if len(params) == 0 {
+		params = []string{"void"}
+	}
+	result := "void"
+	if returnType.GetTypeId() != frontend.TypeVoid {
+		result = typeNames[kindOf(returnType)]
+	}
+	return fmt.Sprintf("%s %s(%s)", result, name, strings.Join(params, ", "))
+}
+
+// vaListSuffix returns the suffix of the name of a va_list parameter,
+// the TACKY parameter is a pointer to a copy of it
+func vaListSuffix(param *tacky.Var) string {
+	if frontend.IsVaListPointer(param.Type) {
+		return "_arg"
+	}
+	return ""
+}
+
+// isVaList tells if a parameter is a va_list, which TACKY passes by
+// address
+func isVaList(typeInfo frontend.TypeInfo) bool {
+	return typeInfo.GetTypeId() == frontend.TypeVaList || frontend.IsVaListPointer(typeInfo)
+}
+
+func storageClass(global bool) string {
+	if global {
+		return ""
+	}
+	return "static "
+}
+
+// identifier maps a TACKY name to a C identifier. TACKY appends ".<n>"
+// to the names of the source, which becomes "__<n>".
+func identifier(name string) string {
+	return strings.ReplaceAll(name, ".", "__")
+}
+
+func intLiteral(value int) string {
+	value32 := int32(value)
+	if value32 == -1<<31 {
+		return "(-2147483647 - 1)"
+	}
+	return fmt.Sprintf("%d", value32)
+}
+
+func sizeOf(value tacky.Value) int {
+	return frontend.SizeOf(value.(*tacky.Var).Type)
+}
+
+func (cg *CodeGenerator) emit(statement string) {
+	cg.writeln("    " + statement)
+}
+
+func (cg *CodeGenerator) writeln(line string) {
+	cg.code.WriteString(line)
+	cg.code.WriteString("\n")
+}
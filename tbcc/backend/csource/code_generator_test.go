@@ -0,0 +1,188 @@
+package csource
+
+import (
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/backend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/internal/backendtest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCodeGenerator_GenerateCode(t *testing.T) {
+	code := `
+	int count(int n) {
+		int i = 0;
+		while (i < n) {
+			if (i == 42)
+				break;
+			i++;
+		}
+		return -i >> 1;
+	}`
+
+	src := generate(t, code)
+
+	for _, want := range []string{
+		"#include <stdint.h>\n",
+		"int32_t count(int32_t);\n",
+		"int32_t count(int32_t tmp__0) {\n    int32_t tmp__1;\n",
+		"loop__0__continue: ;\n    if (tmp__1 >= tmp__0) goto loop__0__break;\n",
+		"    if (tmp__1 != 42) goto end__0;\n    goto loop__0__break;\n",
+		"    tmp__1 = (int32_t)((uint32_t)__t2 + (uint32_t)1);\n",
+		"(int32_t)(0u - (uint32_t)tmp__1)",
+		" < 0 ? ~(~__t",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, src)
+		}
+	}
+	if strings.Contains(src, "tbcc_copy") {
+		t.Errorf("tbcc_copy should only be emitted for structures:\n%s", src)
+	}
+}
+
+func TestCodeGenerator_GenerateCode_Pointers(t *testing.T) {
+	code := `
+	int abs(int x);
+	extern int limit;
+	static int counter = 5;
+	int *last;
+
+	struct pair { int a; int b; };
+
+	int apply(int (*f)(int), int x) {
+		struct pair p;
+		p.b = 2;
+		struct pair q = p;
+		last = &counter;
+		return f(x) + limit + *last + q.b;
+	}
+
+	int main(void) {
+		return apply(abs, -3) + (last == 0);
+	}`
+
+	src := generate(t, code)
+
+	for _, want := range []string{
+		"int32_t apply(tbcc_function, int32_t);\n",
+		"extern int32_t limit;\n",
+		"static int32_t counter = 5;\n",
+		"void *last;\n",
+		"static void tbcc_copy(",
+		"    int32_t tmp__2[2];\n",
+		"    tbcc_copy(tmp__3, tmp__2, 8);\n",
+		" = (void *)&counter;\n",
+		" = ((int32_t (*)(int32_t))tmp__0)(tmp__1);\n",
+		" = *(int32_t *)last;\n",
+		" = (tbcc_function)abs;\n",
+		" = (uintptr_t)last == (uintptr_t)(intptr_t)0;\n",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, src)
+		}
+	}
+}
+
+func TestCodeGenerator_GenerateCode_Variadic(t *testing.T) {
+	code := `
+	int vprintf(void *format, __builtin_va_list ap);
+
+	int vsum(int count, __builtin_va_list args) {
+		int result = 0;
+		for (int i = 0; i < count; i++)
+			result += __builtin_va_arg(args, int);
+		return result;
+	}
+
+	int print(void *format, ...) {
+		__builtin_va_list ap;
+		__builtin_va_start(ap, format);
+		return vprintf(format, ap);
+	}`
+
+	src := generate(t, code)
+
+	for _, want := range []string{
+		"#include <stdarg.h>\n",
+		"int32_t vprintf(void *, va_list);\n",
+		"int32_t vsum(int32_t tmp__0, va_list tmp__1_arg) {\n",
+		"    va_copy(tmp__1_copy, tmp__1_arg);\n",
+		" = va_arg(*(va_list *)tmp__1, int32_t);\n",
+		"int32_t print(void *tmp__",
+		", ...) {\n",
+		"    va_start(*(va_list *)",
+		" = vprintf(tmp__",
+		", *(va_list *)__t",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, src)
+		}
+	}
+}
+
+// TestCodeGenerator_GenerateCode_Execute compiles the C source with gcc
+// and compares the exit status of the program with the one of the
+// program translated by the x86-64 backend. It is skipped if gcc is
+// missing or the host is no x86-64 machine.
+func TestCodeGenerator_GenerateCode_Execute(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("the host is no x86-64 machine")
+	}
+	backendtest.RequireTools(t, "gcc")
+	code := `
+	struct pair {
+		int first;
+		int second;
+	};
+
+	static struct pair saved;
+
+	int sum(int a, int b, int c, int d, int e, int f, int g, int h, int i, int j) {
+		return a / b + c % d + j;
+	}
+
+	int before(int *p, int *q) {
+		return p < q;
+	}
+
+	int main(void) {
+		struct pair s;
+		int i = 0;
+		while (i < 10)
+			i++;
+		if (&s.second > &s.first)
+			i = i + 2;
+		s.first = -7;
+		s.second = i << 2;
+		saved = s;
+		return sum(1, 2, 3, 4, 5, 6, 7, 8, 9, i) + before(&s.first, &s.second) + (i == 12) +
+			saved.first % 4 + (saved.second >> 1);
+	}`
+
+	program, env := backendtest.FrontEnd(t, code)
+	asmProgram := backend.NewTranslator().Translate(program)
+	want := execute(t, "x86.s", backend.NewCodeGenerator(env).GenerateCode(*asmProgram))
+	if got := execute(t, "c99.c", generate(t, code)); got != want {
+		t.Errorf("exit status = %d, want %d (x86-64 backend)", got, want)
+	}
+}
+
+// execute compiles the source with gcc and returns the exit status of
+// the program
+func execute(t *testing.T, name string, source string) int {
+	sourceFile := backendtest.WriteFile(t, name, source)
+	executable := strings.TrimSuffix(sourceFile, filepath.Ext(sourceFile))
+	backendtest.Run(t, "gcc", "-std=c99", sourceFile, "-o", executable)
+	return backendtest.ExitStatus(t, executable)
+}
+
+func generate(t *testing.T, code string) string {
+	program, env := backendtest.FrontEnd(t, code)
+	src, err := NewCodeGenerator(env).GenerateCode(program)
+	if err != nil {
+		t.Fatalf("GenerateCode() error = %v", err)
+	}
+	return src
+}
@@ -0,0 +1,511 @@
+package backend
+
+import (
+	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/tacky"
+	"strings"
+)
+
+// DebugInfo is what the code generator needs besides the assembly
+// program to emit DWARF debug information (-g)
+type DebugInfo struct {
+	FileName  string
+	Directory string
+	// Tacky holds the positions and local variables of the functions
+	// (translated with tacky.NewTranslatorWithDebugInfo)
+	Tacky *tacky.Program
+	// Offsets are the frame offsets of the variables as assigned by
+	// the PseudoRegReplacer
+	Offsets map[string]VarOffsets
+}
+
+// DWARF constants (DWARF 4)
+const (
+	dwTagCompileUnit     = 0x11
+	dwTagSubprogram      = 0x2e
+	dwTagFormalParameter = 0x05
+	dwTagVariable        = 0x34
+	dwTagBaseType        = 0x24
+	dwTagPointerType     = 0x0f
+	dwTagStructureType   = 0x13
+	dwTagUnionType       = 0x17
+	dwTagMember          = 0x0d
+	dwTagEnumerationType = 0x04
+	dwTagEnumerator      = 0x28
+	dwTagSubroutineType  = 0x15
+
+	dwAtLocation           = 0x02
+	dwAtName               = 0x03
+	dwAtByteSize           = 0x0b
+	dwAtBitSize            = 0x0d
+	dwAtStmtList           = 0x10
+	dwAtLowPc              = 0x11
+	dwAtHighPc             = 0x12
+	dwAtLanguage           = 0x13
+	dwAtCompDir            = 0x1b
+	dwAtConstValue         = 0x1c
+	dwAtProducer           = 0x25
+	dwAtPrototyped         = 0x27
+	dwAtDataMemberLocation = 0x38
+	dwAtDeclaration        = 0x3c
+	dwAtDeclFile           = 0x3a
+	dwAtDeclLine           = 0x3b
+	dwAtEncoding           = 0x3e
+	dwAtExternal           = 0x3f
+	dwAtFrameBase          = 0x40
+	dwAtType               = 0x49
+	dwAtDataBitOffset      = 0x6b
+
+	dwFormAddr         = 0x01
+	dwFormData2        = 0x05
+	dwFormData8        = 0x07
+	dwFormString       = 0x08
+	dwFormData1        = 0x0b
+	dwFormFlag         = 0x0c
+	dwFormSdata        = 0x0d
+	dwFormUdata        = 0x0f
+	dwFormRef4         = 0x13
+	dwFormSecOffset    = 0x17
+	dwFormExprloc      = 0x18
+	dwFormFlagPresent  = 0x19
+	dwLangC99          = 0x0c
+	dwAteSigned        = 0x05
+	dwOpAddr           = 0x03
+	dwOpFbreg          = 0x91
+	dwOpCallFrameCfa   = 0x9c
+	dwarfVersion       = 4
+	cfaOffsetOfFrameFp = 16 // the CFA is %rbp + 16 after the prologue
+)
+
+type attribute struct {
+	name, form int
+}
+
+type abbreviation struct {
+	tag      int
+	children bool
+	attrs    []attribute
+}
+
+// debugWriter collects the functions while the code is generated and
+// writes the debug sections at the end
+type debugWriter struct {
+	info          *DebugInfo
+	env           *frontend.Environment
+	functions     []emittedFunction
+	abbrevs       []abbreviation
+	abbrevCodes   map[string]int
+	typeLabels    map[any]string
+	pendingTypes  []frontend.TypeInfo
+	out           strings.Builder
+	labelCounter  int
+	tackyFunction map[string]*tacky.Function
+	// fileNumbers numbers the included files from 2 on (the main file
+	// is file 1)
+	fileNumbers map[string]int
+	// fileDirectives declare the files numbered while writing the
+	// debug sections
+	fileDirectives []string
+}
+
+type emittedFunction struct {
+	name     string
+	endLabel string
+}
+
+func newDebugWriter(info *DebugInfo, env *frontend.Environment) *debugWriter {
+	dw := &debugWriter{
+		info:          info,
+		env:           env,
+		abbrevCodes:   make(map[string]int),
+		typeLabels:    make(map[any]string),
+		tackyFunction: make(map[string]*tacky.Function),
+		fileNumbers:   make(map[string]int),
+	}
+	if info.Tacky != nil {
+		for i := range info.Tacky.Funs {
+			dw.tackyFunction[info.Tacky.Funs[i].Ident] = &info.Tacky.Funs[i]
+		}
+	}
+	return dw
+}
+
+// fileDirective is emitted before the code so that .loc can refer to file 1
+func (dw *debugWriter) fileDirective() string {
+	return fmt.Sprintf("\t.file 1 %s", quote(dw.info.FileName))
+}
+
+// fileNumber returns the number of the file of the position. The
+// directive declaring the number is returned for a file not seen
+// before.
+func (dw *debugWriter) fileNumber(pos frontend.Position) (int, string) {
+	if pos.File == "" {
+		return 1, ""
+	}
+	if number, ok := dw.fileNumbers[pos.File]; ok {
+		return number, ""
+	}
+	number := len(dw.fileNumbers) + 2
+	dw.fileNumbers[pos.File] = number
+	return number, fmt.Sprintf("\t.file %d %s", number, quote(pos.File))
+}
+
+// location returns the .loc directive for the position, preceded by
+// a .file directive if needed
+func (dw *debugWriter) location(pos frontend.Position) []string {
+	number, directive := dw.fileNumber(pos)
+	loc := fmt.Sprintf("\t.loc %d %d %d", number, pos.Line, pos.Col)
+	if directive != "" {
+		return []string{directive, loc}
+	}
+	return []string{loc}
+}
+
+func (dw *debugWriter) functionPos(name string) (frontend.Position, bool) {
+	tackyFunction, ok := dw.tackyFunction[name]
+	if !ok {
+		return frontend.Position{}, false
+	}
+	return tackyFunction.Pos, true
+}
+
+func (dw *debugWriter) addFunction(name string) string {
+	endLabel := fmt.Sprintf(".LFE%d", len(dw.functions))
+	dw.functions = append(dw.functions, emittedFunction{name, endLabel})
+	return endLabel
+}
+
+// sections returns the .debug_info, .debug_abbrev and .debug_line
+// sections. The line number program itself is generated by the
+// assembler from the .loc directives.
+func (dw *debugWriter) sections() string {
+	dw.line("\t.section .debug_info,\"\",@progbits")
+	dw.line(".Ldebug_info0:")
+	dw.line("\t.long .Ldebug_info_end-.Ldebug_info_start")
+	dw.line(".Ldebug_info_start:")
+	dw.line(fmt.Sprintf("\t.value %d", dwarfVersion))
+	dw.line("\t.long .Ldebug_abbrev0")
+	dw.line("\t.byte 8")
+
+	dw.die(dwTagCompileUnit, true,
+		dw.str(dwAtProducer, "tbcc"),
+		dw.value(dwAtLanguage, dwFormData2, fmt.Sprintf("\t.value %#x", dwLangC99)),
+		dw.str(dwAtName, dw.info.FileName),
+		dw.str(dwAtCompDir, dw.info.Directory),
+		dw.value(dwAtLowPc, dwFormAddr, "\t.quad .Ltext0"),
+		dw.value(dwAtHighPc, dwFormData8, "\t.quad .Letext0-.Ltext0"),
+		dw.value(dwAtStmtList, dwFormSecOffset, "\t.long .Ldebug_line0"))
+
+	localStatics := make(map[string]bool)
+	for _, function := range dw.functions {
+		dw.writeFunction(function, localStatics)
+	}
+	dw.writeGlobals(localStatics)
+	for len(dw.pendingTypes) > 0 {
+		typeInfo := dw.pendingTypes[0]
+		dw.pendingTypes = dw.pendingTypes[1:]
+		dw.writeType(typeInfo)
+	}
+	dw.line("\t.byte 0")
+	dw.line(".Ldebug_info_end:")
+
+	dw.writeAbbrevs()
+	dw.line("\t.section .debug_line,\"\",@progbits")
+	dw.line(".Ldebug_line0:")
+	for _, directive := range dw.fileDirectives {
+		dw.line(directive)
+	}
+	return dw.out.String()
+}
+
+func (dw *debugWriter) writeFunction(function emittedFunction, localStatics map[string]bool) {
+	tackyFunction := dw.tackyFunction[function.name]
+	// functions always have external linkage
+	attrs := []dieValue{dw.flag(dwAtExternal, true), dw.str(dwAtName, function.name)}
+	if tackyFunction != nil {
+		attrs = append(attrs, dw.declPos(tackyFunction.Pos)...)
+	}
+	attrs = append(attrs, dw.value(dwAtPrototyped, dwFormFlagPresent, ""))
+	if returnType := dw.returnType(function.name); returnType != nil {
+		attrs = append(attrs, dw.typeRef(returnType))
+	}
+	attrs = append(attrs,
+		dw.value(dwAtLowPc, dwFormAddr, "\t.quad "+function.name),
+		dw.value(dwAtHighPc, dwFormData8, fmt.Sprintf("\t.quad %s-%s", function.endLabel, function.name)),
+		dw.exprloc(dwAtFrameBase, []string{fmt.Sprintf("%#x", dwOpCallFrameCfa)}, 1))
+	dw.die(dwTagSubprogram, true, attrs...)
+
+	if tackyFunction != nil {
+		offsets := dw.info.Offsets[function.name]
+		for _, local := range tackyFunction.Locals {
+			tag := dwTagVariable
+			if local.IsParam {
+				tag = dwTagFormalParameter
+			}
+			attrs = []dieValue{dw.str(dwAtName, local.SourceName)}
+			attrs = append(attrs, dw.declPos(local.Pos)...)
+			attrs = append(attrs, dw.typeRef(local.Type))
+			if local.IsStatic {
+				localStatics[local.Ident] = true
+				attrs = append(attrs, dw.addressLocation(local.Ident))
+			} else if offset, ok := offsets[local.Ident]; ok {
+				attrs = append(attrs, dw.frameLocation(offset))
+			}
+			dw.die(tag, false, attrs...)
+		}
+	}
+	dw.line("\t.byte 0")
+}
+
+// writeGlobals describes the variables with static storage duration
+// that are defined at file scope
+func (dw *debugWriter) writeGlobals(localStatics map[string]bool) {
+	if dw.info.Tacky == nil {
+		return
+	}
+	for _, staticVar := range dw.info.Tacky.StaticVars {
+		if !staticVar.Defined || localStatics[staticVar.Ident] {
+			continue
+		}
+		dw.die(dwTagVariable, false,
+			dw.str(dwAtName, staticVar.Ident),
+			dw.typeRef(staticVar.Type),
+			dw.flag(dwAtExternal, staticVar.Global),
+			dw.addressLocation(staticVar.Ident))
+	}
+}
+
+// returnType returns nil for functions returning void
+func (dw *debugWriter) returnType(name string) frontend.TypeInfo {
+	entry, _ := dw.env.Get(name)
+	if entry == nil {
+		return nil
+	}
+	funcInfo, ok := entry.GetTypeInfo().(*frontend.FuncInfo)
+	if !ok || funcInfo.ReturnType.GetTypeId() == frontend.TypeVoid {
+		return nil
+	}
+	return funcInfo.ReturnType
+}
+
+// writeType writes the DIE of a type that has been referenced. The
+// DIEs of the types it refers to are queued.
+func (dw *debugWriter) writeType(typeInfo frontend.TypeInfo) {
+	dw.line(dw.typeLabel(typeInfo) + ":")
+	switch t := typeInfo.(type) {
+	case *frontend.IntInfo:
+		dw.die(dwTagBaseType, false,
+			dw.value(dwAtByteSize, dwFormData1, "\t.byte 4"),
+			dw.value(dwAtEncoding, dwFormData1, fmt.Sprintf("\t.byte %#x", dwAteSigned)),
+			dw.str(dwAtName, "int"))
+	case *frontend.PointerInfo:
+		attrs := []dieValue{dw.value(dwAtByteSize, dwFormData1, "\t.byte 8")}
+		if t.Referenced.GetTypeId() != frontend.TypeVoid {
+			attrs = append(attrs, dw.typeRef(t.Referenced))
+		}
+		dw.die(dwTagPointerType, false, attrs...)
+	case *frontend.EnumInfo:
+		var attrs []dieValue
+		if t.Tag != "" {
+			attrs = append(attrs, dw.str(dwAtName, t.Tag))
+		}
+		attrs = append(attrs, dw.value(dwAtByteSize, dwFormData1, "\t.byte 4"))
+		dw.die(dwTagEnumerationType, len(t.Constants) > 0, attrs...)
+		for _, constant := range t.Constants {
+			dw.die(dwTagEnumerator, false,
+				dw.str(dwAtName, constant.Name),
+				dw.value(dwAtConstValue, dwFormSdata, fmt.Sprintf("\t.sleb128 %d", constant.Value)))
+		}
+		if len(t.Constants) > 0 {
+			dw.line("\t.byte 0")
+		}
+	case *frontend.StructInfo:
+		dw.writeStruct(t)
+	case *frontend.VaListInfo:
+		dw.die(dwTagStructureType, false,
+			dw.str(dwAtName, "__va_list_tag"),
+			dw.value(dwAtByteSize, dwFormUdata, fmt.Sprintf("\t.uleb128 %d", frontend.SizeOf(t))))
+	case *frontend.FuncInfo:
+		attrs := []dieValue{dw.value(dwAtPrototyped, dwFormFlagPresent, "")}
+		if t.ReturnType.GetTypeId() != frontend.TypeVoid {
+			attrs = append(attrs, dw.typeRef(t.ReturnType))
+		}
+		dw.die(dwTagSubroutineType, false, attrs...)
+	default:
+		panic(fmt.Sprintf("unsupported type in debug information: %s", typeInfo))
+	}
+}
+
+func (dw *debugWriter) writeStruct(s *frontend.StructInfo) {
+	tag := dwTagStructureType
+	if s.IsUnion {
+		tag = dwTagUnionType
+	}
+	var attrs []dieValue
+	if s.Tag != "" {
+		attrs = append(attrs, dw.str(dwAtName, s.Tag))
+	}
+	if !s.IsComplete {
+		dw.die(tag, false, append(attrs, dw.value(dwAtDeclaration, dwFormFlagPresent, ""))...)
+		return
+	}
+	attrs = append(attrs, dw.value(dwAtByteSize, dwFormUdata, fmt.Sprintf("\t.uleb128 %d", s.Size)))
+	dw.die(tag, len(s.Members) > 0, attrs...)
+	for _, member := range s.Members {
+		attrs = []dieValue{dw.str(dwAtName, member.Name), dw.typeRef(member.Type)}
+		if member.IsBitField() {
+			attrs = append(attrs,
+				dw.value(dwAtBitSize, dwFormData1, fmt.Sprintf("\t.byte %d", member.BitWidth)),
+				dw.value(dwAtDataBitOffset, dwFormUdata,
+					fmt.Sprintf("\t.uleb128 %d", member.Offset*8+member.BitOffset)))
+		} else {
+			attrs = append(attrs,
+				dw.value(dwAtDataMemberLocation, dwFormUdata, fmt.Sprintf("\t.uleb128 %d", member.Offset)))
+		}
+		dw.die(dwTagMember, false, attrs...)
+	}
+	if len(s.Members) > 0 {
+		dw.line("\t.byte 0")
+	}
+}
+
+func (dw *debugWriter) writeAbbrevs() {
+	dw.line("\t.section .debug_abbrev,\"\",@progbits")
+	dw.line(".Ldebug_abbrev0:")
+	for i, abbrev := range dw.abbrevs {
+		dw.line(fmt.Sprintf("\t.uleb128 %d", i+1))
+		dw.line(fmt.Sprintf("\t.uleb128 %#x", abbrev.tag))
+		if abbrev.children {
+			dw.line("\t.byte 1")
+		} else {
+			dw.line("\t.byte 0")
+		}
+		for _, attr := range abbrev.attrs {
+			dw.line(fmt.Sprintf("\t.uleb128 %#x", attr.name))
+			dw.line(fmt.Sprintf("\t.uleb128 %#x", attr.form))
+		}
+		dw.line("\t.byte 0")
+		dw.line("\t.byte 0")
+	}
+	dw.line("\t.byte 0")
+}
+
+// dieValue is an attribute of a DIE together with the directive
+// emitting its value
+type dieValue struct {
+	attribute
+	directive string
+}
+
+func (dw *debugWriter) die(tag int, children bool, values ...dieValue) {
+	var attrs []attribute
+	for _, value := range values {
+		attrs = append(attrs, value.attribute)
+	}
+	dw.line(fmt.Sprintf("\t.uleb128 %d", dw.abbrevCode(tag, children, attrs)))
+	for _, value := range values {
+		if value.directive != "" {
+			dw.line(value.directive)
+		}
+	}
+}
+
+// abbrevCode returns the code of the abbreviation, which is added if
+// it does not exist yet
+func (dw *debugWriter) abbrevCode(tag int, children bool, attrs []attribute) int {
+	key := fmt.Sprint(tag, children, attrs)
+	code, ok := dw.abbrevCodes[key]
+	if !ok {
+		dw.abbrevs = append(dw.abbrevs, abbreviation{tag, children, attrs})
+		code = len(dw.abbrevs)
+		dw.abbrevCodes[key] = code
+	}
+	return code
+}
+
+func (dw *debugWriter) value(name, form int, directive string) dieValue {
+	return dieValue{attribute{name, form}, directive}
+}
+
+func (dw *debugWriter) str(name int, text string) dieValue {
+	return dw.value(name, dwFormString, "\t.string "+quote(text))
+}
+
+func (dw *debugWriter) flag(name int, set bool) dieValue {
+	if set {
+		return dw.value(name, dwFormFlag, "\t.byte 1")
+	}
+	return dw.value(name, dwFormFlag, "\t.byte 0")
+}
+
+func (dw *debugWriter) declPos(pos frontend.Position) []dieValue {
+	number, directive := dw.fileNumber(pos)
+	if directive != "" {
+		dw.fileDirectives = append(dw.fileDirectives, directive)
+	}
+	return []dieValue{
+		dw.value(dwAtDeclFile, dwFormUdata, fmt.Sprintf("\t.uleb128 %d", number)),
+		dw.value(dwAtDeclLine, dwFormUdata, fmt.Sprintf("\t.uleb128 %d", pos.Line)),
+	}
+}
+
+func (dw *debugWriter) typeRef(typeInfo frontend.TypeInfo) dieValue {
+	return dw.value(dwAtType, dwFormRef4, fmt.Sprintf("\t.long %s-.Ldebug_info0", dw.typeLabel(typeInfo)))
+}
+
+// typeLabel returns the label of the DIE of a type. Types are
+// identified by name except for structures and unions: every
+// declaration of a tag introduces a distinct type.
+func (dw *debugWriter) typeLabel(typeInfo frontend.TypeInfo) string {
+	var key any = typeInfo.String()
+	if typeInfo.GetTypeId() == frontend.TypeStruct || typeInfo.GetTypeId() == frontend.TypeEnum {
+		key = typeInfo
+	}
+	label, ok := dw.typeLabels[key]
+	if !ok {
+		label = fmt.Sprintf(".Ldie%d", dw.labelCounter)
+		dw.labelCounter++
+		dw.typeLabels[key] = label
+		dw.pendingTypes = append(dw.pendingTypes, typeInfo)
+	}
+	return label
+}
+
+func (dw *debugWriter) frameLocation(offset int) dieValue {
+	operation := []string{fmt.Sprintf("%#x", dwOpFbreg)}
+	for _, b := range sleb128(offset - cfaOffsetOfFrameFp) {
+		operation = append(operation, fmt.Sprintf("%#x", b))
+	}
+	return dw.exprloc(dwAtLocation, operation, len(operation))
+}
+
+func (dw *debugWriter) addressLocation(symbol string) dieValue {
+	return dieValue{attribute{dwAtLocation, dwFormExprloc},
+		fmt.Sprintf("\t.uleb128 9\n\t.byte %#x\n\t.quad %s", dwOpAddr, symbol)}
+}
+
+func (dw *debugWriter) exprloc(name int, operation []string, size int) dieValue {
+	return dw.value(name, dwFormExprloc,
+		fmt.Sprintf("\t.uleb128 %d\n\t.byte %s", size, strings.Join(operation, ", ")))
+}
+
+func (dw *debugWriter) line(text string) {
+	dw.out.WriteString(text + "\n")
+}
+
+func sleb128(value int) []byte {
+	var result []byte
+	for {
+		b := byte(value & 0x7f)
+		value >>= 7
+		if (value == 0 && b&0x40 == 0) || (value == -1 && b&0x40 != 0) {
+			return append(result, b)
+		}
+		result = append(result, b|0x80)
+	}
+}
+
+func quote(text string) string {
+	return fmt.Sprintf("%q", text)
+}
@@ -0,0 +1,372 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+)
+
+// JSON representation of assembly programs (see docs/ir-json.md)
+
+type jsonObject = map[string]any
+
+var conditionCodeNames = map[ConditionCode]string{
+	CcEq:      "E",
+	CcNotEq:   "NE",
+	CcGt:      "G",
+	CcGtEq:    "GE",
+	CcLt:      "L",
+	CcLtEq:    "LE",
+	CcAbove:   "A",
+	CcAboveEq: "AE",
+	CcBelow:   "B",
+	CcBelowEq: "BE",
+}
+
+var operatorNames = map[AsmAstType]string{
+	AsmNeg:           "Neg",
+	AsmNot:           "Not",
+	AsmAdd:           "Add",
+	AsmSub:           "Sub",
+	AsmMul:           "Mul",
+	AsmBitAnd:        "BitAnd",
+	AsmBitOr:         "BitOr",
+	AsmBitXor:        "BitXor",
+	AsmBitShiftLeft:  "BitShiftLeft",
+	AsmBitShiftRight: "BitShiftRight",
+}
+
+func (p *Program) MarshalJSON() ([]byte, error) {
+	funcDefs := make([]any, 0)
+	for _, funcDef := range p.FuncDefs {
+		instructions := make([]any, 0)
+		for _, instr := range funcDef.Instructions {
+			instructions = append(instructions, instructionToJson(instr))
+		}
+		funcDefs = append(funcDefs, jsonObject{
+			"kind":         "FunctionDef",
+			"name":         funcDef.Name,
+			"instructions": instructions,
+		})
+	}
+	staticVars := make([]any, 0)
+	for _, staticVar := range p.StaticVars {
+		staticVars = append(staticVars, jsonObject{
+			"kind":      "StaticVariable",
+			"name":      staticVar.Name,
+			"global":    staticVar.Global,
+			"size":      staticVar.Size,
+			"alignment": staticVar.Alignment,
+			"init":      staticVar.Init,
+		})
+	}
+	return json.Marshal(jsonObject{"kind": "Program", "functions": funcDefs, "staticVars": staticVars})
+}
+
+func (p *Program) UnmarshalJSON(data []byte) error {
+	var obj jsonObject
+	err := json.Unmarshal(data, &obj)
+	if err != nil {
+		return err
+	}
+	if kind, _ := obj["kind"].(string); kind != "Program" {
+		return errors.New("JSON does not contain a program")
+	}
+
+	loader := &jsonLoader{}
+	var funcDefs []FunctionDef
+	for _, item := range loader.getList(obj, "functions") {
+		funcObj := loader.getObject(item)
+		var instructions []Instruction
+		for _, instrItem := range loader.getList(funcObj, "instructions") {
+			instructions = append(instructions, loader.loadInstruction(instrItem))
+		}
+		funcDefs = append(funcDefs, *NewFunctionDef(loader.getString(funcObj, "name"), instructions))
+	}
+	var staticVars []StaticVariable
+	for _, item := range loader.getList(obj, "staticVars") {
+		varObj := loader.getObject(item)
+		global, _ := varObj["global"].(bool)
+		staticVars = append(staticVars, *NewStaticVariable(
+			loader.getString(varObj, "name"),
+			global,
+			loader.getInt(varObj, "size"),
+			loader.getInt(varObj, "alignment"),
+			loader.getInt(varObj, "init")))
+	}
+	if loader.err != nil {
+		return loader.err
+	}
+	p.FuncDefs = funcDefs
+	p.StaticVars = staticVars
+	return nil
+}
+
+func instructionToJson(instr Instruction) jsonObject {
+	switch instr.GetType() {
+	case AsmMov:
+		mov := instr.(*Mov)
+		return jsonObject{
+			"kind": "Mov",
+			"type": mov.Type.String(),
+			"src":  operandToJson(mov.Src),
+			"dst":  operandToJson(mov.Dst),
+		}
+	case AsmMovsx:
+		movsx := instr.(*Movsx)
+		return jsonObject{"kind": "Movsx", "src": operandToJson(movsx.Src), "dst": operandToJson(movsx.Dst)}
+	case AsmLea:
+		lea := instr.(*Lea)
+		return jsonObject{"kind": "Lea", "src": operandToJson(lea.Src), "dst": operandToJson(lea.Dst)}
+	case AsmUnary:
+		unary := instr.(*Unary)
+		return jsonObject{
+			"kind":     "Unary",
+			"type":     unary.Type.String(),
+			"operator": operatorNames[unary.Op.GetType()],
+			"operand":  operandToJson(unary.Operand),
+		}
+	case AsmBinary:
+		binary := instr.(*Binary)
+		return jsonObject{
+			"kind":     "Binary",
+			"type":     binary.Type.String(),
+			"operator": operatorNames[binary.Op.GetType()],
+			"operand1": operandToJson(binary.Operand1),
+			"operand2": operandToJson(binary.Operand2),
+		}
+	case AsmCmp:
+		cmp := instr.(*Cmp)
+		return jsonObject{
+			"kind":  "Cmp",
+			"type":  cmp.Type.String(),
+			"left":  operandToJson(cmp.Left),
+			"right": operandToJson(cmp.Right),
+		}
+	case AsmIDiv:
+		idiv := instr.(*IDiv)
+		return jsonObject{"kind": "IDiv", "type": idiv.Type.String(), "operand": operandToJson(idiv.Operand)}
+	case AsmCdq:
+		return jsonObject{"kind": "Cdq", "type": instr.(*Cdq).Type.String()}
+	case AsmJmp:
+		return jsonObject{"kind": "Jump", "target": instr.(*Jump).Identifier}
+	case AsmJmpCC:
+		jump := instr.(*JumpCC)
+		return jsonObject{"kind": "JumpCC", "condition": conditionCodeNames[jump.CondCode], "target": jump.Identifier}
+	case AsmSetCC:
+		setCC := instr.(*SetCC)
+		return jsonObject{"kind": "SetCC", "condition": conditionCodeNames[setCC.CondCode], "operand": operandToJson(setCC.Op)}
+	case AsmLabel:
+		return jsonObject{"kind": "Label", "name": instr.(*Label).Identifier}
+	case AsmLocation:
+		pos := instr.(*Location).Pos
+		ret := jsonObject{"kind": "Location", "line": pos.Line, "col": pos.Col}
+		if pos.File != "" {
+			ret["file"] = pos.File
+		}
+		return ret
+	case AsmAllocStack:
+		return jsonObject{"kind": "AllocStack", "bytes": instr.(*AllocStack).N}
+	case AsmDeAllocStack:
+		return jsonObject{"kind": "DeAllocStack", "bytes": instr.(*DeAllocStack).N}
+	case AsmPush:
+		return jsonObject{"kind": "Push", "operand": operandToJson(instr.(*Push).Op)}
+	case AsmCall:
+		return jsonObject{"kind": "Call", "name": instr.(*Call).Identifier}
+	case AsmIndirectCall:
+		return jsonObject{"kind": "IndirectCall", "operand": operandToJson(instr.(*IndirectCall).Operand)}
+	case AsmReturn:
+		return jsonObject{"kind": "Return"}
+	default:
+		panic(fmt.Sprintf("unsupported instruction type: %v", instr.GetType()))
+	}
+}
+
+func operandToJson(operand Operand) jsonObject {
+	switch operand.GetType() {
+	case AsmImmediate:
+		return jsonObject{"kind": "Immediate", "value": operand.(*Immediate).Value}
+	case AsmRegister:
+		return jsonObject{"kind": "Register", "name": operand.(*Register).Name}
+	case AsmPseudoReg:
+		pseudoReg := operand.(*PseudoReg)
+		return jsonObject{"kind": "PseudoReg", "name": pseudoReg.Ident, "type": pseudoReg.Type.String()}
+	case AsmPseudoMem:
+		pseudoMem := operand.(*PseudoMem)
+		return jsonObject{"kind": "PseudoMem", "name": pseudoMem.Ident, "size": pseudoMem.Size, "offset": pseudoMem.Offset}
+	case AsmStack:
+		return jsonObject{"kind": "Stack", "offset": operand.(*Stack).N}
+	case AsmMemory:
+		memory := operand.(*Memory)
+		return jsonObject{"kind": "Memory", "register": memory.Reg, "offset": memory.Offset}
+	case AsmData:
+		return jsonObject{"kind": "Data", "name": operand.(*Data).Name}
+	default:
+		panic(fmt.Sprintf("unsupported operand type: %v", operand.GetType()))
+	}
+}
+
+type jsonLoader struct {
+	err error
+}
+
+func (jl *jsonLoader) loadInstruction(value any) Instruction {
+	obj := jl.getObject(value)
+	kind := jl.getString(obj, "kind")
+
+	switch kind {
+	case "Mov":
+		return NewMov(jl.loadAsmType(obj), jl.loadOperand(obj["src"]), jl.loadOperand(obj["dst"]))
+	case "Movsx":
+		return NewMovsx(jl.loadOperand(obj["src"]), jl.loadOperand(obj["dst"]))
+	case "Lea":
+		return NewLea(jl.loadOperand(obj["src"]), jl.loadOperand(obj["dst"]))
+	case "Unary":
+		return NewUnary(jl.loadAsmType(obj), jl.loadOperator(obj), jl.loadOperand(obj["operand"]))
+	case "Binary":
+		return NewBinary(jl.loadAsmType(obj), jl.loadOperator(obj),
+			jl.loadOperand(obj["operand1"]), jl.loadOperand(obj["operand2"]))
+	case "Cmp":
+		return NewCmp(jl.loadAsmType(obj), jl.loadOperand(obj["left"]), jl.loadOperand(obj["right"]))
+	case "IDiv":
+		return NewIDiv(jl.loadAsmType(obj), jl.loadOperand(obj["operand"]))
+	case "Cdq":
+		return NewCdq(jl.loadAsmType(obj))
+	case "Jump":
+		return NewJump(jl.getString(obj, "target"))
+	case "JumpCC":
+		return NewJumpCC(jl.loadConditionCode(obj), jl.getString(obj, "target"))
+	case "SetCC":
+		return NewSetCC(jl.loadConditionCode(obj), jl.loadOperand(obj["operand"]))
+	case "Label":
+		return NewLabel(jl.getString(obj, "name"))
+	case "Location":
+		return NewLocation(frontend.Position{Line: jl.getInt(obj, "line"), Col: jl.getInt(obj, "col"),
+			File: jl.getString(obj, "file")})
+	case "AllocStack":
+		return NewAllocStack(jl.getInt(obj, "bytes"))
+	case "DeAllocStack":
+		return NewDeAllocStack(jl.getInt(obj, "bytes"))
+	case "Push":
+		return NewPush(jl.loadOperand(obj["operand"]))
+	case "Call":
+		return NewCall(jl.getString(obj, "name"))
+	case "IndirectCall":
+		return NewIndirectCall(jl.loadOperand(obj["operand"]))
+	case "Return":
+		return NewReturn()
+	default:
+		jl.fail(fmt.Sprintf("unknown instruction kind '%s'", kind))
+		return nil
+	}
+}
+
+func (jl *jsonLoader) loadOperand(value any) Operand {
+	obj := jl.getObject(value)
+	kind := jl.getString(obj, "kind")
+
+	switch kind {
+	case "Immediate":
+		return NewImmediate(jl.getInt(obj, "value"))
+	case "Register":
+		return NewRegister(jl.getString(obj, "name"))
+	case "PseudoReg":
+		return NewPseudoReg(jl.getString(obj, "name"), jl.loadAsmType(obj))
+	case "PseudoMem":
+		return NewPseudoMem(jl.getString(obj, "name"), jl.getInt(obj, "size"), jl.getInt(obj, "offset"))
+	case "Stack":
+		return NewStack(jl.getInt(obj, "offset"))
+	case "Memory":
+		return NewMemory(jl.getString(obj, "register"), jl.getInt(obj, "offset"))
+	case "Data":
+		return NewData(jl.getString(obj, "name"))
+	default:
+		jl.fail(fmt.Sprintf("unknown operand kind '%s'", kind))
+		return nil
+	}
+}
+
+func (jl *jsonLoader) loadOperator(obj jsonObject) AST {
+	switch jl.getString(obj, "operator") {
+	case "Neg":
+		return NewNeg()
+	case "Not":
+		return NewNot()
+	case "Add":
+		return NewAdd()
+	case "Sub":
+		return NewSub()
+	case "Mul":
+		return NewMul()
+	case "BitAnd":
+		return NewBitAnd()
+	case "BitOr":
+		return NewBitOr()
+	case "BitXor":
+		return NewBitXor()
+	case "BitShiftLeft":
+		return NewBitShiftLeft()
+	case "BitShiftRight":
+		return NewBitShiftRight()
+	default:
+		jl.fail("unknown operator")
+		return nil
+	}
+}
+
+func (jl *jsonLoader) loadAsmType(obj jsonObject) AsmType {
+	switch name := jl.getString(obj, "type"); name {
+	case "Longword":
+		return Longword
+	case "Quadword":
+		return Quadword
+	default:
+		jl.fail(fmt.Sprintf("unknown assembly type '%s'", name))
+		return Longword
+	}
+}
+
+func (jl *jsonLoader) loadConditionCode(obj jsonObject) ConditionCode {
+	name := jl.getString(obj, "condition")
+	for condCode, condName := range conditionCodeNames {
+		if condName == name {
+			return condCode
+		}
+	}
+	jl.fail(fmt.Sprintf("unknown condition code '%s'", name))
+	return CcEq
+}
+
+func (jl *jsonLoader) getObject(value any) jsonObject {
+	obj, ok := value.(jsonObject)
+	if !ok {
+		jl.fail("expected a JSON object")
+		return jsonObject{}
+	}
+	return obj
+}
+
+func (jl *jsonLoader) getString(obj jsonObject, key string) string {
+	value, _ := obj[key].(string)
+	return value
+}
+
+func (jl *jsonLoader) getInt(obj jsonObject, key string) int {
+	value, ok := obj[key].(float64)
+	if !ok {
+		jl.fail(fmt.Sprintf("'%s' must be a number", key))
+	}
+	return int(value)
+}
+
+func (jl *jsonLoader) getList(obj jsonObject, key string) []any {
+	value, _ := obj[key].([]any)
+	return value
+}
+
+func (jl *jsonLoader) fail(message string) {
+	if jl.err == nil {
+		jl.err = errors.New("invalid assembly JSON: " + message)
+	}
+}
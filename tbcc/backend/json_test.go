@@ -0,0 +1,65 @@
+package backend
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProgram_JsonRoundTrip(t *testing.T) {
+	code := `
+static int *last;
+
+int add(int a, int b, int c, int d, int e, int f, int g) {
+	static int calls = 1;
+	calls++;
+	return a + b + c + d + e + f + g;
+}
+
+int main(void) {
+	int x = 7 / 2 % 3;
+	if (x >= 1)
+		x = ~x;
+	int *p = &x;
+	*p = *p + (int) (int *) x;
+	int (*f)(int, int, int, int, int, int, int) = &add;
+	return f(x, 2, 3, 4, 5, 6, 7) != 0;
+}
+
+int first(int n, ...) {
+	__builtin_va_list ap;
+	__builtin_va_start(ap, n);
+	return __builtin_va_arg(ap, int);
+}`
+	program, _ := codeToAsm(t, code)
+
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	var loaded Program
+	err = json.Unmarshal(data, &loaded)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(*program, loaded) {
+		t.Errorf("program differs after round trip")
+		loaded.Accept(NewAsmPrinter(2))
+	}
+}
+
+func TestProgram_UnmarshalJSON_Errors(t *testing.T) {
+	tests := []string{
+		`{"kind": "FunctionDef"}`,
+		`{"kind": "Program", "functions": [{"kind": "FunctionDef", "instructions": [{"kind": "Nop"}]}]}`,
+		`{"kind": "Program", "functions": [{"kind": "FunctionDef", "instructions": [{"kind": "JumpCC", "condition": "X"}]}]}`,
+	}
+	for _, data := range tests {
+		var program Program
+		if err := json.Unmarshal([]byte(data), &program); err == nil {
+			t.Errorf("json.Unmarshal(%s) expected error", data)
+		}
+	}
+}
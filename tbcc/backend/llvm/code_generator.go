@@ -0,0 +1,619 @@
+// Package llvm translates TACKY programs to textual LLVM IR (.ll). Every
+// variable of a function gets an alloca, static variables become
+// globals. Labels start basic blocks, falling through to a label is an
+// explicit branch.
+//
+// Pointers are i8* and are cast to the type of the location they are
+// dereferenced as, so the IR is accepted by LLVM versions with typed
+// and with opaque pointers. The sizes of the types (in particular of
+// va_list) are the ones of x86-64 Linux, which is the target triple of
+// the module.
+package llvm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/tacky"
+	"sort"
+	"strings"
+)
+
+const (
+	targetTriple = "x86_64-unknown-linux-gnu"
+	pointerType  = "i8*"
+	// integers are 64 bits wide when they are computed from pointers
+	addressType = "i64"
+
+	vaStart = "@llvm.va_start"
+	memcpy  = "@llvm.memcpy.p0i8.p0i8.i64"
+)
+
+type CodeGenerator struct {
+	globalEnv *frontend.Environment
+	code      strings.Builder
+	// types of the static variables, defined or not
+	staticTypes  map[string]frontend.TypeInfo
+	ownFunctions map[string]*tacky.Function
+	// functions used but not defined in the program
+	declared   map[string]bool
+	intrinsics map[string]bool
+	// state of the current function
+	function   *tacky.Function
+	nextValue  int
+	terminated bool
+}
+
+func NewCodeGenerator(globalEnv *frontend.Environment) *CodeGenerator {
+	return &CodeGenerator{globalEnv: globalEnv}
+}
+
+func (cg *CodeGenerator) GenerateCode(program *tacky.Program) (string, error) {
+	cg.code.Reset()
+	cg.staticTypes = make(map[string]frontend.TypeInfo)
+	cg.ownFunctions = make(map[string]*tacky.Function)
+	cg.declared = make(map[string]bool)
+	cg.intrinsics = make(map[string]bool)
+	for _, staticVar := range program.StaticVars {
+		cg.staticTypes[staticVar.Ident] = staticVar.Type
+	}
+	for i := range program.Funs {
+		cg.ownFunctions[program.Funs[i].Ident] = &program.Funs[i]
+	}
+
+	cg.writeln(fmt.Sprintf("target triple = \"%s\"", targetTriple))
+	if len(program.StaticVars) > 0 {
+		cg.writeln("")
+	}
+	for _, staticVar := range program.StaticVars {
+		cg.generateStaticVariable(&staticVar)
+	}
+	for i := range program.Funs {
+		if err := cg.generateFunction(&program.Funs[i]); err != nil {
+			return "", err
+		}
+	}
+
+	var names []string
+	for name := range cg.declared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 || len(cg.intrinsics) > 0 {
+		cg.writeln("")
+	}
+	for _, name := range names {
+		funcInfo := cg.lookupFunction(name)
+		if funcInfo == nil {
+			return "", errors.New(fmt.Sprintf("no prototype for function %s", name))
+		}
+		typ := functionType(funcInfo)
+		cg.writeln(fmt.Sprintf("declare %s @%s(%s)", typ.result, name, strings.Join(typ.paramList(), ", ")))
+	}
+	if cg.intrinsics[vaStart] {
+		cg.writeln(fmt.Sprintf("declare void %s(%s)", vaStart, pointerType))
+	}
+	if cg.intrinsics[memcpy] {
+		cg.writeln(fmt.Sprintf("declare void %s(%s, %s, %s, i1)", memcpy, pointerType, pointerType, addressType))
+	}
+
+	return cg.code.String(), nil
+}
+
+func (cg *CodeGenerator) generateStaticVariable(s *tacky.StaticVariable) {
+	typ := llvmType(s.Type)
+	alignment := max(frontend.AlignmentOf(s.Type), 1)
+	if !s.Defined {
+		cg.writeln(fmt.Sprintf("@%s = external global %s, align %d", s.Ident, typ, alignment))
+		return
+	}
+	linkage := ""
+	if !s.Global {
+		linkage = "internal "
+	}
+	cg.writeln(fmt.Sprintf("@%s = %sglobal %s %s, align %d", s.Ident, linkage, typ,
+		initializer(s.Type, s.Init), alignment))
+}
+
+func (cg *CodeGenerator) generateFunction(f *tacky.Function) error {
+	cg.function = f
+	cg.nextValue = 0
+	cg.terminated = false
+
+	var params []string
+	for i, param := range f.Parameters {
+		params = append(params, fmt.Sprintf("%s %%.arg%d", llvmType(param.Type), i))
+	}
+	if f.Variadic {
+		params = append(params, "...")
+	}
+	cg.writeln("")
+	cg.writeln(fmt.Sprintf("define %s @%s(%s) {", cg.returnType(f.Ident), f.Ident, strings.Join(params, ", ")))
+
+	for _, v := range tacky.Variables(f) {
+		if cg.isStatic(v.Ident) || v.Type.GetTypeId() == frontend.TypeFunc {
+			continue
+		}
+		cg.emit(fmt.Sprintf("%%%s = alloca %s, align %d", v.Ident, llvmType(v.Type),
+			max(frontend.AlignmentOf(v.Type), 1)))
+	}
+	for i, param := range f.Parameters {
+		cg.emit(fmt.Sprintf("store %s %%.arg%d, %s* %%%s", llvmType(param.Type), i, llvmType(param.Type),
+			param.Ident))
+	}
+
+	for _, instr := range f.Body {
+		if err := cg.generateInstruction(instr); err != nil {
+			return err
+		}
+	}
+	if !cg.terminated {
+		cg.emit("unreachable")
+	}
+	cg.writeln("}")
+	return nil
+}
+
+func (cg *CodeGenerator) generateInstruction(instr tacky.Instruction) error {
+	if label, ok := instr.(*tacky.Label); ok {
+		if !cg.terminated {
+			cg.emit(fmt.Sprintf("br label %%%s", blockName(label.Name)))
+		}
+		cg.writeln(blockName(label.Name) + ":")
+		cg.terminated = false
+		return nil
+	}
+	if cg.terminated {
+		// instructions after a jump or return are unreachable
+		cg.writeln(cg.newValue()[1:] + ":")
+		cg.terminated = false
+	}
+
+	switch i := instr.(type) {
+	case *tacky.Return:
+		typ := cg.returnType(cg.function.Ident)
+		if typ == "void" {
+			cg.emit("ret void")
+		} else {
+			cg.emit(fmt.Sprintf("ret %s %s", typ, cg.operand(i.Val, typ)))
+		}
+		cg.terminated = true
+	case *tacky.Unary:
+		typ := intType(i.Dst)
+		switch i.Op.GetType() {
+		case tacky.TacNegate:
+			src := cg.operand(i.Src, typ)
+			cg.storeValue(i.Dst, cg.compute(fmt.Sprintf("sub %s 0, %s", typ, src)), typ)
+		case tacky.TacComplement:
+			src := cg.operand(i.Src, typ)
+			cg.storeValue(i.Dst, cg.compute(fmt.Sprintf("xor %s %s, -1", typ, src)), typ)
+		case tacky.TacNot:
+			srcType := intType(i.Src)
+			cond := cg.compute(fmt.Sprintf("icmp eq %s %s, 0", srcType, cg.operand(i.Src, srcType)))
+			cg.storeValue(i.Dst, cg.compute(fmt.Sprintf("zext i1 %s to %s", cond, typ)), typ)
+		default:
+			return errors.New(fmt.Sprintf("unsupported unary operator %T", i.Op))
+		}
+	case *tacky.Binary:
+		if _, ok := predicates[i.Op.GetType()]; ok {
+			cond := cg.compare(i.Op, i.Src1, i.Src2)
+			typ := intType(i.Dst)
+			cg.storeValue(i.Dst, cg.compute(fmt.Sprintf("zext i1 %s to %s", cond, typ)), typ)
+			return nil
+		}
+		instruction, ok := binaryInstructions[i.Op.GetType()]
+		if !ok {
+			return errors.New(fmt.Sprintf("unsupported binary operator %T", i.Op))
+		}
+		typ := intType(i.Dst)
+		src1 := cg.operand(i.Src1, typ)
+		src2 := cg.operand(i.Src2, typ)
+		cg.storeValue(i.Dst, cg.compute(fmt.Sprintf("%s %s %s, %s", instruction, typ, src1, src2)), typ)
+	case *tacky.Copy:
+		if tacky.IsAggregate(i.Dst) {
+			cg.copyBytes(cg.address(i.Dst.(*tacky.Var)), cg.address(i.Src.(*tacky.Var)), sizeOf(i.Dst))
+			return nil
+		}
+		cg.storeValue(i.Dst, cg.operand(i.Src, valueType(i.Dst)), valueType(i.Dst))
+	case *tacky.Jump:
+		cg.emit(fmt.Sprintf("br label %%%s", blockName(i.Target)))
+		cg.terminated = true
+	case *tacky.JumpIfZero:
+		typ := intType(i.Condition)
+		cond := cg.compute(fmt.Sprintf("icmp eq %s %s, 0", typ, cg.operand(i.Condition, typ)))
+		cg.branch(cond, blockName(i.Target))
+	case *tacky.JumpIfNotZero:
+		typ := intType(i.Condition)
+		cond := cg.compute(fmt.Sprintf("icmp ne %s %s, 0", typ, cg.operand(i.Condition, typ)))
+		cg.branch(cond, blockName(i.Target))
+	case *tacky.CompareAndJump:
+		cg.branch(cg.compare(i.Op, i.Src1, i.Src2), blockName(i.Target))
+	case *tacky.FunctionCall:
+		funcInfo := cg.lookupFunction(i.Name)
+		if funcInfo == nil && cg.ownFunctions[i.Name] == nil {
+			return errors.New(fmt.Sprintf("no prototype for function %s", i.Name))
+		}
+		if cg.ownFunctions[i.Name] == nil {
+			cg.declared[i.Name] = true
+		}
+		cg.generateCall(cg.calleeType(i.Name), "@"+i.Name, i.Args, i.Dst)
+	case *tacky.IndirectCall:
+		funcInfo := i.FunPtr.(*tacky.Var).Type.(*frontend.PointerInfo).Referenced.(*frontend.FuncInfo)
+		typ := functionType(funcInfo)
+		funPtr := cg.compute(fmt.Sprintf("bitcast %s %s to %s*", pointerType, cg.operand(i.FunPtr, pointerType),
+			typ.String()))
+		cg.generateCall(typ, funPtr, i.Args, i.Dst)
+	case *tacky.GetAddress:
+		v := i.Src.(*tacky.Var)
+		var ptr string
+		if v.Type.GetTypeId() == frontend.TypeFunc {
+			if cg.ownFunctions[v.Ident] == nil {
+				cg.declared[v.Ident] = true
+			}
+			ptr = cg.compute(fmt.Sprintf("bitcast %s* @%s to %s", cg.calleeType(v.Ident).String(), v.Ident,
+				pointerType))
+		} else {
+			ptr = cg.address(v)
+		}
+		cg.storeValue(i.Dst, ptr, pointerType)
+	case *tacky.Load:
+		ptr := cg.operand(i.SrcPtr, pointerType)
+		if tacky.IsAggregate(i.Dst) {
+			cg.copyBytes(cg.address(i.Dst.(*tacky.Var)), ptr, sizeOf(i.Dst))
+			return nil
+		}
+		typ := valueType(i.Dst)
+		typedPtr := cg.compute(fmt.Sprintf("bitcast %s %s to %s*", pointerType, ptr, typ))
+		cg.storeValue(i.Dst, cg.compute(fmt.Sprintf("load %s, %s* %s", typ, typ, typedPtr)), typ)
+	case *tacky.Store:
+		ptr := cg.operand(i.DstPtr, pointerType)
+		if tacky.IsAggregate(i.Src) {
+			cg.copyBytes(ptr, cg.address(i.Src.(*tacky.Var)), sizeOf(i.Src))
+			return nil
+		}
+		typ := valueType(i.Src)
+		value := cg.operand(i.Src, typ)
+		typedPtr := cg.compute(fmt.Sprintf("bitcast %s %s to %s*", pointerType, ptr, typ))
+		cg.emit(fmt.Sprintf("store %s %s, %s* %s", typ, value, typ, typedPtr))
+	case *tacky.AddOffset:
+		ptr := cg.operand(i.Ptr, pointerType)
+		cg.storeValue(i.Dst, cg.compute(fmt.Sprintf("getelementptr i8, %s %s, %s %d", pointerType, ptr,
+			addressType, i.Offset)), pointerType)
+	case *tacky.SignExtend:
+		cg.storeValue(i.Dst, cg.operand(i.Src, valueType(i.Dst)), valueType(i.Dst))
+	case *tacky.Truncate:
+		cg.storeValue(i.Dst, cg.operand(i.Src, valueType(i.Dst)), valueType(i.Dst))
+	case *tacky.VaStart:
+		cg.intrinsics[vaStart] = true
+		cg.emit(fmt.Sprintf("call void %s(%s %s)", vaStart, pointerType, cg.operand(i.VaList, pointerType)))
+	case *tacky.VaArg:
+		typ := valueType(i.Dst)
+		value := cg.compute(fmt.Sprintf("va_arg %s %s, %s", pointerType, cg.operand(i.VaList, pointerType), typ))
+		cg.storeValue(i.Dst, value, typ)
+	case *tacky.Location:
+		// no debug metadata is generated
+	default:
+		return errors.New(fmt.Sprintf("unsupported instruction type: %T", instr))
+	}
+	return nil
+}
+
+// generateCall converts the named arguments to the parameter types, the
+// unnamed ones are passed as they are
+func (cg *CodeGenerator) generateCall(typ *funcType, callee string, args []tacky.Value, dst tacky.Value) {
+	var operands []string
+	for k, arg := range args {
+		argType := valueType(arg)
+		if k < len(typ.params) {
+			argType = typ.params[k]
+		}
+		operands = append(operands, fmt.Sprintf("%s %s", argType, cg.operand(arg, argType)))
+	}
+	// variadic functions are called with their type, others with
+	// their return type
+	calleeType := typ.result
+	if typ.variadic {
+		calleeType = typ.String()
+	}
+	call := fmt.Sprintf("call %s %s(%s)", calleeType, callee, strings.Join(operands, ", "))
+	if typ.result == "void" {
+		cg.emit(call)
+		return
+	}
+	result := cg.compute(call)
+	if dst != nil {
+		cg.storeValue(dst, result, typ.result)
+	}
+}
+
+// branch jumps to target if cond holds and continues in a new block
+func (cg *CodeGenerator) branch(cond, target string) {
+	next := cg.newValue()[1:]
+	cg.emit(fmt.Sprintf("br i1 %s, label %%%s, label %%%s", cond, target, next))
+	cg.writeln(next + ":")
+}
+
+// compare returns the i1 result of the comparison. Pointers are
+// compared as unsigned addresses.
+func (cg *CodeGenerator) compare(op tacky.BinaryOp, src1, src2 tacky.Value) string {
+	typ := "i32"
+	predicate := predicates[op.GetType()]
+	if isPointer(src1) || isPointer(src2) {
+		typ = addressType
+		predicate = unsignedPredicates[op.GetType()]
+	}
+	return cg.compute(fmt.Sprintf("icmp %s %s %s, %s", predicate, typ, cg.operand(src1, typ),
+		cg.operand(src2, typ)))
+}
+
+var predicates = map[tacky.TacType]string{
+	tacky.TacEq:    "eq",
+	tacky.TacNotEq: "ne",
+	tacky.TacLt:    "slt",
+	tacky.TacLtEq:  "sle",
+	tacky.TacGt:    "sgt",
+	tacky.TacGtEq:  "sge",
+}
+
+var unsignedPredicates = map[tacky.TacType]string{
+	tacky.TacEq:    "eq",
+	tacky.TacNotEq: "ne",
+	tacky.TacLt:    "ult",
+	tacky.TacLtEq:  "ule",
+	tacky.TacGt:    "ugt",
+	tacky.TacGtEq:  "uge",
+}
+
+var binaryInstructions = map[tacky.TacType]string{
+	tacky.TacAdd:           "add",
+	tacky.TacSub:           "sub",
+	tacky.TacMul:           "mul",
+	tacky.TacDiv:           "sdiv",
+	tacky.TacRemainder:     "srem",
+	tacky.TacBitAnd:        "and",
+	tacky.TacBitOr:         "or",
+	tacky.TacBitXor:        "xor",
+	tacky.TacBitShiftLeft:  "shl",
+	tacky.TacBitShiftRight: "ashr",
+}
+
+// operand returns the value as an operand of the given type
+func (cg *CodeGenerator) operand(value tacky.Value, typ string) string {
+	switch v := value.(type) {
+	case *tacky.IntConstant:
+		switch {
+		case typ == pointerType && v.Val == 0:
+			return "null"
+		case typ == pointerType:
+			return fmt.Sprintf("inttoptr (%s %d to %s)", addressType, v.Val, pointerType)
+		case typ == "i32":
+			return fmt.Sprintf("%d", int32(v.Val))
+		default:
+			return fmt.Sprintf("%d", v.Val)
+		}
+	case *tacky.Var:
+		varType := llvmType(v.Type)
+		loaded := cg.compute(fmt.Sprintf("load %s, %s* %s", varType, varType, cg.location(v)))
+		return cg.convert(loaded, varType, typ)
+	default:
+		panic("unsupported value type")
+	}
+}
+
+// storeValue converts the value of the given type to the type of dst
+// and stores it there
+func (cg *CodeGenerator) storeValue(dst tacky.Value, value string, typ string) {
+	v := dst.(*tacky.Var)
+	varType := llvmType(v.Type)
+	value = cg.convert(value, typ, varType)
+	cg.emit(fmt.Sprintf("store %s %s, %s* %s", varType, value, varType, cg.location(v)))
+}
+
+// convert converts between i32, i64 and pointers. Smaller integers are
+// sign extended.
+func (cg *CodeGenerator) convert(value string, from, to string) string {
+	if from == to {
+		return value
+	}
+	if from == pointerType {
+		value = cg.compute(fmt.Sprintf("ptrtoint %s %s to %s", pointerType, value, addressType))
+		from = addressType
+	}
+	target := to
+	if to == pointerType {
+		target = addressType
+	}
+	switch {
+	case from == "i32" && target == addressType:
+		value = cg.compute(fmt.Sprintf("sext i32 %s to %s", value, addressType))
+	case from == addressType && target == "i32":
+		value = cg.compute(fmt.Sprintf("trunc %s %s to i32", addressType, value))
+	}
+	if to == pointerType {
+		value = cg.compute(fmt.Sprintf("inttoptr %s %s to %s", addressType, value, pointerType))
+	}
+	return value
+}
+
+// location returns the pointer to the alloca or global of the variable
+func (cg *CodeGenerator) location(v *tacky.Var) string {
+	if cg.isStatic(v.Ident) {
+		return "@" + v.Ident
+	}
+	return "%" + v.Ident
+}
+
+// address returns the address of the variable as i8*
+func (cg *CodeGenerator) address(v *tacky.Var) string {
+	typ := llvmType(v.Type)
+	return cg.compute(fmt.Sprintf("bitcast %s* %s to %s", typ, cg.location(v), pointerType))
+}
+
+func (cg *CodeGenerator) copyBytes(dst, src string, size int) {
+	cg.intrinsics[memcpy] = true
+	cg.emit(fmt.Sprintf("call void %s(%s %s, %s %s, %s %d, i1 false)", memcpy, pointerType, dst, pointerType,
+		src, addressType, size))
+}
+
+func (cg *CodeGenerator) isStatic(name string) bool {
+	_, ok := cg.staticTypes[name]
+	return ok
+}
+
+// compute emits an instruction with a result and returns the result
+func (cg *CodeGenerator) compute(instruction string) string {
+	value := cg.newValue()
+	cg.emit(fmt.Sprintf("%s = %s", value, instruction))
+	return value
+}
+
+// newValue returns a fresh local name. The names start with a dot,
+// which TACKY identifiers do not.
+func (cg *CodeGenerator) newValue() string {
+	value := fmt.Sprintf("%%.%d", cg.nextValue)
+	cg.nextValue++
+	return value
+}
+
+func blockName(label string) string {
+	return ".L" + label
+}
+
+// funcType is the LLVM type of a function
+type funcType struct {
+	result   string
+	params   []string
+	variadic bool
+}
+
+func (t *funcType) String() string {
+	return fmt.Sprintf("%s (%s)", t.result, strings.Join(t.paramList(), ", "))
+}
+
+// paramList returns the parameter types including "..." for variadic
+// functions
+func (t *funcType) paramList() []string {
+	params := t.params
+	if t.variadic {
+		params = append(params[:len(params):len(params)], "...")
+	}
+	return params
+}
+
+// functionType returns the type of a function. An implicitly declared
+// function is called like a variadic function without parameters.
+func functionType(funcInfo *frontend.FuncInfo) *funcType {
+	return &funcType{returnType(funcInfo), paramTypes(funcInfo), funcInfo.Variadic || funcInfo.Unprototyped}
+}
+
+// calleeType returns the type of a function of the program or of a
+// declared function
+func (cg *CodeGenerator) calleeType(name string) *funcType {
+	if f, ok := cg.ownFunctions[name]; ok {
+		var params []string
+		for _, param := range f.Parameters {
+			params = append(params, llvmType(param.Type))
+		}
+		return &funcType{cg.returnType(name), params, f.Variadic}
+	}
+	return functionType(cg.lookupFunction(name))
+}
+
+func (cg *CodeGenerator) returnType(name string) string {
+	if funcInfo := cg.lookupFunction(name); funcInfo != nil {
+		return returnType(funcInfo)
+	}
+	return "i32"
+}
+
+func (cg *CodeGenerator) lookupFunction(name string) *frontend.FuncInfo {
+	if cg.globalEnv == nil {
+		return nil
+	}
+	entry, _ := cg.globalEnv.Get(name)
+	if entry == nil || entry.GetTypeInfo() == nil {
+		return nil
+	}
+	funcInfo, _ := entry.GetTypeInfo().(*frontend.FuncInfo)
+	return funcInfo
+}
+
+func returnType(funcInfo *frontend.FuncInfo) string {
+	return llvmType(funcInfo.ReturnType)
+}
+
+// paramTypes returns the types of the named parameters. A va_list
+// parameter is a pointer to the va_list of the caller.
+func paramTypes(funcInfo *frontend.FuncInfo) []string {
+	var params []string
+	for _, paramType := range funcInfo.ParamTypes[:funcInfo.NumParams()] {
+		if paramType.GetTypeId() == frontend.TypeVaList {
+			params = append(params, pointerType)
+		} else {
+			params = append(params, llvmType(paramType))
+		}
+	}
+	return params
+}
+
+func llvmType(typeInfo frontend.TypeInfo) string {
+	switch typeInfo.GetTypeId() {
+	case frontend.TypeInt, frontend.TypeEnum:
+		return "i32"
+	case frontend.TypePointer:
+		return pointerType
+	case frontend.TypeVoid:
+		return "void"
+	default:
+		// structures and va_lists are byte arrays
+		return fmt.Sprintf("[%d x i8]", frontend.SizeOf(typeInfo))
+	}
+}
+
+func initializer(typeInfo frontend.TypeInfo, init int) string {
+	switch llvmType(typeInfo) {
+	case "i32":
+		return fmt.Sprintf("%d", int32(init))
+	case pointerType:
+		if init == 0 {
+			return "null"
+		}
+		return fmt.Sprintf("inttoptr (%s %d to %s)", addressType, init, pointerType)
+	default:
+		return "zeroinitializer"
+	}
+}
+
+// valueType returns the LLVM type of a value, constants are i32
+func valueType(value tacky.Value) string {
+	if v, ok := value.(*tacky.Var); ok {
+		return llvmType(v.Type)
+	}
+	return "i32"
+}
+
+// intType returns the integer type arithmetic on the value is done in
+func intType(value tacky.Value) string {
+	if isPointer(value) {
+		return addressType
+	}
+	return "i32"
+}
+
+func isPointer(value tacky.Value) bool {
+	v, ok := value.(*tacky.Var)
+	return ok && v.Type.GetTypeId() == frontend.TypePointer
+}
+
+func sizeOf(value tacky.Value) int {
+	return frontend.SizeOf(value.(*tacky.Var).Type)
+}
+
+func (cg *CodeGenerator) emit(instruction string) {
+	cg.writeln("  " + instruction)
+}
+
+func (cg *CodeGenerator) writeln(line string) {
+	cg.code.WriteString(line)
+	cg.code.WriteString("\n")
+}
@@ -0,0 +1,142 @@
+package llvm
+
+import (
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/internal/backendtest"
+	"strings"
+	"testing"
+)
+
+func TestCodeGenerator_GenerateCode(t *testing.T) {
+	code := `
+	int printf(void *format, ...);
+
+	int count(int n) {
+		int i = 0;
+		while (i < n) {
+			if (i == 42)
+				break;
+			i++;
+		}
+		return i;
+	}
+
+	int main(void) {
+		int fmt = 680997;
+		return printf(&fmt, count(10), 7);
+	}`
+
+	ir := generate(t, code)
+
+	for _, want := range []string{
+		"define i32 @count(i32 %.arg0) {\n  %tmp.0 = alloca i32, align 4\n",
+		"  store i32 %.arg0, i32* %tmp.0\n",
+		"  br label %.Lloop.0.continue\n.Lloop.0.continue:\n",
+		"  %.2 = icmp sge i32 %.0, %.1\n  br i1 %.2, label %.Lloop.0.break, label %.3\n.3:\n",
+		"  %.9 = add i32 %.8, 1\n",
+		"  %.0 = bitcast i32* %tmp.2 to i8*\n",
+		"  %.5 = call i32 (i8*, ...) @printf(i8* %.3, i32 %.4, i32 7)\n",
+		"declare i32 @printf(i8*, ...)\n",
+	} {
+		if !strings.Contains(ir, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, ir)
+		}
+	}
+	if strings.Contains(ir, "declare i32 @count") {
+		t.Errorf("functions of the program must not be declared:\n%s", ir)
+	}
+}
+
+func TestCodeGenerator_GenerateCode_Pointers(t *testing.T) {
+	code := `
+	int abs(int x);
+	extern int limit;
+	static int counter = 5;
+	int *last;
+
+	int apply(int (*f)(int), int x) {
+		last = &counter;
+		return f(x) + limit + *last;
+	}
+
+	int main(void) {
+		return apply(abs, -3) + (last == 0);
+	}`
+
+	ir := generate(t, code)
+
+	for _, want := range []string{
+		"@limit = external global i32, align 4\n",
+		"@counter = internal global i32 5, align 4\n",
+		"@last = global i8* null, align 8\n",
+		"  %.0 = bitcast i32* @counter to i8*\n",
+		"  store i8* %.1, i8** @last\n",
+		"  %.3 = bitcast i8* %.2 to i32 (i32)*\n  %.4 = load i32, i32* %tmp.1\n  %.5 = call i32 %.3(i32 %.4)\n",
+		"  %.10 = bitcast i8* %.9 to i32*\n  %.11 = load i32, i32* %.10\n",
+		"bitcast i32 (i32)* @abs to i8*\n",
+		"icmp eq i64 %.6, 0\n",
+		"declare i32 @abs(i32)\n",
+	} {
+		if !strings.Contains(ir, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, ir)
+		}
+	}
+}
+
+func TestCodeGenerator_GenerateCode_Variadic(t *testing.T) {
+	code := `
+	int vprintf(void *format, __builtin_va_list ap);
+
+	int sum(int count, ...) {
+		__builtin_va_list args;
+		int result = 0;
+		__builtin_va_start(args, count);
+		for (int i = 0; i < count; i++)
+			result += __builtin_va_arg(args, int);
+		__builtin_va_end(args);
+		return result;
+	}
+
+	int print(void *format, ...) {
+		__builtin_va_list ap;
+		__builtin_va_start(ap, format);
+		return vprintf(format, ap);
+	}`
+
+	ir := generate(t, code)
+
+	for _, want := range []string{
+		"define i32 @sum(i32 %.arg0, ...) {\n",
+		"alloca [24 x i8], align 8\n",
+		"call void @llvm.va_start(i8* ",
+		"va_arg i8* ",
+		"call i32 @vprintf(i8* ",
+		"declare i32 @vprintf(i8*, i8*)\n",
+		"declare void @llvm.va_start(i8*)\n",
+	} {
+		if !strings.Contains(ir, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, ir)
+		}
+	}
+}
+
+// TestCodeGenerator_GenerateCode_Execute compiles the IR with llc and
+// runs the program. It is skipped if llc or gcc are missing.
+func TestCodeGenerator_GenerateCode_Execute(t *testing.T) {
+	backendtest.RequireTools(t, "llc", "gcc")
+	irFile := backendtest.WriteFile(t, "program.ll", generate(t, backendtest.ExecuteCode))
+	executable := strings.TrimSuffix(irFile, ".ll")
+	backendtest.Run(t, "llc", "-filetype=obj", "-relocation-model=pic", irFile, "-o", executable+".o")
+	backendtest.Run(t, "gcc", executable+".o", "-o", executable)
+	if got := backendtest.ExitStatus(t, executable); got != backendtest.ExecuteStatus {
+		t.Errorf("exit status = %d, want %d", got, backendtest.ExecuteStatus)
+	}
+}
+
+func generate(t *testing.T, code string) string {
+	program, env := backendtest.FrontEnd(t, code)
+	ir, err := NewCodeGenerator(env).GenerateCode(program)
+	if err != nil {
+		t.Fatalf("GenerateCode() error = %v", err)
+	}
+	return ir
+}
@@ -0,0 +1,597 @@
+// Package riscv64 translates TACKY programs to RV64GC assembly for
+// Linux. Function calls follow the LP64 calling convention.
+package riscv64
+
+import (
+	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/tacky"
+	"strings"
+)
+
+const (
+	numArgRegisters = 8
+	// Variadic functions save a0-a7 right below the stack arguments of
+	// the caller, so that all unnamed arguments are contiguous in memory
+	// and va_list is a plain pointer
+	regSaveAreaSize = 8 * numArgRegisters
+	vaListSize      = 8
+	// TACKY passes va_lists by address, the LP64 convention by value.
+	// A parameter of type va_list is copied to a stack slot with this
+	// suffix, which the parameter then points to.
+	vaListCopySuffix = ".va_list"
+)
+
+// CodeGenerator translates TACKY to RISC-V assembly. Every variable
+// lives in a stack slot; instructions load their operands into the
+// scratch registers t0 and t1 and store the result back. t3 and t4 hold
+// addresses, t5 and t6 are used for offsets and immediates which do not
+// fit into 12 bits.
+type CodeGenerator struct {
+	code strings.Builder
+	// staticVars holds the names of the variables with static storage
+	// duration, ownStatics the ones defined in the program
+	staticVars   map[string]bool
+	ownStatics   map[string]bool
+	ownFunctions map[string]bool
+	labelCounter int
+	// state of the current function
+	slots        map[string]int
+	numParams    int
+	savedRegSize int
+}
+
+func NewCodeGenerator() *CodeGenerator {
+	return &CodeGenerator{}
+}
+
+func (cg *CodeGenerator) GenerateCode(program *tacky.Program) string {
+	cg.code.Reset()
+	cg.staticVars = make(map[string]bool)
+	cg.ownStatics = make(map[string]bool)
+	cg.ownFunctions = make(map[string]bool)
+	for _, staticVar := range program.StaticVars {
+		cg.staticVars[staticVar.Ident] = true
+		cg.ownStatics[staticVar.Ident] = staticVar.Defined
+	}
+	for _, fun := range program.Funs {
+		cg.ownFunctions[fun.Ident] = true
+	}
+
+	for i := range program.Funs {
+		cg.generateFunction(&program.Funs[i])
+	}
+	for _, staticVar := range program.StaticVars {
+		if staticVar.Defined {
+			cg.generateStaticVariable(&staticVar)
+		}
+	}
+	cg.writeln("\t.section .note.GNU-stack,\"\",@progbits")
+	return cg.code.String()
+}
+
+func (cg *CodeGenerator) generateStaticVariable(s *tacky.StaticVariable) {
+	size := frontend.SizeOf(s.Type)
+	if s.Global {
+		cg.writeln("\t.globl " + s.Ident)
+	}
+	if s.Init == 0 {
+		cg.writeln("\t.bss")
+	} else {
+		cg.writeln("\t.data")
+	}
+	cg.writeln(fmt.Sprintf("\t.balign %d", frontend.AlignmentOf(s.Type)))
+	cg.writeln(s.Ident + ":")
+	switch {
+	case s.Init == 0:
+		cg.writeln(fmt.Sprintf("\t.zero %d", size))
+	case size == 8:
+		cg.writeln(fmt.Sprintf("\t.dword %d", s.Init))
+	default:
+		cg.writeln(fmt.Sprintf("\t.word %d", s.Init))
+	}
+}
+
+// generateFunction emits the function with the frame
+//
+//	s0 ...         stack arguments of the caller
+//	s0 - 64        saved a0-a7 (variadic functions only)
+//	               saved ra and s0
+//	sp + outArgs   stack slots of the variables
+//	sp             outgoing stack arguments
+//
+// All parts of the frame are multiples of 16 bytes.
+func (cg *CodeGenerator) generateFunction(f *tacky.Function) {
+	cg.numParams = len(f.Parameters)
+	cg.savedRegSize = 16
+	if f.Variadic {
+		cg.savedRegSize += regSaveAreaSize
+	}
+	frameSize := cg.allocateSlots(f)
+
+	cg.writeln("\t.text")
+	cg.writeln("\t.globl " + f.Ident)
+	cg.writeln("\t.type " + f.Ident + ", @function")
+	cg.writeln(f.Ident + ":")
+	cg.writeln(fmt.Sprintf("\taddi sp, sp, -%d", cg.savedRegSize))
+	cg.writeln("\tsd ra, 8(sp)")
+	cg.writeln("\tsd s0, 0(sp)")
+	cg.writeln(fmt.Sprintf("\taddi s0, sp, %d", cg.savedRegSize))
+	if frameSize > 0 {
+		cg.addImmediate("sp", "sp", -frameSize)
+	}
+
+	if f.Variadic {
+		for i := 0; i < numArgRegisters; i++ {
+			cg.writeln(fmt.Sprintf("\tsd a%d, %d(s0)", i, 8*i-regSaveAreaSize))
+		}
+	}
+	for i, param := range f.Parameters {
+		size := tacky.SizeOf(param.Type, vaListSize)
+		reg := fmt.Sprintf("a%d", i)
+		if i >= numArgRegisters {
+			reg = "t0"
+			cg.writeln(fmt.Sprintf("\t%s t0, %d(s0)", loadInstruction(size), 8*(i-numArgRegisters)))
+		}
+		if isVaListPointer(param) {
+			cg.writeln(fmt.Sprintf("\tsd %s, %s", reg, cg.slot(param.Ident+vaListCopySuffix, 0)))
+			cg.addImmediate(reg, "sp", cg.slots[param.Ident+vaListCopySuffix])
+		}
+		cg.writeln(fmt.Sprintf("\t%s %s, %s", storeInstruction(size), reg, cg.slot(param.Ident, 0)))
+	}
+
+	for _, instr := range f.Body {
+		cg.generateInstruction(instr)
+	}
+	cg.writeln("\t.size " + f.Ident + ", .-" + f.Ident)
+}
+
+// allocateSlots assigns a stack slot to every variable of the function
+// and returns the size of the frame below the saved registers
+func (cg *CodeGenerator) allocateSlots(f *tacky.Function) int {
+	outArgs := 0
+	for _, instr := range f.Body {
+		var args []tacky.Value
+		switch call := instr.(type) {
+		case *tacky.FunctionCall:
+			args = call.Args
+		case *tacky.IndirectCall:
+			args = call.Args
+		}
+		outArgs = max(outArgs, 8*(len(args)-numArgRegisters))
+	}
+	outArgs = tacky.AlignTo(outArgs, 16)
+
+	cg.slots = make(map[string]int)
+	offset := outArgs
+	allocate := func(name string, size, alignment int) {
+		offset = tacky.AlignTo(offset, alignment)
+		cg.slots[name] = offset
+		offset += size
+	}
+	for _, param := range f.Parameters {
+		if isVaListPointer(param) {
+			allocate(param.Ident+vaListCopySuffix, vaListSize, 8)
+		}
+	}
+	for _, v := range tacky.Variables(f) {
+		if cg.staticVars[v.Ident] || v.Type.GetTypeId() == frontend.TypeFunc {
+			continue
+		}
+		allocate(v.Ident, tacky.SizeOf(v.Type, vaListSize), tacky.AlignmentOf(v.Type))
+	}
+	return tacky.AlignTo(offset, 16)
+}
+
+func (cg *CodeGenerator) generateInstruction(instr tacky.Instruction) {
+	switch i := instr.(type) {
+	case *tacky.Return:
+		if i.Val != nil {
+			cg.load(i.Val, "a0", tacky.SizeOfValue(i.Val, vaListSize))
+		}
+		cg.writeln(fmt.Sprintf("\tld ra, -%d(s0)", cg.savedRegSize-8))
+		cg.writeln(fmt.Sprintf("\taddi sp, s0, -%d", cg.savedRegSize))
+		cg.writeln("\tld s0, 0(sp)")
+		cg.writeln(fmt.Sprintf("\taddi sp, sp, %d", cg.savedRegSize))
+		cg.writeln("\tret")
+	case *tacky.Unary:
+		size := tacky.SizeOfValue(i.Src, vaListSize)
+		cg.load(i.Src, "t0", size)
+		switch i.Op.GetType() {
+		case tacky.TacNegate:
+			cg.writeln("\tnegw t0, t0")
+		case tacky.TacComplement:
+			cg.writeln("\tnot t0, t0")
+		case tacky.TacNot:
+			cg.writeln("\tseqz t0, t0")
+		default:
+			panic("unsupported unary operator")
+		}
+		cg.store(i.Dst, "t0")
+	case *tacky.Binary:
+		cg.generateBinary(i)
+	case *tacky.Copy:
+		if tacky.IsAggregate(i.Dst) {
+			cg.address(i.Src, "t3")
+			cg.address(i.Dst, "t4")
+			cg.copyBytes(tacky.SizeOfValue(i.Dst, vaListSize), "t3", "t4")
+			return
+		}
+		cg.load(i.Src, "t0", tacky.SizeOfValue(i.Dst, vaListSize))
+		cg.store(i.Dst, "t0")
+	case *tacky.Jump:
+		cg.writeln("\tj .L" + i.Target)
+	case *tacky.JumpIfZero:
+		cg.load(i.Condition, "t0", tacky.SizeOfValue(i.Condition, vaListSize))
+		cg.writeln("\tbeqz t0, .L" + i.Target)
+	case *tacky.JumpIfNotZero:
+		cg.load(i.Condition, "t0", tacky.SizeOfValue(i.Condition, vaListSize))
+		cg.writeln("\tbnez t0, .L" + i.Target)
+	case *tacky.CompareAndJump:
+		unsigned := cg.loadOperands(i.Src1, i.Src2)
+		cg.writeln(fmt.Sprintf("\t%s t0, t1, .L%s", branchInstruction(i.Op, unsigned), i.Target))
+	case *tacky.Label:
+		cg.writeln(".L" + i.Name + ":")
+	case *tacky.FunctionCall:
+		cg.passArguments(i.Args)
+		cg.writeln("\tcall " + i.Name)
+		cg.storeResult(i.Dst)
+	case *tacky.IndirectCall:
+		cg.passArguments(i.Args)
+		cg.load(i.FunPtr, "t3", 8)
+		cg.writeln("\tjalr t3")
+		cg.storeResult(i.Dst)
+	case *tacky.GetAddress:
+		cg.address(i.Src, "t0")
+		cg.store(i.Dst, "t0")
+	case *tacky.Load:
+		cg.load(i.SrcPtr, "t3", 8)
+		if tacky.IsAggregate(i.Dst) {
+			cg.address(i.Dst, "t4")
+			cg.copyBytes(tacky.SizeOfValue(i.Dst, vaListSize), "t3", "t4")
+			return
+		}
+		cg.writeln(fmt.Sprintf("\t%s t0, 0(t3)", loadInstruction(tacky.SizeOfValue(i.Dst, vaListSize))))
+		cg.store(i.Dst, "t0")
+	case *tacky.Store:
+		// the pointer determines the size (the source may be a null pointer constant)
+		referenced := i.DstPtr.(*tacky.Var).Type.(*frontend.PointerInfo).Referenced
+		if tacky.IsAggregate(i.Src) {
+			// loading a static pointer uses t3
+			cg.load(i.DstPtr, "t4", 8)
+			cg.address(i.Src, "t3")
+			cg.copyBytes(tacky.SizeOf(referenced, vaListSize), "t3", "t4")
+			return
+		}
+		size := tacky.SizeOf(referenced, vaListSize)
+		cg.load(i.Src, "t0", size)
+		cg.load(i.DstPtr, "t3", 8)
+		cg.writeln(fmt.Sprintf("\t%s t0, 0(t3)", storeInstruction(size)))
+	case *tacky.AddOffset:
+		cg.load(i.Ptr, "t0", 8)
+		cg.addImmediate("t0", "t0", i.Offset)
+		cg.store(i.Dst, "t0")
+	case *tacky.SignExtend:
+		// lw already sign extends to 64 bits
+		cg.load(i.Src, "t0", 4)
+		cg.store(i.Dst, "t0")
+	case *tacky.Truncate:
+		// little endian: the low bytes come first
+		cg.load(i.Src, "t0", 4)
+		cg.store(i.Dst, "t0")
+	case *tacky.VaStart:
+		// the first unnamed argument follows the named ones, either in the
+		// register save area or on the stack
+		cg.load(i.VaList, "t3", 8)
+		cg.addImmediate("t0", "s0", 8*cg.numParams-regSaveAreaSize)
+		cg.writeln("\tsd t0, 0(t3)")
+	case *tacky.VaArg:
+		// every argument takes 8 bytes
+		cg.load(i.VaList, "t3", 8)
+		cg.writeln("\tld t1, 0(t3)")
+		cg.writeln(fmt.Sprintf("\t%s t0, 0(t1)", loadInstruction(tacky.SizeOfValue(i.Dst, vaListSize))))
+		cg.writeln("\taddi t1, t1, 8")
+		cg.writeln("\tsd t1, 0(t3)")
+		cg.store(i.Dst, "t0")
+	default:
+		panic(fmt.Sprintf("unsupported instruction type: %T", instr))
+	}
+}
+
+func (cg *CodeGenerator) generateBinary(b *tacky.Binary) {
+	switch b.Op.GetType() {
+	case tacky.TacEq, tacky.TacNotEq, tacky.TacLt, tacky.TacLtEq, tacky.TacGt, tacky.TacGtEq:
+		cg.generateComparison(b)
+		return
+	}
+
+	// int values are kept sign extended to 64 bits, the "w" instructions
+	// operate on the lower 32 bits and sign extend the result
+	size := tacky.SizeOfValue(b.Dst, vaListSize)
+	suffix := ""
+	if size == 4 {
+		suffix = "w"
+	}
+	cg.load(b.Src1, "t0", size)
+	cg.load(b.Src2, "t1", size)
+	var mnemonic string
+	switch b.Op.GetType() {
+	case tacky.TacAdd:
+		mnemonic = "add" + suffix
+	case tacky.TacSub:
+		mnemonic = "sub" + suffix
+	case tacky.TacMul:
+		mnemonic = "mul" + suffix
+	case tacky.TacDiv:
+		mnemonic = "div" + suffix
+	case tacky.TacRemainder:
+		mnemonic = "rem" + suffix
+	case tacky.TacBitAnd:
+		mnemonic = "and"
+	case tacky.TacBitOr:
+		mnemonic = "or"
+	case tacky.TacBitXor:
+		mnemonic = "xor"
+	case tacky.TacBitShiftLeft:
+		mnemonic = "sll" + suffix
+	case tacky.TacBitShiftRight:
+		mnemonic = "sra" + suffix
+	default:
+		panic("unsupported binary operator")
+	}
+	cg.writeln(fmt.Sprintf("\t%s t0, t0, t1", mnemonic))
+	cg.store(b.Dst, "t0")
+}
+
+// generateComparison computes the relation with slt (or sltu), which is
+// the only comparison that yields a value. The others are derived from
+// it.
+func (cg *CodeGenerator) generateComparison(b *tacky.Binary) {
+	slt := "slt"
+	if cg.loadOperands(b.Src1, b.Src2) {
+		slt = "sltu"
+	}
+	switch b.Op.GetType() {
+	case tacky.TacEq:
+		cg.writeln("\txor t0, t0, t1")
+		cg.writeln("\tseqz t0, t0")
+	case tacky.TacNotEq:
+		cg.writeln("\txor t0, t0, t1")
+		cg.writeln("\tsnez t0, t0")
+	case tacky.TacLt:
+		cg.writeln("\t" + slt + " t0, t0, t1")
+	case tacky.TacGt:
+		cg.writeln("\t" + slt + " t0, t1, t0")
+	case tacky.TacLtEq:
+		// a <= b is !(b < a)
+		cg.writeln("\t" + slt + " t0, t1, t0")
+		cg.writeln("\txori t0, t0, 1")
+	case tacky.TacGtEq:
+		cg.writeln("\t" + slt + " t0, t0, t1")
+		cg.writeln("\txori t0, t0, 1")
+	}
+	cg.store(b.Dst, "t0")
+}
+
+// loadOperands loads the operands of a comparison into t0 and t1 and
+// returns whether they are pointers, which are compared as unsigned
+// values
+func (cg *CodeGenerator) loadOperands(src1, src2 tacky.Value) bool {
+	size := max(tacky.SizeOfValue(src1, vaListSize), tacky.SizeOfValue(src2, vaListSize))
+	cg.load(src1, "t0", size)
+	cg.load(src2, "t1", size)
+	return size == 8
+}
+
+var branchInstructions = map[tacky.TacType]string{
+	tacky.TacEq:    "beq",
+	tacky.TacNotEq: "bne",
+	tacky.TacGt:    "bgt",
+	tacky.TacGtEq:  "bge",
+	tacky.TacLt:    "blt",
+	tacky.TacLtEq:  "ble",
+}
+
+func branchInstruction(op tacky.BinaryOp, unsigned bool) string {
+	branch, ok := branchInstructions[op.GetType()]
+	if !ok {
+		panic("not a relational operator")
+	}
+	if unsigned && branch != "beq" && branch != "bne" {
+		branch += "u"
+	}
+	return branch
+}
+
+// passArguments passes the first eight arguments in a0-a7 and the
+// remaining ones in 8 byte slots at the bottom of the stack
+func (cg *CodeGenerator) passArguments(args []tacky.Value) {
+	for i := numArgRegisters; i < len(args); i++ {
+		size := tacky.SizeOfValue(args[i], vaListSize)
+		cg.loadArgument(args[i], "t0")
+		cg.writeln(fmt.Sprintf("\t%s t0, %d(sp)", storeInstruction(size), 8*(i-numArgRegisters)))
+	}
+	for i := 0; i < min(len(args), numArgRegisters); i++ {
+		cg.loadArgument(args[i], fmt.Sprintf("a%d", i))
+	}
+}
+
+func (cg *CodeGenerator) loadArgument(arg tacky.Value, reg string) {
+	cg.load(arg, reg, tacky.SizeOfValue(arg, vaListSize))
+	if isVaListPointer(arg) {
+		cg.writeln(fmt.Sprintf("\tld %s, 0(%s)", reg, reg))
+	}
+}
+
+func (cg *CodeGenerator) storeResult(dst tacky.Value) {
+	if dst != nil {
+		cg.store(dst, "a0")
+	}
+}
+
+// load loads the value into the register. 4 byte values are sign
+// extended.
+func (cg *CodeGenerator) load(value tacky.Value, reg string, size int) {
+	switch v := value.(type) {
+	case *tacky.IntConstant:
+		cg.loadImmediate(reg, v.Val)
+	case *tacky.Var:
+		cg.writeln(fmt.Sprintf("\t%s %s, %s", loadInstruction(size), reg, cg.memory(v)))
+	default:
+		panic("unsupported value type")
+	}
+}
+
+func (cg *CodeGenerator) store(v tacky.Value, reg string) {
+	size := tacky.SizeOfValue(v, vaListSize)
+	cg.writeln(fmt.Sprintf("\t%s %s, %s", storeInstruction(size), reg, cg.memory(v.(*tacky.Var))))
+}
+
+// memory returns the memory operand of the variable. Static variables
+// are addressed through t3.
+func (cg *CodeGenerator) memory(v *tacky.Var) string {
+	if cg.staticVars[v.Ident] {
+		cg.symbolAddress("t3", v.Ident, cg.ownStatics[v.Ident])
+		return "0(t3)"
+	}
+	return cg.slot(v.Ident, 0)
+}
+
+// slot returns the memory operand of the stack slot at the given offset.
+// Offsets which do not fit into 12 bits are computed in t5.
+func (cg *CodeGenerator) slot(name string, offset int) string {
+	offset += cg.slots[name]
+	if fitsInImmediate(offset) {
+		return fmt.Sprintf("%d(sp)", offset)
+	}
+	cg.loadImmediate("t5", offset)
+	cg.writeln("\tadd t5, sp, t5")
+	return "0(t5)"
+}
+
+// address loads the address of the variable (or function) into the
+// register
+func (cg *CodeGenerator) address(value tacky.Value, reg string) {
+	v := value.(*tacky.Var)
+	switch {
+	case v.Type.GetTypeId() == frontend.TypeFunc:
+		cg.symbolAddress(reg, v.Ident, cg.ownFunctions[v.Ident])
+	case cg.staticVars[v.Ident]:
+		cg.symbolAddress(reg, v.Ident, cg.ownStatics[v.Ident])
+	default:
+		cg.addImmediate(reg, "sp", cg.slots[v.Ident])
+	}
+}
+
+// symbolAddress loads the address of a symbol into the register.
+// Symbols defined elsewhere are looked up in the global offset table.
+func (cg *CodeGenerator) symbolAddress(reg string, name string, own bool) {
+	if own {
+		cg.writeln(fmt.Sprintf("\tlla %s, %s", reg, name))
+		return
+	}
+	label := cg.createLabelName("pcrel")
+	cg.writeln(fmt.Sprintf(".L%s:", label))
+	cg.writeln(fmt.Sprintf("\tauipc %s, %%got_pcrel_hi(%s)", reg, name))
+	cg.writeln(fmt.Sprintf("\tld %s, %%pcrel_lo(.L%s)(%s)", reg, label, reg))
+}
+
+// copyBytes copies size bytes from the memory src points to to the
+// memory dst points to. Both registers are advanced when the offsets
+// grow too large.
+func (cg *CodeGenerator) copyBytes(size int, src, dst string) {
+	base := 0
+	advance := func(offset int) int {
+		if !fitsInImmediate(offset - base + 8) {
+			cg.writeln(fmt.Sprintf("\taddi %s, %s, %d", src, src, offset-base))
+			cg.writeln(fmt.Sprintf("\taddi %s, %s, %d", dst, dst, offset-base))
+			base = offset
+		}
+		return offset - base
+	}
+	offset := 0
+	for ; offset+8 <= size; offset += 8 {
+		relative := advance(offset)
+		cg.writeln(fmt.Sprintf("\tld t0, %d(%s)", relative, src))
+		cg.writeln(fmt.Sprintf("\tsd t0, %d(%s)", relative, dst))
+	}
+	// the remaining bytes of structures without named members are padding
+	if offset+4 <= size {
+		relative := advance(offset)
+		cg.writeln(fmt.Sprintf("\tlw t0, %d(%s)", relative, src))
+		cg.writeln(fmt.Sprintf("\tsw t0, %d(%s)", relative, dst))
+	}
+}
+
+// loadImmediate materializes a constant with lui for the upper 20 bits
+// and addi(w) for the lower 12 bits. Constants beyond 32 bits are built
+// 12 bits at a time.
+func (cg *CodeGenerator) loadImmediate(reg string, value int) {
+	if fitsInImmediate(value) {
+		cg.writeln(fmt.Sprintf("\taddi %s, zero, %d", reg, value))
+		return
+	}
+	// the lower 12 bits are sign extended, so the upper part is rounded
+	lower := (value << 52) >> 52
+	if int(int32(value)) == value {
+		upper := ((value - lower) >> 12) & 0xfffff
+		cg.writeln(fmt.Sprintf("\tlui %s, %d", reg, upper))
+		if lower != 0 {
+			cg.writeln(fmt.Sprintf("\taddiw %s, %s, %d", reg, reg, lower))
+		}
+		return
+	}
+	cg.loadImmediate(reg, (value-lower)>>12)
+	cg.writeln(fmt.Sprintf("\tslli %s, %s, 12", reg, reg))
+	if lower != 0 {
+		cg.writeln(fmt.Sprintf("\taddi %s, %s, %d", reg, reg, lower))
+	}
+}
+
+// addImmediate emits dst = src + value for 64 bit registers. Large
+// values are moved into t6 first.
+func (cg *CodeGenerator) addImmediate(dst, src string, value int) {
+	if fitsInImmediate(value) {
+		cg.writeln(fmt.Sprintf("\taddi %s, %s, %d", dst, src, value))
+		return
+	}
+	cg.loadImmediate("t6", value)
+	cg.writeln(fmt.Sprintf("\tadd %s, %s, t6", dst, src))
+}
+
+func (cg *CodeGenerator) createLabelName(prefix string) string {
+	name := fmt.Sprintf("%s.%d", prefix, cg.labelCounter)
+	cg.labelCounter++
+	return name
+}
+
+func (cg *CodeGenerator) writeln(line string) {
+	cg.code.WriteString(line)
+	cg.code.WriteString("\n")
+}
+
+func fitsInImmediate(value int) bool {
+	return value >= -2048 && value < 2048
+}
+
+func loadInstruction(size int) string {
+	if size == 8 {
+		return "ld"
+	}
+	return "lw"
+}
+
+func storeInstruction(size int) string {
+	if size == 8 {
+		return "sd"
+	}
+	return "sw"
+}
+
+func isVaListPointer(value tacky.Value) bool {
+	v, ok := value.(*tacky.Var)
+	if !ok || v.Type.GetTypeId() != frontend.TypePointer {
+		return false
+	}
+	return v.Type.(*frontend.PointerInfo).Referenced.GetTypeId() == frontend.TypeVaList
+}
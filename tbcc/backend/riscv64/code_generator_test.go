@@ -0,0 +1,111 @@
+package riscv64
+
+import (
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/internal/backendtest"
+	"strings"
+	"testing"
+)
+
+func TestCodeGenerator_GenerateCode(t *testing.T) {
+	code := `
+	int sum(int a, int b, int c, int d, int e, int f, int g, int h, int i, int j) {
+		return a / b + c % d + j;
+	}
+
+	int main(void) {
+		int i = 0;
+		while (i < 10)
+			i++;
+		return sum(1, 2, 3, 4, 5, 6, 7, 8, 9, i) + (i <= 3) + 100000;
+	}`
+
+	asm := generate(t, code)
+
+	for _, want := range []string{
+		"main:\n\taddi sp, sp, -16\n\tsd ra, 8(sp)\n\tsd s0, 0(sp)\n\taddi s0, sp, 16\n",
+		"\tld ra, -8(s0)\n\taddi sp, s0, -16\n\tld s0, 0(sp)\n\taddi sp, sp, 16\n\tret\n",
+		"\tdivw t0, t0, t1\n",
+		"\tremw t0, t0, t1\n",
+		// the 10th argument is passed on the stack
+		"\tlw t0, 8(s0)\n",
+		"\tsw t0, 8(sp)\n",
+		"\tbge t0, t1, .Lloop.0.break\n",
+		"\tslt t0, t1, t0\n\txori t0, t0, 1\n",
+		"\tcall sum\n",
+		"\tlui t1, 24\n\taddiw t1, t1, 1696\n",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+}
+
+func TestCodeGenerator_GenerateCode_Pointers(t *testing.T) {
+	code := `
+	int *last;
+
+	int same(int *p, int *q) {
+		extern int external;
+		last = &external;
+		return p == q || p < q;
+	}`
+
+	asm := generate(t, code)
+
+	for _, want := range []string{
+		"\tauipc t0, %got_pcrel_hi(external)\n",
+		"\tlla t3, last\n\tsd t0, 0(t3)\n",
+		"\txor t0, t0, t1\n\tseqz t0, t0\n",
+		"\tsltu t0, t0, t1\n",
+		"last:\n\t.zero 8\n",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+}
+
+func TestCodeGenerator_GenerateCode_Variadic(t *testing.T) {
+	code := `
+	int vprintf(void *format, __builtin_va_list ap);
+
+	int print(void *format, ...) {
+		__builtin_va_list ap;
+		__builtin_va_start(ap, format);
+		int n = vprintf(format, ap);
+		__builtin_va_end(ap);
+		return n;
+	}`
+
+	asm := generate(t, code)
+
+	for _, want := range []string{
+		// the register save area precedes the stack arguments
+		"\taddi sp, sp, -80\n",
+		"\tsd a7, -8(s0)\n",
+		"\taddi t0, s0, -56\n\tsd t0, 0(t3)\n",
+		// the va_list is passed by value
+		"\tld a1, 0(a1)\n\tcall vprintf\n",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+}
+
+// TestCodeGenerator_GenerateCode_Execute runs the generated code with
+// qemu. It is skipped if the cross compiler or qemu are missing.
+func TestCodeGenerator_GenerateCode_Execute(t *testing.T) {
+	backendtest.RequireTools(t, "riscv64-linux-gnu-gcc", "qemu-riscv64")
+	asmFile := backendtest.WriteFile(t, "program.s", generate(t, backendtest.ExecuteCode))
+	executable := strings.TrimSuffix(asmFile, ".s")
+	backendtest.Run(t, "riscv64-linux-gnu-gcc", "-static", asmFile, "-o", executable)
+	if got := backendtest.ExitStatus(t, "qemu-riscv64", executable); got != backendtest.ExecuteStatus {
+		t.Errorf("exit status = %d, want %d", got, backendtest.ExecuteStatus)
+	}
+}
+
+func generate(t *testing.T, code string) string {
+	program, _ := backendtest.FrontEnd(t, code)
+	return NewCodeGenerator().GenerateCode(program)
+}
@@ -0,0 +1,169 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Syntax is the assembler syntax the code generator emits
+type Syntax int
+
+const (
+	SyntaxAtt Syntax = iota
+	SyntaxIntel
+)
+
+func (s Syntax) String() string {
+	if s == SyntaxIntel {
+		return "intel"
+	}
+	return "att"
+}
+
+// ParseSyntax returns the syntax with the given name ("att" or "intel")
+func ParseSyntax(name string) (Syntax, error) {
+	switch name {
+	case "att":
+		return SyntaxAtt, nil
+	case "intel":
+		return SyntaxIntel, nil
+	default:
+		return SyntaxAtt, errors.New(fmt.Sprintf("unknown assembler syntax '%s' (att or intel expected)", name))
+	}
+}
+
+// dialect formats instructions and operands. The code generator passes
+// the operands in AT&T order, i.e. the destination last.
+type dialect interface {
+	// header is emitted before the first directive
+	header() []string
+	instruction(mnemonic string, operands ...string) string
+	// sized returns the mnemonic with the operand size, if the dialect
+	// encodes it in the mnemonic
+	sized(mnemonic string, asmType AsmType) string
+	// signExtend is the mnemonic that sign extends a longword to a
+	// quadword
+	signExtend() string
+	register(name string) string
+	immediate(value int) string
+	// memory returns a memory operand of the given size ("" if the
+	// size does not matter like for lea)
+	memory(base string, offset int, size string) string
+	ripRelative(symbol string, size string) string
+	// indirectCall returns the operand of an indirect call
+	indirectCall(operand string) string
+}
+
+func newDialect(syntax Syntax) dialect {
+	if syntax == SyntaxIntel {
+		return &intelDialect{}
+	}
+	return &attDialect{}
+}
+
+type attDialect struct{}
+
+func (d *attDialect) header() []string {
+	return nil
+}
+
+func (d *attDialect) instruction(mnemonic string, operands ...string) string {
+	if len(operands) == 0 {
+		return "\t" + mnemonic
+	}
+	return "\t" + mnemonic + " " + strings.Join(operands, ", ")
+}
+
+func (d *attDialect) sized(mnemonic string, asmType AsmType) string {
+	if asmType == Quadword {
+		return mnemonic + "q"
+	}
+	return mnemonic + "l"
+}
+
+func (d *attDialect) signExtend() string {
+	return "movslq"
+}
+
+func (d *attDialect) register(name string) string {
+	return "%" + name
+}
+
+func (d *attDialect) immediate(value int) string {
+	return fmt.Sprintf("$%d", value)
+}
+
+func (d *attDialect) memory(base string, offset int, _ string) string {
+	return fmt.Sprintf("%d(%%%s)", offset, base)
+}
+
+func (d *attDialect) ripRelative(symbol string, _ string) string {
+	return symbol + "(%rip)"
+}
+
+func (d *attDialect) indirectCall(operand string) string {
+	return "*" + operand
+}
+
+// intelDialect is the syntax of GNU as after ".intel_syntax noprefix":
+// the destination comes first, registers and immediates have no prefix
+// and memory operands carry their size ("DWORD PTR [rbp-4]").
+type intelDialect struct{}
+
+func (d *intelDialect) header() []string {
+	return []string{"\t.intel_syntax noprefix"}
+}
+
+func (d *intelDialect) instruction(mnemonic string, operands ...string) string {
+	if len(operands) == 0 {
+		return "\t" + mnemonic
+	}
+	reversed := make([]string, len(operands))
+	for i, operand := range operands {
+		reversed[len(operands)-1-i] = operand
+	}
+	return "\t" + mnemonic + " " + strings.Join(reversed, ", ")
+}
+
+func (d *intelDialect) sized(mnemonic string, _ AsmType) string {
+	return mnemonic
+}
+
+func (d *intelDialect) signExtend() string {
+	return "movsxd"
+}
+
+func (d *intelDialect) register(name string) string {
+	return name
+}
+
+func (d *intelDialect) immediate(value int) string {
+	return fmt.Sprintf("%d", value)
+}
+
+func (d *intelDialect) memory(base string, offset int, size string) string {
+	address := "[" + base + "]"
+	switch {
+	case offset > 0:
+		address = fmt.Sprintf("[%s+%d]", base, offset)
+	case offset < 0:
+		address = fmt.Sprintf("[%s%d]", base, offset)
+	}
+	return withSize(address, size)
+}
+
+func (d *intelDialect) ripRelative(symbol string, size string) string {
+	return withSize(symbol+"[rip]", size)
+}
+
+func (d *intelDialect) indirectCall(operand string) string {
+	return operand
+}
+
+func withSize(address string, size string) string {
+	if size == "" {
+		return address
+	}
+	return size + " PTR " + address
+}
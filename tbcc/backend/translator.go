@@ -2,6 +2,7 @@ package backend
 
 import (
 	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
 	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/tacky"
 	"math"
 	"slices"
@@ -9,20 +10,67 @@ import (
 
 var argRegisters = []string{RegDI, RegSI, RegDX, RegCX, RegR8, RegR9}
 
-type Translator struct{}
+// Variadic functions save the argument registers in the register save area
+// so that va_arg can fetch the unnamed arguments passed in registers.
+// Vector registers are not saved since floating point types are not supported.
+const (
+	regSaveArea     = "reg_save_area"
+	regSaveAreaSize = 48
+	// fpOffsetLimit is the fp_offset of a va_list that has no
+	// vector registers left
+	fpOffsetLimit = 176
+)
+
+type Translator struct {
+	// numParams is the number of named parameters of the current function
+	numParams    int
+	labelCounter int
+	// staticVars holds the names of the variables with static storage
+	// duration. They are addressed by name instead of living on the stack.
+	staticVars map[string]bool
+	// pic is set for position-independent code, env tells which
+	// symbols may be preempted then
+	pic bool
+	env *frontend.Environment
+}
 
 func NewTranslator() *Translator {
 	return &Translator{}
 }
 
+// NewTranslatorWithPIC creates a translator for position-independent
+// code (-fPIC). The symbols in env are looked up for their linkage and
+// visibility.
+func NewTranslatorWithPIC(env *frontend.Environment) *Translator {
+	return &Translator{pic: true, env: env}
+}
+
 func (t *Translator) Translate(program *tacky.Program) *Program {
+	prog := t.SelectInstructions(program)
+	prog, stackSizes := NewPseudoRegReplacer().Replace(prog)
+	prog = NewInstructionAdapter(stackSizes).Adapt(prog)
+	return prog
+}
+
+// SelectInstructions translates the TACKY program into assembly
+// instructions that still operate on pseudo registers
+func (t *Translator) SelectInstructions(program *tacky.Program) *Program {
+	var staticVars []StaticVariable
+	t.staticVars = make(map[string]bool)
+	for _, staticVar := range program.StaticVars {
+		t.staticVars[staticVar.Ident] = true
+		if staticVar.Defined {
+			staticVars = append(staticVars, *NewStaticVariable(staticVar.Ident, staticVar.Global,
+				frontend.SizeOf(staticVar.Type), frontend.AlignmentOf(staticVar.Type), staticVar.Init))
+		}
+	}
+
 	var funcDefs []FunctionDef
 	for _, fun := range program.Funs {
 		funcDefs = append(funcDefs, *t.translateFunctionDef(fun))
 	}
 	prog := NewProgram(funcDefs)
-	prog, stackSizes := NewPseudoRegReplacer().Replace(prog)
-	prog = NewInstructionAdapter(stackSizes).Adapt(prog)
+	prog.StaticVars = staticVars
 	return prog
 }
 
@@ -32,21 +80,32 @@ func (t *Translator) translateFunctionDef(fun tacky.Function) *FunctionDef {
 
 	numArgRegisters := len(argRegisters)
 	numParams := len(fun.Parameters)
+	t.numParams = numParams
+
+	if fun.Variadic {
+		for i, regName := range argRegisters {
+			instructions = append(instructions,
+				NewMov(Quadword, NewRegister(regName), NewPseudoMem(regSaveArea, regSaveAreaSize, 8*i)))
+		}
+	}
 
 	if numParams <= numArgRegisters {
 		for i, param := range fun.Parameters {
 			regName := argRegisters[i]
-			instructions = append(instructions, NewMov(NewRegister(regName), NewPseudoReg(param)))
+			instructions = append(instructions,
+				NewMov(asmTypeOf(param), NewRegister(regName), t.translateOperand(param)))
 		}
 	} else {
 		for i := 0; i < numArgRegisters; i++ {
 			regName := argRegisters[i]
 			param := fun.Parameters[i]
-			instructions = append(instructions, NewMov(NewRegister(regName), NewPseudoReg(param)))
+			instructions = append(instructions,
+				NewMov(asmTypeOf(param), NewRegister(regName), t.translateOperand(param)))
 		}
 		for i, param := range fun.Parameters[numArgRegisters:] {
 			offset := 8 + (i+1)*8
-			instructions = append(instructions, NewMov(NewStack(offset), NewPseudoReg(param)))
+			instructions = append(instructions,
+				NewMov(asmTypeOf(param), NewStack(offset), t.translateOperand(param)))
 		}
 	}
 
@@ -58,11 +117,124 @@ func (t *Translator) translateFunctionDef(fun tacky.Function) *FunctionDef {
 func (t *Translator) translateAllInstructions(instructions []tacky.Instruction) []Instruction {
 	var result []Instruction
 	for _, instruction := range instructions {
-		result = append(result, t.translateInstructions(instruction)...)
+		if t.pic {
+			result = append(result, t.translateThroughGot(instruction)...)
+		} else {
+			result = append(result, t.translateInstructions(instruction)...)
+		}
 	}
 	return result
 }
 
+// translateThroughGot translates an instruction of position-independent
+// code. Global variables which may be preempted are accessed through
+// their address in the Global Offset Table: they are loaded into
+// temporaries before the instruction and stored back after it.
+func (t *Translator) translateThroughGot(instruction tacky.Instruction) []Instruction {
+	var before, after []tacky.Instruction
+	load := func(value tacky.Value) tacky.Value {
+		variable := t.preemptibleVar(value)
+		if variable == nil {
+			return value
+		}
+		ptr, tmp := t.gotTemporaries(variable)
+		before = append(before, &tacky.GetAddress{Src: variable, Dst: ptr}, &tacky.Load{SrcPtr: ptr, Dst: tmp})
+		return tmp
+	}
+	store := func(value tacky.Value) tacky.Value {
+		variable := t.preemptibleVar(value)
+		if variable == nil {
+			return value
+		}
+		ptr, tmp := t.gotTemporaries(variable)
+		after = append(after, &tacky.GetAddress{Src: variable, Dst: ptr}, &tacky.Store{Src: tmp, DstPtr: ptr})
+		return tmp
+	}
+	loadAll := func(values []tacky.Value) []tacky.Value {
+		var loaded []tacky.Value
+		for _, value := range values {
+			loaded = append(loaded, load(value))
+		}
+		return loaded
+	}
+
+	switch i := instruction.(type) {
+	case *tacky.Return:
+		instruction = &tacky.Return{Val: load(i.Val)}
+	case *tacky.Unary:
+		instruction = &tacky.Unary{Op: i.Op, Src: load(i.Src), Dst: store(i.Dst)}
+	case *tacky.Binary:
+		instruction = &tacky.Binary{Op: i.Op, Src1: load(i.Src1), Src2: load(i.Src2), Dst: store(i.Dst)}
+	case *tacky.Copy:
+		instruction = &tacky.Copy{Src: load(i.Src), Dst: store(i.Dst)}
+	case *tacky.JumpIfZero:
+		instruction = &tacky.JumpIfZero{Condition: load(i.Condition), Target: i.Target}
+	case *tacky.JumpIfNotZero:
+		instruction = &tacky.JumpIfNotZero{Condition: load(i.Condition), Target: i.Target}
+	case *tacky.CompareAndJump:
+		instruction = &tacky.CompareAndJump{Op: i.Op, Src1: load(i.Src1), Src2: load(i.Src2), Target: i.Target}
+	case *tacky.FunctionCall:
+		instruction = &tacky.FunctionCall{Name: i.Name, Args: loadAll(i.Args), Dst: store(i.Dst), Variadic: i.Variadic}
+	case *tacky.IndirectCall:
+		instruction = &tacky.IndirectCall{FunPtr: load(i.FunPtr), Args: loadAll(i.Args), Dst: store(i.Dst),
+			Variadic: i.Variadic}
+	case *tacky.GetAddress:
+		// the address itself is taken from the GOT by the code generator
+		instruction = &tacky.GetAddress{Src: i.Src, Dst: store(i.Dst)}
+	case *tacky.Load:
+		instruction = &tacky.Load{SrcPtr: load(i.SrcPtr), Dst: store(i.Dst)}
+	case *tacky.Store:
+		instruction = &tacky.Store{Src: load(i.Src), DstPtr: load(i.DstPtr)}
+	case *tacky.AddOffset:
+		instruction = &tacky.AddOffset{Ptr: load(i.Ptr), Offset: i.Offset, Dst: store(i.Dst)}
+	case *tacky.SignExtend:
+		instruction = &tacky.SignExtend{Src: load(i.Src), Dst: store(i.Dst)}
+	case *tacky.Truncate:
+		instruction = &tacky.Truncate{Src: load(i.Src), Dst: store(i.Dst)}
+	case *tacky.VaStart:
+		instruction = &tacky.VaStart{VaList: load(i.VaList)}
+	case *tacky.VaArg:
+		instruction = &tacky.VaArg{VaList: load(i.VaList), Dst: store(i.Dst)}
+	}
+
+	var result []Instruction
+	for _, instr := range append(append(before, instruction), after...) {
+		result = append(result, t.translateInstructions(instr)...)
+	}
+	return result
+}
+
+// preemptibleVar returns the variable if value is a scalar global
+// variable that may be preempted, nil otherwise. Structures are always
+// accessed through their address.
+func (t *Translator) preemptibleVar(value tacky.Value) *tacky.Var {
+	variable, ok := value.(*tacky.Var)
+	if !ok || !t.staticVars[variable.Ident] || !isPreemptible(t.env, variable.Ident) {
+		return nil
+	}
+	switch variable.Type.GetTypeId() {
+	case frontend.TypeStruct, frontend.TypeVaList:
+		return nil
+	}
+	return variable
+}
+
+// gotTemporaries creates the variables holding the address and the
+// value of a global variable
+func (t *Translator) gotTemporaries(variable *tacky.Var) (*tacky.Var, *tacky.Var) {
+	ptr := &tacky.Var{Ident: t.createLabelName("got.ptr"), Type: &frontend.PointerInfo{Referenced: variable.Type}}
+	tmp := &tacky.Var{Ident: t.createLabelName("got.value"), Type: variable.Type}
+	return ptr, tmp
+}
+
+// isPreemptible tells whether a symbol may be replaced by a definition
+// in another module of the process. Position-independent code must not
+// bind references to such symbols at link time.
+func isPreemptible(env *frontend.Environment, name string) bool {
+	entry, _ := env.Get(name)
+	return entry != nil && entry.IsExternal() && entry.GetVisibility() == frontend.VisibilityDefault
+}
+
 func (t *Translator) translateInstructions(instruction tacky.Instruction) []Instruction {
 	var result []Instruction
 
@@ -71,10 +243,11 @@ func (t *Translator) translateInstructions(instruction tacky.Instruction) []Inst
 	switch instrType {
 	case tacky.TacReturn:
 		ret := instruction.(*tacky.Return)
-		operand := t.translateOperand(ret.Val)
-		result = append(result,
-			NewMov(operand, NewRegister(RegAX)),
-			NewReturn())
+		if ret.Val != nil {
+			operand := t.translateOperand(ret.Val)
+			result = append(result, NewMov(asmTypeOf(ret.Val), operand, NewRegister(RegAX)))
+		}
+		result = append(result, NewReturn())
 		return result
 	case tacky.TacUnary:
 		unary := instruction.(*tacky.Unary)
@@ -83,12 +256,12 @@ func (t *Translator) translateInstructions(instruction tacky.Instruction) []Inst
 		if unary.Op.GetType() != tacky.TacNot {
 			op := t.translateUnaryOperator(unary.Op)
 			result = append(result,
-				NewMov(src, dst),
-				NewUnary(op, dst))
+				NewMov(Longword, src, dst),
+				NewUnary(Longword, op, dst))
 		} else {
 			result = append(result,
-				NewCmp(NewImmediate(0), src),
-				NewMov(NewImmediate(0), dst),
+				NewCmp(asmTypeOf(unary.Src), NewImmediate(0), src),
+				NewMov(Longword, NewImmediate(0), dst),
 				NewSetCC(CcEq, dst))
 		}
 		return result
@@ -103,8 +276,8 @@ func (t *Translator) translateInstructions(instruction tacky.Instruction) []Inst
 			tacky.TacBitShiftLeft, tacky.TacBitShiftRight:
 			op := t.translateBinaryOperator(binary.Op)
 			result = append(result,
-				NewMov(src1, dst),
-				NewBinary(op, src2, dst))
+				NewMov(Longword, src1, dst),
+				NewBinary(Longword, op, src2, dst))
 			return result
 		case tacky.TacDiv:
 			return t.createIDivInstructions(true, src1, src2, dst)
@@ -124,46 +297,133 @@ func (t *Translator) translateInstructions(instruction tacky.Instruction) []Inst
 		jumpIfZero := instruction.(*tacky.JumpIfZero)
 		cond := t.translateOperand(jumpIfZero.Condition)
 		return []Instruction{
-			NewCmp(NewImmediate(0), cond),
+			NewCmp(asmTypeOf(jumpIfZero.Condition), NewImmediate(0), cond),
 			NewJumpCC(CcEq, jumpIfZero.Target),
 		}
 	case tacky.TacJumpIfNotZero:
 		jumpIfZero := instruction.(*tacky.JumpIfNotZero)
 		cond := t.translateOperand(jumpIfZero.Condition)
 		return []Instruction{
-			NewCmp(NewImmediate(0), cond),
+			NewCmp(asmTypeOf(jumpIfZero.Condition), NewImmediate(0), cond),
 			NewJumpCC(CcNotEq, jumpIfZero.Target),
 		}
+	case tacky.TacCompareAndJump:
+		jump := instruction.(*tacky.CompareAndJump)
+		return []Instruction{
+			t.translateCompare(jump.Src1, jump.Src2),
+			NewJumpCC(relationConditionCode(jump.Op, jump.Src1, jump.Src2), jump.Target),
+		}
 	case tacky.TacCopy:
 		cp := instruction.(*tacky.Copy)
 		src := t.translateOperand(cp.Src)
 		dst := t.translateOperand(cp.Dst)
-		return []Instruction{NewMov(src, dst)}
+		if isAggregate(cp.Dst) {
+			return append([]Instruction{
+				NewLea(src, NewRegister(RegAX)),
+				NewLea(dst, NewRegister(RegDX)),
+			}, copyBytes(frontend.SizeOf(valueTypeOf(cp.Dst)), RegAX, RegDX)...)
+		}
+		return []Instruction{NewMov(asmTypeOf(cp.Dst), src, dst)}
 	case tacky.TacLabel:
 		label := instruction.(*tacky.Label)
 		return []Instruction{NewLabel(label.Name)}
 	case tacky.TacFunCall:
 		funCall := instruction.(*tacky.FunctionCall)
-		return t.translateFunctionCall(funCall)
+		return t.translateFunctionCall(funCall.Args, NewCall(funCall.Name), funCall.Dst,
+			variadicCallSetup(funCall.Variadic)...)
+	case tacky.TacIndirectCall:
+		call := instruction.(*tacky.IndirectCall)
+		// R11 is neither used for arguments nor for pushing them
+		r11 := NewRegister(RegR11)
+		funPtr := t.translateOperand(call.FunPtr)
+		return t.translateFunctionCall(call.Args, NewIndirectCall(r11), call.Dst,
+			append([]Instruction{NewMov(Quadword, funPtr, r11)}, variadicCallSetup(call.Variadic)...)...)
+	case tacky.TacGetAddress:
+		getAddress := instruction.(*tacky.GetAddress)
+		src := t.translateOperand(getAddress.Src)
+		dst := t.translateOperand(getAddress.Dst)
+		return []Instruction{NewLea(src, dst)}
+	case tacky.TacLoad:
+		load := instruction.(*tacky.Load)
+		ptr := t.translateOperand(load.SrcPtr)
+		dst := t.translateOperand(load.Dst)
+		if isAggregate(load.Dst) {
+			return append([]Instruction{
+				NewMov(Quadword, ptr, NewRegister(RegAX)),
+				NewLea(dst, NewRegister(RegDX)),
+			}, copyBytes(frontend.SizeOf(valueTypeOf(load.Dst)), RegAX, RegDX)...)
+		}
+		return []Instruction{
+			NewMov(Quadword, ptr, NewRegister(RegAX)),
+			NewMov(asmTypeOf(load.Dst), NewMemory(RegAX, 0), dst),
+		}
+	case tacky.TacStore:
+		store := instruction.(*tacky.Store)
+		src := t.translateOperand(store.Src)
+		ptr := t.translateOperand(store.DstPtr)
+		// the pointer determines the size (the source may be a null pointer constant)
+		referenced := store.DstPtr.(*tacky.Var).Type.(*frontend.PointerInfo).Referenced
+		if isAggregate(store.Src) {
+			return append([]Instruction{
+				NewMov(Quadword, ptr, NewRegister(RegAX)),
+				NewLea(src, NewRegister(RegDX)),
+			}, copyBytes(frontend.SizeOf(referenced), RegDX, RegAX)...)
+		}
+		return []Instruction{
+			NewMov(Quadword, ptr, NewRegister(RegAX)),
+			NewMov(asmTypeOfType(referenced), src, NewMemory(RegAX, 0)),
+		}
+	case tacky.TacAddOffset:
+		addOffset := instruction.(*tacky.AddOffset)
+		ptr := t.translateOperand(addOffset.Ptr)
+		dst := t.translateOperand(addOffset.Dst)
+		return []Instruction{
+			NewMov(Quadword, ptr, NewRegister(RegAX)),
+			NewLea(NewMemory(RegAX, addOffset.Offset), dst),
+		}
+	case tacky.TacSignExtend:
+		signExtend := instruction.(*tacky.SignExtend)
+		src := t.translateOperand(signExtend.Src)
+		dst := t.translateOperand(signExtend.Dst)
+		return []Instruction{NewMovsx(src, dst)}
+	case tacky.TacTruncate:
+		truncate := instruction.(*tacky.Truncate)
+		src := t.translateOperand(truncate.Src)
+		dst := t.translateOperand(truncate.Dst)
+		return []Instruction{NewMov(Longword, src, dst)}
+	case tacky.TacVaStart:
+		return t.translateVaStart(instruction.(*tacky.VaStart))
+	case tacky.TacVaArg:
+		return t.translateVaArg(instruction.(*tacky.VaArg))
+	case tacky.TacLocation:
+		return []Instruction{NewLocation(instruction.(*tacky.Location).Pos)}
 	default:
 		panic("unsupported instruction type")
 	}
 }
 
-func (t *Translator) translateFunctionCall(funCall *tacky.FunctionCall) []Instruction {
+// translateFunctionCall passes the arguments, executes the call instruction
+// and stores the result in dst (unless it is nil). The instructions in
+// beforeCall are inserted right before the call.
+func (t *Translator) translateFunctionCall(
+	args []tacky.Value,
+	call Instruction,
+	dst tacky.Value,
+	beforeCall ...Instruction,
+) []Instruction {
 	var ret []Instruction
 	var registerArgs []tacky.Value
 	var stackArgs []tacky.Value
 	var stackPadding int
 
 	numRegs := len(argRegisters)
-	numArgs := len(funCall.Args)
+	numArgs := len(args)
 
 	if numArgs <= numRegs {
-		registerArgs = funCall.Args[:numArgs]
+		registerArgs = args[:numArgs]
 	} else {
-		registerArgs = funCall.Args[:numRegs]
-		stackArgs = funCall.Args[numRegs:]
+		registerArgs = args[:numRegs]
+		stackArgs = slices.Clone(args[numRegs:])
 		slices.Reverse(stackArgs)
 	}
 
@@ -175,7 +435,7 @@ func (t *Translator) translateFunctionCall(funCall *tacky.FunctionCall) []Instru
 	// Fill registers with call arguments
 	for i, argValue := range registerArgs {
 		arg := t.translateOperand(argValue)
-		ret = append(ret, NewMov(arg, NewRegister(argRegisters[i])))
+		ret = append(ret, NewMov(asmTypeOf(argValue), arg, NewRegister(argRegisters[i])))
 	}
 
 	ax := NewRegister(RegAX)
@@ -191,12 +451,15 @@ func (t *Translator) translateFunctionCall(funCall *tacky.FunctionCall) []Instru
 			ret = append(ret, NewPush(immediate))
 		} else if register, ok = arg.(*Register); ok {
 			ret = append(ret, NewPush(register))
+		} else if asmTypeOf(argValue) == Quadword {
+			ret = append(ret, NewPush(arg))
 		} else {
-			ret = append(ret, NewMov(arg, ax), NewPush(ax))
+			ret = append(ret, NewMov(Longword, arg, ax), NewPush(ax))
 		}
 	}
 
-	ret = append(ret, NewCall(funCall.Name))
+	ret = append(ret, beforeCall...)
+	ret = append(ret, call)
 
 	// adjust stack pointer
 	bytesToRemove := 8*len(stackArgs) + stackPadding
@@ -204,53 +467,138 @@ func (t *Translator) translateFunctionCall(funCall *tacky.FunctionCall) []Instru
 		ret = append(ret, NewDeAllocStack(bytesToRemove))
 	}
 
-	// Set result
-	dst := t.translateOperand(funCall.Dst)
-	ret = append(ret, NewMov(ax, dst))
+	// Set result (unless the function returns void)
+	if dst != nil {
+		ret = append(ret, NewMov(asmTypeOf(dst), ax, t.translateOperand(dst)))
+	}
 
 	return ret
 }
 
+// variadicCallSetup passes the number of vector registers used for
+// arguments in AL, which is always 0 since there are no floating point types
+func variadicCallSetup(variadic bool) []Instruction {
+	if !variadic {
+		return nil
+	}
+	return []Instruction{NewMov(Longword, NewImmediate(0), NewRegister(RegAX))}
+}
+
+// translateVaStart initializes the va_list
+//
+//	struct { int gp_offset; int fp_offset; void *overflow_arg_area; void *reg_save_area; }
+//
+// so that the next argument is the first one after the named parameters
+func (t *Translator) translateVaStart(vaStart *tacky.VaStart) []Instruction {
+	numArgRegisters := len(argRegisters)
+	gpOffset := 8 * min(t.numParams, numArgRegisters)
+	overflowArgArea := 16 + 8*max(t.numParams-numArgRegisters, 0)
+
+	return []Instruction{
+		NewMov(Quadword, t.translateOperand(vaStart.VaList), NewRegister(RegAX)),
+		NewMov(Longword, NewImmediate(gpOffset), NewMemory(RegAX, 0)),
+		NewMov(Longword, NewImmediate(fpOffsetLimit), NewMemory(RegAX, 4)),
+		NewLea(NewStack(overflowArgArea), NewMemory(RegAX, 8)),
+		NewLea(NewPseudoMem(regSaveArea, regSaveAreaSize, 0), NewMemory(RegAX, 16)),
+	}
+}
+
+// translateVaArg fetches the next argument from the register save area
+// as long as gp_offset is below its size and from the overflow area otherwise
+func (t *Translator) translateVaArg(vaArg *tacky.VaArg) []Instruction {
+	overflowLabel := t.createLabelName("va_arg.overflow")
+	endLabel := t.createLabelName("va_arg.end")
+	ax := NewRegister(RegAX)
+	r10 := NewRegister(RegR10)
+	r11 := NewRegister(RegR11)
+
+	return []Instruction{
+		NewMov(Quadword, t.translateOperand(vaArg.VaList), ax),
+		NewMov(Longword, NewMemory(RegAX, 0), r10),
+		NewCmp(Longword, NewImmediate(regSaveAreaSize), r10),
+		NewJumpCC(CcGtEq, overflowLabel),
+		// address in the register save area
+		NewMov(Quadword, NewMemory(RegAX, 16), r11),
+		NewBinary(Quadword, NewAdd(), r10, r11),
+		NewBinary(Longword, NewAdd(), NewImmediate(8), NewMemory(RegAX, 0)),
+		NewJump(endLabel),
+		NewLabel(overflowLabel),
+		// address in the overflow area (every argument takes 8 bytes)
+		NewMov(Quadword, NewMemory(RegAX, 8), r11),
+		NewBinary(Quadword, NewAdd(), NewImmediate(8), NewMemory(RegAX, 8)),
+		NewLabel(endLabel),
+		NewMov(asmTypeOf(vaArg.Dst), NewMemory(RegR11, 0), t.translateOperand(vaArg.Dst)),
+	}
+}
+
+func (t *Translator) createLabelName(prefix string) string {
+	name := fmt.Sprintf("%s.%d", prefix, t.labelCounter)
+	t.labelCounter++
+	return name
+}
+
 func (t *Translator) translateRelation(binary *tacky.Binary) []Instruction {
-	src1 := t.translateOperand(binary.Src1)
-	src2 := t.translateOperand(binary.Src2)
 	dst := t.translateOperand(binary.Dst)
-	result := []Instruction{
-		NewCmp(src2, src1), // order of operands switched!
-		NewMov(NewImmediate(0), dst),
+	return []Instruction{
+		t.translateCompare(binary.Src1, binary.Src2),
+		NewMov(Longword, NewImmediate(0), dst),
+		NewSetCC(relationConditionCode(binary.Op, binary.Src1, binary.Src2), dst),
+	}
+}
+
+// translateCompare compares the operands of a relation "src1 op src2"
+func (t *Translator) translateCompare(src1, src2 tacky.Value) Instruction {
+	cmpType := asmTypeOf(src1)
+	if asmTypeOf(src2) == Quadword {
+		cmpType = Quadword
 	}
-	var conditionCode ConditionCode
-	switch binary.Op.GetType() {
+	// order of operands switched!
+	return NewCmp(cmpType, t.translateOperand(src2), t.translateOperand(src1))
+}
+
+// relationConditionCode returns the condition code of a relation.
+// Pointers are compared as unsigned values.
+func relationConditionCode(op tacky.BinaryOp, src1, src2 tacky.Value) ConditionCode {
+	unsigned := frontend.IsPointer(valueTypeOf(src1)) || frontend.IsPointer(valueTypeOf(src2))
+	switch op.GetType() {
 	case tacky.TacEq:
-		conditionCode = CcEq
+		return CcEq
 	case tacky.TacNotEq:
-		conditionCode = CcNotEq
+		return CcNotEq
 	case tacky.TacGt:
-		conditionCode = CcGt
+		if unsigned {
+			return CcAbove
+		}
+		return CcGt
 	case tacky.TacGtEq:
-		conditionCode = CcGtEq
+		if unsigned {
+			return CcAboveEq
+		}
+		return CcGtEq
 	case tacky.TacLt:
-		conditionCode = CcLt
+		if unsigned {
+			return CcBelow
+		}
+		return CcLt
 	case tacky.TacLtEq:
-		conditionCode = CcLtEq
+		if unsigned {
+			return CcBelowEq
+		}
+		return CcLtEq
 	default:
-		panic(fmt.Sprintf("unsupported relation type: %v", binary.Op.GetType()))
+		panic(fmt.Sprintf("unsupported relation type: %v", op.GetType()))
 	}
-
-	result = append(result, NewSetCC(conditionCode, dst))
-
-	return result
 }
 
 func (t *Translator) createIDivInstructions(calcQuotient bool, src1, src2, dst Operand) []Instruction {
 	var result []Instruction
-	result = append(result, NewMov(src1, NewRegister(RegAX)))
-	result = append(result, NewCdq())
-	result = append(result, NewIDiv(src2))
+	result = append(result, NewMov(Longword, src1, NewRegister(RegAX)))
+	result = append(result, NewCdq(Longword))
+	result = append(result, NewIDiv(Longword, src2))
 	if calcQuotient {
-		result = append(result, NewMov(NewRegister(RegAX), dst))
+		result = append(result, NewMov(Longword, NewRegister(RegAX), dst))
 	} else {
-		result = append(result, NewMov(NewRegister(RegDX), dst))
+		result = append(result, NewMov(Longword, NewRegister(RegDX), dst))
 	}
 	return result
 }
@@ -262,12 +610,66 @@ func (t *Translator) translateOperand(value tacky.Value) Operand {
 		return NewImmediate(intLiteral.Val)
 	case tacky.TacVar:
 		variable := value.(*tacky.Var)
-		return NewPseudoReg(variable.Ident)
+		if t.staticVars[variable.Ident] {
+			return NewData(variable.Ident)
+		}
+		switch variable.Type.GetTypeId() {
+		case frontend.TypeFunc:
+			return NewData(variable.Ident)
+		case frontend.TypeVaList, frontend.TypeStruct:
+			return NewPseudoMem(variable.Ident, frontend.SizeOf(variable.Type), 0)
+		}
+		return NewPseudoReg(variable.Ident, asmTypeOf(variable))
 	default:
 		panic("unsupported value type")
 	}
 }
 
+// copyBytes copies size bytes from the memory src points to to the
+// memory dst points to
+func copyBytes(size int, src, dst string) []Instruction {
+	var instructions []Instruction
+	offset := 0
+	for ; offset+8 <= size; offset += 8 {
+		instructions = append(instructions,
+			NewMov(Quadword, NewMemory(src, offset), NewMemory(dst, offset)))
+	}
+	// structures with named members have a size that is a multiple of 4.
+	// The other ones only consist of padding which need not be copied.
+	if offset+4 <= size {
+		instructions = append(instructions,
+			NewMov(Longword, NewMemory(src, offset), NewMemory(dst, offset)))
+	}
+	return instructions
+}
+
+// isAggregate tells whether the value is a structure or union that has
+// to be copied byte by byte
+func isAggregate(value tacky.Value) bool {
+	return valueTypeOf(value).GetTypeId() == frontend.TypeStruct
+}
+
+func valueTypeOf(value tacky.Value) frontend.TypeInfo {
+	if variable, ok := value.(*tacky.Var); ok {
+		return variable.Type
+	}
+	return &frontend.IntInfo{}
+}
+
+func asmTypeOf(value tacky.Value) AsmType {
+	if variable, ok := value.(*tacky.Var); ok {
+		return asmTypeOfType(variable.Type)
+	}
+	return Longword
+}
+
+func asmTypeOfType(typeInfo frontend.TypeInfo) AsmType {
+	if frontend.SizeOf(typeInfo) == 8 {
+		return Quadword
+	}
+	return Longword
+}
+
 func (t *Translator) translateUnaryOperator(op tacky.UnaryOp) UnaryOp {
 	switch op.GetType() {
 	case tacky.TacComplement:
@@ -302,12 +704,13 @@ func (t *Translator) translateBinaryOperator(op tacky.BinaryOp) BinaryOp {
 	}
 }
 
-type varOffsetsPerFunc map[string]int
+// VarOffsets are the offsets of the variables of a function relative to %rbp
+type VarOffsets map[string]int
 
 type PseudoRegReplacer struct {
-	varSizeByte  int
 	currFunction string
-	varOffsets   map[string]varOffsetsPerFunc
+	varOffsets   map[string]VarOffsets
+	stackSizes   VarSizesPerFunc
 	result       any
 }
 
@@ -320,16 +723,18 @@ type VarSizesPerFunc map[string]int
 func (pr *PseudoRegReplacer) Replace(p *Program) (*Program, VarSizesPerFunc) {
 	pr.initialize()
 	prog := pr.eval(p).(*Program)
-	sizes := make(VarSizesPerFunc)
-	for fn, offsets := range pr.varOffsets {
-		sizes[fn] = len(offsets) * pr.varSizeByte
-	}
-	return prog, sizes
+	return prog, pr.stackSizes
+}
+
+// Offsets returns the offsets assigned by the last call of Replace
+// per function
+func (pr *PseudoRegReplacer) Offsets() map[string]VarOffsets {
+	return pr.varOffsets
 }
 
 func (pr *PseudoRegReplacer) initialize() {
-	pr.varSizeByte = 4
-	pr.varOffsets = make(map[string]varOffsetsPerFunc)
+	pr.varOffsets = make(map[string]VarOffsets)
+	pr.stackSizes = make(VarSizesPerFunc)
 	pr.result = nil
 }
 
@@ -339,13 +744,18 @@ func (pr *PseudoRegReplacer) VisitProgram(p *Program) {
 		newFuncDef := pr.eval(&fun).(*FunctionDef)
 		newFuncDefs = append(newFuncDefs, *newFuncDef)
 	}
-	pr.result = &Program{newFuncDefs}
+	pr.result = &Program{newFuncDefs, p.StaticVars}
+}
+
+func (pr *PseudoRegReplacer) VisitStaticVariable(s *StaticVariable) {
+	pr.result = s
 }
 
 func (pr *PseudoRegReplacer) VisitFunctionDef(f *FunctionDef) {
 	var instructions []Instruction
 	pr.currFunction = f.Name
-	pr.varOffsets[f.Name] = make(varOffsetsPerFunc)
+	pr.varOffsets[f.Name] = make(VarOffsets)
+	pr.stackSizes[f.Name] = 0
 	for _, instruction := range f.Instructions {
 		instructions = append(instructions, pr.eval(instruction).(Instruction))
 	}
@@ -356,29 +766,41 @@ func (pr *PseudoRegReplacer) VisitFunctionDef(f *FunctionDef) {
 func (pr *PseudoRegReplacer) VisitMov(m *Mov) {
 	src := pr.eval(m.Src).(Operand)
 	dst := pr.eval(m.Dst).(Operand)
-	pr.result = &Mov{src, dst}
+	pr.result = &Mov{m.Type, src, dst}
+}
+
+func (pr *PseudoRegReplacer) VisitMovsx(m *Movsx) {
+	src := pr.eval(m.Src).(Operand)
+	dst := pr.eval(m.Dst).(Operand)
+	pr.result = &Movsx{src, dst}
+}
+
+func (pr *PseudoRegReplacer) VisitLea(l *Lea) {
+	src := pr.eval(l.Src).(Operand)
+	dst := pr.eval(l.Dst).(Operand)
+	pr.result = &Lea{src, dst}
 }
 
 func (pr *PseudoRegReplacer) VisitUnary(u *Unary) {
 	operand := pr.eval(u.Operand).(Operand)
-	pr.result = &Unary{u.Op, operand}
+	pr.result = &Unary{u.Type, u.Op, operand}
 }
 
 func (pr *PseudoRegReplacer) VisitBinary(b *Binary) {
 	operand1 := pr.eval(b.Operand1).(Operand)
 	operand2 := pr.eval(b.Operand2).(Operand)
-	pr.result = &Binary{b.Op, operand1, operand2}
+	pr.result = &Binary{b.Type, b.Op, operand1, operand2}
 }
 
 func (pr *PseudoRegReplacer) VisitCmp(c *Cmp) {
 	left := pr.eval(c.Left).(Operand)
 	right := pr.eval(c.Right).(Operand)
-	pr.result = NewCmp(left, right)
+	pr.result = NewCmp(c.Type, left, right)
 }
 
 func (pr *PseudoRegReplacer) VisitIDiv(i *IDiv) {
 	operand := pr.eval(i.Operand).(Operand)
-	pr.result = &IDiv{operand}
+	pr.result = &IDiv{i.Type, operand}
 }
 
 func (pr *PseudoRegReplacer) VisitCdq(c *Cdq) {
@@ -402,6 +824,10 @@ func (pr *PseudoRegReplacer) VisitLabel(l *Label) {
 	pr.result = l
 }
 
+func (pr *PseudoRegReplacer) VisitLocation(l *Location) {
+	pr.result = l
+}
+
 func (pr *PseudoRegReplacer) VisitAllocStack(a *AllocStack) {
 	pr.result = a
 }
@@ -419,6 +845,11 @@ func (pr *PseudoRegReplacer) VisitCall(c *Call) {
 	pr.result = c
 }
 
+func (pr *PseudoRegReplacer) VisitIndirectCall(i *IndirectCall) {
+	operand := pr.eval(i.Operand).(Operand)
+	pr.result = NewIndirectCall(operand)
+}
+
 func (pr *PseudoRegReplacer) VisitReturn() {
 	pr.result = &Return{}
 }
@@ -459,18 +890,45 @@ func (pr *PseudoRegReplacer) VisitPseudoReg(p *PseudoReg) {
 	varOffsets := pr.varOffsets[pr.currFunction]
 	offset, ok := varOffsets[p.Ident]
 	if !ok {
-		numVars := len(varOffsets)
-		numVars++
-		offset = -numVars * pr.varSizeByte
-		pr.varOffsets[pr.currFunction][p.Ident] = offset
+		size := pr.stackSizes[pr.currFunction]
+		if p.Type == Quadword {
+			size += 8
+			size = (size + 7) / 8 * 8 // quadwords are 8-byte aligned
+		} else {
+			size += 4
+		}
+		pr.stackSizes[pr.currFunction] = size
+		offset = -size
+		varOffsets[p.Ident] = offset
 	}
 	pr.result = NewStack(offset)
 }
 
+func (pr *PseudoRegReplacer) VisitPseudoMem(p *PseudoMem) {
+	varOffsets := pr.varOffsets[pr.currFunction]
+	offset, ok := varOffsets[p.Ident]
+	if !ok {
+		size := pr.stackSizes[pr.currFunction] + p.Size
+		size = (size + 7) / 8 * 8
+		pr.stackSizes[pr.currFunction] = size
+		offset = -size
+		varOffsets[p.Ident] = offset
+	}
+	pr.result = NewStack(offset + p.Offset)
+}
+
 func (pr *PseudoRegReplacer) VisitStack(s *Stack) {
 	pr.result = s
 }
 
+func (pr *PseudoRegReplacer) VisitMemory(m *Memory) {
+	pr.result = m
+}
+
+func (pr *PseudoRegReplacer) VisitData(d *Data) {
+	pr.result = d
+}
+
 func (pr *PseudoRegReplacer) eval(ast AST) any {
 	ast.Accept(pr)
 	return pr.result
@@ -495,8 +953,11 @@ func (ia *InstructionAdapter) VisitProgram(p *Program) {
 		newFuncDef := ia.eval(&fun).(*FunctionDef)
 		newFuncDefs = append(newFuncDefs, *newFuncDef)
 	}
-	ia.result = &Program{newFuncDefs}
+	ia.result = &Program{newFuncDefs, p.StaticVars}
+}
 
+func (ia *InstructionAdapter) VisitStaticVariable(s *StaticVariable) {
+	ia.result = s
 }
 
 func (ia *InstructionAdapter) VisitFunctionDef(f *FunctionDef) {
@@ -511,17 +972,47 @@ func (ia *InstructionAdapter) VisitFunctionDef(f *FunctionDef) {
 }
 
 func (ia *InstructionAdapter) VisitMov(m *Mov) {
-	if m.Src.GetType() == AsmStack && m.Dst.GetType() == AsmStack {
+	if isMemory(m.Src) && isMemory(m.Dst) {
 		r10 := NewRegister(RegR10)
 		ia.result = []Instruction{
-			&Mov{m.Src, r10},
-			&Mov{r10, m.Dst},
+			&Mov{m.Type, m.Src, r10},
+			&Mov{m.Type, r10, m.Dst},
 		}
 	} else {
 		ia.result = []Instruction{m}
 	}
 }
 
+func (ia *InstructionAdapter) VisitMovsx(m *Movsx) {
+	src := m.Src
+	var instructions []Instruction
+	if src.GetType() == AsmImmediate {
+		src = NewRegister(RegR10)
+		instructions = append(instructions, NewMov(Longword, m.Src, src))
+	}
+	if isMemory(m.Dst) {
+		r11 := NewRegister(RegR11)
+		instructions = append(instructions,
+			NewMovsx(src, r11),
+			NewMov(Quadword, r11, m.Dst))
+	} else {
+		instructions = append(instructions, NewMovsx(src, m.Dst))
+	}
+	ia.result = instructions
+}
+
+func (ia *InstructionAdapter) VisitLea(l *Lea) {
+	if isMemory(l.Dst) {
+		r11 := NewRegister(RegR11)
+		ia.result = []Instruction{
+			NewLea(l.Src, r11),
+			NewMov(Quadword, r11, l.Dst),
+		}
+	} else {
+		ia.result = []Instruction{l}
+	}
+}
+
 func (ia *InstructionAdapter) VisitUnary(u *Unary) {
 	ia.result = []Instruction{u}
 }
@@ -529,39 +1020,39 @@ func (ia *InstructionAdapter) VisitUnary(u *Unary) {
 func (ia *InstructionAdapter) VisitBinary(b *Binary) {
 	switch b.Op.GetType() {
 	case AsmAdd, AsmSub, AsmBitAnd, AsmBitOr, AsmBitXor:
-		if b.Operand1.GetType() == AsmStack && b.Operand2.GetType() == AsmStack {
+		if isMemory(b.Operand1) && isMemory(b.Operand2) {
 			r10 := NewRegister(RegR10)
 			ia.result = []Instruction{
-				NewMov(b.Operand1, r10),
-				NewBinary(b.Op, r10, b.Operand2),
+				NewMov(b.Type, b.Operand1, r10),
+				NewBinary(b.Type, b.Op, r10, b.Operand2),
 			}
 		} else if b.Operand2.GetType() == AsmImmediate {
 			r11 := NewRegister(RegR11)
 			ia.result = []Instruction{
-				NewMov(b.Operand2, r11),
-				NewBinary(b.Op, b.Operand1, r11),
+				NewMov(b.Type, b.Operand2, r11),
+				NewBinary(b.Type, b.Op, b.Operand1, r11),
 			}
 		} else {
 			ia.result = []Instruction{b}
 		}
 	case AsmBitShiftLeft, AsmBitShiftRight:
-		if b.Operand1.GetType() == AsmStack {
+		if isMemory(b.Operand1) {
 			cx := NewRegister(RegCX)
 			ia.result = []Instruction{
-				NewMov(b.Operand1, cx),
-				NewBinary(b.Op, cx, b.Operand2),
-				NewMov(cx, b.Operand1),
+				NewMov(b.Type, b.Operand1, cx),
+				NewBinary(b.Type, b.Op, cx, b.Operand2),
+				NewMov(b.Type, cx, b.Operand1),
 			}
 		} else {
 			ia.result = []Instruction{b}
 		}
 	case AsmMul:
-		if b.Operand2.GetType() == AsmStack {
+		if isMemory(b.Operand2) {
 			r11 := NewRegister(RegR11)
 			ia.result = []Instruction{
-				NewMov(b.Operand2, r11),
-				NewBinary(b.Op, b.Operand1, r11),
-				NewMov(r11, b.Operand2),
+				NewMov(b.Type, b.Operand2, r11),
+				NewBinary(b.Type, b.Op, b.Operand1, r11),
+				NewMov(b.Type, r11, b.Operand2),
 			}
 		} else {
 			ia.result = []Instruction{b}
@@ -572,20 +1063,17 @@ func (ia *InstructionAdapter) VisitBinary(b *Binary) {
 }
 
 func (ia *InstructionAdapter) VisitCmp(c *Cmp) {
-	leftType := c.Left.GetType()
-	rightType := c.Right.GetType()
-
-	if leftType == AsmStack && rightType == AsmStack {
+	if isMemory(c.Left) && isMemory(c.Right) {
 		r10 := NewRegister(RegR10)
 		ia.result = []Instruction{
-			NewMov(c.Left, r10),
-			NewCmp(r10, c.Right),
+			NewMov(c.Type, c.Left, r10),
+			NewCmp(c.Type, r10, c.Right),
 		}
-	} else if rightType == AsmImmediate {
+	} else if c.Right.GetType() == AsmImmediate {
 		r11 := NewRegister(RegR11)
 		ia.result = []Instruction{
-			NewMov(c.Right, r11),
-			NewCmp(c.Left, r11),
+			NewMov(c.Type, c.Right, r11),
+			NewCmp(c.Type, c.Left, r11),
 		}
 	} else {
 		ia.result = []Instruction{c}
@@ -596,8 +1084,8 @@ func (ia *InstructionAdapter) VisitIDiv(i *IDiv) {
 	if i.Operand.GetType() == AsmImmediate {
 		r10 := NewRegister(RegR10)
 		ia.result = []Instruction{
-			NewMov(i.Operand, r10),
-			NewIDiv(r10),
+			NewMov(i.Type, i.Operand, r10),
+			NewIDiv(i.Type, r10),
 		}
 	} else {
 		ia.result = []Instruction{i}
@@ -624,6 +1112,10 @@ func (ia *InstructionAdapter) VisitLabel(l *Label) {
 	ia.result = []Instruction{l}
 }
 
+func (ia *InstructionAdapter) VisitLocation(l *Location) {
+	ia.result = []Instruction{l}
+}
+
 func (ia *InstructionAdapter) VisitAllocStack(a *AllocStack) {
 	ia.result = []Instruction{a}
 }
@@ -640,6 +1132,10 @@ func (ia *InstructionAdapter) VisitCall(c *Call) {
 	ia.result = []Instruction{c}
 }
 
+func (ia *InstructionAdapter) VisitIndirectCall(i *IndirectCall) {
+	ia.result = []Instruction{i}
+}
+
 func (ia *InstructionAdapter) VisitReturn() {
 	ia.result = []Instruction{&Return{}}
 }
@@ -680,10 +1176,22 @@ func (ia *InstructionAdapter) VisitPseudoReg(p *PseudoReg) {
 	ia.result = p
 }
 
+func (ia *InstructionAdapter) VisitPseudoMem(p *PseudoMem) {
+	ia.result = p
+}
+
 func (ia *InstructionAdapter) VisitStack(s *Stack) {
 	ia.result = s
 }
 
+func (ia *InstructionAdapter) VisitMemory(m *Memory) {
+	ia.result = m
+}
+
+func (ia *InstructionAdapter) VisitData(d *Data) {
+	ia.result = d
+}
+
 func (ia *InstructionAdapter) eval(ast AST) any {
 	ast.Accept(ia)
 	return ia.result
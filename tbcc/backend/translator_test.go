@@ -14,6 +14,7 @@ int main(void) {
 	tokens, _ := frontend.Tokenize(code)
 	program, _ := frontend.NewParser(tokens).ParseProgram()
 	nameCreator := frontend.NewNameCreator()
+	program, _, _ = frontend.AnalyzeSemantics(program, nameCreator)
 	tackyProgram := tacky.NewTranslator(nameCreator).Translate(program)
 
 	translator := NewTranslator()
@@ -30,6 +31,7 @@ int main(void) {
 	tokens, _ := frontend.Tokenize(code)
 	program, _ := frontend.NewParser(tokens).ParseProgram()
 	nameCreator := frontend.NewNameCreator()
+	program, _, _ = frontend.AnalyzeSemantics(program, nameCreator)
 	tackyProgram := tacky.NewTranslator(nameCreator).Translate(program)
 
 	translator := NewTranslator()
@@ -46,6 +48,7 @@ int main(void) {
 	tokens, _ := frontend.Tokenize(code)
 	program, _ := frontend.NewParser(tokens).ParseProgram()
 	nameCreator := frontend.NewNameCreator()
+	program, _, _ = frontend.AnalyzeSemantics(program, nameCreator)
 	tackyProgram := tacky.NewTranslator(nameCreator).Translate(program)
 
 	translator := NewTranslator()
@@ -0,0 +1,187 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Verify checks that the program only contains legal x86-64 operand
+// combinations. It is meant to be run on the output of the
+// InstructionAdapter:
+//   - no pseudo registers or pseudo memory operands are left
+//   - instructions do not have two memory operands
+//   - destinations are not immediate values
+//   - IDiv does not operate on an immediate value
+//   - Movsx and Lea have register destinations
+//   - indirect calls go through a register
+//   - the stack is 16-byte aligned at every Call
+func Verify(program *Program) error {
+	var errorList []error
+	for i := range program.FuncDefs {
+		errorList = append(errorList, verifyFunctionDef(&program.FuncDefs[i])...)
+	}
+	return errors.Join(errorList...)
+}
+
+func verifyFunctionDef(f *FunctionDef) []error {
+	var errorList []error
+	addError := func(idx int, message string) {
+		errorList = append(errorList,
+			errors.New(fmt.Sprintf("%s: instruction %d: %s", f.Name, idx, message)))
+	}
+
+	// After "pushq %rbp" the stack pointer is 16-byte aligned
+	stackOffset := 0
+
+	for idx, instr := range f.Instructions {
+		for _, operand := range operandsOf(instr) {
+			switch operand.GetType() {
+			case AsmPseudoReg:
+				addError(idx, fmt.Sprintf("pseudo register %s has not been replaced",
+					operand.(*PseudoReg).Ident))
+			case AsmPseudoMem:
+				addError(idx, fmt.Sprintf("pseudo memory operand %s has not been replaced",
+					operand.(*PseudoMem).Ident))
+			}
+		}
+
+		switch instr.GetType() {
+		case AsmMov:
+			mov := instr.(*Mov)
+			if isMemory(mov.Src) && isMemory(mov.Dst) {
+				addError(idx, "mov with two memory operands")
+			}
+			if mov.Dst.GetType() == AsmImmediate {
+				addError(idx, "mov to an immediate value")
+			}
+		case AsmMovsx:
+			movsx := instr.(*Movsx)
+			if movsx.Src.GetType() == AsmImmediate {
+				addError(idx, "movsx from an immediate value")
+			}
+			if isMemory(movsx.Dst) {
+				addError(idx, "movsx with a memory destination")
+			}
+		case AsmLea:
+			lea := instr.(*Lea)
+			if !isMemory(lea.Src) {
+				addError(idx, "lea source must be a memory operand")
+			}
+			if isMemory(lea.Dst) {
+				addError(idx, "lea with a memory destination")
+			}
+		case AsmUnary:
+			if instr.(*Unary).Operand.GetType() == AsmImmediate {
+				addError(idx, "unary operation on an immediate value")
+			}
+		case AsmBinary:
+			binary := instr.(*Binary)
+			if binary.Operand2.GetType() == AsmImmediate {
+				addError(idx, "binary operation with an immediate destination")
+			}
+			switch binary.Op.GetType() {
+			case AsmMul:
+				if isMemory(binary.Operand2) {
+					addError(idx, "imul with a memory destination")
+				}
+			case AsmBitShiftLeft, AsmBitShiftRight:
+				if !isImmediateOrReg(binary.Operand1, RegCX) {
+					addError(idx, "shift count must be an immediate value or CX")
+				}
+			default:
+				if isMemory(binary.Operand1) && isMemory(binary.Operand2) {
+					addError(idx, "binary operation with two memory operands")
+				}
+			}
+		case AsmCmp:
+			cmp := instr.(*Cmp)
+			if isMemory(cmp.Left) && isMemory(cmp.Right) {
+				addError(idx, "cmp with two memory operands")
+			}
+			if cmp.Right.GetType() == AsmImmediate {
+				addError(idx, "cmp with an immediate second operand")
+			}
+		case AsmIDiv:
+			if instr.(*IDiv).Operand.GetType() == AsmImmediate {
+				addError(idx, "idiv on an immediate value")
+			}
+		case AsmSetCC:
+			if instr.(*SetCC).Op.GetType() == AsmImmediate {
+				addError(idx, "setcc with an immediate destination")
+			}
+		case AsmAllocStack:
+			stackOffset += instr.(*AllocStack).N
+		case AsmDeAllocStack:
+			stackOffset -= instr.(*DeAllocStack).N
+		case AsmPush:
+			stackOffset += 8
+		case AsmCall:
+			if stackOffset%16 != 0 {
+				addError(idx, fmt.Sprintf("stack is not 16-byte aligned at call of %s",
+					instr.(*Call).Identifier))
+			}
+		case AsmIndirectCall:
+			if instr.(*IndirectCall).Operand.GetType() != AsmRegister {
+				addError(idx, "indirect call through a non-register operand")
+			}
+			if stackOffset%16 != 0 {
+				addError(idx, "stack is not 16-byte aligned at indirect call")
+			}
+		default:
+		}
+	}
+
+	return errorList
+}
+
+func operandsOf(instr Instruction) []Operand {
+	switch instr.GetType() {
+	case AsmMov:
+		mov := instr.(*Mov)
+		return []Operand{mov.Src, mov.Dst}
+	case AsmMovsx:
+		movsx := instr.(*Movsx)
+		return []Operand{movsx.Src, movsx.Dst}
+	case AsmLea:
+		lea := instr.(*Lea)
+		return []Operand{lea.Src, lea.Dst}
+	case AsmUnary:
+		return []Operand{instr.(*Unary).Operand}
+	case AsmBinary:
+		binary := instr.(*Binary)
+		return []Operand{binary.Operand1, binary.Operand2}
+	case AsmCmp:
+		cmp := instr.(*Cmp)
+		return []Operand{cmp.Left, cmp.Right}
+	case AsmIDiv:
+		return []Operand{instr.(*IDiv).Operand}
+	case AsmSetCC:
+		return []Operand{instr.(*SetCC).Op}
+	case AsmPush:
+		return []Operand{instr.(*Push).Op}
+	case AsmIndirectCall:
+		return []Operand{instr.(*IndirectCall).Operand}
+	default:
+		return nil
+	}
+}
+
+func isMemory(operand Operand) bool {
+	switch operand.GetType() {
+	case AsmStack, AsmMemory, AsmData, AsmPseudoMem:
+		return true
+	default:
+		return false
+	}
+}
+
+func isImmediateOrReg(operand Operand, regName string) bool {
+	switch operand.GetType() {
+	case AsmImmediate:
+		return true
+	case AsmRegister:
+		return operand.(*Register).Name == regName
+	default:
+		return false
+	}
+}
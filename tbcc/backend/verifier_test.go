@@ -0,0 +1,45 @@
+package backend
+
+import (
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	code := `
+	int mult_many(int a, int b, int c, int d, int e, int f, int g) {
+		return a * g / c % d;
+	}
+
+	int main(void) {
+		int x = 3;
+		return mult_many(1, 2, 3, 4, 5, 6, 7) + (x << 2) + (x > 1);
+	}`
+
+	program, _ := codeToAsm(t, code)
+	err := Verify(program)
+	if err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestVerify_Errors(t *testing.T) {
+	tests := []struct {
+		name         string
+		instructions []Instruction
+	}{
+		{"pseudo register", []Instruction{NewMov(Longword, NewImmediate(1), NewPseudoReg("a", Longword))}},
+		{"memory to memory", []Instruction{NewMov(Longword, NewStack(-4), NewStack(-8))}},
+		{"immediate destination", []Instruction{NewMov(Longword, NewRegister(RegAX), NewImmediate(1))}},
+		{"idiv on immediate", []Instruction{NewCdq(Longword), NewIDiv(Longword, NewImmediate(2))}},
+		{"unaligned call", []Instruction{NewAllocStack(8), NewCall("foo")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := NewProgram([]FunctionDef{*NewFunctionDef("main", tt.instructions)})
+			err := Verify(program)
+			if err == nil {
+				t.Errorf("Verify() should have returned an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,812 @@
+// Package wasm translates TACKY programs to a WebAssembly module in text
+// format (.wat). Values are i32; pointers are addresses in the linear
+// memory. Variables whose address is taken live in a frame on a shadow
+// stack, the others in wasm locals.
+//
+// Variadic functions receive their unnamed arguments in a buffer in the
+// linear memory, a va_list points into it (the convention of clang for
+// wasm32). Functions called but not defined are imported from the module
+// "env", global variables declared but not defined are imported as
+// globals holding their address.
+package wasm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/tacky"
+	"sort"
+	"strings"
+)
+
+const (
+	// the static variables start above the null page
+	dataStart = 1024
+	stackSize = 64 * 1024
+	pageSize  = 64 * 1024
+	// every unnamed argument takes one i32 in the argument buffer
+	varargSize = 4
+	vaListSize = 4
+	// TACKY passes va_lists by address, the wasm convention by value.
+	// A parameter of type va_list is copied to a frame slot with this
+	// suffix, which the parameter then points to.
+	vaListCopySuffix = ".va_list"
+
+	stackPointer  = "$__stack_pointer"
+	framePointer  = "$__fp"
+	varargs       = "$__varargs"
+	dispatchLabel = "$__label"
+)
+
+type CodeGenerator struct {
+	globalEnv *frontend.Environment
+	code      strings.Builder
+	indent    int
+	// addresses of the static variables defined in the program
+	staticAddresses map[string]int
+	externVars      map[string]bool
+	ownFunctions    map[string]*tacky.Function
+	// indices of the functions in the table for indirect calls
+	tableIndices map[string]int
+	tableEntries []string
+	types        []string
+	// number of arguments of the implicitly declared functions
+	arities map[string]int
+	// state of the current function
+	function  *tacky.Function
+	slots     map[string]int
+	frameSize int
+	structure *structure
+	scopes    []scope
+}
+
+func NewCodeGenerator(globalEnv *frontend.Environment) *CodeGenerator {
+	return &CodeGenerator{globalEnv: globalEnv}
+}
+
+func (cg *CodeGenerator) GenerateCode(program *tacky.Program) (string, error) {
+	cg.code.Reset()
+	cg.staticAddresses = make(map[string]int)
+	cg.externVars = make(map[string]bool)
+	cg.ownFunctions = make(map[string]*tacky.Function)
+	cg.tableIndices = make(map[string]int)
+	cg.tableEntries = nil
+	cg.types = nil
+	if err := cg.collectArities(program); err != nil {
+		return "", err
+	}
+
+	dataEnd := dataStart
+	for _, staticVar := range program.StaticVars {
+		if !staticVar.Defined {
+			cg.externVars[staticVar.Ident] = true
+			continue
+		}
+		dataEnd = tacky.AlignTo(dataEnd, frontend.AlignmentOf(staticVar.Type))
+		cg.staticAddresses[staticVar.Ident] = dataEnd
+		dataEnd += frontend.SizeOf(staticVar.Type)
+	}
+	stackTop := tacky.AlignTo(dataEnd, 16) + stackSize
+	for i := range program.Funs {
+		cg.ownFunctions[program.Funs[i].Ident] = &program.Funs[i]
+	}
+	cg.collectTableEntries(program)
+
+	// the functions are generated first as they add to the type section
+	cg.indent = 1
+	for i := range program.Funs {
+		if err := cg.generateFunction(&program.Funs[i]); err != nil {
+			return "", err
+		}
+	}
+	functions := cg.code.String()
+	cg.code.Reset()
+
+	cg.indent = 0
+	cg.writeln("(module")
+	cg.indent++
+	for i, signature := range cg.types {
+		cg.writeln(fmt.Sprintf("(type $t%d (func%s))", i, signature))
+	}
+	for _, name := range cg.importedFunctions(program) {
+		cg.writeln(fmt.Sprintf("(import \"env\" \"%s\" (func $%s%s))", name, name, cg.signature(name)))
+	}
+	for _, staticVar := range program.StaticVars {
+		if !staticVar.Defined {
+			cg.writeln(fmt.Sprintf("(import \"env\" \"%s\" (global $%s i32))", staticVar.Ident, staticVar.Ident))
+		}
+	}
+	cg.writeln(fmt.Sprintf("(memory (export \"memory\") %d)", (stackTop+pageSize-1)/pageSize))
+	cg.writeln(fmt.Sprintf("(global %s (mut i32) (i32.const %d))", stackPointer, stackTop))
+	if len(cg.tableEntries) > 0 {
+		// index 0 is the null pointer
+		cg.writeln(fmt.Sprintf("(table %d funcref)", len(cg.tableEntries)+1))
+		cg.writeln("(elem (i32.const 1) func $" + strings.Join(cg.tableEntries, " $") + ")")
+	}
+	cg.code.WriteString(functions)
+	for _, staticVar := range program.StaticVars {
+		if staticVar.Defined && staticVar.Init != 0 {
+			cg.writeln(fmt.Sprintf("(data (i32.const %d) \"%s\")", cg.staticAddresses[staticVar.Ident],
+				littleEndian(staticVar.Init, frontend.SizeOf(staticVar.Type))))
+		}
+	}
+	cg.indent--
+	cg.writeln(")")
+	return cg.code.String(), nil
+}
+
+// collectTableEntries assigns table indices to all functions whose
+// address is taken
+func (cg *CodeGenerator) collectTableEntries(program *tacky.Program) {
+	for _, f := range program.Funs {
+		for _, instr := range f.Body {
+			getAddress, ok := instr.(*tacky.GetAddress)
+			if !ok {
+				continue
+			}
+			v := getAddress.Src.(*tacky.Var)
+			if v.Type.GetTypeId() == frontend.TypeFunc {
+				if _, ok := cg.tableIndices[v.Ident]; !ok {
+					cg.tableEntries = append(cg.tableEntries, v.Ident)
+					cg.tableIndices[v.Ident] = len(cg.tableEntries)
+				}
+			}
+		}
+	}
+}
+
+// importedFunctions returns the functions which are called or whose
+// address is taken but which are not defined in the program
+// collectArities determines the signatures of implicitly declared
+// functions from their calls
+func (cg *CodeGenerator) collectArities(program *tacky.Program) error {
+	cg.arities = make(map[string]int)
+	for _, f := range program.Funs {
+		for _, instr := range f.Body {
+			call, ok := instr.(*tacky.FunctionCall)
+			if !ok {
+				continue
+			}
+			if funcInfo := cg.lookupFunction(call.Name); funcInfo == nil || !funcInfo.Unprototyped {
+				continue
+			}
+			if arity, ok := cg.arities[call.Name]; ok && arity != len(call.Args) {
+				return errors.New(fmt.Sprintf("implicitly declared function %s is called with %d and %d arguments",
+					call.Name, arity, len(call.Args)))
+			}
+			cg.arities[call.Name] = len(call.Args)
+		}
+	}
+	return nil
+}
+
+func (cg *CodeGenerator) importedFunctions(program *tacky.Program) []string {
+	imported := make(map[string]bool)
+	for _, f := range program.Funs {
+		for _, instr := range f.Body {
+			if call, ok := instr.(*tacky.FunctionCall); ok && cg.ownFunctions[call.Name] == nil {
+				imported[call.Name] = true
+			}
+		}
+	}
+	for _, name := range cg.tableEntries {
+		if cg.ownFunctions[name] == nil {
+			imported[name] = true
+		}
+	}
+	var names []string
+	for name := range imported {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (cg *CodeGenerator) generateFunction(f *tacky.Function) error {
+	structure := stackify(tacky.BuildCfg(f))
+	cg.function = f
+	cg.structure = structure
+	cg.scopes = nil
+	cg.allocateSlots(f)
+
+	var header strings.Builder
+	header.WriteString(fmt.Sprintf("(func $%s (export \"%s\")", f.Ident, f.Ident))
+	for _, param := range f.Parameters {
+		header.WriteString(fmt.Sprintf(" (param $%s i32)", param.Ident))
+	}
+	if f.Variadic {
+		header.WriteString(fmt.Sprintf(" (param %s i32)", varargs))
+	}
+	if cg.hasResult(f.Ident) {
+		header.WriteString(" (result i32)")
+	}
+
+	cg.writeln(header.String())
+	cg.indent++
+	isParam := make(map[string]bool)
+	for _, param := range f.Parameters {
+		isParam[param.Ident] = true
+	}
+	for _, v := range tacky.Variables(f) {
+		if !isParam[v.Ident] && cg.isLocal(v) {
+			cg.writeln(fmt.Sprintf("(local $%s i32)", v.Ident))
+		}
+	}
+	if structure.dispatch {
+		cg.writeln(fmt.Sprintf("(local %s i32)", dispatchLabel))
+	}
+	if cg.frameSize > 0 {
+		cg.writeln(fmt.Sprintf("(local %s i32)", framePointer))
+		cg.writeln("global.get " + stackPointer)
+		cg.writeln(fmt.Sprintf("i32.const %d", cg.frameSize))
+		cg.writeln("i32.sub")
+		cg.writeln("local.tee " + framePointer)
+		cg.writeln("global.set " + stackPointer)
+	}
+	for _, param := range f.Parameters {
+		if isVaListPointer(param) {
+			cg.writeln("local.get " + framePointer)
+			cg.writeln("local.get $" + param.Ident)
+			cg.writeln(fmt.Sprintf("i32.store offset=%d", cg.slots[param.Ident+vaListCopySuffix]))
+			cg.writeln("local.get " + framePointer)
+			cg.writeln(fmt.Sprintf("i32.const %d", cg.slots[param.Ident+vaListCopySuffix]))
+			cg.writeln("i32.add")
+			cg.writeln("local.set $" + param.Ident)
+		}
+		if !cg.isLocal(param) {
+			cg.writeln("local.get " + framePointer)
+			cg.writeln("local.get $" + param.Ident)
+			cg.writeln(fmt.Sprintf("i32.store offset=%d", cg.slots[param.Ident]))
+		}
+	}
+
+	for pos, block := range structure.blocks {
+		cg.closeScopes(pos)
+		cg.openScopes(pos)
+		if structure.dispatch && pos == 0 {
+			cg.writeln("block")
+			cg.writeln("  local.get " + dispatchLabel)
+			table := ""
+			for i := range structure.blocks {
+				table += fmt.Sprintf(" %d", i)
+			}
+			cg.writeln("  br_table" + table)
+			cg.writeln("end")
+		}
+		cg.generateBlock(pos, block)
+	}
+	cg.closeScopes(len(structure.blocks))
+	if cg.hasResult(f.Ident) {
+		// every path ends with a return
+		cg.writeln("unreachable")
+	}
+	cg.indent--
+	cg.writeln(")")
+	return nil
+}
+
+// allocateSlots assigns frame slots to the variables that cannot be
+// wasm locals. The buffer for the unnamed arguments of calls is at the
+// bottom of the frame.
+func (cg *CodeGenerator) allocateSlots(f *tacky.Function) {
+	offset := 0
+	for _, instr := range f.Body {
+		var unnamed int
+		switch call := instr.(type) {
+		case *tacky.FunctionCall:
+			unnamed = len(call.Args) - cg.numNamedParams(call.Name, call.Variadic, len(call.Args))
+		case *tacky.IndirectCall:
+			unnamed = len(call.Args) - indirectNamedParams(call)
+		}
+		offset = max(offset, varargSize*unnamed)
+	}
+
+	cg.slots = make(map[string]int)
+	allocate := func(name string, size, alignment int) {
+		offset = tacky.AlignTo(offset, alignment)
+		cg.slots[name] = offset
+		offset += size
+	}
+	for _, param := range f.Parameters {
+		if isVaListPointer(param) {
+			allocate(param.Ident+vaListCopySuffix, vaListSize, 4)
+		}
+	}
+	for _, v := range tacky.Variables(f) {
+		if cg.isLocal(v) || cg.isStatic(v.Ident) || v.Type.GetTypeId() == frontend.TypeFunc {
+			continue
+		}
+		allocate(v.Ident, tacky.SizeOf(v.Type, vaListSize), max(frontend.AlignmentOf(v.Type), 1))
+	}
+	cg.frameSize = tacky.AlignTo(offset, 16)
+}
+
+// isLocal tells if the variable can be held in a wasm local
+func (cg *CodeGenerator) isLocal(v *tacky.Var) bool {
+	switch v.Type.GetTypeId() {
+	case frontend.TypeStruct, frontend.TypeVaList, frontend.TypeFunc:
+		return false
+	}
+	if cg.isStatic(v.Ident) {
+		return false
+	}
+	for _, instr := range cg.function.Body {
+		if getAddress, ok := instr.(*tacky.GetAddress); ok && getAddress.Src.(*tacky.Var).Ident == v.Ident {
+			return false
+		}
+	}
+	return true
+}
+
+func (cg *CodeGenerator) isStatic(name string) bool {
+	_, own := cg.staticAddresses[name]
+	return own || cg.externVars[name]
+}
+
+func (cg *CodeGenerator) openScopes(pos int) {
+	for _, s := range cg.structure.scopes {
+		if s.first != pos {
+			continue
+		}
+		if s.kind == scopeLoop {
+			cg.writeln("loop")
+		} else {
+			cg.writeln("block")
+		}
+		cg.indent++
+		cg.scopes = append(cg.scopes, s)
+	}
+}
+
+func (cg *CodeGenerator) closeScopes(pos int) {
+	for len(cg.scopes) > 0 && cg.scopes[len(cg.scopes)-1].end == pos {
+		cg.scopes = cg.scopes[:len(cg.scopes)-1]
+		cg.indent--
+		cg.writeln("end")
+	}
+}
+
+// branch emits a branch from the given position to the label. It is
+// conditional if pushCondition is not nil. No branch is needed to get
+// to the next block.
+func (cg *CodeGenerator) branch(pos int, label string, pushCondition func()) {
+	target := cg.structure.labels[label]
+	if target == pos+1 {
+		return
+	}
+	if cg.structure.dispatch {
+		cg.writeln(fmt.Sprintf("i32.const %d", target))
+		cg.writeln("local.set " + dispatchLabel)
+	}
+
+	depth := -1
+	for d := 0; d < len(cg.scopes) && depth < 0; d++ {
+		s := cg.scopes[len(cg.scopes)-1-d]
+		switch {
+		case cg.structure.dispatch:
+			if s.kind == scopeLoop {
+				depth = d
+			}
+		case target <= pos:
+			if s.kind == scopeLoop && s.first == target {
+				depth = d
+			}
+		default:
+			if s.kind == scopeBlock && s.end == target {
+				depth = d
+			}
+		}
+	}
+	if depth < 0 {
+		panic("no scope for branch to " + label)
+	}
+
+	if pushCondition == nil {
+		cg.writeln(fmt.Sprintf("br %d", depth))
+		return
+	}
+	pushCondition()
+	cg.writeln(fmt.Sprintf("br_if %d", depth))
+}
+
+func (cg *CodeGenerator) generateBlock(pos int, block *tacky.BasicBlock) {
+	for _, instr := range block.Instructions {
+		switch i := instr.(type) {
+		case *tacky.Jump:
+			cg.branch(pos, i.Target, nil)
+		case *tacky.JumpIfZero:
+			cg.branch(pos, i.Target, func() {
+				cg.push(i.Condition)
+				cg.writeln("i32.eqz")
+			})
+		case *tacky.JumpIfNotZero:
+			cg.branch(pos, i.Target, func() { cg.push(i.Condition) })
+		case *tacky.CompareAndJump:
+			cg.branch(pos, i.Target, func() { cg.compare(i.Op, i.Src1, i.Src2) })
+		default:
+			cg.generateInstruction(instr)
+		}
+	}
+}
+
+func (cg *CodeGenerator) generateInstruction(instr tacky.Instruction) {
+	switch i := instr.(type) {
+	case *tacky.Label:
+	case *tacky.Return:
+		if i.Val != nil && cg.hasResult(cg.function.Ident) {
+			cg.push(i.Val)
+		}
+		if cg.frameSize > 0 {
+			cg.writeln("local.get " + framePointer)
+			cg.writeln(fmt.Sprintf("i32.const %d", cg.frameSize))
+			cg.writeln("i32.add")
+			cg.writeln("global.set " + stackPointer)
+		}
+		cg.writeln("return")
+	case *tacky.Unary:
+		cg.pop(i.Dst, func() {
+			switch i.Op.GetType() {
+			case tacky.TacNegate:
+				cg.writeln("i32.const 0")
+				cg.push(i.Src)
+				cg.writeln("i32.sub")
+			case tacky.TacComplement:
+				cg.push(i.Src)
+				cg.writeln("i32.const -1")
+				cg.writeln("i32.xor")
+			case tacky.TacNot:
+				cg.push(i.Src)
+				cg.writeln("i32.eqz")
+			default:
+				panic("unsupported unary operator")
+			}
+		})
+	case *tacky.Binary:
+		cg.pop(i.Dst, func() {
+			if _, ok := comparisons[i.Op.GetType()]; ok {
+				cg.compare(i.Op, i.Src1, i.Src2)
+				return
+			}
+			cg.push(i.Src1)
+			cg.push(i.Src2)
+			cg.writeln(binaryInstruction(i.Op))
+		})
+	case *tacky.Copy:
+		if tacky.IsAggregate(i.Dst) {
+			cg.pushAddress(i.Dst.(*tacky.Var))
+			cg.pushAddress(i.Src.(*tacky.Var))
+			cg.copyBytes(tacky.SizeOfValue(i.Dst, vaListSize))
+			return
+		}
+		cg.pop(i.Dst, func() { cg.push(i.Src) })
+	case *tacky.FunctionCall:
+		cg.generateCall(i.Args, cg.numNamedParams(i.Name, i.Variadic, len(i.Args)), i.Variadic, i.Dst,
+			cg.hasResult(i.Name), func() { cg.writeln("call $" + i.Name) })
+	case *tacky.IndirectCall:
+		funcInfo := i.FunPtr.(*tacky.Var).Type.(*frontend.PointerInfo).Referenced.(*frontend.FuncInfo)
+		cg.generateCall(i.Args, indirectNamedParams(i), i.Variadic, i.Dst,
+			funcInfo.ReturnType.GetTypeId() != frontend.TypeVoid, func() {
+				cg.push(i.FunPtr)
+				cg.writeln(fmt.Sprintf("call_indirect (type $t%d)", cg.typeIndex(funcSignature(funcInfo))))
+			})
+	case *tacky.GetAddress:
+		cg.pop(i.Dst, func() {
+			v := i.Src.(*tacky.Var)
+			if v.Type.GetTypeId() == frontend.TypeFunc {
+				cg.writeln(fmt.Sprintf("i32.const %d", cg.tableIndices[v.Ident]))
+			} else {
+				cg.pushAddress(v)
+			}
+		})
+	case *tacky.Load:
+		if tacky.IsAggregate(i.Dst) {
+			cg.pushAddress(i.Dst.(*tacky.Var))
+			cg.push(i.SrcPtr)
+			cg.copyBytes(tacky.SizeOfValue(i.Dst, vaListSize))
+			return
+		}
+		cg.pop(i.Dst, func() {
+			cg.push(i.SrcPtr)
+			cg.writeln("i32.load")
+		})
+	case *tacky.Store:
+		cg.push(i.DstPtr)
+		if tacky.IsAggregate(i.Src) {
+			cg.pushAddress(i.Src.(*tacky.Var))
+			cg.copyBytes(tacky.SizeOfValue(i.Src, vaListSize))
+			return
+		}
+		cg.push(i.Src)
+		cg.writeln("i32.store")
+	case *tacky.AddOffset:
+		cg.pop(i.Dst, func() {
+			cg.push(i.Ptr)
+			cg.writeln(fmt.Sprintf("i32.const %d", i.Offset))
+			cg.writeln("i32.add")
+		})
+	case *tacky.SignExtend:
+		// ints and pointers are both i32 values
+		cg.pop(i.Dst, func() { cg.push(i.Src) })
+	case *tacky.Truncate:
+		cg.pop(i.Dst, func() { cg.push(i.Src) })
+	case *tacky.VaStart:
+		cg.push(i.VaList)
+		cg.writeln("local.get " + varargs)
+		cg.writeln("i32.store")
+	case *tacky.VaArg:
+		cg.pop(i.Dst, func() {
+			cg.push(i.VaList)
+			cg.writeln("i32.load")
+			cg.writeln("i32.load")
+		})
+		cg.push(i.VaList)
+		cg.push(i.VaList)
+		cg.writeln("i32.load")
+		cg.writeln(fmt.Sprintf("i32.const %d", varargSize))
+		cg.writeln("i32.add")
+		cg.writeln("i32.store")
+	default:
+		panic(fmt.Sprintf("unsupported instruction type: %T", instr))
+	}
+}
+
+// generateCall pushes the named arguments, stores the unnamed ones in
+// the buffer at the bottom of the frame and passes its address
+func (cg *CodeGenerator) generateCall(args []tacky.Value, numNamed int, variadic bool, dst tacky.Value,
+	hasResult bool, call func()) {
+	generate := func() {
+		for _, arg := range args[:numNamed] {
+			cg.push(arg)
+			if isVaListPointer(arg) {
+				cg.writeln("i32.load")
+			}
+		}
+		if variadic {
+			for k, arg := range args[numNamed:] {
+				cg.writeln("local.get " + framePointer)
+				cg.push(arg)
+				cg.writeln(fmt.Sprintf("i32.store offset=%d", varargSize*k))
+			}
+			cg.pushFramePointer()
+		}
+		call()
+	}
+	switch {
+	case dst != nil && hasResult:
+		cg.pop(dst, generate)
+	case hasResult:
+		generate()
+		cg.writeln("drop")
+	default:
+		generate()
+	}
+}
+
+func (cg *CodeGenerator) pushFramePointer() {
+	if cg.frameSize > 0 {
+		cg.writeln("local.get " + framePointer)
+	} else {
+		cg.writeln("global.get " + stackPointer)
+	}
+}
+
+func (cg *CodeGenerator) compare(op tacky.BinaryOp, src1, src2 tacky.Value) {
+	cg.push(src1)
+	cg.push(src2)
+	instruction := comparisons[op.GetType()]
+	// pointers are compared as unsigned values
+	if strings.HasSuffix(instruction, "_s") && (tacky.SizeOfValue(src1, vaListSize) == 8 || tacky.SizeOfValue(src2, vaListSize) == 8) {
+		instruction = strings.TrimSuffix(instruction, "_s") + "_u"
+	}
+	cg.writeln(instruction)
+}
+
+var comparisons = map[tacky.TacType]string{
+	tacky.TacEq:    "i32.eq",
+	tacky.TacNotEq: "i32.ne",
+	tacky.TacLt:    "i32.lt_s",
+	tacky.TacLtEq:  "i32.le_s",
+	tacky.TacGt:    "i32.gt_s",
+	tacky.TacGtEq:  "i32.ge_s",
+}
+
+func binaryInstruction(op tacky.BinaryOp) string {
+	switch op.GetType() {
+	case tacky.TacAdd:
+		return "i32.add"
+	case tacky.TacSub:
+		return "i32.sub"
+	case tacky.TacMul:
+		return "i32.mul"
+	case tacky.TacDiv:
+		return "i32.div_s"
+	case tacky.TacRemainder:
+		return "i32.rem_s"
+	case tacky.TacBitAnd:
+		return "i32.and"
+	case tacky.TacBitOr:
+		return "i32.or"
+	case tacky.TacBitXor:
+		return "i32.xor"
+	case tacky.TacBitShiftLeft:
+		return "i32.shl"
+	case tacky.TacBitShiftRight:
+		return "i32.shr_s"
+	default:
+		panic("unsupported binary operator")
+	}
+}
+
+// push pushes the value onto the operand stack
+func (cg *CodeGenerator) push(value tacky.Value) {
+	switch v := value.(type) {
+	case *tacky.IntConstant:
+		cg.writeln(fmt.Sprintf("i32.const %d", v.Val))
+	case *tacky.Var:
+		if cg.isLocal(v) {
+			cg.writeln("local.get $" + v.Ident)
+			return
+		}
+		offset := cg.pushBase(v)
+		cg.writeln(memoryInstruction("i32.load", offset))
+	default:
+		panic("unsupported value type")
+	}
+}
+
+// pop assigns the value computed by generate to the variable
+func (cg *CodeGenerator) pop(dst tacky.Value, generate func()) {
+	v := dst.(*tacky.Var)
+	if cg.isLocal(v) {
+		generate()
+		cg.writeln("local.set $" + v.Ident)
+		return
+	}
+	offset := cg.pushBase(v)
+	generate()
+	cg.writeln(memoryInstruction("i32.store", offset))
+}
+
+// pushBase pushes the base address of a variable in the linear memory
+// and returns its offset from the base
+func (cg *CodeGenerator) pushBase(v *tacky.Var) int {
+	switch {
+	case cg.externVars[v.Ident]:
+		cg.writeln("global.get $" + v.Ident)
+		return 0
+	case cg.isStatic(v.Ident):
+		cg.writeln("i32.const 0")
+		return cg.staticAddresses[v.Ident]
+	default:
+		cg.writeln("local.get " + framePointer)
+		return cg.slots[v.Ident]
+	}
+}
+
+func (cg *CodeGenerator) pushAddress(v *tacky.Var) {
+	if offset := cg.pushBase(v); offset != 0 {
+		cg.writeln(fmt.Sprintf("i32.const %d", offset))
+		cg.writeln("i32.add")
+	}
+}
+
+// copyBytes copies memory, the destination and source addresses are on
+// the stack
+func (cg *CodeGenerator) copyBytes(size int) {
+	cg.writeln(fmt.Sprintf("i32.const %d", size))
+	cg.writeln("memory.copy")
+}
+
+// numNamedParams returns the number of arguments of a call which are
+// passed as wasm parameters
+func (cg *CodeGenerator) numNamedParams(name string, variadic bool, numArgs int) int {
+	if !variadic {
+		return numArgs
+	}
+	if f, ok := cg.ownFunctions[name]; ok {
+		return len(f.Parameters)
+	}
+	if funcInfo := cg.lookupFunction(name); funcInfo != nil {
+		return funcInfo.NumParams()
+	}
+	return numArgs
+}
+
+func indirectNamedParams(call *tacky.IndirectCall) int {
+	if !call.Variadic {
+		return len(call.Args)
+	}
+	funcInfo := call.FunPtr.(*tacky.Var).Type.(*frontend.PointerInfo).Referenced.(*frontend.FuncInfo)
+	return funcInfo.NumParams()
+}
+
+func (cg *CodeGenerator) lookupFunction(name string) *frontend.FuncInfo {
+	if cg.globalEnv == nil {
+		return nil
+	}
+	entry, _ := cg.globalEnv.Get(name)
+	if entry == nil || entry.GetTypeInfo() == nil {
+		return nil
+	}
+	funcInfo, _ := entry.GetTypeInfo().(*frontend.FuncInfo)
+	return funcInfo
+}
+
+// hasResult tells if the function returns a value. Without prototype
+// an int result is assumed.
+func (cg *CodeGenerator) hasResult(name string) bool {
+	funcInfo := cg.lookupFunction(name)
+	return funcInfo == nil || funcInfo.ReturnType.GetTypeId() != frontend.TypeVoid
+}
+
+// signature returns the parameters and the result of the function in
+// text format
+func (cg *CodeGenerator) signature(name string) string {
+	if funcInfo := cg.lookupFunction(name); funcInfo != nil {
+		if funcInfo.Unprototyped {
+			// the arguments are passed as i32 like ints
+			implicit := frontend.FuncInfo{ReturnType: funcInfo.ReturnType}
+			for range cg.arities[name] {
+				implicit.ParamTypes = append(implicit.ParamTypes, &frontend.IntInfo{})
+			}
+			return funcSignature(&implicit)
+		}
+		return funcSignature(funcInfo)
+	}
+	panic("no prototype for function " + name)
+}
+
+func funcSignature(funcInfo *frontend.FuncInfo) string {
+	var signature strings.Builder
+	numParams := funcInfo.NumParams()
+	if funcInfo.Variadic {
+		numParams++
+	}
+	if numParams > 0 {
+		signature.WriteString(" (param" + strings.Repeat(" i32", numParams) + ")")
+	}
+	if funcInfo.ReturnType.GetTypeId() != frontend.TypeVoid {
+		signature.WriteString(" (result i32)")
+	}
+	return signature.String()
+}
+
+func (cg *CodeGenerator) typeIndex(signature string) int {
+	for i, s := range cg.types {
+		if s == signature {
+			return i
+		}
+	}
+	cg.types = append(cg.types, signature)
+	return len(cg.types) - 1
+}
+
+func (cg *CodeGenerator) writeln(line string) {
+	cg.code.WriteString(strings.Repeat("  ", cg.indent))
+	cg.code.WriteString(line)
+	cg.code.WriteString("\n")
+}
+
+func memoryInstruction(instruction string, offset int) string {
+	if offset == 0 {
+		return instruction
+	}
+	return fmt.Sprintf("%s offset=%d", instruction, offset)
+}
+
+// littleEndian returns the bytes of the value as escaped string
+func littleEndian(value int, size int) string {
+	var bytes strings.Builder
+	for i := 0; i < size; i++ {
+		bytes.WriteString(fmt.Sprintf("\\%02x", (value>>(8*i))&0xff))
+	}
+	return bytes.String()
+}
+
+func isVaListPointer(value tacky.Value) bool {
+	v, ok := value.(*tacky.Var)
+	if !ok || v.Type.GetTypeId() != frontend.TypePointer {
+		return false
+	}
+	return v.Type.(*frontend.PointerInfo).Referenced.GetTypeId() == frontend.TypeVaList
+}
@@ -0,0 +1,130 @@
+package wasm
+
+import (
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/internal/backendtest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCodeGenerator_GenerateCode(t *testing.T) {
+	code := `
+	int printf(void *format, ...);
+
+	int count(int n) {
+		int i = 0;
+		while (i < n) {
+			if (i == 42)
+				break;
+			i++;
+		}
+		return i;
+	}
+
+	int main(void) {
+		int fmt = 680997;
+		return printf(&fmt, count(10), 7);
+	}`
+
+	asm := generate(t, code)
+
+	for _, want := range []string{
+		"(import \"env\" \"printf\" (func $printf (param i32 i32) (result i32)))",
+		"(memory (export \"memory\") 2)",
+		"(func $count (export \"count\") (param $tmp.0 i32) (result i32)",
+		"    block\n      loop\n",
+		"        i32.ge_s\n        br_if 1\n",
+		"          br_if 0\n          br 2\n        end\n",
+		"        br 0\n      end\n    end\n",
+		"    global.get $__stack_pointer\n    i32.const 16\n    i32.sub\n    local.tee $__fp\n",
+		"    i32.const 7\n    i32.store offset=4\n    local.get $__fp\n    call $printf\n",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+}
+
+func TestCodeGenerator_GenerateCode_Irreducible(t *testing.T) {
+	code := `
+	int skip(int a) {
+		goto middle;
+		while (a < 20) {
+			a = a + 2;
+		middle:
+			a = a + 1;
+		}
+		return a;
+	}`
+
+	asm := generate(t, code)
+
+	for _, want := range []string{
+		"(local $__label i32)",
+		"    loop\n      block\n",
+		"local.get $__label\n                br_table 0 1 2 3 4\n",
+		"i32.const 3\n              local.set $__label\n              br 4\n",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+}
+
+func TestCodeGenerator_GenerateCode_FunctionPointers(t *testing.T) {
+	code := `
+	int abs(int x);
+	extern int limit;
+	int counter = 5;
+
+	int apply(int (*f)(int), int x) {
+		return f(x) + limit + counter;
+	}
+
+	int main(void) {
+		return apply(abs, -3);
+	}`
+
+	asm := generate(t, code)
+
+	for _, want := range []string{
+		"(type $t0 (func (param i32) (result i32)))",
+		"(import \"env\" \"limit\" (global $limit i32))",
+		"(table 2 funcref)",
+		"(elem (i32.const 1) func $abs)",
+		"    call_indirect (type $t0)\n",
+		"    global.get $limit\n    i32.load\n",
+		"    i32.const 0\n    i32.load offset=1024\n",
+		"(data (i32.const 1024) \"\\05\\00\\00\\00\")",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("expected %q in generated code:\n%s", want, asm)
+		}
+	}
+}
+
+// TestCodeGenerator_GenerateCode_Execute runs main with wasmtime. It is
+// skipped if wat2wasm or wasmtime are missing.
+func TestCodeGenerator_GenerateCode_Execute(t *testing.T) {
+	backendtest.RequireTools(t, "wat2wasm", "wasmtime")
+	watFile := backendtest.WriteFile(t, "program.wat", generate(t, backendtest.ExecuteCode))
+	wasmFile := strings.TrimSuffix(watFile, ".wat") + ".wasm"
+	backendtest.Run(t, "wat2wasm", watFile, "-o", wasmFile)
+	output := backendtest.Run(t, "wasmtime", "run", "--invoke", "main", wasmFile)
+	got, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	if err != nil {
+		t.Fatalf("wasmtime: unexpected output %q", output)
+	}
+	if got != backendtest.ExecuteStatus {
+		t.Errorf("main() = %d, want %d", got, backendtest.ExecuteStatus)
+	}
+}
+
+func generate(t *testing.T, code string) string {
+	program, env := backendtest.FrontEnd(t, code)
+	asm, err := NewCodeGenerator(env).GenerateCode(program)
+	if err != nil {
+		t.Fatalf("GenerateCode() error = %v", err)
+	}
+	return asm
+}
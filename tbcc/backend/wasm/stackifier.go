@@ -0,0 +1,167 @@
+package wasm
+
+import (
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/tacky"
+	"sort"
+)
+
+type scopeKind int
+
+const (
+	scopeBlock scopeKind = iota
+	scopeLoop
+)
+
+// scope is a wasm block or loop around the basic blocks at the positions
+// first..end-1. A br to a block continues at end, a br to a loop at first.
+type scope struct {
+	kind  scopeKind
+	first int
+	end   int
+}
+
+// structure is the result of the stackifier: the reachable basic blocks
+// in program order and the properly nested scopes around them
+type structure struct {
+	blocks []*tacky.BasicBlock
+	// positions maps block ids to positions in blocks, labels the
+	// labels of the blocks
+	positions map[int]int
+	labels    map[string]int
+	// scopes are ordered by their opening position, outer scopes first
+	scopes []scope
+	// dispatch is set for irreducible control flow. The blocks are
+	// placed in a loop which branches to the block whose position is
+	// held in a local (see dispatchScopes).
+	dispatch bool
+}
+
+// stackify structures the control flow of the function into nested
+// blocks and loops. The basic blocks keep their order: every back edge
+// makes its target a loop header, the loop extends to the last block
+// jumping back. A forward jump leaves a block that ends right before
+// the jump target. Blocks are widened until all scopes nest properly.
+// This works for every reducible control flow graph whose loops are
+// contiguous, which is what the translation of C statements produces.
+// Other functions (e.g. with jumps into loops) fall back to dispatching.
+func stackify(cfg *tacky.Cfg) *structure {
+	s := &structure{positions: make(map[int]int), labels: make(map[string]int)}
+	reachable := cfg.Reachable()
+	for i := range cfg.Blocks {
+		if reachable[i] {
+			s.positions[i] = len(s.blocks)
+			s.labels[cfg.Blocks[i].Label()] = len(s.blocks)
+			s.blocks = append(s.blocks, &cfg.Blocks[i])
+		}
+	}
+
+	loopEnds := make(map[int]int)
+	blockStarts := make(map[int]int)
+	for pos, block := range s.blocks {
+		for _, edge := range block.Successors {
+			target := s.positions[edge.Target]
+			switch {
+			case target <= pos:
+				loopEnds[target] = max(loopEnds[target], pos+1)
+			case target > pos+1:
+				if first, ok := blockStarts[target]; !ok || pos < first {
+					blockStarts[target] = pos
+				}
+			}
+		}
+	}
+
+	for header, end := range loopEnds {
+		s.scopes = append(s.scopes, scope{scopeLoop, header, end})
+	}
+	for target, first := range blockStarts {
+		s.scopes = append(s.scopes, scope{scopeBlock, first, target})
+	}
+
+	if !s.hasSingleLoopEntries() || !s.nestScopes() {
+		s.dispatchScopes()
+	}
+
+	sort.Slice(s.scopes, func(i, j int) bool {
+		a, b := s.scopes[i], s.scopes[j]
+		if a.first != b.first {
+			return a.first < b.first
+		}
+		if a.end != b.end {
+			return a.end > b.end
+		}
+		return a.kind == scopeBlock && b.kind == scopeLoop
+	})
+
+	return s
+}
+
+// hasSingleLoopEntries tells if all loops are only entered through
+// their headers
+func (s *structure) hasSingleLoopEntries() bool {
+	for _, loop := range s.scopes {
+		if loop.kind != scopeLoop {
+			continue
+		}
+		for pos := loop.first + 1; pos < loop.end; pos++ {
+			for _, pred := range s.blocks[pos].Predecessors {
+				predPos, ok := s.positions[pred]
+				if ok && (predPos < loop.first || predPos >= loop.end) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// nestScopes moves the start of blocks outwards until no two scopes
+// overlap partially. Loops cannot be moved, false is returned if one
+// would have to.
+func (s *structure) nestScopes() bool {
+	changed := true
+	for changed {
+		changed = false
+		for i := range s.scopes {
+			for j := range s.scopes {
+				a, b := &s.scopes[i], &s.scopes[j]
+				if !(a.first < b.first && b.first < a.end && a.end < b.end) {
+					continue
+				}
+				if b.kind == scopeLoop {
+					return false
+				}
+				b.first = a.first
+				changed = true
+			}
+		}
+	}
+	return true
+}
+
+// dispatchScopes places the blocks into a loop and into blocks that end
+// right before each basic block:
+//
+//	loop
+//	  block
+//	    block
+//	      block
+//	        local.get $__label
+//	        br_table 0 1 2
+//	      end
+//	      ...basic block 0
+//	    end
+//	    ...basic block 1
+//	  end
+//	  ...basic block 2
+//	end
+//
+// Every branch stores the position of its target and continues the loop.
+// The innermost block is emitted with the br_table.
+func (s *structure) dispatchScopes() {
+	s.dispatch = true
+	s.scopes = []scope{{scopeLoop, 0, len(s.blocks)}}
+	for pos := 1; pos < len(s.blocks); pos++ {
+		s.scopes = append(s.scopes, scope{scopeBlock, 0, pos})
+	}
+}
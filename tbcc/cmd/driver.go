@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/pipeline"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// phase is a step of the compiler driver. An input file enters the
+// phase given by its suffix and passes all phases up to the last one
+// requested (-E, -S, -c or linking).
+type phase int
+
+const (
+	phasePreprocess phase = iota
+	phaseCompile
+	phaseAssemble
+	phaseLink
+)
+
+type driver struct {
+	options     Options
+	target      pipeline.Target
+	last        phase
+	output      string // -o
+	linkOptions []string
+	saveTemps   bool
+	tempDir     string
+}
+
+// job is the translation of one input file. Its messages are collected
+// so that the ones of concurrent jobs do not get mixed up.
+type job struct {
+	index  int
+	input  string
+	first  phase
+	result string // the file written by the last phase run
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+}
+
+func (d *driver) run(ctx context.Context, inputs []string) error {
+	var jobs []*job
+	numOutputs := 0
+	for i, input := range inputs {
+		j := &job{index: i, input: input, first: d.firstPhase(input)}
+		if j.first <= d.last && j.first != phaseLink {
+			numOutputs++
+		}
+		jobs = append(jobs, j)
+	}
+	if d.output != "" && d.last != phaseLink && numOutputs > 1 {
+		return errors.New("cannot specify -o with -c, -S or -E with multiple files")
+	}
+
+	if !d.saveTemps {
+		tempDir, err := os.MkdirTemp("", "tbcc")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = os.RemoveAll(tempDir)
+		}()
+		d.tempDir = tempDir
+	}
+
+	errs := make([]error, len(jobs))
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[j.index] = d.translate(ctx, j)
+		}()
+	}
+	wg.Wait()
+
+	failed := false
+	for _, j := range jobs {
+		_, _ = os.Stdout.Write(j.stdout.Bytes())
+		_, _ = os.Stderr.Write(j.stderr.Bytes())
+		var diagnostic diagnosticError
+		if errs[j.index] != nil {
+			if !errors.As(errs[j.index], &diagnostic) {
+				errs[j.index] = errors.New(fmt.Sprintf("%s: %s", j.input, errs[j.index]))
+			}
+			failed = true
+		}
+	}
+	if failed {
+		return errors.Join(errs...)
+	}
+
+	if d.last != phaseLink {
+		return nil
+	}
+	return d.link(ctx, jobs)
+}
+
+// firstPhase tells by the suffix of an input file which phase it
+// enters. Files with unknown suffixes are passed to the linker.
+func (d *driver) firstPhase(input string) phase {
+	switch filepath.Ext(input) {
+	case ".c":
+		return phasePreprocess
+	case ".i":
+		return phaseCompile
+	case d.target.AssemblySuffix():
+		return phaseAssemble
+	}
+	return phaseLink
+}
+
+// translate runs the phases before linking for an input file
+func (d *driver) translate(ctx context.Context, j *job) error {
+	j.result = j.input
+	if j.first > d.last {
+		if j.first == phaseLink {
+			_, _ = fmt.Fprintf(&j.stderr, "tbcc: warning: %s: linker input file unused because linking not done\n",
+				j.input)
+		}
+		return nil
+	}
+
+	for p := j.first; p <= d.last && p != phaseLink; p++ {
+		outputFile := d.tempName(j, p)
+		if p == d.last {
+			outputFile = d.outputName(j, p)
+		}
+		var err error
+		switch p {
+		case phasePreprocess:
+			err = d.preProcess(ctx, j, outputFile)
+		case phaseCompile:
+			outputFile, err = compile(ctx, j.result, j.input, outputFile, d.options, &j.stdout, &j.stderr)
+		case phaseAssemble:
+			err = d.assemble(ctx, j, outputFile)
+		}
+		if err != nil || outputFile == "" {
+			return err
+		}
+		j.result = outputFile
+	}
+
+	return nil
+}
+
+// preProcess runs the preprocessor of the target. Its output goes to
+// stdout if outputFile is empty.
+func (d *driver) preProcess(ctx context.Context, j *job, outputFile string) error {
+	command := []string{d.target.CC(), "-E", j.result}
+	if outputFile != "" {
+		command = append(command, "-o", outputFile)
+	}
+	return execute(ctx, command, &j.stdout, &j.stderr)
+}
+
+// assemble runs the assembler of the target. The object file goes to
+// stdout if outputFile is empty. As the assembler cannot write to
+// stdout, it is written to a temporary file first.
+func (d *driver) assemble(ctx context.Context, j *job, outputFile string) error {
+	objectFile := outputFile
+	if objectFile == "" {
+		objectFile = d.tempName(j, phaseAssemble)
+	}
+	err := execute(ctx, d.target.AssembleCommand(j.result, objectFile), &j.stdout, &j.stderr)
+	if err != nil || outputFile != "" {
+		return err
+	}
+	content, err := os.ReadFile(objectFile)
+	if err != nil {
+		return err
+	}
+	_, err = j.stdout.Write(content)
+	return err
+}
+
+func (d *driver) link(ctx context.Context, jobs []*job) error {
+	var objectFiles []string
+	for _, j := range jobs {
+		objectFiles = append(objectFiles, j.result)
+	}
+
+	output := pipeline.OutputExecutable
+	if d.options.shared {
+		output = pipeline.OutputSharedLibrary
+	}
+	outputFile := d.output
+	if outputFile == "" {
+		// as in the test suite of the book, a program translated from a
+		// single file is named after it
+		outputFile = "a.out"
+		if len(jobs) == 1 && jobs[0].first != phaseLink {
+			outputFile = stripSuffix(jobs[0].input) + d.target.OutputSuffix(output)
+		}
+	}
+
+	command, err := d.target.LinkCommand(objectFiles, d.linkOptions, outputFile, output)
+	if err != nil {
+		return err
+	}
+	if command == nil {
+		return copyFile(objectFiles[0], outputFile)
+	}
+	return execute(ctx, command, os.Stdout, os.Stderr)
+}
+
+// suffix returns the suffix of the files written by a phase
+func (d *driver) suffix(p phase) string {
+	switch p {
+	case phasePreprocess:
+		return ".i"
+	case phaseCompile:
+		if d.options.emitLlvm {
+			return ".ll"
+		}
+		return d.target.AssemblySuffix()
+	default:
+		return d.target.OutputSuffix(pipeline.OutputObject)
+	}
+}
+
+// tempName returns the name of an intermediate file. With -save-temps
+// the intermediate files are kept in the current directory as with gcc.
+func (d *driver) tempName(j *job, p phase) string {
+	name := stripSuffix(filepath.Base(j.input)) + d.suffix(p)
+	if d.saveTemps {
+		return name
+	}
+	return filepath.Join(d.tempDir, fmt.Sprintf("%d-%s", j.index, name))
+}
+
+// outputName returns the name of the file written by the last phase:
+// the one given with -o or, as with gcc, the name of the input file with
+// the suffix of the phase in the current directory. An empty name
+// stands for stdout, which is selected with -o - and is the default for
+// -E.
+func (d *driver) outputName(j *job, p phase) string {
+	switch {
+	case d.output == "-":
+		return ""
+	case d.output != "":
+		return d.output
+	case p == phasePreprocess:
+		return ""
+	}
+	return filepath.Base(stripSuffix(j.input)) + d.suffix(p)
+}
+
+func execute(ctx context.Context, command []string, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+func copyFile(source, destination string) error {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(destination, content, 0666)
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/pipeline"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDriver_FirstPhase(t *testing.T) {
+	d := &driver{target: pipeline.DefaultTarget()}
+	for input, want := range map[string]phase{
+		"main.c":       phasePreprocess,
+		"dir/main.i":   phaseCompile,
+		"main.s":       phaseAssemble,
+		"main.o":       phaseLink,
+		"libm.a":       phaseLink,
+		"no-extension": phaseLink,
+	} {
+		if got := d.firstPhase(input); got != want {
+			t.Errorf("firstPhase(%s) = %d, want %d", input, got, want)
+		}
+	}
+}
+
+func TestDriver_OutputName(t *testing.T) {
+	j := &job{input: "src/v1.2/main.c"}
+	for _, test := range []struct {
+		output string
+		p      phase
+		want   string
+	}{
+		// the outputs of -S and -c go to the current directory
+		{"", phaseCompile, "main.s"},
+		{"", phaseAssemble, "main.o"},
+		{"", phasePreprocess, ""},
+		{"out/prog.s", phaseCompile, "out/prog.s"},
+		{"out/prog.i", phasePreprocess, "out/prog.i"},
+		// -o - selects stdout
+		{"-", phasePreprocess, ""},
+		{"-", phaseCompile, ""},
+		{"-", phaseAssemble, ""},
+	} {
+		d := &driver{target: pipeline.DefaultTarget(), output: test.output}
+		if got := d.outputName(j, test.p); got != test.want {
+			t.Errorf("outputName() with -o %q in phase %d = %q, want %q", test.output, test.p, got, test.want)
+		}
+	}
+
+	d := &driver{target: pipeline.DefaultTarget(), options: Options{emitLlvm: true}}
+	if got := d.outputName(j, phaseCompile); got != "main.ll" {
+		t.Errorf("outputName() with --emit-llvm = %q, want main.ll", got)
+	}
+}
+
+func TestDriver_RunMultipleOutputs(t *testing.T) {
+	for _, last := range []phase{phasePreprocess, phaseCompile, phaseAssemble} {
+		d := &driver{target: pipeline.DefaultTarget(), last: last, output: "out"}
+		err := d.run(context.Background(), []string{"a.c", "b.c"})
+		if err == nil || !strings.Contains(err.Error(), "cannot specify -o") {
+			t.Errorf("run() in phase %d error = %v, want error for -o with multiple files", last, err)
+		}
+	}
+
+	// b.i is not preprocessed, so -E writes a single output
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a.c")
+	if err := os.WriteFile(source, []byte("#define N 42\nint n = N;\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "a.i")
+	d := &driver{target: pipeline.DefaultTarget(), last: phasePreprocess, output: output}
+	if err := d.run(context.Background(), []string{source, filepath.Join(dir, "b.i")}); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	content, err := os.ReadFile(output)
+	if err != nil || !strings.Contains(string(content), "int n = 42;") {
+		t.Errorf("run() did not preprocess %s: %v", source, err)
+	}
+}
+
+func TestDriver_RunErrorPosition(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "bad.i")
+	if err := os.WriteFile(source, []byte("int main(void) {\n\treturn x;\n}\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	d := &driver{target: pipeline.DefaultTarget(), last: phaseCompile, output: filepath.Join(dir, "bad.s")}
+	err := d.run(context.Background(), []string{source})
+	if err == nil || err.Error() != source+":2:9: error: identifier 'x' is not defined" {
+		t.Errorf("run() error = %v, want the position of x", err)
+	}
+}
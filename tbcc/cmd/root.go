@@ -2,25 +2,40 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/backend"
-	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
-	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/tacky"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/compiler"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/pipeline"
+	"io"
 	"os"
-	"os/exec"
+	"slices"
 	"strings"
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use:     "tbcc sourcefile",
-	Short:   "A compiler for a simplified version of C",
-	Long:    `TBCC is a compiler for a simplified version of C.`,
+	Use:   "tbcc [flags] file...",
+	Short: "A compiler for a simplified version of C",
+	Long: `TBCC is a compiler for a simplified version of C.
+
+The suffix of an input file tells what is done with it: .c files are
+preprocessed, compiled and assembled, .i files are compiled and assembled,
+.s files are assembled and all other files are passed to the linker.
+The translation units are compiled concurrently.
+
+Without -o, the files written by -S and -c are named after the input file
+and written to the current directory. A program linked from a single input
+file is named after it and written to its directory, other programs are
+named a.out. With -o -, the output of -E, -S and -c goes to stdout.`,
 	Version: "0.9.4",
-	Args:    cobra.ExactArgs(1),
+	Args:    cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		err := run(args)
+		err := run(cmd.Context(), args)
 		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 	},
@@ -33,6 +48,22 @@ type Options struct {
 	stopAfterIR           bool
 	stopAfterCodegen      bool
 	stopAfterCodeEmission bool
+	printBefore           []string
+	printAfter            []string
+	disabledPasses        []string
+	timePasses            bool
+	verify                bool
+	verifyEach            bool
+	emitJson              string
+	emitLlvm              bool
+	emitC                 bool
+	dot                   string
+	warnings              []string
+	machine               []string
+	debugInfo             bool
+	flags                 []string
+	shared                bool
+	target                pipeline.Target
 }
 
 var (
@@ -43,147 +74,279 @@ var (
 	stopAfterCodegen      *bool = nil
 	stopAfterCodeEmission *bool = nil
 	doNotLink             *bool = nil
+	printBefore           *[]string
+	printAfter            *[]string
+	disabledPasses        *[]string
+	timePasses            *bool = nil
+	verify                *bool = nil
+	verifyEach            *bool = nil
+	emitJson              *string
+	emitLlvm              *bool = nil
+	emitC                 *bool = nil
+	dot                   *string
+	warnings              *[]string
+	machine               *[]string
+	debugInfo             *bool = nil
+	flags                 *[]string
+	shared                *bool = nil
+	targetName            *string
+	outputFile            *string
+	preProcessOnly        *bool = nil
+	libraries             *[]string
+	libraryPaths          *[]string
+	saveTemps             *bool = nil
 )
 
-func run(args []string) error {
-
-	var preProcessedFile string
-	var assemblyFile string
-
-	defer func() {
-		if preProcessedFile != "" && fileExists(preProcessedFile) {
-			_ = os.Remove(preProcessedFile)
-		}
-		if assemblyFile != "" && fileExists(assemblyFile) && !*stopAfterCodeEmission {
-			_ = os.Remove(assemblyFile)
-		}
-	}()
+func run(ctx context.Context, args []string) error {
 
-	preProcessedFile, err := preProcess(args[0])
+	target, err := pipeline.LookupTarget(*targetName)
 	if err != nil {
 		return err
 	}
 
-	assemblyFile, err = compile(preProcessedFile, Options{
+	options := Options{
 		*stopAfterLex,
 		*stopAfterParse,
 		*stopAfterSemAnalysis,
 		*stopAfterIR,
 		*stopAfterCodegen,
 		*stopAfterCodeEmission,
-	})
+		*printBefore,
+		*printAfter,
+		*disabledPasses,
+		*timePasses,
+		*verify,
+		*verifyEach,
+		*emitJson,
+		*emitLlvm,
+		*emitC,
+		*dot,
+		*warnings,
+		*machine,
+		*debugInfo,
+		*flags,
+		*shared,
+		target,
+	}
 
-	if err != nil {
-		return err
+	last := phaseLink
+	switch {
+	case *preProcessOnly:
+		last = phasePreprocess
+	case *stopAfterLex, *stopAfterParse, *stopAfterSemAnalysis, *stopAfterIR, *stopAfterCodegen,
+		*stopAfterCodeEmission, *emitJson != "", *emitLlvm, *emitC, *dot != "":
+		last = phaseCompile
+	case *doNotLink:
+		last = phaseAssemble
 	}
 
-	if assemblyFile == "" || *stopAfterCodeEmission {
-		return nil
+	var linkOptions []string
+	for _, path := range *libraryPaths {
+		linkOptions = append(linkOptions, "-L"+path)
+	}
+	for _, library := range *libraries {
+		linkOptions = append(linkOptions, "-l"+library)
 	}
 
-	_, err = assemble(assemblyFile, *doNotLink)
-	if err != nil {
-		return err
+	d := &driver{
+		options:     options,
+		target:      target,
+		last:        last,
+		output:      *outputFile,
+		linkOptions: linkOptions,
+		saveTemps:   *saveTemps,
 	}
+	return d.run(ctx, args)
+}
 
-	return nil
+// diagnosticError is an error that already names the file and the
+// position it was found at
+type diagnosticError struct {
+	compiler.Diagnostic
 }
 
-func fileExists(filename string) bool {
-	_, err := os.Stat(filename)
-	return err == nil
+func (e diagnosticError) Error() string {
+	return e.String()
 }
 
-func assemble(assemblyFile string, doNotLink bool) (string, error) {
-	var cmd *exec.Cmd
+// compile translates a preprocessed file and writes the emitted code
+// (or the LLVM IR) to outputFile or to stdout if outputFile is empty. It
+// returns an empty name if the compilation stopped earlier or wrote to
+// stdout.
+func compile(ctx context.Context, preProcessedFile, sourceFile, outputFile string, options Options, stdout, stderr io.Writer) (
+	string, error) {
+	fileContent, err := os.ReadFile(preProcessedFile)
+	if err != nil {
+		return "", err
+	}
+
+	stopAfter, printResult := "", pipeline.IrNone
+	switch {
+	case options.stopAfterLex:
+		stopAfter = pipeline.PassLex
+	case options.stopAfterParse:
+		stopAfter, printResult = pipeline.PassParse, pipeline.IrAst
+	case options.stopAfterSemAnalysis:
+		stopAfter, printResult = pipeline.PassIdentifierResolution, pipeline.IrAst
+	case options.stopAfterIR:
+		stopAfter = pipeline.PassTackyGen
+	case options.stopAfterCodegen:
+		stopAfter, printResult = pipeline.PassInstructionFixup, pipeline.IrAsm
+	}
 
-	outFile := stripSuffix(assemblyFile)
+	jsonKind := pipeline.IrNone
+	switch options.emitJson {
+	case "":
+	case "ast":
+		stopAfter, jsonKind = pipeline.PassIdentifierResolution, pipeline.IrAst
+	case "tacky":
+		stopAfter, jsonKind = pipeline.PassTackyGen, pipeline.IrTacky
+	case "asm":
+		stopAfter, jsonKind = pipeline.PassInstructionFixup, pipeline.IrAsm
+	default:
+		return "", errors.New(fmt.Sprintf("invalid value '%s' for --emit-json (ast, tacky or asm expected)",
+			options.emitJson))
+	}
 
-	if !doNotLink {
-		cmd = exec.Command("gcc", assemblyFile, "-o", outFile)
-	} else {
-		outFile += ".o"
-		cmd = exec.Command("gcc", "-c", assemblyFile, "-o", outFile)
+	if options.emitLlvm || options.emitC {
+		stopAfter = pipeline.PassTackyGen
 	}
 
-	err := cmd.Run()
-	if err != nil {
-		return "", err
+	switch options.dot {
+	case "":
+	case "cfg", "callgraph":
+		stopAfter = pipeline.PassTackyGen
+	default:
+		return "", errors.New(fmt.Sprintf("invalid value '%s' for --dot (cfg or callgraph expected)",
+			options.dot))
 	}
-	return outFile, nil
-}
 
-func compile(preProcessedFile string, options Options) (string, error) {
-	fileContent, err := os.ReadFile(preProcessedFile)
+	syntax, err := asmSyntax(options.machine)
 	if err != nil {
 		return "", err
 	}
-
-	// Run lexer
-	tokens, err := frontend.Tokenize(string(fileContent))
+	pic, err := positionIndependent(options.flags, options.shared)
 	if err != nil {
 		return "", err
 	}
-	if options.stopAfterLex {
-		return "", nil
+	directory, err := os.Getwd()
+	if err != nil {
+		return "", err
 	}
 
-	// Run parser
-	parser := frontend.NewParser(tokens)
-	program, err := parser.ParseProgram()
+	result, err := compiler.Compile(ctx, compiler.Source{Name: sourceFile, Code: string(fileContent)},
+		compiler.Options{
+			Target:         options.target,
+			StopAfter:      stopAfter,
+			DisabledPasses: options.disabledPasses,
+			Warnings:       options.warnings,
+			Syntax:         syntax,
+			DebugInfo:      options.debugInfo,
+			Directory:      directory,
+			PIC:            pic,
+			Verify:         options.verify,
+			VerifyEach:     options.verifyEach,
+			PrintBefore:    options.printBefore,
+			PrintAfter:     options.printAfter,
+			TimePasses:     options.timePasses,
+			Out:            stdout,
+			TimingOut:      stderr,
+		})
+	for _, diagnostic := range result.Diagnostics {
+		switch {
+		case diagnostic.Severity == compiler.SeverityWarning:
+			_, _ = fmt.Fprintln(stderr, diagnostic)
+		case diagnostic.Pos.Line > 0:
+			err = diagnosticError{diagnostic}
+		}
+	}
 	if err != nil {
 		return "", err
 	}
-	if options.stopAfterParse {
-		program.Accept(frontend.NewAstPrinter(4))
-		return "", nil
+
+	if options.dot != "" {
+		return "", result.WriteDot(options.dot, stdout)
 	}
 
-	// Semantic analysis
-	nameCreator := frontend.NewNameCreator()
-	program, globalEnv, err := frontend.AnalyzeSemantics(program, nameCreator)
-	if err != nil {
-		return "", err
+	if jsonKind != pipeline.IrNone {
+		return "", result.WriteJson(jsonKind, stdout)
 	}
-	if options.stopAfterSemAnalysis {
-		program.Accept(frontend.NewAstPrinter(4))
-		return "", nil
+
+	if options.emitC {
+		return "", result.WriteC(stdout)
 	}
 
-	// Create TACKY
-	emitter := tacky.NewTranslator(nameCreator)
-	tackyProgram := emitter.Translate(program)
-	if options.stopAfterIR {
-		return "", nil
+	if options.emitLlvm && outputFile == "" {
+		return "", result.WriteLlvm(stdout)
 	}
 
-	// assembly generation
-	asmProgram := backend.NewTranslator().Translate(tackyProgram)
-	if options.stopAfterCodegen {
-		asmProgram.Accept(backend.NewAsmPrinter(4))
+	if options.emitLlvm {
+		return outputFile, writeLlvm(&result, outputFile)
+	}
+
+	if stopAfter != "" {
+		result.Print(printResult, stdout)
 		return "", nil
 	}
 
-	// emit code
-	assembly := backend.NewCodeGenerator(globalEnv).GenerateCode(*asmProgram)
-	assemblyFile := stripSuffix(preProcessedFile) + ".s"
-	err = os.WriteFile(assemblyFile, []byte(assembly), 0666)
+	if outputFile == "" {
+		_, err = io.WriteString(stdout, result.Assembly)
+		return "", err
+	}
+
+	// write emitted code
+	err = os.WriteFile(outputFile, []byte(result.Assembly), 0666)
 
 	if err != nil {
 		return "", err
 	}
 
-	return assemblyFile, nil
+	return outputFile, nil
+}
+
+// asmSyntax returns the assembler syntax selected with -masm=att|intel
+func asmSyntax(machineOptions []string) (backend.Syntax, error) {
+	syntax := backend.SyntaxAtt
+	for _, option := range machineOptions {
+		name, found := strings.CutPrefix(option, "asm=")
+		if !found {
+			return syntax, errors.New(fmt.Sprintf("unknown machine option '-m%s'", option))
+		}
+		var err error
+		syntax, err = backend.ParseSyntax(name)
+		if err != nil {
+			return syntax, err
+		}
+	}
+	return syntax, nil
+}
+
+// positionIndependent tells whether position-independent code is
+// requested with -fPIC (or -fpic). Shared libraries always consist of
+// position-independent code.
+func positionIndependent(flags []string, shared bool) (bool, error) {
+	pic := shared
+	for _, flag := range flags {
+		switch flag {
+		case "PIC", "pic":
+			pic = true
+		default:
+			return false, errors.New(fmt.Sprintf("unknown option '-f%s'", flag))
+		}
+	}
+	return pic, nil
 }
 
-func preProcess(sourceFile string) (string, error) {
-	preProcessedFile := stripSuffix(sourceFile) + ".i"
-	cmd := exec.Command("gcc", "-E", "-P", sourceFile, "-o", preProcessedFile)
-	err := cmd.Run()
+func writeLlvm(result *compiler.Result, llvmFile string) error {
+	file, err := os.Create(llvmFile)
 	if err != nil {
-		return "", err
+		return err
+	}
+	err = result.WriteLlvm(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
 	}
-	return preProcessedFile, nil
+	return err
 }
 
 func stripSuffix(filename string) string {
@@ -193,7 +356,25 @@ func stripSuffix(filename string) string {
 	return strings.Join(parts, ".")
 }
 
+// singleDashFlags are the long options that are written with a single
+// dash as in gcc (e.g. -shared)
+var singleDashFlags = []string{"shared", "save-temps"}
+
+// gccStyleArgs rewrites the options in singleDashFlags to the double
+// dash form the flag parser expects
+func gccStyleArgs(args []string) []string {
+	var ret []string
+	for _, arg := range args {
+		if name, found := strings.CutPrefix(arg, "-"); found && slices.Contains(singleDashFlags, name) {
+			arg = "--" + name
+		}
+		ret = append(ret, arg)
+	}
+	return ret
+}
+
 func Execute() {
+	rootCmd.SetArgs(gccStyleArgs(os.Args[1:]))
 	err := rootCmd.Execute()
 	if err != nil {
 		os.Exit(1)
@@ -208,5 +389,40 @@ func init() {
 	stopAfterCodegen = rootCmd.PersistentFlags().Bool("codegen", false, "stop after codegen")
 	stopAfterCodeEmission = rootCmd.PersistentFlags().BoolP("emission", "S", false, "stop after emission")
 	doNotLink = rootCmd.PersistentFlags().BoolP("no-linking", "c", false, "don't run linker")
-	rootCmd.MarkFlagsMutuallyExclusive("lex", "parse", "validate", "tacky", "codegen", "emission")
+	printBefore = rootCmd.PersistentFlags().StringSlice("print-before", nil,
+		"print the IR before the given passes (\"all\" for every pass)")
+	printAfter = rootCmd.PersistentFlags().StringSlice("print-after", nil,
+		"print the IR after the given passes (\"all\" for every pass)")
+	disabledPasses = rootCmd.PersistentFlags().StringSlice("disable-pass", nil, "skip the given passes")
+	timePasses = rootCmd.PersistentFlags().Bool("time-passes", false, "report wall time and allocations per pass")
+	verify = rootCmd.PersistentFlags().Bool("verify", false, "verify the TACKY and the assembly program")
+	verifyEach = rootCmd.PersistentFlags().Bool("verify-each", false, "verify the IR after each pass")
+	emitJson = rootCmd.PersistentFlags().String("emit-json", "",
+		"print the AST, TACKY or assembly program as JSON and stop (ast|tacky|asm)")
+	emitLlvm = rootCmd.PersistentFlags().Bool("emit-llvm", false, "write the program as LLVM IR (.ll) and stop")
+	emitC = rootCmd.PersistentFlags().Bool("emit-c", false, "print the TACKY program as portable C99 and stop")
+	dot = rootCmd.PersistentFlags().String("dot", "",
+		"print the control flow graphs or the call graph in Graphviz format and stop (cfg|callgraph)")
+	warnings = rootCmd.PersistentFlags().StringArrayP("warning", "W", nil,
+		"enable (-W<name>) or disable (-Wno-<name>) warnings; -Wall, -Wextra, -Werror")
+	machine = rootCmd.PersistentFlags().StringArrayP("machine", "m", nil,
+		"machine dependent options; -masm=att|intel selects the assembler syntax for x86_64")
+	debugInfo = rootCmd.PersistentFlags().BoolP("debug", "g", false,
+		"emit DWARF debug information (line numbers, call frames and variables)")
+	flags = rootCmd.PersistentFlags().StringArrayP("flag", "f", nil,
+		"code generation options; -fPIC generates position-independent code (x86_64 only)")
+	shared = rootCmd.PersistentFlags().Bool("shared", false,
+		"link a shared library (.so) instead of an executable; implies -fPIC")
+	outputFile = rootCmd.PersistentFlags().StringP("output", "o", "", "write the output to the given file (- for stdout with -E, -S and -c)")
+	preProcessOnly = rootCmd.PersistentFlags().BoolP("preprocess", "E", false,
+		"stop after preprocessing; the output goes to stdout unless -o is given")
+	libraries = rootCmd.PersistentFlags().StringArrayP("library", "l", nil, "link the given library (-l<name>)")
+	libraryPaths = rootCmd.PersistentFlags().StringArrayP("library-path", "L", nil,
+		"add a directory to the library search path (-L<dir>)")
+	saveTemps = rootCmd.PersistentFlags().Bool("save-temps", false,
+		"keep the intermediate files in the current directory")
+	targetName = rootCmd.PersistentFlags().String("target", pipeline.DefaultTarget().Name(),
+		"generate code for the given target (x86_64-linux|aarch64-linux|riscv64-linux|wasm32)")
+	rootCmd.MarkFlagsMutuallyExclusive("preprocess", "lex", "parse", "validate", "tacky", "codegen", "emission", "emit-json",
+		"emit-llvm", "emit-c", "dot")
 }
@@ -0,0 +1,273 @@
+// Package compiler is the API for embedding tbcc. Compile runs the
+// pipeline on a source held in memory and returns all intermediate
+// representations.
+package compiler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/backend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/pipeline"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/tacky"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Source is a translation unit
+type Source struct {
+	// Name is the file name used in diagnostics and debug information
+	Name string
+	// Code must be preprocessed unless Options.Preprocess is set
+	Code string
+}
+
+type Options struct {
+	// Target selects the backend (default: pipeline.DefaultTarget())
+	Target pipeline.Target
+	// StopAfter names the last pass to be run (empty: run all passes)
+	StopAfter      string
+	DisabledPasses []string
+	// Warnings are the warning options without -W, e.g. "all" or
+	// "no-unused-variable"
+	Warnings []string
+	Syntax   backend.Syntax
+	// DebugInfo requests debug information. Directory is recorded in it
+	// as the compilation directory.
+	DebugInfo  bool
+	Directory  string
+	PIC        bool
+	Verify     bool
+	VerifyEach bool
+	// Preprocess runs the preprocessor of the target on the code first.
+	// This is the only option which starts a process and reads files
+	// (the included headers).
+	Preprocess bool
+	// PrintBefore, PrintAfter and TimePasses write IR dumps to Out and
+	// the timing report to TimingOut. Both are discarded if nil.
+	PrintBefore []string
+	PrintAfter  []string
+	TimePasses  bool
+	Out         io.Writer
+	TimingOut   io.Writer
+}
+
+// Result holds the representations of the unit after the last pass
+// that produced them. Representations of passes that did not run are
+// nil (or empty).
+type Result struct {
+	Tokens      []frontend.Token
+	Ast         *frontend.Program
+	Tacky       *tacky.Program
+	Asm         *backend.Program
+	Assembly    string
+	Diagnostics []Diagnostic
+	Timings     []pipeline.PassTiming
+	unit        *pipeline.Unit
+}
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic is an error or a warning. Only warnings have a category
+// (the name of the warning option). The lexer, the parser and the
+// semantic passes report errors with a position; the position of other
+// errors is zero.
+type Diagnostic struct {
+	Severity Severity
+	File     string
+	Pos      frontend.Position
+	Category string
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	switch {
+	case d.Severity == SeverityWarning:
+		return fmt.Sprintf("%s:%d:%d: %s: %s [-W%s]", d.File, d.Pos.Line, d.Pos.Col, d.Severity, d.Message,
+			d.Category)
+	case d.Pos.Line > 0:
+		return fmt.Sprintf("%s:%d:%d: %s: %s", d.File, d.Pos.Line, d.Pos.Col, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s", d.File, d.Message)
+}
+
+// Compile translates the source. If it fails, the result holds the
+// representations produced so far and an error diagnostic.
+func Compile(ctx context.Context, source Source, options Options) (Result, error) {
+	if options.Target == nil {
+		options.Target = pipeline.DefaultTarget()
+	}
+	unit := pipeline.NewUnit(source.Code)
+	ret := Result{unit: unit}
+
+	err := checkOptions(options)
+	if err == nil && options.Preprocess {
+		unit.Source, err = preProcess(ctx, source, options.Target)
+	}
+	if err != nil {
+		ret.addError(source, err)
+		return ret, err
+	}
+
+	for _, option := range options.Warnings {
+		err = unit.WarningOptions.Set(option)
+		if err != nil {
+			ret.addError(source, err)
+			return ret, err
+		}
+	}
+	unit.AsmSyntax = options.Syntax
+	unit.DebugInfo = options.DebugInfo
+	unit.SourceFile = source.Name
+	unit.Directory = options.Directory
+	unit.PIC = options.PIC
+
+	out, timingOut := options.Out, options.TimingOut
+	if out == nil {
+		out = io.Discard
+	}
+	if timingOut == nil {
+		timingOut = io.Discard
+	}
+	manager := pipeline.NewDefaultManager(pipeline.Options{
+		PrintBefore:  options.PrintBefore,
+		PrintAfter:   options.PrintAfter,
+		DisabledPass: options.DisabledPasses,
+		TimePasses:   options.TimePasses,
+		Verify:       options.Verify,
+		VerifyEach:   options.VerifyEach,
+		StopAfter:    options.StopAfter,
+		Target:       options.Target,
+		Out:          out,
+		TimingOut:    timingOut,
+	})
+	err = manager.RunContext(ctx, unit)
+
+	ret.Tokens = unit.Tokens
+	ret.Ast = unit.Ast
+	ret.Tacky = unit.Tacky
+	ret.Asm = unit.Asm
+	ret.Assembly = unit.Assembly
+	ret.Timings = manager.Timings()
+	for _, warning := range unit.Warnings {
+		ret.Diagnostics = append(ret.Diagnostics, Diagnostic{
+			Severity: SeverityWarning,
+			File:     fileName(source, warning.Pos),
+			Pos:      warning.Pos,
+			Category: warning.Category,
+			Message:  warning.Message,
+		})
+	}
+	if err != nil {
+		ret.addError(source, err)
+	}
+
+	return ret, err
+}
+
+// checkOptions rejects the options only the default target supports
+func checkOptions(options Options) error {
+	if options.Target == pipeline.DefaultTarget() {
+		return nil
+	}
+	switch {
+	case options.Syntax != backend.SyntaxAtt:
+		return errors.New(fmt.Sprintf("-masm=%s is not supported for target %s", options.Syntax,
+			options.Target.Name()))
+	case options.DebugInfo:
+		return errors.New(fmt.Sprintf("-g is not supported for target %s", options.Target.Name()))
+	case options.PIC:
+		return errors.New(fmt.Sprintf("position-independent code is not supported for target %s",
+			options.Target.Name()))
+	case options.StopAfter != "" && !hasPass(options.Target, options.StopAfter):
+		// e.g. --codegen and --emit-json=asm stop after instruction-fixup
+		return errors.New(fmt.Sprintf("stopping after %s is not supported for target %s", options.StopAfter,
+			options.Target.Name()))
+	}
+	return nil
+}
+
+func hasPass(target pipeline.Target, name string) bool {
+	for _, pass := range append(pipeline.FrontendPasses(), target.Passes()...) {
+		if pass.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// preProcess pipes the code through the preprocessor. Quoted includes
+// are searched in the directory of the source.
+func preProcess(ctx context.Context, source Source, target pipeline.Target) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, target.CC(), "-E", "-iquote", filepath.Dir(source.Name), "-x", "c", "-")
+	cmd.Stdin = strings.NewReader(source.Code)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", errors.New(strings.ReplaceAll(message, "<stdin>", source.Name))
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// fileName returns the name of the included file a position belongs
+// to or the name of the source
+func fileName(source Source, pos frontend.Position) string {
+	if pos.File != "" {
+		return pos.File
+	}
+	return source.Name
+}
+
+func (r *Result) addError(source Source, err error) {
+	pos, _ := frontend.ErrorPosition(err)
+	r.Diagnostics = append(r.Diagnostics, Diagnostic{
+		Severity: SeverityError,
+		File:     fileName(source, pos),
+		Pos:      pos,
+		Message:  err.Error(),
+	})
+}
+
+// Print, WriteJson, WriteDot, WriteLlvm and WriteC write the unit like
+// the corresponding methods of pipeline.Unit
+
+func (r *Result) Print(kind pipeline.IrKind, out io.Writer) {
+	r.unit.Print(kind, out)
+}
+
+func (r *Result) WriteJson(kind pipeline.IrKind, out io.Writer) error {
+	return r.unit.WriteJson(kind, out)
+}
+
+func (r *Result) WriteDot(graph string, out io.Writer) error {
+	return r.unit.WriteDot(graph, out)
+}
+
+func (r *Result) WriteLlvm(out io.Writer) error {
+	return r.unit.WriteLlvm(out)
+}
+
+func (r *Result) WriteC(out io.Writer) error {
+	return r.unit.WriteC(out)
+}
@@ -0,0 +1,132 @@
+package compiler
+
+import (
+	"context"
+	"errors"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/pipeline"
+	"strings"
+	"testing"
+)
+
+const testCode = `
+int add(int a, int b) {
+	int unused;
+	return a + b;
+}
+
+int main(void) {
+	return add(1, 2);
+}
+`
+
+func TestCompile(t *testing.T) {
+	result, err := Compile(context.Background(), Source{Name: "add.c", Code: testCode},
+		Options{Warnings: []string{"all"}})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	if len(result.Tokens) == 0 || result.Ast == nil || result.Tacky == nil || result.Asm == nil {
+		t.Errorf("Compile() did not return all intermediate representations")
+	}
+	if !strings.Contains(result.Assembly, "call add") {
+		t.Errorf("Compile() assembly does not contain call of add:\n%s", result.Assembly)
+	}
+	if len(result.Diagnostics) != 1 {
+		t.Fatalf("got %d diagnostics, want 1", len(result.Diagnostics))
+	}
+	warning := result.Diagnostics[0]
+	if warning.Severity != SeverityWarning || warning.Category != "unused-variable" || warning.Pos.Line != 3 {
+		t.Errorf("unexpected diagnostic %v", warning)
+	}
+	if got := warning.String(); !strings.HasPrefix(got, "add.c:3:2: warning: unused variable 'unused'") {
+		t.Errorf("Diagnostic.String() = %s", got)
+	}
+}
+
+func TestCompile_StopAfter(t *testing.T) {
+	result, err := Compile(context.Background(), Source{Name: "add.c", Code: testCode},
+		Options{StopAfter: pipeline.PassTackyGen})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	if result.Tacky == nil || result.Asm != nil || result.Assembly != "" {
+		t.Errorf("Compile() should have stopped after %s", pipeline.PassTackyGen)
+	}
+	var out strings.Builder
+	if err = result.WriteC(&out); err != nil || !strings.Contains(out.String(), "add(") {
+		t.Errorf("WriteC() error = %v, output:\n%s", err, out.String())
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	result, err := Compile(context.Background(), Source{Name: "bad.c", Code: "int main(void) { return x; }"},
+		Options{})
+	if err == nil {
+		t.Fatalf("Compile() should have returned an error")
+	}
+	if result.Ast == nil || result.Tacky != nil {
+		t.Errorf("Compile() should return the AST parsed before the error")
+	}
+	if len(result.Diagnostics) != 1 || result.Diagnostics[0].Severity != SeverityError {
+		t.Fatalf("Compile() should report the error as diagnostic: %v", result.Diagnostics)
+	}
+	if got := result.Diagnostics[0].String(); got != "bad.c:1:25: error: identifier 'x' is not defined" {
+		t.Errorf("Diagnostic.String() = %s", got)
+	}
+
+	for code, want := range map[string]frontend.Position{
+		"int main(void) {\n\treturn 1 @ 2;\n}":                {Line: 2, Col: 11},
+		"int main(void) {\n\treturn 1 +;\n}":                  {Line: 2, Col: 12},
+		"int main(void) {\n\tint *p = 0;\n\treturn -p;\n}":    {Line: 3, Col: 9},
+		"int main(void) {\n\tbreak;\n}":                       {Line: 2, Col: 2},
+		"int main(void) {\n\tgoto end;\n}":                    {Line: 2, Col: 2},
+		"int main(void) {\n\t1 = 2;\n\treturn 0;\n}":          {Line: 2, Col: 4},
+		"enum { A };\n\nint A;":                               {Line: 3, Col: 1},
+		"int main(void) {\n\t{\n\t\textern int main;\n\t}\n}": {Line: 3, Col: 3},
+		"int x;\n\nint y = x;":                                {Line: 3, Col: 1},
+		"int *p = 0;\nint q =\n\tp;":                          {Line: 2, Col: 1},
+		"enum E {\n\tA,\n\tB = A / 0\n};":                     {Line: 3, Col: 2},
+		"struct s {\n\tint a;\n\tint b : 40;\n};":             {Line: 3, Col: 6},
+		"struct s {\n\tint a;\n\tint : -1;\n};":               {Line: 3, Col: 2},
+	} {
+		result, err = Compile(context.Background(), Source{Name: "bad.c", Code: code}, Options{})
+		if err == nil || len(result.Diagnostics) != 1 {
+			t.Fatalf("Compile() should have returned an error for %q", code)
+		}
+		if got := result.Diagnostics[0].Pos; got != want {
+			t.Errorf("position of %q = %v, want %v", result.Diagnostics[0].Message, got, want)
+		}
+	}
+
+	code := "# 1 \"bad.c\"\n# 1 \"bad.h\" 1\nint f(void) { return x; }\n# 2 \"bad.c\" 2\nint main(void) { return y; }\n"
+	result, _ = Compile(context.Background(), Source{Name: "bad.c", Code: code}, Options{})
+	if len(result.Diagnostics) != 1 || result.Diagnostics[0].String() != "bad.h:1:22: error: identifier 'x' is not defined" {
+		t.Errorf("error in an included file reported as %v", result.Diagnostics)
+	}
+
+	riscv, _ := pipeline.LookupTarget("riscv64-linux")
+	if _, err = Compile(context.Background(), Source{Code: testCode}, Options{Target: riscv, PIC: true}); err == nil {
+		t.Errorf("Compile() should reject -fPIC for %s", riscv.Name())
+	}
+	for _, name := range []string{"aarch64-linux", "riscv64-linux", "wasm32"} {
+		target, _ := pipeline.LookupTarget(name)
+		_, err = Compile(context.Background(), Source{Code: testCode},
+			Options{Target: target, StopAfter: pipeline.PassInstructionFixup})
+		if err == nil || err.Error() != "stopping after instruction-fixup is not supported for target "+name {
+			t.Errorf("Compile() error = %v, want rejection of the asm IR for %s", err, name)
+		}
+	}
+	aarch64, _ := pipeline.LookupTarget("aarch64-linux")
+	_, err = Compile(context.Background(), Source{Code: testCode},
+		Options{Target: aarch64, StopAfter: pipeline.PassTackyGen})
+	if err != nil {
+		t.Errorf("Compile() error = %v, want none when stopping after %s", err, pipeline.PassTackyGen)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = Compile(ctx, Source{Code: testCode}, Options{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Compile() error = %v, want %v", err, context.Canceled)
+	}
+}
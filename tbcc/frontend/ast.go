@@ -6,6 +6,9 @@ const (
 	AstProgram AstType = iota
 	AstFunction
 	AstVarDecl
+	AstEnumDecl
+	AstStructDecl
+	AstTypedefDecl
 	AstReturn
 	AstExprStmt
 	AstIfStmt
@@ -24,9 +27,20 @@ const (
 	AstVariable
 	AstFunctionCall
 	AstUnary
+	AstPrefixIncDec
 	AstPostfixIncDec
 	AstBinary
+	AstCompoundAssignment
 	AstConditional
+	AstAddressOf
+	AstDereference
+	AstMemberAccess
+	AstCast
+	AstSizeOfType
+	AstSizeOfExpr
+	AstVaStart
+	AstVaArg
+	AstVaEnd
 )
 
 type AST interface {
@@ -38,6 +52,9 @@ type AstVisitor interface {
 	VisitProgram(p *Program)
 	VisitFunction(f *Function)
 	VisitVarDecl(v *VarDecl)
+	VisitEnumDecl(e *EnumDecl)
+	VisitStructDecl(s *StructDecl)
+	VisitTypedefDecl(t *TypedefDecl)
 	VisitReturn(r *ReturnStmt)
 	VisitExprStmt(e *ExpressionStmt)
 	VisitIfStmt(i *IfStmt)
@@ -51,17 +68,32 @@ type AstVisitor interface {
 	VisitContinueStmt(c *ContinueStmt)
 	VisitSwitchStmt(s *SwitchStmt)
 	VisitCaseStmt(c *CaseStmt)
-	VisitNullStmt()
+	VisitNullStmt(n *NullStmt)
 	VisitInteger(i *IntegerLiteral)
 	VisitVariable(v *Variable)
 	VisitFunctionCall(f *FunctionCall)
 	VisitUnary(u *UnaryExpression)
+	VisitPrefixIncDec(p *PrefixIncDec)
 	VisitPostfixIncDec(p *PostfixIncDec)
 	VisitBinary(b *BinaryExpression)
+	VisitCompoundAssignment(c *CompoundAssignment)
 	VisitConditional(c *Conditional)
+	VisitAddressOf(a *AddressOf)
+	VisitDereference(d *Dereference)
+	VisitMemberAccess(m *MemberAccess)
+	VisitCast(c *Cast)
+	VisitSizeOfType(s *SizeOfType)
+	VisitSizeOfExpr(s *SizeOfExpr)
+	VisitVaStart(v *VaStart)
+	VisitVaArg(v *VaArg)
+	VisitVaEnd(v *VaEnd)
 }
 
 type Program struct {
+	// TypeDecls are the enum, struct, union and typedef declarations at file scope
+	TypeDecls []BodyItem
+	// Variables are the variable declarations at file scope
+	Variables []VarDecl
 	Functions []Function
 }
 
@@ -74,13 +106,22 @@ func (p *Program) Accept(visitor AstVisitor) {
 
 type Parameter struct {
 	Name string
-	TyId TypeId
+	Type TypeInfo
+	Pos  Position
+	// SourceName is the name before identifier resolution made it unique
+	SourceName string
 }
 
 type Function struct {
-	Name   string
-	Params []Parameter
-	Body   *BlockStmt
+	Name       string
+	Params     []Parameter
+	ReturnType TypeInfo
+	// Variadic is set if the parameter list ends with "..."
+	Variadic bool
+	Body     *BlockStmt
+	Pos      Position
+	// Visibility is set by __attribute__((visibility(...)))
+	Visibility Visibility
 }
 
 func (f *Function) GetType() AstType {
@@ -96,8 +137,61 @@ type BodyItem interface {
 }
 
 type VarDecl struct {
-	Name      string
-	InitValue Expression
+	Name         string
+	VarType      TypeInfo
+	InitValue    Expression
+	StorageClass StorageClass
+	Pos          Position
+	// SourceName is the name of a local variable before identifier
+	// resolution made it unique
+	SourceName string
+	// Visibility is set by __attribute__((visibility(...)))
+	Visibility Visibility
+}
+
+// StorageClass is given by the storage class specifier of a declaration
+type StorageClass int
+
+const (
+	StorageNone StorageClass = iota
+	StorageStatic
+	StorageExtern
+)
+
+func (s StorageClass) String() string {
+	switch s {
+	case StorageStatic:
+		return "static"
+	case StorageExtern:
+		return "extern"
+	default:
+		return ""
+	}
+}
+
+// Visibility is the ELF symbol visibility of a function or variable. It
+// determines whether the symbol is exported from a shared library and
+// whether other modules may preempt it.
+type Visibility int
+
+const (
+	VisibilityDefault Visibility = iota
+	VisibilityHidden
+	VisibilityProtected
+	VisibilityInternal
+)
+
+func (v Visibility) String() string {
+	switch v {
+	case VisibilityHidden:
+		return "hidden"
+	case VisibilityProtected:
+		return "protected"
+	case VisibilityInternal:
+		return "internal"
+	default:
+		return "default"
+	}
 }
 
 func (v *VarDecl) GetType() AstType {
@@ -108,12 +202,76 @@ func (v *VarDecl) Accept(visitor AstVisitor) {
 	visitor.VisitVarDecl(v)
 }
 
+// EnumDecl is the definition of an enumeration. The values of the
+// constants are stored in EnumType by the type checker.
+type EnumDecl struct {
+	EnumType *EnumInfo
+	Members  []EnumMember
+	Pos      Position
+}
+
+type EnumMember struct {
+	Name  string
+	Value Expression // nil if the value is implicit
+	Pos   Position
+}
+
+func (e *EnumDecl) GetType() AstType {
+	return AstEnumDecl
+}
+
+func (e *EnumDecl) Accept(visitor AstVisitor) {
+	visitor.VisitEnumDecl(e)
+}
+
+// StructDecl is the definition of a structure or union. The layout
+// is stored in StructType by the type checker. A declaration without
+// members (e.g. "struct node;") declares the tag only.
+type StructDecl struct {
+	StructType *StructInfo
+	Members    []MemberDecl
+	Pos        Position
+}
+
+type MemberDecl struct {
+	Name string // empty for unnamed bit-fields
+	Type TypeInfo
+	// BitWidth is nil if the member is not a bit-field
+	BitWidth Expression
+	// Unsigned is set for bit-fields declared as "unsigned"
+	Unsigned bool
+	Pos      Position
+}
+
+func (s *StructDecl) GetType() AstType {
+	return AstStructDecl
+}
+
+func (s *StructDecl) Accept(visitor AstVisitor) {
+	visitor.VisitStructDecl(s)
+}
+
+type TypedefDecl struct {
+	Name string
+	Type TypeInfo
+	Pos  Position
+}
+
+func (t *TypedefDecl) GetType() AstType {
+	return AstTypedefDecl
+}
+
+func (t *TypedefDecl) Accept(visitor AstVisitor) {
+	visitor.VisitTypedefDecl(t)
+}
+
 type Statement interface {
 	AST
 }
 
 type ReturnStmt struct {
 	Expression Expression
+	Pos        Position
 }
 
 func (r *ReturnStmt) GetType() AstType {
@@ -126,6 +284,7 @@ func (r *ReturnStmt) Accept(visitor AstVisitor) {
 
 type ExpressionStmt struct {
 	Expression Expression
+	Pos        Position
 }
 
 func (e *ExpressionStmt) GetType() AstType {
@@ -140,6 +299,7 @@ type IfStmt struct {
 	Condition  Expression
 	Consequent Statement
 	Alternate  Statement
+	Pos        Position
 }
 
 func (i *IfStmt) GetType() AstType {
@@ -152,6 +312,7 @@ func (i *IfStmt) Accept(visitor AstVisitor) {
 
 type BlockStmt struct {
 	Items []BodyItem
+	Pos   Position
 }
 
 func (b *BlockStmt) GetType() AstType {
@@ -164,6 +325,7 @@ func (b *BlockStmt) Accept(visitor AstVisitor) {
 
 type GotoStmt struct {
 	Target string
+	Pos    Position
 }
 
 func (g *GotoStmt) GetType() AstType {
@@ -176,6 +338,7 @@ func (g *GotoStmt) Accept(visitor AstVisitor) {
 
 type LabelStmt struct {
 	Name string
+	Pos  Position
 }
 
 func (l *LabelStmt) GetType() AstType {
@@ -190,6 +353,7 @@ type DoWhileStmt struct {
 	Condition Expression
 	Body      Statement
 	Label     string
+	Pos       Position
 }
 
 func (d *DoWhileStmt) GetType() AstType {
@@ -204,6 +368,7 @@ type WhileStmt struct {
 	Condition Expression
 	Body      Statement
 	Label     string
+	Pos       Position
 }
 
 func (w *WhileStmt) GetType() AstType {
@@ -220,6 +385,7 @@ type ForStmt struct {
 	Post      Expression
 	Body      Statement
 	Label     string
+	Pos       Position
 }
 
 func (f *ForStmt) GetType() AstType {
@@ -232,6 +398,7 @@ func (f *ForStmt) Accept(visitor AstVisitor) {
 
 type BreakStmt struct {
 	Label string
+	Pos   Position
 }
 
 func (b *BreakStmt) GetType() AstType {
@@ -244,6 +411,7 @@ func (b *BreakStmt) Accept(visitor AstVisitor) {
 
 type ContinueStmt struct {
 	Label string
+	Pos   Position
 }
 
 func (c *ContinueStmt) GetType() AstType {
@@ -259,6 +427,7 @@ type SwitchStmt struct {
 	Body           Statement
 	Label          string
 	FirstCaseLabel string
+	Pos            Position
 }
 
 func (s *SwitchStmt) GetType() AstType {
@@ -274,6 +443,7 @@ type CaseStmt struct {
 	Label         string
 	PrevCaseLabel string
 	NextCaseLabel string
+	Pos           Position
 }
 
 func (c *CaseStmt) GetType() AstType {
@@ -284,22 +454,43 @@ func (c *CaseStmt) Accept(visitor AstVisitor) {
 	visitor.VisitCaseStmt(c)
 }
 
-type NullStmt struct{}
+type NullStmt struct {
+	Pos Position
+}
 
 func (n *NullStmt) GetType() AstType {
 	return AstNullStmt
 }
 
 func (n *NullStmt) Accept(visitor AstVisitor) {
-	visitor.VisitNullStmt()
+	visitor.VisitNullStmt(n)
 }
 
 type Expression interface {
 	AST
+	// GetResultType returns the type determined by the type checker
+	// (nil before type checking)
+	GetResultType() TypeInfo
+	SetResultType(resultType TypeInfo)
+}
+
+// exprInfo is embedded in all expression nodes
+type exprInfo struct {
+	resultType TypeInfo
+}
+
+func (e *exprInfo) GetResultType() TypeInfo {
+	return e.resultType
+}
+
+func (e *exprInfo) SetResultType(resultType TypeInfo) {
+	e.resultType = resultType
 }
 
 type IntegerLiteral struct {
+	exprInfo
 	Value int
+	Pos   Position
 }
 
 func (i *IntegerLiteral) GetType() AstType {
@@ -311,7 +502,9 @@ func (i *IntegerLiteral) Accept(visitor AstVisitor) {
 }
 
 type Variable struct {
+	exprInfo
 	Name string
+	Pos  Position
 }
 
 func (v *Variable) GetType() AstType {
@@ -323,8 +516,10 @@ func (v *Variable) Accept(visitor AstVisitor) {
 }
 
 type FunctionCall struct {
-	Callee string
+	exprInfo
+	Callee Expression // a function designator or a function pointer
 	Args   []Expression
+	Pos    Position
 }
 
 func (f *FunctionCall) GetType() AstType {
@@ -336,8 +531,10 @@ func (f *FunctionCall) Accept(visitor AstVisitor) {
 }
 
 type UnaryExpression struct {
-	Operator string
+	exprInfo
+	Operator UnaryOp
 	Right    Expression
+	Pos      Position
 }
 
 func (u *UnaryExpression) GetType() AstType {
@@ -348,9 +545,26 @@ func (u *UnaryExpression) Accept(visitor AstVisitor) {
 	visitor.VisitUnary(u)
 }
 
+type PrefixIncDec struct {
+	exprInfo
+	Operator IncDecOp
+	Operand  Expression
+	Pos      Position
+}
+
+func (p *PrefixIncDec) GetType() AstType {
+	return AstPrefixIncDec
+}
+
+func (p *PrefixIncDec) Accept(visitor AstVisitor) {
+	visitor.VisitPrefixIncDec(p)
+}
+
 type PostfixIncDec struct {
-	Operator string
-	Operand  Variable
+	exprInfo
+	Operator IncDecOp
+	Operand  Expression
+	Pos      Position
 }
 
 func (p *PostfixIncDec) GetType() AstType {
@@ -362,9 +576,11 @@ func (p *PostfixIncDec) Accept(visitor AstVisitor) {
 }
 
 type BinaryExpression struct {
-	Operator string
+	exprInfo
+	Operator BinaryOp
 	Left     Expression
 	Right    Expression
+	Pos      Position
 }
 
 func (b *BinaryExpression) GetType() AstType {
@@ -375,10 +591,30 @@ func (b *BinaryExpression) Accept(visitor AstVisitor) {
 	visitor.VisitBinary(b)
 }
 
+// CompoundAssignment is an assignment like a += 1 where the
+// left side is evaluated only once
+type CompoundAssignment struct {
+	exprInfo
+	Operator BinaryOp
+	Left     Expression
+	Right    Expression
+	Pos      Position
+}
+
+func (c *CompoundAssignment) GetType() AstType {
+	return AstCompoundAssignment
+}
+
+func (c *CompoundAssignment) Accept(visitor AstVisitor) {
+	visitor.VisitCompoundAssignment(c)
+}
+
 type Conditional struct {
+	exprInfo
 	Condition  Expression
 	Consequent Expression
 	Alternate  Expression
+	Pos        Position
 }
 
 func (c *Conditional) GetType() AstType {
@@ -388,3 +624,141 @@ func (c *Conditional) GetType() AstType {
 func (c *Conditional) Accept(visitor AstVisitor) {
 	visitor.VisitConditional(c)
 }
+
+type AddressOf struct {
+	exprInfo
+	Operand Expression
+	Pos     Position
+}
+
+func (a *AddressOf) GetType() AstType {
+	return AstAddressOf
+}
+
+func (a *AddressOf) Accept(visitor AstVisitor) {
+	visitor.VisitAddressOf(a)
+}
+
+type Dereference struct {
+	exprInfo
+	Operand Expression
+	Pos     Position
+}
+
+func (d *Dereference) GetType() AstType {
+	return AstDereference
+}
+
+func (d *Dereference) Accept(visitor AstVisitor) {
+	visitor.VisitDereference(d)
+}
+
+// MemberAccess is the access to a member of a structure or union:
+// object.Member. The parser turns p->m into (*p).m.
+type MemberAccess struct {
+	exprInfo
+	Object Expression
+	Member string
+	Pos    Position
+}
+
+func (m *MemberAccess) GetType() AstType {
+	return AstMemberAccess
+}
+
+func (m *MemberAccess) Accept(visitor AstVisitor) {
+	visitor.VisitMemberAccess(m)
+}
+
+type Cast struct {
+	exprInfo
+	TargetType TypeInfo
+	Operand    Expression
+	Pos        Position
+}
+
+func (c *Cast) GetType() AstType {
+	return AstCast
+}
+
+func (c *Cast) Accept(visitor AstVisitor) {
+	visitor.VisitCast(c)
+}
+
+// SizeOfType is sizeof applied to a type name: sizeof(int *)
+type SizeOfType struct {
+	exprInfo
+	TargetType TypeInfo
+	Pos        Position
+}
+
+func (s *SizeOfType) GetType() AstType {
+	return AstSizeOfType
+}
+
+func (s *SizeOfType) Accept(visitor AstVisitor) {
+	visitor.VisitSizeOfType(s)
+}
+
+// SizeOfExpr is sizeof applied to an expression which is not evaluated
+type SizeOfExpr struct {
+	exprInfo
+	Operand Expression
+	Pos     Position
+}
+
+func (s *SizeOfExpr) GetType() AstType {
+	return AstSizeOfExpr
+}
+
+func (s *SizeOfExpr) Accept(visitor AstVisitor) {
+	visitor.VisitSizeOfExpr(s)
+}
+
+// VaStart is the builtin __builtin_va_start(ap, last) that va_start expands to
+type VaStart struct {
+	exprInfo
+	VaList Expression
+	// LastParam is the last named parameter of the function
+	LastParam Expression
+	Pos       Position
+}
+
+func (v *VaStart) GetType() AstType {
+	return AstVaStart
+}
+
+func (v *VaStart) Accept(visitor AstVisitor) {
+	visitor.VisitVaStart(v)
+}
+
+// VaArg is the builtin __builtin_va_arg(ap, type) that va_arg expands to
+type VaArg struct {
+	exprInfo
+	VaList  Expression
+	ArgType TypeInfo
+	Pos     Position
+}
+
+func (v *VaArg) GetType() AstType {
+	return AstVaArg
+}
+
+func (v *VaArg) Accept(visitor AstVisitor) {
+	visitor.VisitVaArg(v)
+}
+
+// VaEnd is the builtin __builtin_va_end(ap) that va_end expands to
+type VaEnd struct {
+	exprInfo
+	VaList Expression
+	Pos    Position
+}
+
+func (v *VaEnd) GetType() AstType {
+	return AstVaEnd
+}
+
+func (v *VaEnd) Accept(visitor AstVisitor) {
+	visitor.VisitVaEnd(v)
+}
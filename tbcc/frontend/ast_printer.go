@@ -1,20 +1,35 @@
 package frontend
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+)
 
 type AstPrinter struct {
 	offset          int
 	delta           int
 	suppressPadding bool
+	out             io.Writer
 }
 
 func NewAstPrinter(delta int) *AstPrinter {
-	return &AstPrinter{0, delta, false}
+	return NewAstPrinterWithWriter(delta, os.Stdout)
+}
+
+func NewAstPrinterWithWriter(delta int, out io.Writer) *AstPrinter {
+	return &AstPrinter{0, delta, false, out}
 }
 
 func (ap *AstPrinter) VisitProgram(p *Program) {
 	ap.println("Program(")
 	ap.indent()
+	for _, decl := range p.TypeDecls {
+		decl.Accept(ap)
+	}
+	for _, v := range p.Variables {
+		v.Accept(ap)
+	}
 	for _, fun := range p.Functions {
 		fun.Accept(ap)
 	}
@@ -26,15 +41,19 @@ func (ap *AstPrinter) VisitFunction(f *Function) {
 	ap.println("Function(")
 	ap.indent()
 	ap.println("name=\"" + f.Name + "\"")
+	ap.println("returnType=" + f.ReturnType.String())
 	if len(f.Params) > 0 {
 		ap.println("parameters=[")
 		ap.indent()
 		for _, param := range f.Params {
-			ap.println(fmt.Sprintf("%s: int", param.Name))
+			ap.println(fmt.Sprintf("%s: %s", param.Name, param.Type))
 		}
 		ap.dedent()
 		ap.println("]")
 	}
+	if f.Variadic {
+		ap.println("variadic=true")
+	}
 	if f.Body != nil {
 		ap.print("body=")
 		ap.suppressPadding = true
@@ -48,6 +67,10 @@ func (ap *AstPrinter) VisitVarDecl(v *VarDecl) {
 	ap.println("VarDeclaration(")
 	ap.indent()
 	ap.println("name=\"" + v.Name + "\"")
+	ap.println("type=" + v.VarType.String())
+	if v.StorageClass != StorageNone {
+		ap.println("storageClass=" + v.StorageClass.String())
+	}
 	if v.InitValue != nil {
 		ap.print("initValue=")
 		ap.suppressPadding = true
@@ -57,10 +80,69 @@ func (ap *AstPrinter) VisitVarDecl(v *VarDecl) {
 	ap.println(")")
 }
 
+func (ap *AstPrinter) VisitEnumDecl(e *EnumDecl) {
+	ap.println("EnumDeclaration(")
+	ap.indent()
+	ap.println("type=" + e.EnumType.String())
+	ap.println("members=[")
+	ap.indent()
+	for _, member := range e.Members {
+		if member.Value != nil {
+			ap.print(member.Name + "=")
+			ap.suppressPadding = true
+			member.Value.Accept(ap)
+		} else {
+			ap.println(member.Name)
+		}
+	}
+	ap.dedent()
+	ap.println("]")
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AstPrinter) VisitStructDecl(s *StructDecl) {
+	ap.println("StructDeclaration(")
+	ap.indent()
+	ap.println("type=" + s.StructType.String())
+	if s.Members != nil {
+		ap.println("members=[")
+		ap.indent()
+		for _, member := range s.Members {
+			line := typeString(member.Type, member.Name)
+			if member.Unsigned {
+				line = "unsigned " + line
+			}
+			if member.BitWidth != nil {
+				ap.print(line + " : ")
+				ap.suppressPadding = true
+				member.BitWidth.Accept(ap)
+			} else {
+				ap.println(line)
+			}
+		}
+		ap.dedent()
+		ap.println("]")
+	}
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AstPrinter) VisitTypedefDecl(t *TypedefDecl) {
+	ap.println("TypedefDeclaration(")
+	ap.indent()
+	ap.println("name=\"" + t.Name + "\"")
+	ap.println("type=" + t.Type.String())
+	ap.dedent()
+	ap.println(")")
+}
+
 func (ap *AstPrinter) VisitReturn(r *ReturnStmt) {
 	ap.println("Return(")
 	ap.indent()
-	r.Expression.Accept(ap)
+	if r.Expression != nil {
+		r.Expression.Accept(ap)
+	}
 	ap.dedent()
 	ap.println(")")
 }
@@ -233,7 +315,7 @@ func (ap *AstPrinter) VisitCaseStmt(c *CaseStmt) {
 	}
 }
 
-func (ap *AstPrinter) VisitNullStmt() {
+func (ap *AstPrinter) VisitNullStmt(*NullStmt) {
 	ap.println("NullStatement()")
 }
 
@@ -250,7 +332,9 @@ func (ap *AstPrinter) VisitVariable(v *Variable) {
 func (ap *AstPrinter) VisitFunctionCall(f *FunctionCall) {
 	ap.println("FunctionCall(")
 	ap.indent()
-	ap.println(fmt.Sprintf("name=%s", f.Callee))
+	ap.print("callee=")
+	ap.suppressPadding = true
+	f.Callee.Accept(ap)
 	if len(f.Args) > 0 {
 		ap.println("arguments=[")
 		ap.indent()
@@ -269,7 +353,7 @@ func (ap *AstPrinter) VisitFunctionCall(f *FunctionCall) {
 func (ap *AstPrinter) VisitUnary(unary *UnaryExpression) {
 	ap.println("Unary(")
 	ap.indent()
-	ap.print("operator=\"" + unary.Operator + "\"\n")
+	ap.print("operator=\"" + unary.Operator.String() + "\"\n")
 	ap.print("right=")
 	ap.suppressPadding = true
 	unary.Right.Accept(ap)
@@ -277,10 +361,21 @@ func (ap *AstPrinter) VisitUnary(unary *UnaryExpression) {
 	ap.println(")")
 }
 
+func (ap *AstPrinter) VisitPrefixIncDec(p *PrefixIncDec) {
+	ap.println("PrefixIncDec(")
+	ap.indent()
+	ap.print("operator=\"" + p.Operator.String() + "\"\n")
+	ap.print("operand=")
+	ap.suppressPadding = true
+	p.Operand.Accept(ap)
+	ap.dedent()
+	ap.println(")")
+}
+
 func (ap *AstPrinter) VisitPostfixIncDec(p *PostfixIncDec) {
 	ap.println("PostfixIncDec(")
 	ap.indent()
-	ap.print("operator=\"" + p.Operator + "\"\n")
+	ap.print("operator=\"" + p.Operator.String() + "\"\n")
 	ap.print("operand=")
 	ap.suppressPadding = true
 	p.Operand.Accept(ap)
@@ -291,7 +386,7 @@ func (ap *AstPrinter) VisitPostfixIncDec(p *PostfixIncDec) {
 func (ap *AstPrinter) VisitBinary(binary *BinaryExpression) {
 	ap.println("Binary(")
 	ap.indent()
-	ap.print("operator=\"" + binary.Operator + "\"\n")
+	ap.print("operator=\"" + binary.Operator.String() + "\"\n")
 	ap.print("left=")
 	ap.suppressPadding = true
 	binary.Left.Accept(ap)
@@ -302,6 +397,20 @@ func (ap *AstPrinter) VisitBinary(binary *BinaryExpression) {
 	ap.println(")")
 }
 
+func (ap *AstPrinter) VisitCompoundAssignment(c *CompoundAssignment) {
+	ap.println("CompoundAssignment(")
+	ap.indent()
+	ap.print("operator=\"" + c.Operator.String() + "=\"\n")
+	ap.print("left=")
+	ap.suppressPadding = true
+	c.Left.Accept(ap)
+	ap.print("right=")
+	ap.suppressPadding = true
+	c.Right.Accept(ap)
+	ap.dedent()
+	ap.println(")")
+}
+
 func (ap *AstPrinter) VisitConditional(cond *Conditional) {
 	ap.println("Conditional(")
 	ap.indent()
@@ -318,6 +427,88 @@ func (ap *AstPrinter) VisitConditional(cond *Conditional) {
 	ap.println(")")
 }
 
+func (ap *AstPrinter) VisitAddressOf(a *AddressOf) {
+	ap.println("AddressOf(")
+	ap.indent()
+	a.Operand.Accept(ap)
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AstPrinter) VisitDereference(d *Dereference) {
+	ap.println("Dereference(")
+	ap.indent()
+	d.Operand.Accept(ap)
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AstPrinter) VisitMemberAccess(m *MemberAccess) {
+	ap.println("MemberAccess(")
+	ap.indent()
+	ap.println("member=\"" + m.Member + "\"")
+	ap.print("object=")
+	ap.suppressPadding = true
+	m.Object.Accept(ap)
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AstPrinter) VisitCast(c *Cast) {
+	ap.println("Cast(")
+	ap.indent()
+	ap.println("targetType=" + c.TargetType.String())
+	ap.print("operand=")
+	ap.suppressPadding = true
+	c.Operand.Accept(ap)
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AstPrinter) VisitSizeOfType(s *SizeOfType) {
+	ap.println(fmt.Sprintf("SizeOfType(%s)", s.TargetType))
+}
+
+func (ap *AstPrinter) VisitSizeOfExpr(s *SizeOfExpr) {
+	ap.println("SizeOfExpr(")
+	ap.indent()
+	s.Operand.Accept(ap)
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AstPrinter) VisitVaStart(v *VaStart) {
+	ap.println("VaStart(")
+	ap.indent()
+	ap.print("vaList=")
+	ap.suppressPadding = true
+	v.VaList.Accept(ap)
+	ap.print("lastParam=")
+	ap.suppressPadding = true
+	v.LastParam.Accept(ap)
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AstPrinter) VisitVaArg(v *VaArg) {
+	ap.println("VaArg(")
+	ap.indent()
+	ap.println("argType=" + v.ArgType.String())
+	ap.print("vaList=")
+	ap.suppressPadding = true
+	v.VaList.Accept(ap)
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AstPrinter) VisitVaEnd(v *VaEnd) {
+	ap.println("VaEnd(")
+	ap.indent()
+	v.VaList.Accept(ap)
+	ap.dedent()
+	ap.println(")")
+}
+
 func (ap *AstPrinter) indent() {
 	ap.offset += ap.delta
 }
@@ -328,7 +519,7 @@ func (ap *AstPrinter) dedent() {
 
 func (ap *AstPrinter) print(text string) {
 	if ap.suppressPadding {
-		fmt.Print(text)
+		_, _ = fmt.Fprint(ap.out, text)
 		ap.suppressPadding = false
 		return
 	}
@@ -336,7 +527,7 @@ func (ap *AstPrinter) print(text string) {
 	for i := 0; i < ap.offset; i++ {
 		leftPadding += " "
 	}
-	fmt.Printf("%s%s", leftPadding, text)
+	_, _ = fmt.Fprintf(ap.out, "%s%s", leftPadding, text)
 }
 
 func (ap *AstPrinter) println(text string) {
@@ -0,0 +1,124 @@
+package frontend
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errNotConstant = errors.New("expression is not an integer constant")
+
+// evalConstant evaluates an integer constant expression as needed for
+// case labels and the values of enumeration constants. Enumeration
+// constants are looked up in env.
+func evalConstant(expr Expression, env *Environment) (int, error) {
+	switch expr.GetType() {
+	case AstInteger:
+		return expr.(*IntegerLiteral).Value, nil
+	case AstVariable:
+		name := expr.(*Variable).Name
+		entry, _ := env.Get(name)
+		if entry == nil || entry.category != idCatEnumConstant {
+			return 0, errors.New(fmt.Sprintf("'%s' is not an integer constant", name))
+		}
+		return entry.constValue, nil
+	case AstUnary:
+		unary := expr.(*UnaryExpression)
+		value, err := evalConstant(unary.Right, env)
+		if err != nil {
+			return 0, err
+		}
+		switch unary.Operator {
+		case UnOpNegate:
+			return int(-int32(value)), nil
+		case UnOpComplement:
+			return int(^int32(value)), nil
+		default:
+			return boolToInt(value == 0), nil
+		}
+	case AstBinary:
+		return evalBinaryConstant(expr.(*BinaryExpression), env)
+	case AstConditional:
+		conditional := expr.(*Conditional)
+		condition, err := evalConstant(conditional.Condition, env)
+		if err != nil {
+			return 0, err
+		}
+		if condition != 0 {
+			return evalConstant(conditional.Consequent, env)
+		}
+		return evalConstant(conditional.Alternate, env)
+	case AstCast:
+		cast := expr.(*Cast)
+		if !IsInteger(cast.TargetType) {
+			return 0, errNotConstant
+		}
+		return evalConstant(cast.Operand, env)
+	default:
+		return 0, errNotConstant
+	}
+}
+
+func evalBinaryConstant(binary *BinaryExpression, env *Environment) (int, error) {
+	if binary.Operator == BinOpAssign {
+		return 0, errNotConstant
+	}
+	left, err := evalConstant(binary.Left, env)
+	if err != nil {
+		return 0, err
+	}
+	right, err := evalConstant(binary.Right, env)
+	if err != nil {
+		return 0, err
+	}
+
+	l, r := int32(left), int32(right)
+	switch binary.Operator {
+	case BinOpAdd:
+		return int(l + r), nil
+	case BinOpSub:
+		return int(l - r), nil
+	case BinOpMul:
+		return int(l * r), nil
+	case BinOpDiv, BinOpRemainder:
+		if r == 0 {
+			return 0, errors.New("division by zero in constant expression")
+		}
+		if binary.Operator == BinOpDiv {
+			return int(l / r), nil
+		}
+		return int(l % r), nil
+	case BinOpBitAnd:
+		return int(l & r), nil
+	case BinOpBitOr:
+		return int(l | r), nil
+	case BinOpBitXor:
+		return int(l ^ r), nil
+	case BinOpShiftLeft:
+		return int(l << (r & 31)), nil
+	case BinOpShiftRight:
+		return int(l >> (r & 31)), nil
+	case BinOpAnd:
+		return boolToInt(l != 0 && r != 0), nil
+	case BinOpOr:
+		return boolToInt(l != 0 || r != 0), nil
+	case BinOpEqual:
+		return boolToInt(l == r), nil
+	case BinOpNotEqual:
+		return boolToInt(l != r), nil
+	case BinOpLess:
+		return boolToInt(l < r), nil
+	case BinOpLessEq:
+		return boolToInt(l <= r), nil
+	case BinOpGreater:
+		return boolToInt(l > r), nil
+	default:
+		return boolToInt(l >= r), nil
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,633 @@
+package frontend
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Declarators describe how the type of a declared name is derived from
+// the base type (e.g. "int"), following the grammar
+//
+//	<declarator>        ::= "*" <declarator> | <direct-declarator>
+//	<direct-declarator> ::= <simple-declarator> [ <param-list> ]
+//	<simple-declarator> ::= <identifier> | "(" <declarator> ")"
+//	<param-list>        ::= "(" "void" ")" | "(" <param> { "," <param> } [ "," "..." ] ")"
+//
+// Abstract declarators (used in type names) omit the identifier:
+//
+//	<abstract-declarator>        ::= "*" [ <abstract-declarator> ] | <direct-abstract-declarator>
+//	<direct-abstract-declarator> ::= "(" <abstract-declarator> ")" [ <param-list> ] | <param-list>
+
+type declarator interface{}
+
+type identDeclarator struct {
+	name string
+	pos  Position
+}
+
+type pointerDeclarator struct {
+	inner declarator // nil in abstract declarators
+}
+
+type funcDeclarator struct {
+	params   []paramDeclaration
+	variadic bool
+	inner    declarator
+}
+
+type paramDeclaration struct {
+	baseType TypeInfo
+	decl     declarator
+}
+
+func isTypeSpecifier(tokenType TokenType) bool {
+	return tokenType == TokTypeInt || tokenType == TokTypeVoid || tokenType == TokTypeEnum ||
+		tokenType == TokTypeVaList || tokenType == TokTypeStruct || tokenType == TokTypeUnion ||
+		tokenType == TokTypeUnsigned
+}
+
+func (p *Parser) parseTypeSpecifier() (TypeInfo, error) {
+	token, err := p.consume(TokTypeInt, TokTypeVoid, TokTypeEnum, TokTypeVaList,
+		TokTypeStruct, TokTypeUnion, TokTypeUnsigned, TokTypeIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	switch token.tokenType {
+	case TokTypeVoid:
+		return &VoidInfo{}, nil
+	case TokTypeVaList:
+		return &VaListInfo{}, nil
+	case TokTypeEnum:
+		return p.parseEnumSpecifier(token.position)
+	case TokTypeStruct, TokTypeUnion:
+		return p.parseStructSpecifier(token.tokenType == TokTypeUnion, token.position)
+	case TokTypeUnsigned:
+		return nil, errors.New("unsigned types are only supported for bit-fields")
+	case TokTypeIdentifier:
+		if !p.isTypedefName(token.lexeme) {
+			return nil, errors.New(fmt.Sprintf("unknown type name '%s'", token.lexeme))
+		}
+		return &TypedefInfo{Name: token.lexeme}, nil
+	default:
+		return &IntInfo{}, nil
+	}
+}
+
+// parseEnumSpecifier parses the part of an enum specifier following
+// the keyword "enum":
+//
+//	<enum-specifier> ::= "enum" [ <identifier> ] "{" <enumerator> { "," <enumerator> } [ "," ] "}"
+//	                   | "enum" <identifier>
+//	<enumerator>     ::= <identifier> [ "=" <exp> ]
+//
+// A definition is added to the pending type declarations of the parser.
+func (p *Parser) parseEnumSpecifier(pos Position) (TypeInfo, error) {
+	tag := ""
+	token, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if token.tokenType == TokTypeIdentifier {
+		_, _ = p.consume()
+		tag = token.lexeme
+		token, err = p.peek()
+	}
+	if err != nil || token.tokenType != TokTypeLeftBrace {
+		if tag == "" {
+			return nil, errors.New("expected identifier or '{' after enum")
+		}
+		return p.lookupEnumTag(tag), nil
+	}
+
+	if _, defined := p.currentScope().enumTags[tag]; defined && tag != "" {
+		return nil, errors.New(fmt.Sprintf("redefinition of enum %s", tag))
+	}
+	members, err := p.parseEnumerators()
+	if err != nil {
+		return nil, err
+	}
+
+	enumType := &EnumInfo{Tag: tag}
+	if tag != "" {
+		p.currentScope().enumTags[tag] = enumType
+	}
+	p.typeDecls = append(p.typeDecls, &EnumDecl{
+		EnumType: enumType,
+		Members:  members,
+		Pos:      pos,
+	})
+
+	return enumType, nil
+}
+
+func (p *Parser) parseEnumerators() ([]EnumMember, error) {
+	var members []EnumMember
+
+	_, err := p.consume(TokTypeLeftBrace)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token, err := p.consume(TokTypeIdentifier, TokTypeRightBrace)
+		if err != nil {
+			return nil, errors.New("expected identifier in enumerator list")
+		}
+		if token.tokenType == TokTypeRightBrace {
+			if len(members) == 0 {
+				return nil, errors.New("empty enumerator list")
+			}
+			return members, nil
+		}
+		member := EnumMember{Name: token.lexeme, Pos: token.position}
+		p.declareName(member.Name, false)
+
+		token, err = p.consume(TokTypeEq, TokTypeComma, TokTypeRightBrace)
+		if err != nil {
+			return nil, errors.New("expected '=', ',' or '}' after enumerator")
+		}
+		if token.tokenType == TokTypeEq {
+			member.Value, err = p.parseExpression(0)
+			if err != nil {
+				return nil, err
+			}
+			token, err = p.consume(TokTypeComma, TokTypeRightBrace)
+			if err != nil {
+				return nil, errors.New("expected ',' or '}' after enumerator")
+			}
+		}
+		members = append(members, member)
+		if token.tokenType == TokTypeRightBrace {
+			return members, nil
+		}
+	}
+}
+
+// lookupEnumTag returns the enumeration with the given tag that is
+// visible in the current scope. Unknown tags refer to an enumeration
+// without constants.
+func (p *Parser) lookupEnumTag(tag string) *EnumInfo {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if enumType, ok := p.scopes[i].enumTags[tag]; ok {
+			return enumType
+		}
+	}
+	return &EnumInfo{Tag: tag}
+}
+
+// parseStructSpecifier parses the part of a struct or union specifier
+// following the keyword "struct" or "union":
+//
+//	<struct-specifier> ::= ( "struct" | "union" ) [ <identifier> ] "{" <member-decl> { <member-decl> } "}"
+//	                     | ( "struct" | "union" ) <identifier>
+//
+// Like enum definitions, definitions are added to the pending type
+// declarations of the parser. So is a declaration of the tag only
+// ("struct node;") which declares the tag in the current scope.
+func (p *Parser) parseStructSpecifier(isUnion bool, pos Position) (TypeInfo, error) {
+	keyword := "struct"
+	if isUnion {
+		keyword = "union"
+	}
+	tag := ""
+	token, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if token.tokenType == TokTypeIdentifier {
+		_, _ = p.consume()
+		tag = token.lexeme
+		token, err = p.peek()
+	}
+	if err != nil || token.tokenType != TokTypeLeftBrace {
+		if tag == "" {
+			return nil, errors.New(fmt.Sprintf("expected identifier or '{' after %s", keyword))
+		}
+		if err == nil && token.tokenType == TokTypeSemicolon {
+			structType, err := p.declareStructTag(tag, isUnion)
+			if err != nil {
+				return nil, err
+			}
+			p.typeDecls = append(p.typeDecls, &StructDecl{StructType: structType, Pos: pos})
+			return structType, nil
+		}
+		return p.lookupStructTag(tag, isUnion)
+	}
+
+	structType := &StructInfo{IsUnion: isUnion}
+	if tag != "" {
+		// the tag is known within the member list, e.g. for "struct node *next;"
+		structType, err = p.declareStructTag(tag, isUnion)
+		if err != nil {
+			return nil, err
+		}
+		if p.definedStructs[structType] {
+			return nil, errors.New(fmt.Sprintf("redefinition of %s", structType))
+		}
+	}
+	p.definedStructs[structType] = true
+	members, err := p.parseMemberDecls()
+	if err != nil {
+		return nil, err
+	}
+	p.typeDecls = append(p.typeDecls, &StructDecl{
+		StructType: structType,
+		Members:    members,
+		Pos:        pos,
+	})
+
+	return structType, nil
+}
+
+// parseMemberDecls parses the member list of a structure or union:
+//
+//	<member-decl> ::= <type-specifier> [ <declarator> ] [ ":" <exp> ] ";"
+//	                | "unsigned" [ "int" ] [ <declarator> ] ":" <exp> ";"
+//
+// Members without declarator must be bit-fields. The type "unsigned"
+// is supported for bit-fields only.
+func (p *Parser) parseMemberDecls() ([]MemberDecl, error) {
+	var members []MemberDecl
+
+	_, err := p.consume(TokTypeLeftBrace)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if token.tokenType == TokTypeRightBrace {
+			_, _ = p.consume()
+			if len(members) == 0 {
+				return nil, errors.New("struct or union has no members")
+			}
+			return members, nil
+		}
+
+		member := MemberDecl{Pos: token.position}
+		if token.tokenType == TokTypeUnsigned {
+			_, _ = p.consume()
+			if next, err := p.peek(); err == nil && next.tokenType == TokTypeInt {
+				_, _ = p.consume()
+			}
+			member.Type = &IntInfo{}
+			member.Unsigned = true
+		} else {
+			member.Type, err = p.parseTypeSpecifier()
+			if err != nil {
+				return nil, err
+			}
+		}
+		token, err = p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if token.tokenType != TokTypeColon {
+			decl, err := p.parseDeclarator()
+			if err != nil {
+				return nil, err
+			}
+			member.Name, member.Type, _, err = processDeclarator(decl, member.Type)
+			if err != nil {
+				return nil, err
+			}
+			member.Pos = paramPos(decl)
+		}
+		token, err = p.consume(TokTypeColon, TokTypeSemicolon)
+		if err != nil {
+			return nil, errors.New("expected ':' or ';' after member declarator")
+		}
+		if token.tokenType == TokTypeColon {
+			member.BitWidth, err = p.parseExpression(0)
+			if err != nil {
+				return nil, err
+			}
+			_, err = p.consume(TokTypeSemicolon)
+			if err != nil {
+				return nil, err
+			}
+		} else if member.Name == "" {
+			return nil, errors.New("declaration does not declare anything")
+		} else if member.Unsigned {
+			return nil, errors.New(fmt.Sprintf("member %s: unsigned types are only supported for bit-fields", member.Name))
+		}
+		members = append(members, member)
+	}
+}
+
+// declareStructTag returns the structure or union with the given tag
+// that is declared in the current scope. If there is none, a new
+// incomplete type is declared.
+func (p *Parser) declareStructTag(tag string, isUnion bool) (*StructInfo, error) {
+	structType, ok := p.currentScope().structTags[tag]
+	if !ok {
+		structType = &StructInfo{Tag: tag, IsUnion: isUnion}
+		p.currentScope().structTags[tag] = structType
+	}
+	if structType.IsUnion != isUnion {
+		return nil, errors.New(fmt.Sprintf("'%s' defined as wrong kind of tag", tag))
+	}
+	return structType, nil
+}
+
+// lookupStructTag returns the structure or union with the given tag that
+// is visible in the current scope. Unknown tags are declared in the
+// current scope.
+func (p *Parser) lookupStructTag(tag string, isUnion bool) (*StructInfo, error) {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if structType, ok := p.scopes[i].structTags[tag]; ok {
+			if structType.IsUnion != isUnion {
+				return nil, errors.New(fmt.Sprintf("'%s' defined as wrong kind of tag", tag))
+			}
+			return structType, nil
+		}
+	}
+	return p.declareStructTag(tag, isUnion)
+}
+
+func (p *Parser) parseDeclarator() (declarator, error) {
+	token, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if token.tokenType == TokTypeAsterisk {
+		_, _ = p.consume()
+		inner, err := p.parseDeclarator()
+		if err != nil {
+			return nil, err
+		}
+		return &pointerDeclarator{inner}, nil
+	}
+	return p.parseDirectDeclarator()
+}
+
+func (p *Parser) parseDirectDeclarator() (declarator, error) {
+	var decl declarator
+
+	token, err := p.consume(TokTypeIdentifier, TokTypeLeftParen)
+	if err != nil {
+		return nil, errors.New("expected identifier or '(' in declarator")
+	}
+	if token.tokenType == TokTypeIdentifier {
+		decl = &identDeclarator{token.lexeme, token.position}
+	} else {
+		decl, err = p.parseDeclarator()
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.consume(TokTypeRightParen)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	token, err = p.peek()
+	if err == nil && token.tokenType == TokTypeLeftParen {
+		params, variadic, err := p.parseParamList(false)
+		if err != nil {
+			return nil, err
+		}
+		decl = &funcDeclarator{params, variadic, decl}
+	}
+
+	return decl, nil
+}
+
+// parseParamList parses a parenthesized parameter list. In abstract
+// declarators the parameters are type names without identifiers.
+// The returned flag is set if the list ends with "...".
+func (p *Parser) parseParamList(abstract bool) ([]paramDeclaration, bool, error) {
+	var params []paramDeclaration
+
+	_, err := p.consume(TokTypeLeftParen)
+	if err != nil {
+		return nil, false, err
+	}
+
+	nextTokens := p.peekN(2)
+	if len(nextTokens) > 0 && nextTokens[0].tokenType == TokTypeRightParen {
+		_, _ = p.consume()
+		return params, false, nil
+	}
+	if len(nextTokens) == 2 &&
+		nextTokens[0].tokenType == TokTypeVoid &&
+		nextTokens[1].tokenType == TokTypeRightParen {
+		_, _ = p.consume()
+		_, _ = p.consume()
+		return params, false, nil
+	}
+
+	for {
+		token, err := p.peek()
+		if err == nil && token.tokenType == TokTypeEllipsis {
+			if len(params) == 0 {
+				return nil, false, errors.New("a named parameter is required before '...'")
+			}
+			_, _ = p.consume()
+			_, err = p.consume(TokTypeRightParen)
+			if err != nil {
+				return nil, false, errors.New("expected ')' after '...'")
+			}
+			return params, true, nil
+		}
+		baseType, err := p.parseTypeSpecifier()
+		if err != nil {
+			return nil, false, err
+		}
+		var decl declarator
+		if abstract || !p.hasDeclaratorName() {
+			decl, err = p.parseAbstractDeclarator()
+		} else {
+			decl, err = p.parseDeclarator()
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		params = append(params, paramDeclaration{baseType, decl})
+
+		token, err = p.consume(TokTypeRightParen, TokTypeComma)
+		if err != nil {
+			return nil, false, errors.New("expected comma or parenthesis")
+		}
+		if token.tokenType == TokTypeRightParen {
+			return params, false, nil
+		}
+	}
+}
+
+// hasDeclaratorName checks if the following declarator contains
+// an identifier. Parameters of function declarations may be unnamed.
+// Following the type specifier, a typedef name is the declared name
+// (int f(int T) hides the typedef T) unless it is enclosed in
+// parentheses: int f(int (T)) takes a function returning int.
+func (p *Parser) hasDeclaratorName() bool {
+	afterParen := false
+	for i := 1; ; i++ {
+		tokens := p.peekN(i)
+		if len(tokens) < i {
+			return false
+		}
+		token := tokens[i-1]
+		switch token.tokenType {
+		case TokTypeAsterisk:
+			afterParen = false
+		case TokTypeLeftParen:
+			afterParen = true
+		case TokTypeIdentifier:
+			return !afterParen || !p.isTypedefName(token.lexeme)
+		default:
+			return false
+		}
+	}
+}
+
+func (p *Parser) parseTypeName() (TypeInfo, error) {
+	baseType, err := p.parseTypeSpecifier()
+	if err != nil {
+		return nil, err
+	}
+	decl, err := p.parseAbstractDeclarator()
+	if err != nil {
+		return nil, err
+	}
+	return processAbstractDeclarator(decl, baseType)
+}
+
+// parseAbstractDeclarator returns nil if the type name consists of
+// the type specifier only
+func (p *Parser) parseAbstractDeclarator() (declarator, error) {
+	token, err := p.peek()
+	if err != nil {
+		return nil, nil
+	}
+
+	switch token.tokenType {
+	case TokTypeAsterisk:
+		_, _ = p.consume()
+		inner, err := p.parseAbstractDeclarator()
+		if err != nil {
+			return nil, err
+		}
+		return &pointerDeclarator{inner}, nil
+	case TokTypeLeftParen:
+		nextTokens := p.peekN(2)
+		if len(nextTokens) < 2 {
+			return nil, nil
+		}
+		if nextTokens[1].tokenType == TokTypeRightParen || p.startsTypeName(&nextTokens[1]) {
+			// function type, e.g. "int (int)"
+			params, variadic, err := p.parseParamList(true)
+			if err != nil {
+				return nil, err
+			}
+			return &funcDeclarator{params, variadic, nil}, nil
+		}
+		if nextTokens[1].tokenType != TokTypeAsterisk && nextTokens[1].tokenType != TokTypeLeftParen {
+			return nil, nil
+		}
+		_, _ = p.consume()
+		decl, err := p.parseAbstractDeclarator()
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.consume(TokTypeRightParen)
+		if err != nil {
+			return nil, err
+		}
+		token, err = p.peek()
+		if err == nil && token.tokenType == TokTypeLeftParen {
+			params, variadic, err := p.parseParamList(true)
+			if err != nil {
+				return nil, err
+			}
+			decl = &funcDeclarator{params, variadic, decl}
+		}
+		return decl, nil
+	default:
+		return nil, nil
+	}
+}
+
+// processDeclarator derives name and type of a declaration. For function
+// declarations the parameters are returned as well.
+func processDeclarator(decl declarator, baseType TypeInfo) (string, TypeInfo, []Parameter, error) {
+	switch d := decl.(type) {
+	case nil:
+		// unnamed parameter
+		return "", baseType, nil, nil
+	case *identDeclarator:
+		return d.name, baseType, nil, nil
+	case *pointerDeclarator:
+		return processDeclarator(d.inner, &PointerInfo{baseType})
+	case *funcDeclarator:
+		if baseType.GetTypeId() == TypeFunc {
+			return "", nil, nil, errors.New("functions cannot return a function")
+		}
+		var params []Parameter
+		for _, param := range d.params {
+			name, paramType, _, err := processDeclarator(param.decl, param.baseType)
+			if err != nil {
+				return "", nil, nil, err
+			}
+			params = append(params, Parameter{Name: name, Type: adjustParamType(paramType), Pos: paramPos(param.decl)})
+		}
+		funcType := &FuncInfo{ReturnType: baseType, Variadic: d.variadic}
+		for _, param := range params {
+			funcType.ParamTypes = append(funcType.ParamTypes, param.Type)
+		}
+		if ident, ok := d.inner.(*identDeclarator); ok {
+			return ident.name, funcType, params, nil
+		}
+		// e.g. a pointer to a function
+		return processDeclarator(d.inner, funcType)
+	default:
+		return "", nil, nil, errors.New("invalid declarator")
+	}
+}
+
+func processAbstractDeclarator(decl declarator, baseType TypeInfo) (TypeInfo, error) {
+	switch d := decl.(type) {
+	case nil:
+		return baseType, nil
+	case *pointerDeclarator:
+		return processAbstractDeclarator(d.inner, &PointerInfo{baseType})
+	case *funcDeclarator:
+		if baseType.GetTypeId() == TypeFunc {
+			return nil, errors.New("functions cannot return a function")
+		}
+		funcType := &FuncInfo{ReturnType: baseType, Variadic: d.variadic}
+		for _, param := range d.params {
+			paramType, err := processAbstractDeclarator(param.decl, param.baseType)
+			if err != nil {
+				return nil, err
+			}
+			funcType.ParamTypes = append(funcType.ParamTypes, adjustParamType(paramType))
+		}
+		return processAbstractDeclarator(d.inner, funcType)
+	default:
+		return nil, errors.New("invalid abstract declarator")
+	}
+}
+
+// adjustParamType turns parameters of function type into function pointers.
+// Parameters of type va_list become pointers to a va_list.
+func adjustParamType(paramType TypeInfo) TypeInfo {
+	if paramType.GetTypeId() == TypeFunc || paramType.GetTypeId() == TypeVaList {
+		return &PointerInfo{paramType}
+	}
+	return paramType
+}
+
+func paramPos(decl declarator) Position {
+	switch d := decl.(type) {
+	case *identDeclarator:
+		return d.pos
+	case *pointerDeclarator:
+		return paramPos(d.inner)
+	case *funcDeclarator:
+		return paramPos(d.inner)
+	default:
+		return Position{}
+	}
+}
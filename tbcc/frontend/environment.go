@@ -16,6 +16,8 @@ const (
 	idCatVariable identCategory = iota
 	idCatFunction
 	idCatParameter
+	idCatEnumConstant
+	idCatTypedef
 )
 
 type EnvEntry struct {
@@ -23,12 +25,29 @@ type EnvEntry struct {
 	isExternal bool
 	category   identCategory
 	typeInfo   TypeInfo
+	constValue int // value of enumeration constants
+	// isStatic is set for variables with static storage duration,
+	// the others are automatic variables on the stack
+	isStatic bool
+	// isInitialized is set for static variables once a declaration
+	// with initializer has been seen
+	isInitialized bool
+	visibility    Visibility
 }
 
 func (ee *EnvEntry) GetTypeInfo() TypeInfo {
 	return ee.typeInfo
 }
 
+// IsExternal tells whether the name has external linkage
+func (ee *EnvEntry) IsExternal() bool {
+	return ee.isExternal
+}
+
+func (ee *EnvEntry) GetVisibility() Visibility {
+	return ee.visibility
+}
+
 func NewEnvironment(parent *Environment) *Environment {
 	return &Environment{
 		parent:   parent,
@@ -74,6 +93,50 @@ func (env *Environment) set(
 
 }
 
+// setStaticVariable adds a variable with static storage duration.
+// Variables with internal linkage are not external.
+func (env *Environment) setStaticVariable(
+	name string,
+	isExternal bool,
+	isInitialized bool,
+	typeInfo TypeInfo,
+) {
+	entry := EnvEntry{
+		uniqueName:    name,
+		isExternal:    isExternal,
+		category:      idCatVariable,
+		typeInfo:      typeInfo,
+		isStatic:      true,
+		isInitialized: isInitialized,
+	}
+
+	env.identMap[name] = entry
+	if isExternal {
+		env.getGlobal().identMap[name] = entry
+	}
+}
+
+// setVisibility changes the visibility of a function or variable
+func (env *Environment) setVisibility(name string, visibility Visibility) {
+	for _, e := range []*Environment{env, env.getGlobal()} {
+		if entry, ok := e.identMap[name]; ok {
+			entry.visibility = visibility
+			e.identMap[name] = entry
+		}
+	}
+}
+
+// setEnumConstant adds an enumeration constant. Enumeration constants
+// share the namespace of variables and functions.
+func (env *Environment) setEnumConstant(name string, value int, typeInfo TypeInfo) {
+	env.identMap[name] = EnvEntry{
+		uniqueName: name,
+		category:   idCatEnumConstant,
+		typeInfo:   typeInfo,
+		constValue: value,
+	}
+}
+
 func (env *Environment) Get(name string) (*EnvEntry, *Environment) {
 	ret, ok := env.identMap[name]
 	if ok {
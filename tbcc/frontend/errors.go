@@ -0,0 +1,40 @@
+package frontend
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error is an error found at a position of the source code by the
+// lexer, the parser or a semantic pass. The message does not contain
+// the position.
+type Error struct {
+	Pos     Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func errorAt(pos Position, format string, args ...any) error {
+	return &Error{Pos: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// withPosition adds the position to an error that has none yet
+func withPosition(err error, pos Position) error {
+	var positioned *Error
+	if err == nil || errors.As(err, &positioned) {
+		return err
+	}
+	return &Error{Pos: pos, Message: err.Error()}
+}
+
+// ErrorPosition returns the position of an error of the frontend
+func ErrorPosition(err error) (Position, bool) {
+	var positioned *Error
+	if errors.As(err, &positioned) {
+		return positioned.Pos, true
+	}
+	return Position{}, false
+}
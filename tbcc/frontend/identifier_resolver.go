@@ -1,10 +1,5 @@
 package frontend
 
-import (
-	"errors"
-	"fmt"
-)
-
 type idResolverResult struct {
 	ast AST
 	err error
@@ -37,8 +32,29 @@ func (ir *identifierResolver) resolve(program *Program) (*Program, error) {
 }
 
 func (ir *identifierResolver) VisitProgram(p *Program) {
+	var newTypeDecls []BodyItem
+	var newVariables []VarDecl
 	var newFunctions []Function
 
+	for _, decl := range p.TypeDecls {
+		ast, err := ir.evalAst(decl)
+		if err != nil {
+			return
+		}
+		newTypeDecls = append(newTypeDecls, ast)
+	}
+
+	for _, v := range p.Variables {
+		// variables at file scope keep their names since they are linked
+		// by name. Conflicting declarations are reported by the type checker.
+		if entry, definingEnv := ir.env.Get(v.Name); definingEnv != nil && entry.category != idCatVariable {
+			ir.setResult(nil, errorAt(v.Pos, "%s is already defined", v.Name))
+			return
+		}
+		ir.env.set(v.Name, v.Name, true, idCatVariable, v.VarType)
+		newVariables = append(newVariables, v)
+	}
+
 	for _, fun := range p.Functions {
 		ast, err := ir.evalAst(&fun)
 		if err != nil {
@@ -47,7 +63,7 @@ func (ir *identifierResolver) VisitProgram(p *Program) {
 		newFunctions = append(newFunctions, *ast.(*Function))
 	}
 
-	ir.setResult(&Program{newFunctions}, nil)
+	ir.setResult(&Program{TypeDecls: newTypeDecls, Variables: newVariables, Functions: newFunctions}, nil)
 }
 
 func (ir *identifierResolver) VisitFunction(f *Function) {
@@ -56,20 +72,20 @@ func (ir *identifierResolver) VisitFunction(f *Function) {
 
 	if !allParamsUnique(f.Params) {
 		ir.setResult(nil,
-			errors.New(fmt.Sprintf("parameters of function %s must be unique", f.Name)))
+			errorAt(f.Pos, "parameters of function %s must be unique", f.Name))
 		return
 	}
 
 	if f.Body != nil && ir.functionNesting > 0 {
 		ir.setResult(nil,
-			errors.New(fmt.Sprintf("function %s must not be defined within another function", f.Name)))
+			errorAt(f.Pos, "function %s must not be defined within another function", f.Name))
 		return
 	}
 
 	entry, env := ir.env.Get(f.Name)
 	if env != nil {
 		if ir.env == env && entry.category != idCatFunction {
-			ir.setResult(nil, errors.New(fmt.Sprintf("%s is already defined", f.Name)))
+			ir.setResult(nil, errorAt(f.Pos, "%s is already defined", f.Name))
 			return
 		}
 	}
@@ -81,10 +97,12 @@ func (ir *identifierResolver) VisitFunction(f *Function) {
 
 		for _, param := range f.Params {
 			uniqueName := ir.nameCreator.VarName()
-			ir.env.set(param.Name, uniqueName, false, idCatParameter, &IntInfo{})
+			ir.env.set(param.Name, uniqueName, false, idCatParameter, param.Type)
 			newParams = append(newParams, Parameter{
-				Name: uniqueName,
-				TyId: param.TyId,
+				Name:       uniqueName,
+				Type:       param.Type,
+				Pos:        param.Pos,
+				SourceName: param.Name,
 			})
 		}
 
@@ -104,15 +122,22 @@ func (ir *identifierResolver) VisitFunction(f *Function) {
 	}
 
 	ir.setResult(&Function{
-		Name:   f.Name,
-		Params: newParams,
-		Body:   newBody,
+		Name:       f.Name,
+		Params:     newParams,
+		ReturnType: f.ReturnType,
+		Variadic:   f.Variadic,
+		Body:       newBody,
+		Pos:        f.Pos,
+		Visibility: f.Visibility,
 	}, nil)
 }
 
 func allParamsUnique(params []Parameter) bool {
 	paramSet := make(map[string]bool)
 	for _, param := range params {
+		if param.Name == "" {
+			continue
+		}
 		_, ok := paramSet[param.Name]
 		if ok {
 			return false
@@ -128,24 +153,37 @@ func (ir *identifierResolver) VisitVarDecl(v *VarDecl) {
 	alreadyDefined := false
 	if definingEnv != nil {
 		if definingEnv == ir.env {
-			alreadyDefined = true
+			// repeated extern declarations refer to the same variable
+			alreadyDefined = v.StorageClass != StorageExtern || !entry.isExternal
 		} else if definingEnv == ir.env.getParent() && entry.category == idCatParameter {
 			alreadyDefined = true
 		}
 	}
 	if alreadyDefined {
-		ir.setResult(nil, errors.New(fmt.Sprintf("variable %s already defined", v.Name)))
+		ir.setResult(nil, errorAt(v.Pos, "variable %s already defined", v.Name))
 		return
 	}
 
-	uniqueName := ir.nameCreator.VarName()
-	ir.env.set(v.Name, uniqueName, false, idCatVariable, &IntInfo{})
+	var uniqueName string
+	switch v.StorageClass {
+	case StorageExtern:
+		uniqueName = v.Name
+		ir.env.set(v.Name, uniqueName, true, idCatVariable, v.VarType)
+	case StorageStatic:
+		// static variables become assembler symbols, the
+		// counters of label names make them unique
+		uniqueName = ir.nameCreator.LabelName(v.Name)
+		ir.env.set(v.Name, uniqueName, false, idCatVariable, v.VarType)
+	default:
+		uniqueName = ir.nameCreator.VarName()
+		ir.env.set(v.Name, uniqueName, false, idCatVariable, v.VarType)
+	}
 
-	var newInitValue AST
+	var newInitValue Expression
 	var err error
 
 	if v.InitValue != nil {
-		newInitValue, err = ir.evalAst(v.InitValue)
+		newInitValue, err = ir.evalExpr(v.InitValue)
 		if err != nil {
 			return
 		}
@@ -153,27 +191,60 @@ func (ir *identifierResolver) VisitVarDecl(v *VarDecl) {
 		newInitValue = nil
 	}
 
-	ir.setResult(&VarDecl{uniqueName, newInitValue}, nil)
+	ir.setResult(&VarDecl{uniqueName, v.VarType, newInitValue, v.StorageClass, v.Pos, v.Name, v.Visibility}, nil)
+}
+
+// VisitEnumDecl registers the enumeration constants. Their values
+// have been determined by the type checker.
+func (ir *identifierResolver) VisitEnumDecl(e *EnumDecl) {
+	for i, member := range e.Members {
+		if _, definingEnv := ir.env.Get(member.Name); definingEnv == ir.env {
+			ir.setResult(nil, errorAt(member.Pos, "%s already defined", member.Name))
+			return
+		}
+		ir.env.setEnumConstant(member.Name, e.EnumType.Constants[i].Value, &IntInfo{})
+	}
+	ir.setResult(e, nil)
+}
+
+// VisitStructDecl keeps the declaration. Tags have been resolved by the
+// parser and the widths of bit-fields have been evaluated by the type checker.
+func (ir *identifierResolver) VisitStructDecl(s *StructDecl) {
+	ir.setResult(s, nil)
+}
+
+func (ir *identifierResolver) VisitTypedefDecl(t *TypedefDecl) {
+	entry, definingEnv := ir.env.Get(t.Name)
+	if definingEnv == ir.env && entry.category != idCatTypedef {
+		ir.setResult(nil, errorAt(t.Pos, "%s redeclared as different kind of symbol", t.Name))
+		return
+	}
+	ir.env.set(t.Name, t.Name, false, idCatTypedef, t.Type)
+	ir.setResult(t, nil)
 }
 
 func (ir *identifierResolver) VisitReturn(r *ReturnStmt) {
-	newExpr, err := ir.evalAst(r.Expression)
+	if r.Expression == nil {
+		ir.setResult(r, nil)
+		return
+	}
+	newExpr, err := ir.evalExpr(r.Expression)
 	if err != nil {
 		return
 	}
-	ir.setResult(&ReturnStmt{newExpr}, nil)
+	ir.setResult(&ReturnStmt{newExpr, r.Pos}, nil)
 }
 
 func (ir *identifierResolver) VisitExprStmt(e *ExpressionStmt) {
-	newExpr, err := ir.evalAst(e.Expression)
+	newExpr, err := ir.evalExpr(e.Expression)
 	if err != nil {
 		return
 	}
-	ir.setResult(&ExpressionStmt{newExpr}, nil)
+	ir.setResult(&ExpressionStmt{newExpr, e.Pos}, nil)
 }
 
 func (ir *identifierResolver) VisitIfStmt(i *IfStmt) {
-	newCondition, err := ir.evalAst(i.Condition)
+	newCondition, err := ir.evalExpr(i.Condition)
 	if err != nil {
 		return
 	}
@@ -192,6 +263,7 @@ func (ir *identifierResolver) VisitIfStmt(i *IfStmt) {
 		newCondition,
 		newConsequent,
 		newAlternate,
+		i.Pos,
 	}, nil)
 }
 
@@ -212,7 +284,7 @@ func (ir *identifierResolver) VisitBlockStmt(b *BlockStmt) {
 		newItems = append(newItems, newItem)
 	}
 
-	ir.setResult(&BlockStmt{newItems}, nil)
+	ir.setResult(&BlockStmt{newItems, b.Pos}, nil)
 }
 
 func (ir *identifierResolver) VisitGotoStmt(g *GotoStmt) {
@@ -222,7 +294,7 @@ func (ir *identifierResolver) VisitGotoStmt(g *GotoStmt) {
 		ir.labelMap[g.Target] = uniqueTarget
 	}
 
-	ir.setResult(&GotoStmt{uniqueTarget}, nil)
+	ir.setResult(&GotoStmt{uniqueTarget, g.Pos}, nil)
 }
 
 func (ir *identifierResolver) VisitLabelStmt(l *LabelStmt) {
@@ -231,11 +303,11 @@ func (ir *identifierResolver) VisitLabelStmt(l *LabelStmt) {
 		uniqueName = ir.nameCreator.LabelName(l.Name)
 		ir.labelMap[l.Name] = uniqueName
 	}
-	ir.setResult(&LabelStmt{uniqueName}, nil)
+	ir.setResult(&LabelStmt{uniqueName, l.Pos}, nil)
 }
 
 func (ir *identifierResolver) VisitDoWhileStmt(d *DoWhileStmt) {
-	newCondition, err := ir.evalAst(d.Condition)
+	newCondition, err := ir.evalExpr(d.Condition)
 	if err != nil {
 		return
 	}
@@ -247,11 +319,12 @@ func (ir *identifierResolver) VisitDoWhileStmt(d *DoWhileStmt) {
 		Condition: newCondition,
 		Body:      newBody,
 		Label:     d.Label,
+		Pos:       d.Pos,
 	}, nil)
 }
 
 func (ir *identifierResolver) VisitWhileStmt(w *WhileStmt) {
-	newCondition, err := ir.evalAst(w.Condition)
+	newCondition, err := ir.evalExpr(w.Condition)
 	if err != nil {
 		return
 	}
@@ -263,6 +336,7 @@ func (ir *identifierResolver) VisitWhileStmt(w *WhileStmt) {
 		Condition: newCondition,
 		Body:      newBody,
 		Label:     w.Label,
+		Pos:       w.Pos,
 	}, nil)
 }
 
@@ -283,14 +357,14 @@ func (ir *identifierResolver) VisitForStmt(f *ForStmt) {
 	}
 
 	if f.Condition != nil {
-		newCondition, err = ir.evalAst(f.Condition)
+		newCondition, err = ir.evalExpr(f.Condition)
 		if err != nil {
 			return
 		}
 	}
 
 	if f.Post != nil {
-		newPost, err = ir.evalAst(f.Post)
+		newPost, err = ir.evalExpr(f.Post)
 		if err != nil {
 			return
 		}
@@ -306,6 +380,7 @@ func (ir *identifierResolver) VisitForStmt(f *ForStmt) {
 		Post:      newPost,
 		Body:      newBody,
 		Label:     f.Label,
+		Pos:       f.Pos,
 	}, nil)
 
 }
@@ -319,7 +394,7 @@ func (ir *identifierResolver) VisitContinueStmt(c *ContinueStmt) {
 }
 
 func (ir *identifierResolver) VisitSwitchStmt(s *SwitchStmt) {
-	newExpr, err := ir.evalAst(s.Expr)
+	newExpr, err := ir.evalExpr(s.Expr)
 	if err != nil {
 		return
 	}
@@ -335,15 +410,34 @@ func (ir *identifierResolver) VisitSwitchStmt(s *SwitchStmt) {
 		Body:           newBody,
 		Label:          s.Label,
 		FirstCaseLabel: s.FirstCaseLabel,
+		Pos:            s.Pos,
 	}, nil)
 }
 
+// VisitCaseStmt replaces the case value by its constant value
 func (ir *identifierResolver) VisitCaseStmt(c *CaseStmt) {
-	ir.setResult(c, nil)
+	if c.Value == nil || c.Value.GetType() == AstInteger {
+		ir.setResult(c, nil)
+		return
+	}
+	value, err := evalConstant(c.Value, ir.env)
+	if err != nil {
+		ir.setResult(nil, err)
+		return
+	}
+	newValue := &IntegerLiteral{Value: value, Pos: c.Pos}
+	newValue.SetResultType(&IntInfo{})
+	ir.setResult(&CaseStmt{
+		Value:         newValue,
+		Label:         c.Label,
+		PrevCaseLabel: c.PrevCaseLabel,
+		NextCaseLabel: c.NextCaseLabel,
+		Pos:           c.Pos,
+	}, nil)
 }
 
-func (ir *identifierResolver) VisitNullStmt() {
-	ir.setResult(&NullStmt{}, nil)
+func (ir *identifierResolver) VisitNullStmt(n *NullStmt) {
+	ir.setResult(&NullStmt{n.Pos}, nil)
 }
 
 func (ir *identifierResolver) VisitInteger(i *IntegerLiteral) {
@@ -353,52 +447,84 @@ func (ir *identifierResolver) VisitInteger(i *IntegerLiteral) {
 func (ir *identifierResolver) VisitVariable(v *Variable) {
 	uniqueName, err := ir.env.Lookup(v.Name)
 	if err != nil {
-		ir.setResult(nil, err)
+		ir.setResult(nil, withPosition(err, v.Pos))
 		return
 	}
-	ir.setResult(&Variable{uniqueName}, nil)
+	entry, _ := ir.env.Get(v.Name)
+	if entry.category == idCatEnumConstant {
+		ir.setResult(&IntegerLiteral{Value: entry.constValue, Pos: v.Pos}, nil)
+		return
+	}
+	ir.setResult(&Variable{Name: uniqueName, Pos: v.Pos}, nil)
 }
 
 func (ir *identifierResolver) VisitFunctionCall(f *FunctionCall) {
 	var newArgs []Expression
 
-	entry, definingEnv := ir.env.Get(f.Callee)
-	if definingEnv == nil || entry.category != idCatFunction {
-		ir.setResult(nil,
-			errors.New(fmt.Sprintf("%s is not a function", f.Callee)))
+	if callee, ok := f.Callee.(*Variable); ok {
+		if _, definingEnv := ir.env.Get(callee.Name); definingEnv == nil {
+			// implicit declaration (reported as a warning)
+			ir.env.getGlobal().set(callee.Name, callee.Name, true, idCatFunction, nil)
+		}
+	}
+
+	newCallee, err := ir.evalExpr(f.Callee)
+	if err != nil {
 		return
 	}
 
 	for _, arg := range f.Args {
-		newArg, err := ir.evalAst(arg)
+		newArg, err := ir.evalExpr(arg)
 		if err != nil {
 			return
 		}
 		newArgs = append(newArgs, newArg)
 	}
 
-	ir.setResult(&FunctionCall{f.Callee, newArgs}, nil)
+	ir.setResult(&FunctionCall{Callee: newCallee, Args: newArgs, Pos: f.Pos}, nil)
 }
 
 func (ir *identifierResolver) VisitUnary(u *UnaryExpression) {
-	newRight, err := ir.evalAst(u.Right)
+	newRight, err := ir.evalExpr(u.Right)
 	if err != nil {
 		return
 	}
 	ir.setResult(&UnaryExpression{
 		Operator: u.Operator,
 		Right:    newRight,
+		Pos:      u.Pos,
+	}, nil)
+}
+
+func (ir *identifierResolver) VisitPrefixIncDec(p *PrefixIncDec) {
+	newOperand, err := ir.evalExpr(p.Operand)
+	if err != nil {
+		return
+	}
+	if !isLvalue(newOperand) {
+		ir.setResult(nil, errorAt(p.Pos, "invalid lvalue for %s", p.Operator))
+		return
+	}
+	ir.setResult(&PrefixIncDec{
+		Operator: p.Operator,
+		Operand:  newOperand,
+		Pos:      p.Pos,
 	}, nil)
 }
 
 func (ir *identifierResolver) VisitPostfixIncDec(p *PostfixIncDec) {
-	newOperand, err := ir.evalAst(&p.Operand)
+	newOperand, err := ir.evalExpr(p.Operand)
 	if err != nil {
 		return
 	}
+	if !isLvalue(newOperand) {
+		ir.setResult(nil, errorAt(p.Pos, "invalid lvalue for %s", p.Operator))
+		return
+	}
 	ir.setResult(&PostfixIncDec{
 		Operator: p.Operator,
-		Operand:  *newOperand.(*Variable),
+		Operand:  newOperand,
+		Pos:      p.Pos,
 	}, nil)
 }
 
@@ -407,19 +533,19 @@ func (ir *identifierResolver) VisitBinary(b *BinaryExpression) {
 	var newRight Expression
 	var err error
 
-	newLeft, err = ir.evalAst(b.Left)
+	newLeft, err = ir.evalExpr(b.Left)
 	if err != nil {
 		return
 	}
 
-	newRight, err = ir.evalAst(b.Right)
+	newRight, err = ir.evalExpr(b.Right)
 	if err != nil {
 		return
 	}
 
 	// For assignment check if left expression is LVALUE
-	if b.Operator == "=" && newLeft.GetType() != AstVariable {
-		ir.setResult(nil, errors.New("invalid lvalue"))
+	if b.Operator == BinOpAssign && !isLvalue(newLeft) {
+		ir.setResult(nil, errorAt(b.Pos, "invalid lvalue"))
 		return
 	}
 
@@ -427,29 +553,146 @@ func (ir *identifierResolver) VisitBinary(b *BinaryExpression) {
 		Operator: b.Operator,
 		Left:     newLeft,
 		Right:    newRight,
+		Pos:      b.Pos,
+	}, nil)
+}
+
+func (ir *identifierResolver) VisitCompoundAssignment(c *CompoundAssignment) {
+	newLeft, err := ir.evalExpr(c.Left)
+	if err != nil {
+		return
+	}
+	newRight, err := ir.evalExpr(c.Right)
+	if err != nil {
+		return
+	}
+	if !isLvalue(newLeft) {
+		ir.setResult(nil, errorAt(c.Pos, "invalid lvalue"))
+		return
+	}
+	ir.setResult(&CompoundAssignment{
+		Operator: c.Operator,
+		Left:     newLeft,
+		Right:    newRight,
+		Pos:      c.Pos,
 	}, nil)
 }
 
 func (ir *identifierResolver) VisitConditional(cond *Conditional) {
-	newCond, err := ir.evalAst(cond.Condition)
+	newCond, err := ir.evalExpr(cond.Condition)
 	if err != nil {
 		return
 	}
-	newConsequent, err := ir.evalAst(cond.Consequent)
+	newConsequent, err := ir.evalExpr(cond.Consequent)
 	if err != nil {
 		return
 	}
-	newAlternate, err := ir.evalAst(cond.Alternate)
+	newAlternate, err := ir.evalExpr(cond.Alternate)
 	if err != nil {
 		return
 	}
 	ir.setResult(&Conditional{
-		newCond,
-		newConsequent,
-		newAlternate,
+		Condition:  newCond,
+		Consequent: newConsequent,
+		Alternate:  newAlternate,
+		Pos:        cond.Pos,
 	}, nil)
 }
 
+func isLvalue(expr Expression) bool {
+	if access, ok := expr.(*MemberAccess); ok {
+		return isLvalue(access.Object)
+	}
+	return expr.GetType() == AstVariable || expr.GetType() == AstDereference
+}
+
+func (ir *identifierResolver) VisitAddressOf(a *AddressOf) {
+	newOperand, err := ir.evalExpr(a.Operand)
+	if err != nil {
+		return
+	}
+	if !isLvalue(newOperand) {
+		ir.setResult(nil, errorAt(a.Pos, "cannot take the address of an rvalue"))
+		return
+	}
+	ir.setResult(&AddressOf{Operand: newOperand, Pos: a.Pos}, nil)
+}
+
+func (ir *identifierResolver) VisitDereference(d *Dereference) {
+	newOperand, err := ir.evalExpr(d.Operand)
+	if err != nil {
+		return
+	}
+	ir.setResult(&Dereference{Operand: newOperand, Pos: d.Pos}, nil)
+}
+
+func (ir *identifierResolver) VisitMemberAccess(m *MemberAccess) {
+	newObject, err := ir.evalExpr(m.Object)
+	if err != nil {
+		return
+	}
+	ir.setResult(&MemberAccess{Object: newObject, Member: m.Member, Pos: m.Pos}, nil)
+}
+
+func (ir *identifierResolver) VisitCast(c *Cast) {
+	newOperand, err := ir.evalExpr(c.Operand)
+	if err != nil {
+		return
+	}
+	ir.setResult(&Cast{TargetType: c.TargetType, Operand: newOperand, Pos: c.Pos}, nil)
+}
+
+func (ir *identifierResolver) VisitSizeOfType(s *SizeOfType) {
+	ir.setResult(s, nil)
+}
+
+func (ir *identifierResolver) VisitSizeOfExpr(s *SizeOfExpr) {
+	newOperand, err := ir.evalExpr(s.Operand)
+	if err != nil {
+		return
+	}
+	ir.setResult(&SizeOfExpr{Operand: newOperand, Pos: s.Pos}, nil)
+}
+
+func (ir *identifierResolver) VisitVaStart(v *VaStart) {
+	newVaList, err := ir.evalExpr(v.VaList)
+	if err != nil {
+		return
+	}
+	newLastParam, err := ir.evalExpr(v.LastParam)
+	if err != nil {
+		return
+	}
+	ir.setResult(&VaStart{VaList: newVaList, LastParam: newLastParam, Pos: v.Pos}, nil)
+}
+
+func (ir *identifierResolver) VisitVaArg(v *VaArg) {
+	newVaList, err := ir.evalExpr(v.VaList)
+	if err != nil {
+		return
+	}
+	ir.setResult(&VaArg{VaList: newVaList, ArgType: v.ArgType, Pos: v.Pos}, nil)
+}
+
+func (ir *identifierResolver) VisitVaEnd(v *VaEnd) {
+	newVaList, err := ir.evalExpr(v.VaList)
+	if err != nil {
+		return
+	}
+	ir.setResult(&VaEnd{VaList: newVaList, Pos: v.Pos}, nil)
+}
+
+// evalExpr resolves the identifiers in an expression and keeps its result type
+func (ir *identifierResolver) evalExpr(expr Expression) (Expression, error) {
+	ast, err := ir.evalAst(expr)
+	if err != nil {
+		return nil, err
+	}
+	newExpr := ast.(Expression)
+	newExpr.SetResultType(expr.GetResultType())
+	return newExpr, nil
+}
+
 func (ir *identifierResolver) evalAst(ast AST) (AST, error) {
 	ast.Accept(ir)
 	return ir.result.ast, ir.result.err
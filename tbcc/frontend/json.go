@@ -0,0 +1,845 @@
+package frontend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// JSON representation of the AST (see docs/ir-json.md)
+
+type jsonObject = map[string]any
+
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newJsonExporter().eval(p))
+}
+
+func (p *Program) UnmarshalJSON(data []byte) error {
+	var obj jsonObject
+	err := json.Unmarshal(data, &obj)
+	if err != nil {
+		return err
+	}
+	loader := &jsonLoader{structTags: make(map[string]*StructInfo)}
+	ast := loader.loadNode(obj)
+	if loader.err != nil {
+		return loader.err
+	}
+	program, ok := ast.(*Program)
+	if !ok {
+		return errors.New("JSON does not contain a program")
+	}
+	*p = *program
+	return nil
+}
+
+type jsonExporter struct {
+	result jsonObject
+}
+
+func newJsonExporter() *jsonExporter {
+	return &jsonExporter{}
+}
+
+func (je *jsonExporter) VisitProgram(p *Program) {
+	typeDecls := make([]any, 0)
+	for _, decl := range p.TypeDecls {
+		typeDecls = append(typeDecls, je.eval(decl))
+	}
+	variables := make([]any, 0)
+	for _, v := range p.Variables {
+		variables = append(variables, je.eval(&v))
+	}
+	functions := make([]any, 0)
+	for _, fun := range p.Functions {
+		functions = append(functions, je.eval(&fun))
+	}
+	je.result = jsonObject{
+		"kind":      "Program",
+		"typeDecls": typeDecls,
+		"variables": variables,
+		"functions": functions,
+	}
+}
+
+func (je *jsonExporter) VisitFunction(f *Function) {
+	params := make([]any, 0)
+	for _, param := range f.Params {
+		params = append(params, jsonObject{
+			"kind":       "Parameter",
+			"name":       param.Name,
+			"type":       param.Type.String(),
+			"pos":        jsonPos(param.Pos),
+			"sourceName": param.SourceName,
+		})
+	}
+	je.result = jsonObject{
+		"kind":       "Function",
+		"name":       f.Name,
+		"params":     params,
+		"returnType": f.ReturnType.String(),
+		"variadic":   f.Variadic,
+		"body":       je.evalOptional(f.Body),
+		"pos":        jsonPos(f.Pos),
+		"visibility": f.Visibility.String(),
+	}
+}
+
+func (je *jsonExporter) VisitVarDecl(v *VarDecl) {
+	je.result = jsonObject{
+		"kind":         "VarDecl",
+		"name":         v.Name,
+		"type":         v.VarType.String(),
+		"initValue":    je.evalOptional(v.InitValue),
+		"storageClass": v.StorageClass.String(),
+		"pos":          jsonPos(v.Pos),
+		"sourceName":   v.SourceName,
+		"visibility":   v.Visibility.String(),
+	}
+}
+
+func (je *jsonExporter) VisitEnumDecl(e *EnumDecl) {
+	members := make([]any, 0)
+	for _, member := range e.Members {
+		members = append(members, jsonObject{
+			"kind":  "EnumMember",
+			"name":  member.Name,
+			"value": je.evalOptional(member.Value),
+			"pos":   jsonPos(member.Pos),
+		})
+	}
+	je.result = jsonObject{
+		"kind":    "EnumDecl",
+		"type":    e.EnumType.String(),
+		"members": members,
+		"pos":     jsonPos(e.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitStructDecl(s *StructDecl) {
+	var members any
+	if s.Members != nil {
+		memberList := make([]any, 0)
+		for _, member := range s.Members {
+			memberList = append(memberList, jsonObject{
+				"kind":     "MemberDecl",
+				"name":     member.Name,
+				"type":     member.Type.String(),
+				"bitWidth": je.evalOptional(member.BitWidth),
+				"unsigned": member.Unsigned,
+				"pos":      jsonPos(member.Pos),
+			})
+		}
+		members = memberList
+	}
+	je.result = jsonObject{
+		"kind":    "StructDecl",
+		"type":    s.StructType.String(),
+		"members": members,
+		"pos":     jsonPos(s.Pos),
+	}
+	if s.StructType.IsComplete && s.Members != nil {
+		je.result["layout"] = structLayoutToJson(s.StructType)
+	}
+}
+
+// structLayoutToJson writes the layout computed by the type checker
+func structLayoutToJson(structType *StructInfo) jsonObject {
+	members := make([]any, 0)
+	for _, member := range structType.Members {
+		members = append(members, jsonObject{
+			"name":      member.Name,
+			"type":      member.Type.String(),
+			"offset":    member.Offset,
+			"bitOffset": member.BitOffset,
+			"bitWidth":  member.BitWidth,
+			"unsigned":  member.Unsigned,
+		})
+	}
+	return jsonObject{
+		"size":      structType.Size,
+		"alignment": structType.Alignment,
+		"members":   members,
+	}
+}
+
+func (je *jsonExporter) VisitTypedefDecl(t *TypedefDecl) {
+	je.result = jsonObject{
+		"kind": "TypedefDecl",
+		"name": t.Name,
+		"type": t.Type.String(),
+		"pos":  jsonPos(t.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitReturn(r *ReturnStmt) {
+	je.result = jsonObject{
+		"kind":       "ReturnStmt",
+		"expression": je.evalOptional(r.Expression),
+		"pos":        jsonPos(r.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitExprStmt(e *ExpressionStmt) {
+	je.result = jsonObject{
+		"kind":       "ExpressionStmt",
+		"expression": je.eval(e.Expression),
+		"pos":        jsonPos(e.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitIfStmt(i *IfStmt) {
+	je.result = jsonObject{
+		"kind":       "IfStmt",
+		"condition":  je.eval(i.Condition),
+		"consequent": je.eval(i.Consequent),
+		"alternate":  je.evalOptional(i.Alternate),
+		"pos":        jsonPos(i.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitBlockStmt(b *BlockStmt) {
+	items := make([]any, 0)
+	for _, item := range b.Items {
+		items = append(items, je.eval(item))
+	}
+	je.result = jsonObject{"kind": "BlockStmt", "items": items, "pos": jsonPos(b.Pos)}
+}
+
+func (je *jsonExporter) VisitGotoStmt(g *GotoStmt) {
+	je.result = jsonObject{"kind": "GotoStmt", "target": g.Target, "pos": jsonPos(g.Pos)}
+}
+
+func (je *jsonExporter) VisitLabelStmt(l *LabelStmt) {
+	je.result = jsonObject{"kind": "LabelStmt", "name": l.Name, "pos": jsonPos(l.Pos)}
+}
+
+func (je *jsonExporter) VisitDoWhileStmt(d *DoWhileStmt) {
+	je.result = jsonObject{
+		"kind":      "DoWhileStmt",
+		"condition": je.eval(d.Condition),
+		"body":      je.eval(d.Body),
+		"label":     d.Label,
+		"pos":       jsonPos(d.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitWhileStmt(w *WhileStmt) {
+	je.result = jsonObject{
+		"kind":      "WhileStmt",
+		"condition": je.eval(w.Condition),
+		"body":      je.eval(w.Body),
+		"label":     w.Label,
+		"pos":       jsonPos(w.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitForStmt(f *ForStmt) {
+	je.result = jsonObject{
+		"kind":      "ForStmt",
+		"init":      je.eval(f.InitStmt),
+		"condition": je.evalOptional(f.Condition),
+		"post":      je.evalOptional(f.Post),
+		"body":      je.eval(f.Body),
+		"label":     f.Label,
+		"pos":       jsonPos(f.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitBreakStmt(b *BreakStmt) {
+	je.result = jsonObject{"kind": "BreakStmt", "label": b.Label, "pos": jsonPos(b.Pos)}
+}
+
+func (je *jsonExporter) VisitContinueStmt(c *ContinueStmt) {
+	je.result = jsonObject{"kind": "ContinueStmt", "label": c.Label, "pos": jsonPos(c.Pos)}
+}
+
+func (je *jsonExporter) VisitSwitchStmt(s *SwitchStmt) {
+	je.result = jsonObject{
+		"kind":           "SwitchStmt",
+		"expression":     je.eval(s.Expr),
+		"body":           je.eval(s.Body),
+		"label":          s.Label,
+		"firstCaseLabel": s.FirstCaseLabel,
+		"pos":            jsonPos(s.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitCaseStmt(c *CaseStmt) {
+	je.result = jsonObject{
+		"kind":          "CaseStmt",
+		"value":         je.evalOptional(c.Value),
+		"label":         c.Label,
+		"prevCaseLabel": c.PrevCaseLabel,
+		"nextCaseLabel": c.NextCaseLabel,
+		"pos":           jsonPos(c.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitNullStmt(n *NullStmt) {
+	je.result = jsonObject{"kind": "NullStmt", "pos": jsonPos(n.Pos)}
+}
+
+func (je *jsonExporter) VisitInteger(i *IntegerLiteral) {
+	je.result = jsonObject{"kind": "IntegerLiteral", "value": i.Value, "pos": jsonPos(i.Pos)}
+}
+
+func (je *jsonExporter) VisitVariable(v *Variable) {
+	je.result = jsonObject{"kind": "Variable", "name": v.Name, "pos": jsonPos(v.Pos)}
+}
+
+func (je *jsonExporter) VisitFunctionCall(f *FunctionCall) {
+	args := make([]any, 0)
+	for _, arg := range f.Args {
+		args = append(args, je.eval(arg))
+	}
+	je.result = jsonObject{
+		"kind":   "FunctionCall",
+		"callee": je.eval(f.Callee),
+		"args":   args,
+		"pos":    jsonPos(f.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitUnary(u *UnaryExpression) {
+	je.result = jsonObject{
+		"kind":     "UnaryExpression",
+		"operator": u.Operator.String(),
+		"right":    je.eval(u.Right),
+		"pos":      jsonPos(u.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitPrefixIncDec(p *PrefixIncDec) {
+	je.result = jsonObject{
+		"kind":     "PrefixIncDec",
+		"operator": p.Operator.String(),
+		"operand":  je.eval(p.Operand),
+		"pos":      jsonPos(p.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitPostfixIncDec(p *PostfixIncDec) {
+	je.result = jsonObject{
+		"kind":     "PostfixIncDec",
+		"operator": p.Operator.String(),
+		"operand":  je.eval(p.Operand),
+		"pos":      jsonPos(p.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitBinary(b *BinaryExpression) {
+	je.result = jsonObject{
+		"kind":     "BinaryExpression",
+		"operator": b.Operator.String(),
+		"left":     je.eval(b.Left),
+		"right":    je.eval(b.Right),
+		"pos":      jsonPos(b.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitCompoundAssignment(c *CompoundAssignment) {
+	je.result = jsonObject{
+		"kind":     "CompoundAssignment",
+		"operator": c.Operator.String() + "=",
+		"left":     je.eval(c.Left),
+		"right":    je.eval(c.Right),
+		"pos":      jsonPos(c.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitConditional(c *Conditional) {
+	je.result = jsonObject{
+		"kind":       "Conditional",
+		"condition":  je.eval(c.Condition),
+		"consequent": je.eval(c.Consequent),
+		"alternate":  je.eval(c.Alternate),
+		"pos":        jsonPos(c.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitAddressOf(a *AddressOf) {
+	je.result = jsonObject{"kind": "AddressOf", "operand": je.eval(a.Operand), "pos": jsonPos(a.Pos)}
+}
+
+func (je *jsonExporter) VisitDereference(d *Dereference) {
+	je.result = jsonObject{"kind": "Dereference", "operand": je.eval(d.Operand), "pos": jsonPos(d.Pos)}
+}
+
+func (je *jsonExporter) VisitMemberAccess(m *MemberAccess) {
+	je.result = jsonObject{
+		"kind":   "MemberAccess",
+		"object": je.eval(m.Object),
+		"member": m.Member,
+		"pos":    jsonPos(m.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitCast(c *Cast) {
+	je.result = jsonObject{
+		"kind":       "Cast",
+		"targetType": c.TargetType.String(),
+		"operand":    je.eval(c.Operand),
+		"pos":        jsonPos(c.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitSizeOfType(s *SizeOfType) {
+	je.result = jsonObject{"kind": "SizeOfType", "targetType": s.TargetType.String(), "pos": jsonPos(s.Pos)}
+}
+
+func (je *jsonExporter) VisitSizeOfExpr(s *SizeOfExpr) {
+	je.result = jsonObject{"kind": "SizeOfExpr", "operand": je.eval(s.Operand), "pos": jsonPos(s.Pos)}
+}
+
+func (je *jsonExporter) VisitVaStart(v *VaStart) {
+	je.result = jsonObject{
+		"kind":      "VaStart",
+		"vaList":    je.eval(v.VaList),
+		"lastParam": je.eval(v.LastParam),
+		"pos":       jsonPos(v.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitVaArg(v *VaArg) {
+	je.result = jsonObject{
+		"kind":    "VaArg",
+		"vaList":  je.eval(v.VaList),
+		"argType": v.ArgType.String(),
+		"pos":     jsonPos(v.Pos),
+	}
+}
+
+func (je *jsonExporter) VisitVaEnd(v *VaEnd) {
+	je.result = jsonObject{"kind": "VaEnd", "vaList": je.eval(v.VaList), "pos": jsonPos(v.Pos)}
+}
+
+func (je *jsonExporter) eval(ast AST) jsonObject {
+	ast.Accept(je)
+	if expr, ok := ast.(Expression); ok && expr.GetResultType() != nil {
+		je.result["resultType"] = expr.GetResultType().String()
+	}
+	return je.result
+}
+
+func (je *jsonExporter) evalOptional(ast AST) any {
+	if ast == nil || isNilPointer(ast) {
+		return nil
+	}
+	return je.eval(ast)
+}
+
+func isNilPointer(ast AST) bool {
+	switch node := ast.(type) {
+	case *BlockStmt:
+		return node == nil
+	default:
+		return false
+	}
+}
+
+func jsonPos(pos Position) jsonObject {
+	ret := jsonObject{"line": pos.Line, "col": pos.Col}
+	if pos.File != "" {
+		ret["file"] = pos.File
+	}
+	return ret
+}
+
+type jsonLoader struct {
+	// structTags holds the structures and unions by tag. All references
+	// to a tag share the StructInfo which is completed by the StructDecl.
+	structTags map[string]*StructInfo
+	err        error
+}
+
+func (jl *jsonLoader) loadNode(value any) AST {
+	if jl.err != nil || value == nil {
+		return nil
+	}
+	obj, ok := value.(jsonObject)
+	if !ok {
+		jl.fail("node must be a JSON object")
+		return nil
+	}
+
+	kind := jl.getString(obj, "kind")
+	pos := jl.getPos(obj)
+
+	switch kind {
+	case "Program":
+		var typeDecls []BodyItem
+		for _, item := range jl.getList(obj, "typeDecls") {
+			typeDecls = append(typeDecls, jl.loadNode(item))
+		}
+		var variables []VarDecl
+		for _, item := range jl.getList(obj, "variables") {
+			if v, ok := jl.loadNode(item).(*VarDecl); ok {
+				variables = append(variables, *v)
+			}
+		}
+		var functions []Function
+		for _, item := range jl.getList(obj, "functions") {
+			if f, ok := jl.loadNode(item).(*Function); ok {
+				functions = append(functions, *f)
+			}
+		}
+		return &Program{TypeDecls: typeDecls, Variables: variables, Functions: functions}
+	case "Function":
+		var params []Parameter
+		for _, item := range jl.getList(obj, "params") {
+			paramObj, _ := item.(jsonObject)
+			params = append(params, Parameter{
+				Name:       jl.getString(paramObj, "name"),
+				Type:       jl.getType(paramObj, "type"),
+				Pos:        jl.getPos(paramObj),
+				SourceName: jl.getString(paramObj, "sourceName"),
+			})
+		}
+		body, _ := jl.loadNode(obj["body"]).(*BlockStmt)
+		return &Function{
+			jl.getString(obj, "name"),
+			params,
+			jl.getType(obj, "returnType"),
+			jl.getBool(obj, "variadic"),
+			body,
+			pos,
+			jl.getVisibility(obj),
+		}
+	case "VarDecl":
+		return &VarDecl{
+			jl.getString(obj, "name"),
+			jl.getType(obj, "type"),
+			jl.loadExpr(obj["initValue"]),
+			jl.getStorageClass(obj),
+			pos,
+			jl.getString(obj, "sourceName"),
+			jl.getVisibility(obj),
+		}
+	case "EnumDecl":
+		enumType, ok := jl.getType(obj, "type").(*EnumInfo)
+		if !ok {
+			// anonymous enumeration
+			enumType = &EnumInfo{}
+		}
+		var members []EnumMember
+		for _, item := range jl.getList(obj, "members") {
+			memberObj, _ := item.(jsonObject)
+			members = append(members, EnumMember{
+				Name:  jl.getString(memberObj, "name"),
+				Value: jl.loadExpr(memberObj["value"]),
+				Pos:   jl.getPos(memberObj),
+			})
+		}
+		return &EnumDecl{EnumType: enumType, Members: members, Pos: pos}
+	case "StructDecl":
+		structType, ok := jl.getType(obj, "type").(*StructInfo)
+		if !ok {
+			jl.fail("'type' of StructDecl must be a struct or union")
+			return nil
+		}
+		var members []MemberDecl
+		if obj["members"] != nil {
+			members = make([]MemberDecl, 0)
+		}
+		for _, item := range jl.getList(obj, "members") {
+			memberObj, _ := item.(jsonObject)
+			members = append(members, MemberDecl{
+				Name:     jl.getString(memberObj, "name"),
+				Type:     jl.getType(memberObj, "type"),
+				BitWidth: jl.loadExpr(memberObj["bitWidth"]),
+				Unsigned: jl.getBool(memberObj, "unsigned"),
+				Pos:      jl.getPos(memberObj),
+			})
+		}
+		if layout, ok := obj["layout"].(jsonObject); ok {
+			jl.loadStructLayout(structType, layout)
+		}
+		return &StructDecl{StructType: structType, Members: members, Pos: pos}
+	case "TypedefDecl":
+		return &TypedefDecl{Name: jl.getString(obj, "name"), Type: jl.getType(obj, "type"), Pos: pos}
+	case "ReturnStmt":
+		return &ReturnStmt{jl.loadExpr(obj["expression"]), pos}
+	case "ExpressionStmt":
+		return &ExpressionStmt{jl.loadExpr(obj["expression"]), pos}
+	case "IfStmt":
+		return &IfStmt{
+			jl.loadExpr(obj["condition"]),
+			jl.loadNode(obj["consequent"]),
+			jl.loadNode(obj["alternate"]),
+			pos,
+		}
+	case "BlockStmt":
+		var items []BodyItem
+		for _, item := range jl.getList(obj, "items") {
+			items = append(items, jl.loadNode(item))
+		}
+		return &BlockStmt{items, pos}
+	case "GotoStmt":
+		return &GotoStmt{jl.getString(obj, "target"), pos}
+	case "LabelStmt":
+		return &LabelStmt{jl.getString(obj, "name"), pos}
+	case "DoWhileStmt":
+		return &DoWhileStmt{
+			jl.loadExpr(obj["condition"]),
+			jl.loadNode(obj["body"]),
+			jl.getString(obj, "label"),
+			pos,
+		}
+	case "WhileStmt":
+		return &WhileStmt{
+			jl.loadExpr(obj["condition"]),
+			jl.loadNode(obj["body"]),
+			jl.getString(obj, "label"),
+			pos,
+		}
+	case "ForStmt":
+		return &ForStmt{
+			jl.loadNode(obj["init"]),
+			jl.loadExpr(obj["condition"]),
+			jl.loadExpr(obj["post"]),
+			jl.loadNode(obj["body"]),
+			jl.getString(obj, "label"),
+			pos,
+		}
+	case "BreakStmt":
+		return &BreakStmt{jl.getString(obj, "label"), pos}
+	case "ContinueStmt":
+		return &ContinueStmt{jl.getString(obj, "label"), pos}
+	case "SwitchStmt":
+		return &SwitchStmt{
+			jl.loadExpr(obj["expression"]),
+			jl.loadNode(obj["body"]),
+			jl.getString(obj, "label"),
+			jl.getString(obj, "firstCaseLabel"),
+			pos,
+		}
+	case "CaseStmt":
+		return &CaseStmt{
+			jl.loadExpr(obj["value"]),
+			jl.getString(obj, "label"),
+			jl.getString(obj, "prevCaseLabel"),
+			jl.getString(obj, "nextCaseLabel"),
+			pos,
+		}
+	case "NullStmt":
+		return &NullStmt{pos}
+	case "IntegerLiteral":
+		return &IntegerLiteral{Value: jl.getInt(obj, "value"), Pos: pos}
+	case "Variable":
+		return &Variable{Name: jl.getString(obj, "name"), Pos: pos}
+	case "FunctionCall":
+		var args []Expression
+		for _, item := range jl.getList(obj, "args") {
+			args = append(args, jl.loadExpr(item))
+		}
+		return &FunctionCall{Callee: jl.loadExpr(obj["callee"]), Args: args, Pos: pos}
+	case "UnaryExpression":
+		return &UnaryExpression{
+			Operator: jl.getUnaryOp(obj),
+			Right:    jl.loadExpr(obj["right"]),
+			Pos:      pos,
+		}
+	case "PrefixIncDec":
+		return &PrefixIncDec{
+			Operator: jl.getIncDecOp(obj),
+			Operand:  jl.loadExpr(obj["operand"]),
+			Pos:      pos,
+		}
+	case "PostfixIncDec":
+		return &PostfixIncDec{
+			Operator: jl.getIncDecOp(obj),
+			Operand:  jl.loadExpr(obj["operand"]),
+			Pos:      pos,
+		}
+	case "BinaryExpression":
+		return &BinaryExpression{
+			Operator: jl.getBinaryOp(obj, ""),
+			Left:     jl.loadExpr(obj["left"]),
+			Right:    jl.loadExpr(obj["right"]),
+			Pos:      pos,
+		}
+	case "CompoundAssignment":
+		return &CompoundAssignment{
+			Operator: jl.getBinaryOp(obj, "="),
+			Left:     jl.loadExpr(obj["left"]),
+			Right:    jl.loadExpr(obj["right"]),
+			Pos:      pos,
+		}
+	case "Conditional":
+		return &Conditional{
+			Condition:  jl.loadExpr(obj["condition"]),
+			Consequent: jl.loadExpr(obj["consequent"]),
+			Alternate:  jl.loadExpr(obj["alternate"]),
+			Pos:        pos,
+		}
+	case "AddressOf":
+		return &AddressOf{Operand: jl.loadExpr(obj["operand"]), Pos: pos}
+	case "Dereference":
+		return &Dereference{Operand: jl.loadExpr(obj["operand"]), Pos: pos}
+	case "MemberAccess":
+		return &MemberAccess{Object: jl.loadExpr(obj["object"]), Member: jl.getString(obj, "member"), Pos: pos}
+	case "Cast":
+		return &Cast{TargetType: jl.getType(obj, "targetType"), Operand: jl.loadExpr(obj["operand"]), Pos: pos}
+	case "SizeOfType":
+		return &SizeOfType{TargetType: jl.getType(obj, "targetType"), Pos: pos}
+	case "SizeOfExpr":
+		return &SizeOfExpr{Operand: jl.loadExpr(obj["operand"]), Pos: pos}
+	case "VaStart":
+		return &VaStart{VaList: jl.loadExpr(obj["vaList"]), LastParam: jl.loadExpr(obj["lastParam"]), Pos: pos}
+	case "VaArg":
+		return &VaArg{VaList: jl.loadExpr(obj["vaList"]), ArgType: jl.getType(obj, "argType"), Pos: pos}
+	case "VaEnd":
+		return &VaEnd{VaList: jl.loadExpr(obj["vaList"]), Pos: pos}
+	default:
+		jl.fail(fmt.Sprintf("unknown node kind '%s'", kind))
+		return nil
+	}
+}
+
+// loadExpr loads an optional expression including its result type
+func (jl *jsonLoader) loadExpr(value any) Expression {
+	node := jl.loadNode(value)
+	if node == nil {
+		return nil
+	}
+	expr, ok := node.(Expression)
+	if !ok {
+		jl.fail("node must be an expression")
+		return nil
+	}
+	if obj := value.(jsonObject); obj["resultType"] != nil {
+		expr.SetResultType(jl.getType(obj, "resultType"))
+	}
+	return expr
+}
+
+func (jl *jsonLoader) loadStructLayout(structType *StructInfo, layout jsonObject) {
+	var members []StructMember
+	for _, item := range jl.getList(layout, "members") {
+		memberObj, _ := item.(jsonObject)
+		members = append(members, StructMember{
+			Name:      jl.getString(memberObj, "name"),
+			Type:      jl.getType(memberObj, "type"),
+			Offset:    jl.getInt(memberObj, "offset"),
+			BitOffset: jl.getInt(memberObj, "bitOffset"),
+			BitWidth:  jl.getInt(memberObj, "bitWidth"),
+			Unsigned:  jl.getBool(memberObj, "unsigned"),
+		})
+	}
+	structType.Members = members
+	structType.Size = jl.getInt(layout, "size")
+	structType.Alignment = jl.getInt(layout, "alignment")
+	structType.IsComplete = true
+}
+
+func (jl *jsonLoader) getUnaryOp(obj jsonObject) UnaryOp {
+	lexeme := jl.getString(obj, "operator")
+	for op, opLexeme := range unaryOpLexemes {
+		if opLexeme == lexeme {
+			return op
+		}
+	}
+	jl.fail(fmt.Sprintf("unknown unary operator '%s'", lexeme))
+	return UnOpNegate
+}
+
+// getBinaryOp reads a binary operator which is followed by suffix
+// in the JSON (e.g. "=" for compound assignments)
+func (jl *jsonLoader) getBinaryOp(obj jsonObject, suffix string) BinaryOp {
+	lexeme := jl.getString(obj, "operator")
+	for op, opLexeme := range binaryOpLexemes {
+		if opLexeme+suffix == lexeme {
+			return op
+		}
+	}
+	jl.fail(fmt.Sprintf("unknown binary operator '%s'", lexeme))
+	return BinOpAdd
+}
+
+func (jl *jsonLoader) getIncDecOp(obj jsonObject) IncDecOp {
+	switch lexeme := jl.getString(obj, "operator"); lexeme {
+	case "++":
+		return IncOp
+	case "--":
+		return DecOp
+	default:
+		jl.fail(fmt.Sprintf("unknown increment operator '%s'", lexeme))
+		return IncOp
+	}
+}
+
+func (jl *jsonLoader) getStorageClass(obj jsonObject) StorageClass {
+	switch name := jl.getString(obj, "storageClass"); name {
+	case "":
+		return StorageNone
+	case "static":
+		return StorageStatic
+	case "extern":
+		return StorageExtern
+	default:
+		jl.fail(fmt.Sprintf("unknown storage class '%s'", name))
+		return StorageNone
+	}
+}
+
+func (jl *jsonLoader) getVisibility(obj jsonObject) Visibility {
+	name := jl.getString(obj, "visibility")
+	if name == "" {
+		return VisibilityDefault
+	}
+	visibility, err := parseVisibility(name)
+	if err != nil {
+		jl.fail(err.Error())
+	}
+	return visibility
+}
+
+func (jl *jsonLoader) getString(obj jsonObject, key string) string {
+	value, _ := obj[key].(string)
+	return value
+}
+
+func (jl *jsonLoader) getBool(obj jsonObject, key string) bool {
+	value, _ := obj[key].(bool)
+	return value
+}
+
+func (jl *jsonLoader) getInt(obj jsonObject, key string) int {
+	value, ok := obj[key].(float64)
+	if !ok {
+		jl.fail(fmt.Sprintf("'%s' must be a number", key))
+	}
+	return int(value)
+}
+
+func (jl *jsonLoader) getType(obj jsonObject, key string) TypeInfo {
+	typeInfo, err := parseTypeName(jl.getString(obj, key), jl.structTags)
+	if err != nil {
+		jl.fail(fmt.Sprintf("'%s' must be a type name", key))
+		return &IntInfo{}
+	}
+	return typeInfo
+}
+
+func (jl *jsonLoader) getList(obj jsonObject, key string) []any {
+	value, _ := obj[key].([]any)
+	return value
+}
+
+func (jl *jsonLoader) getPos(obj jsonObject) Position {
+	posObj, ok := obj["pos"].(jsonObject)
+	if !ok {
+		return Position{}
+	}
+	line, _ := posObj["line"].(float64)
+	col, _ := posObj["col"].(float64)
+	file, _ := posObj["file"].(string)
+	return Position{int(line), int(col), file}
+}
+
+func (jl *jsonLoader) fail(message string) {
+	if jl.err == nil {
+		jl.err = errors.New("invalid AST JSON: " + message)
+	}
+}
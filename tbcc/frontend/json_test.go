@@ -0,0 +1,104 @@
+package frontend
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProgram_JsonRoundTrip(t *testing.T) {
+	code := `
+int add(int a, int b);
+int apply(int (*f)(int, int), int a);
+
+enum mode { OFF, ON = 3 };
+typedef enum mode mode_t;
+
+struct point { int x; int y : 4; unsigned : 0; unsigned z : 7; };
+union value { struct point p; int raw; };
+
+static int calls = 1;
+extern int *last;
+
+int main(void) {
+	static int runs;
+	extern int calls;
+	int x = 1;
+	int y;
+	mode_t m = ON;
+	enum { LOW = -1, HIGH } level = HIGH;
+	union value v;
+	struct point *pp = &v.p;
+	pp->z = v.raw + pp->x;
+	for (int i = 0; i < 10; i++) {
+		if (i == 5)
+			continue;
+		x += add(i, 2) + apply(&add, i) + (*add)(1, i);
+	}
+	do {
+		y = x > 3 ? -x : ~x;
+	} while (0);
+	switch (x) {
+		case 1: x--; break;
+		case ON: x = m + level; break;
+		default: ;
+	}
+	while (1) break;
+	goto end;
+end:
+	return x && y || !x;
+}
+
+int sum(int n, ...) {
+	__builtin_va_list ap;
+	__builtin_va_start(ap, n);
+	int x = __builtin_va_arg(ap, int);
+	__builtin_va_end(ap);
+	return x;
+}`
+	tokens, _ := Tokenize(code)
+	program, err := NewParser(tokens).ParseProgram()
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+	program, _, err = AnalyzeSemantics(program, NewNameCreator())
+	if err != nil {
+		t.Fatalf("AnalyzeSemantics() error = %v", err)
+	}
+
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	var loaded Program
+	err = json.Unmarshal(data, &loaded)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	reloaded, _ := json.Marshal(&loaded)
+	if string(reloaded) != string(data) {
+		t.Errorf("JSON differs after round trip:\n%s\n%s", data, reloaded)
+	}
+	if !reflect.DeepEqual(program.Functions[1].Name, loaded.Functions[1].Name) {
+		t.Errorf("function name = %s, want %s", loaded.Functions[1].Name, program.Functions[1].Name)
+	}
+	if loaded.Functions[1].Pos != program.Functions[1].Pos {
+		t.Errorf("function position = %v, want %v", loaded.Functions[1].Pos, program.Functions[1].Pos)
+	}
+}
+
+func TestProgram_UnmarshalJSON_Errors(t *testing.T) {
+	tests := []string{
+		`{"kind": "Function", "name": "main"}`,
+		`{"kind": "Program", "functions": [{"kind": "Unknown"}]}`,
+		`[1, 2, 3]`,
+	}
+	for _, data := range tests {
+		var program Program
+		if err := json.Unmarshal([]byte(data), &program); err == nil {
+			t.Errorf("json.Unmarshal(%s) expected error", data)
+		}
+	}
+}
@@ -1,32 +1,54 @@
 package frontend
 
-import (
-	"errors"
-	"fmt"
-)
+import "fmt"
 
 type labelChecker struct {
-	gotoStmts  map[string]bool
+	// gotoStmts maps the targets to the first goto statement
+	gotoStmts  map[string]*GotoStmt
 	labelStmts map[string]error
+	labelNodes map[string]*LabelStmt
 	caseErrors map[string]error
+	switches   []*switchCoverage
+	// warnings about switch statements over enumerations that do not
+	// handle every member (only available after type checking)
+	warnings []Warning
 }
 
-func newLabelChecker() *labelChecker {
-	return &labelChecker{}
+// switchCoverage collects the case values of a switch statement
+type switchCoverage struct {
+	enumType   *EnumInfo
+	hasDefault bool
+	values     map[int]bool
+	// unknownValues is set if a case value is not a literal or an
+	// enumeration constant
+	unknownValues bool
 }
 
-func (lc *labelChecker) check(program *Program) error {
+func newLabelChecker() *labelChecker {
+	lc := &labelChecker{}
+	lc.reset()
+	return lc
+}
 
-	lc.gotoStmts = map[string]bool{}
+func (lc *labelChecker) reset() {
+	lc.gotoStmts = map[string]*GotoStmt{}
 	lc.labelStmts = map[string]error{}
+	lc.labelNodes = map[string]*LabelStmt{}
 	lc.caseErrors = map[string]error{}
+	lc.switches = nil
+	lc.warnings = nil
+}
+
+func (lc *labelChecker) check(program *Program) error {
+
+	lc.reset()
 
 	program.Accept(lc)
 
-	for target := range lc.gotoStmts {
+	for target, g := range lc.gotoStmts {
 		_, ok := lc.labelStmts[target]
 		if !ok {
-			return errors.New("target " + target + " does not exist")
+			return errorAt(g.Pos, "target %s does not exist", target)
 		}
 	}
 	for _, err := range lc.labelStmts {
@@ -42,6 +64,17 @@ func (lc *labelChecker) check(program *Program) error {
 	return nil
 }
 
+// unusedLabels returns the labels that are not the target of any goto
+func (lc *labelChecker) unusedLabels() []*LabelStmt {
+	var ret []*LabelStmt
+	for name, label := range lc.labelNodes {
+		if _, ok := lc.gotoStmts[name]; !ok {
+			ret = append(ret, label)
+		}
+	}
+	return ret
+}
+
 func (lc *labelChecker) VisitProgram(p *Program) {
 	for _, fun := range p.Functions {
 		fun.Accept(lc)
@@ -56,6 +89,12 @@ func (lc *labelChecker) VisitFunction(f *Function) {
 
 func (lc *labelChecker) VisitVarDecl(*VarDecl) {}
 
+func (lc *labelChecker) VisitEnumDecl(*EnumDecl) {}
+
+func (lc *labelChecker) VisitStructDecl(*StructDecl) {}
+
+func (lc *labelChecker) VisitTypedefDecl(*TypedefDecl) {}
+
 func (lc *labelChecker) VisitReturn(*ReturnStmt) {}
 
 func (lc *labelChecker) VisitExprStmt(*ExpressionStmt) {}
@@ -71,11 +110,13 @@ func (lc *labelChecker) VisitBlockStmt(b *BlockStmt) {
 	var labelName string
 	var caseName string
 	var caseLabel string
+	var labelPos, casePos Position
 
 	for _, item := range b.Items {
 		item.Accept(lc)
 		if item.GetType() == AstLabelStmt {
 			labelName = item.(*LabelStmt).Name
+			labelPos = item.(*LabelStmt).Pos
 		} else if item.GetType() == AstCaseStmt {
 			caseStmt := item.(*CaseStmt)
 			if caseStmt.Value != nil {
@@ -84,16 +125,17 @@ func (lc *labelChecker) VisitBlockStmt(b *BlockStmt) {
 				caseName = "default"
 			}
 			caseLabel = caseStmt.Label
+			casePos = caseStmt.Pos
 		} else if labelName != "" {
-			if item.GetType() == AstVarDecl {
-				lc.labelStmts[labelName] = errors.New("label " + labelName +
-					" is not allowed before a variable declaration")
+			if isDeclaration(item) {
+				lc.labelStmts[labelName] = errorAt(labelPos,
+					"label %s is not allowed before a variable declaration", labelName)
 			}
 			labelName = ""
 		} else if caseLabel != "" {
-			if item.GetType() == AstVarDecl {
-				lc.caseErrors[caseLabel] = errors.New(caseName +
-					" is not allowed before a variable declaration")
+			if isDeclaration(item) {
+				lc.caseErrors[caseLabel] = errorAt(casePos,
+					"%s is not allowed before a variable declaration", caseName)
 			}
 			caseName = ""
 			caseLabel = ""
@@ -101,17 +143,17 @@ func (lc *labelChecker) VisitBlockStmt(b *BlockStmt) {
 	}
 
 	if labelName != "" {
-		lc.labelStmts[labelName] = errors.New("label " + labelName + " is not before any statement")
+		lc.labelStmts[labelName] = errorAt(labelPos, "label %s is not before any statement", labelName)
 	}
 	if caseName != "" {
-		lc.caseErrors[caseLabel] = errors.New(caseName + " is not before any statement")
+		lc.caseErrors[caseLabel] = errorAt(casePos, "%s is not before any statement", caseName)
 	}
 }
 
 func (lc *labelChecker) VisitGotoStmt(g *GotoStmt) {
 	_, ok := lc.gotoStmts[g.Target]
 	if !ok {
-		lc.gotoStmts[g.Target] = true
+		lc.gotoStmts[g.Target] = g
 	}
 }
 
@@ -119,8 +161,9 @@ func (lc *labelChecker) VisitLabelStmt(l *LabelStmt) {
 	_, ok := lc.labelStmts[l.Name]
 	if !ok {
 		lc.labelStmts[l.Name] = nil
+		lc.labelNodes[l.Name] = l
 	} else {
-		lc.labelStmts[l.Name] = errors.New("label " + l.Name + " already exists")
+		lc.labelStmts[l.Name] = errorAt(l.Pos, "label %s already exists", l.Name)
 	}
 }
 
@@ -141,12 +184,72 @@ func (lc *labelChecker) VisitBreakStmt(*BreakStmt) {}
 func (lc *labelChecker) VisitContinueStmt(*ContinueStmt) {}
 
 func (lc *labelChecker) VisitSwitchStmt(s *SwitchStmt) {
+	enumType, _ := s.Expr.GetResultType().(*EnumInfo)
+	coverage := &switchCoverage{enumType: enumType, values: map[int]bool{}}
+
+	lc.switches = append(lc.switches, coverage)
 	s.Body.Accept(lc)
+	lc.switches = lc.switches[:len(lc.switches)-1]
+
+	if enumType == nil || coverage.hasDefault || coverage.unknownValues {
+		return
+	}
+	for _, constant := range enumType.Constants {
+		if !coverage.values[constant.Value] {
+			lc.warnings = append(lc.warnings, Warning{
+				Category: WarnSwitch,
+				Message:  fmt.Sprintf("enumeration value '%s' not handled in switch", constant.Name),
+				Pos:      s.Pos,
+			})
+		}
+	}
+}
+
+func (lc *labelChecker) VisitCaseStmt(c *CaseStmt) {
+	if len(lc.switches) == 0 {
+		return
+	}
+	coverage := lc.switches[len(lc.switches)-1]
+
+	switch value := c.Value.(type) {
+	case nil:
+		coverage.hasDefault = true
+	case *IntegerLiteral:
+		coverage.values[value.Value] = true
+	case *Variable:
+		constant := coverage.enumConstant(value.Name)
+		if constant == nil {
+			coverage.unknownValues = true
+		} else {
+			coverage.values[constant.Value] = true
+		}
+	default:
+		coverage.unknownValues = true
+	}
 }
 
-func (lc *labelChecker) VisitCaseStmt(*CaseStmt) {}
+func (sc *switchCoverage) enumConstant(name string) *EnumConstant {
+	if sc.enumType == nil {
+		return nil
+	}
+	for i := range sc.enumType.Constants {
+		if sc.enumType.Constants[i].Name == name {
+			return &sc.enumType.Constants[i]
+		}
+	}
+	return nil
+}
+
+func isDeclaration(item BodyItem) bool {
+	switch item.GetType() {
+	case AstVarDecl, AstEnumDecl, AstStructDecl, AstTypedefDecl:
+		return true
+	default:
+		return false
+	}
+}
 
-func (lc *labelChecker) VisitNullStmt() {}
+func (lc *labelChecker) VisitNullStmt(*NullStmt) {}
 
 func (lc *labelChecker) VisitInteger(*IntegerLiteral) {}
 
@@ -156,8 +259,30 @@ func (lc *labelChecker) VisitFunctionCall(*FunctionCall) {}
 
 func (lc *labelChecker) VisitUnary(*UnaryExpression) {}
 
+func (lc *labelChecker) VisitPrefixIncDec(*PrefixIncDec) {}
+
 func (lc *labelChecker) VisitPostfixIncDec(*PostfixIncDec) {}
 
 func (lc *labelChecker) VisitBinary(*BinaryExpression) {}
 
+func (lc *labelChecker) VisitCompoundAssignment(*CompoundAssignment) {}
+
 func (lc *labelChecker) VisitConditional(*Conditional) {}
+
+func (lc *labelChecker) VisitAddressOf(*AddressOf) {}
+
+func (lc *labelChecker) VisitDereference(*Dereference) {}
+
+func (lc *labelChecker) VisitMemberAccess(*MemberAccess) {}
+
+func (lc *labelChecker) VisitCast(*Cast) {}
+
+func (lc *labelChecker) VisitSizeOfType(*SizeOfType) {}
+
+func (lc *labelChecker) VisitSizeOfExpr(*SizeOfExpr) {}
+
+func (lc *labelChecker) VisitVaStart(*VaStart) {}
+
+func (lc *labelChecker) VisitVaArg(*VaArg) {}
+
+func (lc *labelChecker) VisitVaEnd(*VaEnd) {}
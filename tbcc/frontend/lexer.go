@@ -1,18 +1,22 @@
 package frontend
 
 import (
-	"errors"
 	"regexp"
+	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 func Tokenize(code string) ([]Token, error) {
-	pos := Position{1, 1}
+	pos := Position{1, 1, ""}
 	remaining := code
 	tokens := make([]Token, 0)
+	// number of included files entered by line markers
+	includeDepth := 0
 
 	for remaining != "" {
-		remaining, pos = skipWhitespace(remaining, pos)
+		remaining, pos = skipWhitespace(remaining, pos, &includeDepth)
 		if remaining == "" {
 			break
 		}
@@ -60,7 +64,7 @@ func maxMunch(code string, pos Position) (*Token, error) {
 		tokenType := adaptTokenType(maxTokenType, maxLexeme)
 		return NewToken(tokenType, maxLexeme, pos), nil
 	} else {
-		return nil, errors.New("code matches no token")
+		return nil, errorAt(pos, "code matches no token")
 	}
 }
 
@@ -76,13 +80,59 @@ func adaptTokenType(tokenType TokenType, lexeme string) TokenType {
 	}
 }
 
-func skipWhitespace(code string, startPos Position) (string, Position) {
+func skipWhitespace(code string, startPos Position, includeDepth *int) (string, Position) {
 	pos := startPos
-	for i, ch := range code {
+	for code != "" {
+		ch, size := utf8.DecodeRuneInString(code)
+		if ch == '#' && pos.Col == 1 {
+			code, pos = skipLineMarker(code, pos, includeDepth)
+			continue
+		}
 		if !unicode.IsSpace(ch) {
-			return code[i:], pos
+			return code, pos
 		}
 		pos = pos.Advance(ch)
+		code = code[size:]
 	}
 	return "", pos
 }
+
+// skipLineMarker skips a line marker of the preprocessor
+// (# <line> "<file>" <flags>) and continues counting lines
+// from the line given in the marker. The flags 1 (entering an included
+// file) and 2 (returning to a file) track the include depth. Positions
+// in included files get the name of the file.
+func skipLineMarker(code string, pos Position, includeDepth *int) (string, Position) {
+	line, rest, _ := strings.Cut(code, "\n")
+	nextPos := Position{pos.Line + 1, 1, pos.File}
+
+	marker := strings.TrimSpace(line[1:])
+	if after, ok := strings.CutPrefix(marker, "line"); ok {
+		marker = strings.TrimSpace(after)
+	}
+	lineField, marker, _ := strings.Cut(marker, " ")
+	lineNo, err := strconv.Atoi(lineField)
+	if err != nil {
+		return rest, nextPos
+	}
+	nextPos.Line = lineNo
+	marker = strings.TrimSpace(marker)
+	quoted, err := strconv.QuotedPrefix(marker)
+	if err != nil {
+		return rest, nextPos
+	}
+	for _, flag := range strings.Fields(marker[len(quoted):]) {
+		switch flag {
+		case "1":
+			*includeDepth++
+		case "2":
+			*includeDepth--
+		}
+	}
+	nextPos.File = ""
+	if *includeDepth > 0 {
+		nextPos.File, _ = strconv.Unquote(quoted)
+	}
+
+	return rest, nextPos
+}
@@ -21,31 +21,56 @@ func Test_skipWhitespace(t *testing.T) {
 		{"no whitespace",
 			args{
 				"int main()",
-				Position{1, 1},
+				Position{1, 1, ""},
 			},
 			"int main()",
-			Position{1, 1},
+			Position{1, 1, ""},
 		},
 		{"with whitespace",
 			args{
 				"    \tint main()",
-				Position{1, 1},
+				Position{1, 1, ""},
 			},
 			"int main()",
-			Position{1, 6},
+			Position{1, 6, ""},
 		},
 		{"with newline",
 			args{
 				"    \n int main()",
-				Position{1, 1},
+				Position{1, 1, ""},
 			},
 			"int main()",
-			Position{2, 2},
+			Position{2, 2, ""},
+		},
+		{"with line marker",
+			args{
+				"# 1 \"<built-in>\"\n# 12 \"prog.c\"\n\n  int main()",
+				Position{1, 1, ""},
+			},
+			"int main()",
+			Position{13, 3, ""},
+		},
+		{"in included file",
+			args{
+				"# 1 \"prog.c\"\n# 1 \"/usr/include/x.h\" 1 3 4\n# 1 \"sub/y.h\" 1\n# 7 \"/usr/include/x.h\" 2\n int x;",
+				Position{1, 1, ""},
+			},
+			"int x;",
+			Position{7, 2, "/usr/include/x.h"},
+		},
+		{"back in main file",
+			args{
+				"# 1 \"/usr/include/x.h\" 1 3 4\n# 3 \"prog.c\" 2\nint main()",
+				Position{1, 1, ""},
+			},
+			"int main()",
+			Position{3, 1, ""},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, got1 := skipWhitespace(tt.args.code, tt.args.startPos)
+			includeDepth := 0
+			got, got1 := skipWhitespace(tt.args.code, tt.args.startPos, &includeDepth)
 			if got != tt.want {
 				t.Errorf("skipWhitespace() got = %v, want %v", got, tt.want)
 			}
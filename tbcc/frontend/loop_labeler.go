@@ -1,9 +1,6 @@
 package frontend
 
-import (
-	"errors"
-	"fmt"
-)
+import "fmt"
 
 type labelContext uint
 
@@ -21,7 +18,7 @@ type labelInfo struct {
 type switchInfo struct {
 	nextCaseIdx uint
 	prevCase    *CaseStmt
-	cases       map[string]bool
+	hasDefault  bool
 	caseLabels  []string
 }
 
@@ -53,7 +50,6 @@ func (ll *loopLabeler) pushNewLabel(ctx labelContext) labelInfo {
 		switchInfo_ = &switchInfo{
 			nextCaseIdx: 0,
 			prevCase:    nil,
-			cases:       make(map[string]bool),
 			caseLabels:  make([]string, 0),
 		}
 	}
@@ -121,6 +117,12 @@ func (ll *loopLabeler) VisitFunction(f *Function) {
 
 func (ll *loopLabeler) VisitVarDecl(*VarDecl) {}
 
+func (ll *loopLabeler) VisitEnumDecl(*EnumDecl) {}
+
+func (ll *loopLabeler) VisitStructDecl(*StructDecl) {}
+
+func (ll *loopLabeler) VisitTypedefDecl(*TypedefDecl) {}
+
 func (ll *loopLabeler) VisitReturn(*ReturnStmt) {}
 
 func (ll *loopLabeler) VisitExprStmt(*ExpressionStmt) {}
@@ -172,7 +174,7 @@ func (ll *loopLabeler) VisitForStmt(f *ForStmt) {
 func (ll *loopLabeler) VisitBreakStmt(b *BreakStmt) {
 	lInfo := ll.peekLabel()
 	if lInfo == nil {
-		ll.err = errors.New("break statement outside of loop/switch")
+		ll.err = errorAt(b.Pos, "break statement outside of loop/switch")
 		return
 	}
 	b.Label = lInfo.name
@@ -181,7 +183,7 @@ func (ll *loopLabeler) VisitBreakStmt(b *BreakStmt) {
 func (ll *loopLabeler) VisitContinueStmt(c *ContinueStmt) {
 	loopIdx := ll.getLoopIdx()
 	if loopIdx == -1 {
-		ll.err = errors.New("continue statement outside of loop")
+		ll.err = errorAt(c.Pos, "continue statement outside of loop")
 		return
 	}
 	c.Label = ll.labelStack[loopIdx].name
@@ -202,25 +204,22 @@ func (ll *loopLabeler) VisitSwitchStmt(s *SwitchStmt) {
 func (ll *loopLabeler) VisitCaseStmt(c *CaseStmt) {
 	switchIdx := ll.getSwitchIdx()
 	if switchIdx == -1 {
-		ll.err = errors.New("case/default statement outside of switch")
+		ll.err = errorAt(c.Pos, "case/default statement outside of switch")
 		return
 	}
 	switchData := ll.labelStack[switchIdx]
 
-	var caseValueStr string
-	if c.Value != nil {
-		caseValueStr = fmt.Sprintf("%d", c.Value.(*IntegerLiteral).Value)
-	} else {
-		caseValueStr = "default"
-	}
-	_, ok := switchData.switchInfo_.cases[caseValueStr]
-	if ok {
-		ll.err = errors.New("there is already a case clause for value " + caseValueStr)
-		return
+	// Duplicate case values are detected by the type checker
+	// which evaluates the constant expressions
+	if c.Value == nil {
+		if switchData.switchInfo_.hasDefault {
+			ll.err = errorAt(c.Pos, "there is already a default clause")
+			return
+		}
+		switchData.switchInfo_.hasDefault = true
 	}
 
 	label := fmt.Sprintf("%s.case.%d", switchData.name, switchData.switchInfo_.nextCaseIdx)
-	switchData.switchInfo_.cases[caseValueStr] = true
 	switchData.switchInfo_.caseLabels = append(switchData.switchInfo_.caseLabels, label)
 
 	if switchData.switchInfo_.prevCase != nil {
@@ -235,7 +234,7 @@ func (ll *loopLabeler) VisitCaseStmt(c *CaseStmt) {
 	ll.labelStack[switchIdx] = switchData
 }
 
-func (ll *loopLabeler) VisitNullStmt() {}
+func (ll *loopLabeler) VisitNullStmt(*NullStmt) {}
 
 func (ll *loopLabeler) VisitInteger(*IntegerLiteral) {}
 
@@ -245,8 +244,30 @@ func (ll *loopLabeler) VisitFunctionCall(*FunctionCall) {}
 
 func (ll *loopLabeler) VisitUnary(*UnaryExpression) {}
 
+func (ll *loopLabeler) VisitPrefixIncDec(*PrefixIncDec) {}
+
 func (ll *loopLabeler) VisitPostfixIncDec(*PostfixIncDec) {}
 
 func (ll *loopLabeler) VisitBinary(*BinaryExpression) {}
 
+func (ll *loopLabeler) VisitCompoundAssignment(*CompoundAssignment) {}
+
 func (ll *loopLabeler) VisitConditional(*Conditional) {}
+
+func (ll *loopLabeler) VisitAddressOf(*AddressOf) {}
+
+func (ll *loopLabeler) VisitDereference(*Dereference) {}
+
+func (ll *loopLabeler) VisitMemberAccess(*MemberAccess) {}
+
+func (ll *loopLabeler) VisitCast(*Cast) {}
+
+func (ll *loopLabeler) VisitSizeOfType(*SizeOfType) {}
+
+func (ll *loopLabeler) VisitSizeOfExpr(*SizeOfExpr) {}
+
+func (ll *loopLabeler) VisitVaStart(*VaStart) {}
+
+func (ll *loopLabeler) VisitVaArg(*VaArg) {}
+
+func (ll *loopLabeler) VisitVaEnd(*VaEnd) {}
@@ -1,12 +1,24 @@
 package frontend
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type NameCreator interface {
 	VarName() string
+	// TempName returns the name of a temporary introduced by the
+	// translation to TACKY (see IsTempName)
+	TempName() string
 	LabelName(prefix string) string
 }
 
+// IsTempName checks if the variable is a temporary. Unlike the names of
+// variables of the source, the names of temporaries start with a dot.
+func IsTempName(name string) bool {
+	return strings.HasPrefix(name, ".t")
+}
+
 type nameCreator struct {
 	varCounter    uint
 	labelCounters map[string]uint
@@ -25,6 +37,12 @@ func (n *nameCreator) VarName() string {
 	return varName
 }
 
+func (n *nameCreator) TempName() string {
+	tempName := fmt.Sprintf(".t%d", n.varCounter)
+	n.varCounter++
+	return tempName
+}
+
 func (n *nameCreator) LabelName(prefix string) string {
 	current, ok := n.labelCounters[prefix]
 	if !ok {
@@ -0,0 +1,137 @@
+package frontend
+
+type UnaryOp int
+
+const (
+	UnOpNegate UnaryOp = iota
+	UnOpComplement
+	UnOpNot
+)
+
+var unaryOpLexemes = map[UnaryOp]string{
+	UnOpNegate:     "-",
+	UnOpComplement: "~",
+	UnOpNot:        "!",
+}
+
+// String returns the operator as written in C
+func (op UnaryOp) String() string {
+	return unaryOpLexemes[op]
+}
+
+type BinaryOp int
+
+const (
+	BinOpAdd BinaryOp = iota
+	BinOpSub
+	BinOpMul
+	BinOpDiv
+	BinOpRemainder
+	BinOpBitAnd
+	BinOpBitOr
+	BinOpBitXor
+	BinOpShiftLeft
+	BinOpShiftRight
+	BinOpAnd
+	BinOpOr
+	BinOpEqual
+	BinOpNotEqual
+	BinOpLess
+	BinOpLessEq
+	BinOpGreater
+	BinOpGreaterEq
+	BinOpAssign
+)
+
+var binaryOpLexemes = map[BinaryOp]string{
+	BinOpAdd:        "+",
+	BinOpSub:        "-",
+	BinOpMul:        "*",
+	BinOpDiv:        "/",
+	BinOpRemainder:  "%",
+	BinOpBitAnd:     "&",
+	BinOpBitOr:      "|",
+	BinOpBitXor:     "^",
+	BinOpShiftLeft:  "<<",
+	BinOpShiftRight: ">>",
+	BinOpAnd:        "&&",
+	BinOpOr:         "||",
+	BinOpEqual:      "==",
+	BinOpNotEqual:   "!=",
+	BinOpLess:       "<",
+	BinOpLessEq:     "<=",
+	BinOpGreater:    ">",
+	BinOpGreaterEq:  ">=",
+	BinOpAssign:     "=",
+}
+
+// String returns the operator as written in C
+func (op BinaryOp) String() string {
+	return binaryOpLexemes[op]
+}
+
+func (op BinaryOp) IsRelational() bool {
+	switch op {
+	case BinOpEqual, BinOpNotEqual, BinOpLess, BinOpLessEq, BinOpGreater, BinOpGreaterEq:
+		return true
+	default:
+		return false
+	}
+}
+
+// IncDecOp is the operator of prefix and postfix increments and decrements
+type IncDecOp int
+
+const (
+	IncOp IncDecOp = iota
+	DecOp
+)
+
+func (op IncDecOp) String() string {
+	if op == DecOp {
+		return "--"
+	}
+	return "++"
+}
+
+var unaryOperators = map[TokenType]UnaryOp{
+	TokTypeMinus:    UnOpNegate,
+	TokTypeTilde:    UnOpComplement,
+	TokTypeExclMark: UnOpNot,
+}
+
+var binaryOperators = map[TokenType]BinaryOp{
+	TokTypePlus:           BinOpAdd,
+	TokTypeMinus:          BinOpSub,
+	TokTypeAsterisk:       BinOpMul,
+	TokTypeSlash:          BinOpDiv,
+	TokTypePercent:        BinOpRemainder,
+	TokTypeAmpersand:      BinOpBitAnd,
+	TokTypePipe:           BinOpBitOr,
+	TokTypeCaret:          BinOpBitXor,
+	TokTypeLessLess:       BinOpShiftLeft,
+	TokTypeGreaterGreater: BinOpShiftRight,
+	TokTypeAmperAmper:     BinOpAnd,
+	TokTypePipePipe:       BinOpOr,
+	TokTypeEqEq:           BinOpEqual,
+	TokTypeExclMarkEq:     BinOpNotEqual,
+	TokTypeLt:             BinOpLess,
+	TokTypeLtEq:           BinOpLessEq,
+	TokTypeGt:             BinOpGreater,
+	TokTypeGtEq:           BinOpGreaterEq,
+	TokTypeEq:             BinOpAssign,
+}
+
+// compoundAssignOperators maps e.g. "+=" to the operator "+"
+var compoundAssignOperators = map[TokenType]BinaryOp{
+	TokTypePlusEq:           BinOpAdd,
+	TokTypeMinusEq:          BinOpSub,
+	TokTypeAsteriskEq:       BinOpMul,
+	TokTypeSlashEq:          BinOpDiv,
+	TokTypePercentEq:        BinOpRemainder,
+	TokTypeAmpersandEq:      BinOpBitAnd,
+	TokTypePipeEq:           BinOpBitOr,
+	TokTypeCaretEq:          BinOpBitXor,
+	TokTypeLessLessEq:       BinOpShiftLeft,
+	TokTypeGreaterGreaterEq: BinOpShiftRight,
+}
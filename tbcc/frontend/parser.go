@@ -4,99 +4,316 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 type Parser struct {
 	tokens  []Token
 	currIdx int
 	maxIdx  int
+	scopes  []*parserScope
+	// typeDecls holds the enum, struct and union declarations found in
+	// type specifiers that have not been added to the enclosing block yet
+	typeDecls []BodyItem
+	// definedStructs holds the structures and unions whose definition
+	// has been parsed
+	definedStructs map[*StructInfo]bool
+}
+
+// parserScope holds the names that must be known while parsing
+type parserScope struct {
+	enumTags map[string]*EnumInfo
+	// structTags holds the tags of structures and unions which share
+	// one name space
+	structTags map[string]*StructInfo
+	// typedefNames maps the identifiers declared in the scope to true for
+	// typedef names and to false for ordinary identifiers. The latter
+	// hide typedef names of enclosing scopes.
+	typedefNames map[string]bool
 }
 
 func NewParser(tokens []Token) *Parser {
-	return &Parser{
-		tokens:  tokens,
-		currIdx: 0,
-		maxIdx:  len(tokens) - 1,
+	p := &Parser{
+		tokens:         tokens,
+		currIdx:        0,
+		maxIdx:         len(tokens) - 1,
+		definedStructs: make(map[*StructInfo]bool),
+	}
+	p.pushScope()
+	return p
+}
+
+func (p *Parser) pushScope() {
+	p.scopes = append(p.scopes, &parserScope{
+		enumTags:     make(map[string]*EnumInfo),
+		structTags:   make(map[string]*StructInfo),
+		typedefNames: make(map[string]bool),
+	})
+}
+
+func (p *Parser) popScope() {
+	p.scopes = p.scopes[:len(p.scopes)-1]
+}
+
+func (p *Parser) currentScope() *parserScope {
+	return p.scopes[len(p.scopes)-1]
+}
+
+func (p *Parser) declareName(name string, isTypedef bool) {
+	p.currentScope().typedefNames[name] = isTypedef
+}
+
+func (p *Parser) isTypedefName(name string) bool {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if isTypedef, ok := p.scopes[i].typedefNames[name]; ok {
+			return isTypedef
+		}
 	}
+	return false
+}
+
+// startsTypeName checks whether the token is the first one of a type
+// name. This depends on the typedef names known at this point (the
+// so-called lexer hack).
+func (p *Parser) startsTypeName(token *Token) bool {
+	return isTypeSpecifier(token.tokenType) ||
+		(token.tokenType == TokTypeIdentifier && p.isTypedefName(token.lexeme))
+}
+
+// takeTypeDecls returns and clears the pending type declarations
+func (p *Parser) takeTypeDecls() []BodyItem {
+	ret := p.typeDecls
+	p.typeDecls = nil
+	return ret
 }
 
 func (p *Parser) ParseProgram() (*Program, error) {
+	var typeDecls []BodyItem
+	var vars []VarDecl
 	var fs []Function
 
 	for !p.endOfInput() {
-		f, err := p.parseFunction()
+		decl, err := p.parseDeclaration()
 		if err != nil {
-			return nil, err
+			return nil, withPosition(err, p.errorPos())
+		}
+		typeDecls = append(typeDecls, p.takeTypeDecls()...)
+		switch decl.GetType() {
+		case AstFunction:
+			fs = append(fs, *decl.(*Function))
+		case AstEnumDecl, AstStructDecl, AstTypedefDecl:
+			typeDecls = append(typeDecls, decl)
+		default:
+			vars = append(vars, *decl.(*VarDecl))
 		}
-		fs = append(fs, *f)
 	}
 
-	return &Program{fs}, nil
+	return &Program{TypeDecls: typeDecls, Variables: vars, Functions: fs}, nil
 }
 
-func (p *Parser) parseFunction() (*Function, error) {
-
-	_, err := p.consume(TokTypeInt) // only integer types are supported for now
+// parseDeclaration parses a function or variable declaration. Which
+// one it is, is determined by the declarator following the type.
+func (p *Parser) parseDeclaration() (BodyItem, error) {
+	visibility, err := p.parseAttributes(VisibilityDefault)
 	if err != nil {
 		return nil, err
 	}
-
-	token, err := p.consume(TokTypeIdentifier)
+	typeToken, err := p.peek()
 	if err != nil {
 		return nil, err
 	}
-	name := token.lexeme
-
-	_, err = p.consume(TokTypeLeftParen)
+	if typeToken.tokenType == TokTypeTypedef {
+		return p.parseTypedef()
+	}
+	storageClass := StorageNone
+	switch typeToken.tokenType {
+	case TokTypeStatic:
+		storageClass = StorageStatic
+		_, _ = p.consume()
+	case TokTypeExtern:
+		storageClass = StorageExtern
+		_, _ = p.consume()
+	}
+	baseType, err := p.parseTypeSpecifier()
 	if err != nil {
 		return nil, err
 	}
-
-	var params []Parameter
-	var param *Parameter
-	token, err = p.peek()
+	token, err := p.peek()
+	if err == nil && token.tokenType == TokTypeSemicolon {
+		// declaration of a type only, e.g. "enum color { RED, GREEN };"
+		_, _ = p.consume()
+		typeDecls := p.takeTypeDecls()
+		if len(typeDecls) == 0 {
+			return nil, errors.New("declaration does not declare anything")
+		}
+		// nested definitions stay pending, e.g. "struct b" in
+		// "struct a { struct b { int x; } b; };"
+		p.typeDecls = typeDecls[:len(typeDecls)-1]
+		return typeDecls[len(typeDecls)-1], nil
+	}
+	decl, err := p.parseDeclarator()
+	if err != nil {
+		return nil, err
+	}
+	name, declType, params, err := processDeclarator(decl, baseType)
+	if err != nil {
+		return nil, err
+	}
+	visibility, err = p.parseAttributes(visibility)
 	if err != nil {
 		return nil, err
 	}
-	if token.tokenType != TokTypeVoid {
-	paramsLoop:
+
+	// the scope of a name starts right after its declarator
+	p.declareName(name, false)
+
+	if declType.GetTypeId() == TypeFunc {
+		if storageClass == StorageStatic {
+			return nil, errors.New(fmt.Sprintf("function %s: static functions are not supported", name))
+		}
+		function, err := p.parseFunction(name, declType.(*FuncInfo), params, typeToken.position)
+		if err != nil {
+			return nil, err
+		}
+		function.Visibility = visibility
+		return function, nil
+	} else {
+		varDecl, err := p.parseVarDeclaration(name, declType, storageClass, typeToken.position)
+		if err != nil {
+			return nil, err
+		}
+		varDecl.Visibility = visibility
+		return varDecl, nil
+	}
+}
+
+// parseAttributes parses the GNU attribute specifiers in front of and
+// after a declarator. Only the visibility attribute is supported.
+//
+//	<attributes> ::= { "__attribute__" "(" "(" <attribute> { "," <attribute> } ")" ")" }
+//	<attribute> ::= "visibility" "(" <string> ")"
+func (p *Parser) parseAttributes(visibility Visibility) (Visibility, error) {
+	for {
+		token, err := p.peek()
+		if err != nil || token.tokenType != TokTypeAttribute {
+			return visibility, nil
+		}
+		_, _ = p.consume()
+		for _, expected := range []TokenType{TokTypeLeftParen, TokTypeLeftParen} {
+			if _, err = p.consume(expected); err != nil {
+				return visibility, err
+			}
+		}
 		for {
-			param, err = p.parseParameter()
+			name, err := p.consume(TokTypeIdentifier)
 			if err != nil {
-				return nil, err
+				return visibility, err
 			}
-			params = append(params, *param)
-			token, err = p.peek()
+			if name.lexeme != "visibility" {
+				return visibility, errors.New(fmt.Sprintf("attribute '%s' is not supported", name.lexeme))
+			}
+			if _, err = p.consume(TokTypeLeftParen); err != nil {
+				return visibility, err
+			}
+			argument, err := p.consume(TokTypeStringLiteral)
 			if err != nil {
-				return nil, err
+				return visibility, err
 			}
-
-			switch token.tokenType {
-			case TokTypeRightParen:
-				break paramsLoop
-			case TokTypeComma:
-				_, _ = p.consume(TokTypeComma)
-			default:
-				return nil, errors.New("expected comma or parenthesis")
+			visibility, err = parseVisibility(strings.Trim(argument.lexeme, "\""))
+			if err != nil {
+				return visibility, err
+			}
+			if _, err = p.consume(TokTypeRightParen); err != nil {
+				return visibility, err
+			}
+			token, err = p.consume(TokTypeComma, TokTypeRightParen)
+			if err != nil {
+				return visibility, err
+			}
+			if token.tokenType == TokTypeRightParen {
+				break
 			}
 		}
-	} else {
-		_, _ = p.consume(TokTypeVoid)
+		if _, err = p.consume(TokTypeRightParen); err != nil {
+			return visibility, err
+		}
 	}
+}
 
-	_, err = p.consume(TokTypeRightParen)
+func parseVisibility(name string) (Visibility, error) {
+	for _, visibility := range []Visibility{
+		VisibilityDefault, VisibilityHidden, VisibilityProtected, VisibilityInternal,
+	} {
+		if visibility.String() == name {
+			return visibility, nil
+		}
+	}
+	return VisibilityDefault, errors.New(fmt.Sprintf(
+		"visibility '%s' is unknown (default, hidden, protected or internal expected)", name))
+}
+
+// parseTypedef parses a typedef declaration:
+//
+//	<typedef> ::= "typedef" <type-specifier> <declarator> ";"
+//
+// Typedefs of function types (typedef int F(void);) are not supported
+// since a declaration like F f; would declare a function. Typedefs of
+// pointers to functions are.
+func (p *Parser) parseTypedef() (*TypedefDecl, error) {
+	typedefToken, err := p.consume(TokTypeTypedef)
+	if err != nil {
+		return nil, err
+	}
+	baseType, err := p.parseTypeSpecifier()
+	if err != nil {
+		return nil, err
+	}
+	decl, err := p.parseDeclarator()
+	if err != nil {
+		return nil, err
+	}
+	name, typeInfo, _, err := processDeclarator(decl, baseType)
+	if err != nil {
+		return nil, err
+	}
+	if typeInfo.GetTypeId() == TypeFunc {
+		return nil, errors.New(fmt.Sprintf("typedef %s: function types are not supported", name))
+	}
+	_, err = p.consume(TokTypeSemicolon)
 	if err != nil {
 		return nil, err
 	}
 
-	token, err = p.peek()
+	p.declareName(name, true)
+
+	return &TypedefDecl{Name: name, Type: typeInfo, Pos: typedefToken.position}, nil
+}
+
+func (p *Parser) parseFunction(
+	name string,
+	funcInfo *FuncInfo,
+	params []Parameter,
+	pos Position,
+) (*Function, error) {
+
+	token, err := p.peek()
 	if err != nil {
 		return nil, err
 	}
 
 	var body *BlockStmt
 	if token.tokenType != TokTypeSemicolon {
+		for _, param := range params {
+			if param.Name == "" {
+				return nil, errors.New(fmt.Sprintf("%s: parameter name omitted", name))
+			}
+		}
+		p.pushScope()
+		for _, param := range params {
+			p.declareName(param.Name, false)
+		}
 		body, err = p.parseBlockStmt()
+		p.popScope()
 		if err != nil {
 			return nil, err
 		}
@@ -105,30 +322,17 @@ func (p *Parser) parseFunction() (*Function, error) {
 	}
 
 	return &Function{
-		Name:   name,
-		Params: params,
-		Body:   body,
-	}, nil
-}
-
-func (p *Parser) parseParameter() (*Parameter, error) {
-	_, err := p.consume(TokTypeInt) // only integer types are supported for now
-	if err != nil {
-		return nil, err
-	}
-	identifier, err := p.consume(TokTypeIdentifier)
-	if err != nil {
-		return nil, err
-	}
-
-	return &Parameter{
-		Name: identifier.lexeme,
-		TyId: TypeInt,
+		Name:       name,
+		Params:     params,
+		ReturnType: funcInfo.ReturnType,
+		Variadic:   funcInfo.Variadic,
+		Body:       body,
+		Pos:        pos,
 	}, nil
 }
 
 func (p *Parser) parseBlockStmt() (*BlockStmt, error) {
-	_, err := p.consume(TokTypeLeftBrace)
+	leftBrace, err := p.consume(TokTypeLeftBrace)
 	if err != nil {
 		return nil, err
 	}
@@ -137,6 +341,7 @@ func (p *Parser) parseBlockStmt() (*BlockStmt, error) {
 	var item BodyItem
 	var token *Token
 
+	p.pushScope()
 	for {
 		token, err = p.peek()
 		if err != nil {
@@ -149,46 +354,49 @@ func (p *Parser) parseBlockStmt() (*BlockStmt, error) {
 		if err != nil {
 			return nil, err
 		}
+		items = append(items, p.takeTypeDecls()...)
 		items = append(items, item)
 	}
+	p.popScope()
 
 	_, err = p.consume(TokTypeRightBrace)
 	if err != nil {
 		return nil, err
 	}
 
-	return &BlockStmt{items}, nil
+	return &BlockStmt{items, leftBrace.position}, nil
 }
 
 func (p *Parser) parseBodyItem() (BodyItem, error) {
-	tokens := p.peekN(3)
-
-	if len(tokens) == 3 {
-		if tokens[0].tokenType == TokTypeInt && tokens[1].tokenType == TokTypeIdentifier {
-			if tokens[2].tokenType == TokTypeLeftParen {
-				return p.parseFunction()
-			} else {
-				return p.parseVarDeclaration()
-			}
-		} else {
-			return p.parseStatement()
-		}
+	token, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if token.tokenType == TokTypeTypedef || token.tokenType == TokTypeStatic ||
+		token.tokenType == TokTypeExtern || token.tokenType == TokTypeAttribute ||
+		(p.startsTypeName(token) && !p.isLabel()) {
+		return p.parseDeclaration()
 	} else {
 		return p.parseStatement()
 	}
 }
 
-func (p *Parser) parseVarDeclaration() (*VarDecl, error) {
-	var ret *VarDecl
+// isLabel checks whether the next tokens are an identifier followed
+// by a colon. Labels may have the same name as a typedef.
+func (p *Parser) isLabel() bool {
+	nextTokens := p.peekN(2)
+	return len(nextTokens) == 2 &&
+		nextTokens[0].tokenType == TokTypeIdentifier &&
+		nextTokens[1].tokenType == TokTypeColon
+}
 
-	_, err := p.consume(TokTypeInt)
-	if err != nil {
-		return nil, err
-	}
-	ident, err := p.consume(TokTypeIdentifier)
-	if err != nil {
-		return nil, err
-	}
+func (p *Parser) parseVarDeclaration(
+	name string,
+	varType TypeInfo,
+	storageClass StorageClass,
+	pos Position,
+) (*VarDecl, error) {
+	var ret *VarDecl
 
 	token, err := p.peek()
 	if err != nil {
@@ -205,13 +413,19 @@ func (p *Parser) parseVarDeclaration() (*VarDecl, error) {
 			return nil, err
 		}
 		ret = &VarDecl{
-			Name:      ident.lexeme,
-			InitValue: initValue,
+			Name:         name,
+			VarType:      varType,
+			InitValue:    initValue,
+			StorageClass: storageClass,
+			Pos:          pos,
 		}
 	case TokTypeSemicolon:
 		ret = &VarDecl{
-			Name:      ident.lexeme,
-			InitValue: nil,
+			Name:         name,
+			VarType:      varType,
+			InitValue:    nil,
+			StorageClass: storageClass,
+			Pos:          pos,
 		}
 	default:
 		return nil, errors.New("unexpected token at var declaration: " + token.lexeme)
@@ -254,15 +468,15 @@ func (p *Parser) parseStatement() (Statement, error) {
 			return nil, err
 		}
 		if token.tokenType == TokTypeBreak {
-			return &BreakStmt{}, nil
+			return &BreakStmt{Pos: token.position}, nil
 		} else {
-			return &ContinueStmt{}, nil
+			return &ContinueStmt{Pos: token.position}, nil
 		}
 	case TokTypeLeftBrace:
 		return p.parseBlockStmt()
 	case TokTypeSemicolon:
 		_, _ = p.consume()
-		return &NullStmt{}, nil
+		return &NullStmt{token.position}, nil
 	case TokTypeGoto:
 		return p.parseGotoStmt()
 	case TokTypeIdentifier:
@@ -276,7 +490,7 @@ func (p *Parser) parseStatement() (Statement, error) {
 			name := token.lexeme
 			_, _ = p.consume()
 			_, _ = p.consume()
-			return &LabelStmt{Name: name}, nil
+			return &LabelStmt{Name: name, Pos: token.position}, nil
 		default:
 			return p.parseExprStmt()
 		}
@@ -298,9 +512,6 @@ func (p *Parser) parseCaseStmt() (*CaseStmt, error) {
 		if err != nil {
 			return nil, err
 		}
-		if value.GetType() != AstInteger {
-			return nil, errors.New("expected integer as case value")
-		}
 	}
 
 	_, err = p.consume(TokTypeColon)
@@ -308,11 +519,11 @@ func (p *Parser) parseCaseStmt() (*CaseStmt, error) {
 		return nil, err
 	}
 
-	return &CaseStmt{value, "", "", ""}, nil
+	return &CaseStmt{value, "", "", "", token.position}, nil
 }
 
 func (p *Parser) parseSwitchStmt() (*SwitchStmt, error) {
-	_, err := p.consume(TokTypeSwitch)
+	switchToken, err := p.consume(TokTypeSwitch)
 	if err != nil {
 		return nil, err
 	}
@@ -344,6 +555,7 @@ func (p *Parser) parseSwitchStmt() (*SwitchStmt, error) {
 		Body:           body,
 		Label:          "",
 		FirstCaseLabel: "",
+		Pos:            switchToken.position,
 	}, nil
 }
 
@@ -358,7 +570,18 @@ func (p *Parser) hoistingSwitchBlockVars(block *BlockStmt) *BlockStmt {
 		case AstVarDecl:
 			if hoisting {
 				varDecl := item.(*VarDecl)
-				varDecls = append(varDecls, &VarDecl{Name: varDecl.Name})
+				if varDecl.StorageClass != StorageNone {
+					// static variables are initialized before the program starts
+					varDecls = append(varDecls, varDecl)
+				} else {
+					varDecls = append(varDecls, &VarDecl{Name: varDecl.Name, VarType: varDecl.VarType, Pos: varDecl.Pos})
+				}
+				continue
+			}
+		case AstEnumDecl, AstStructDecl, AstTypedefDecl:
+			// the hoisted variables may refer to the declared types
+			if hoisting {
+				varDecls = append(varDecls, item)
 				continue
 			}
 		case AstCaseStmt:
@@ -370,11 +593,11 @@ func (p *Parser) hoistingSwitchBlockVars(block *BlockStmt) *BlockStmt {
 
 	newItems = append(varDecls, newItems...)
 
-	return &BlockStmt{Items: newItems}
+	return &BlockStmt{Items: newItems, Pos: block.Pos}
 }
 
 func (p *Parser) parseForStmt() (*ForStmt, error) {
-	_, err := p.consume(TokTypeFor)
+	forToken, err := p.consume(TokTypeFor)
 	if err != nil {
 		return nil, err
 	}
@@ -387,8 +610,16 @@ func (p *Parser) parseForStmt() (*ForStmt, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(p.takeTypeDecls()) > 0 {
+		return nil, errors.New("types must not be declared in for loop initializers")
+	}
 	switch initStmt.GetType() {
-	case AstVarDecl, AstExprStmt, AstNullStmt:
+	case AstVarDecl:
+		if varDecl := initStmt.(*VarDecl); varDecl.StorageClass != StorageNone {
+			return nil, errors.New(fmt.Sprintf(
+				"variable %s: storage class '%s' in for loop initializer", varDecl.Name, varDecl.StorageClass))
+		}
+	case AstExprStmt, AstNullStmt:
 		break
 	default:
 		return nil, errors.New("init statement must be one of: varDecl, exprStmt or nullStmt")
@@ -439,11 +670,12 @@ func (p *Parser) parseForStmt() (*ForStmt, error) {
 		post,
 		body,
 		"",
+		forToken.position,
 	}, nil
 }
 
 func (p *Parser) parseWhileStmt() (*WhileStmt, error) {
-	_, err := p.consume(TokTypeWhile)
+	whileToken, err := p.consume(TokTypeWhile)
 	if err != nil {
 		return nil, err
 	}
@@ -468,11 +700,12 @@ func (p *Parser) parseWhileStmt() (*WhileStmt, error) {
 		condition,
 		body,
 		"",
+		whileToken.position,
 	}, nil
 }
 
 func (p *Parser) parseDoWhileStmt() (*DoWhileStmt, error) {
-	_, err := p.consume(TokTypeDo)
+	doToken, err := p.consume(TokTypeDo)
 	if err != nil {
 		return nil, err
 	}
@@ -504,11 +737,12 @@ func (p *Parser) parseDoWhileStmt() (*DoWhileStmt, error) {
 		condition,
 		body,
 		"",
+		doToken.position,
 	}, nil
 }
 
 func (p *Parser) parseGotoStmt() (*GotoStmt, error) {
-	_, err := p.consume(TokTypeGoto)
+	gotoToken, err := p.consume(TokTypeGoto)
 	if err != nil {
 		return nil, err
 	}
@@ -520,11 +754,11 @@ func (p *Parser) parseGotoStmt() (*GotoStmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &GotoStmt{target.lexeme}, nil
+	return &GotoStmt{target.lexeme, gotoToken.position}, nil
 }
 
 func (p *Parser) parseIfStmt() (*IfStmt, error) {
-	_, _ = p.consume(TokTypeIf)
+	ifToken, _ := p.consume(TokTypeIf)
 	_, err := p.consume(TokTypeLeftParen)
 	if err != nil {
 		return nil, err
@@ -551,10 +785,14 @@ func (p *Parser) parseIfStmt() (*IfStmt, error) {
 		}
 	}
 
-	return &IfStmt{condition, consequent, alternate}, nil
+	return &IfStmt{condition, consequent, alternate, ifToken.position}, nil
 }
 
 func (p *Parser) parseExprStmt() (*ExpressionStmt, error) {
+	token, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
 	expr, err := p.parseExpression(0)
 	if err != nil {
 		return nil, err
@@ -563,23 +801,30 @@ func (p *Parser) parseExprStmt() (*ExpressionStmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &ExpressionStmt{expr}, nil
+	return &ExpressionStmt{expr, token.position}, nil
 }
 
 func (p *Parser) parseReturnStmt() (*ReturnStmt, error) {
-	_, err := p.consume(TokTypeReturn)
+	returnToken, err := p.consume(TokTypeReturn)
 	if err != nil {
 		return nil, err
 	}
-	expr, err := p.parseExpression(0)
+	var expr Expression
+	token, err := p.peek()
 	if err != nil {
 		return nil, err
 	}
+	if token.tokenType != TokTypeSemicolon {
+		expr, err = p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+	}
 	_, err = p.consume(TokTypeSemicolon)
 	if err != nil {
 		return nil, err
 	}
-	return &ReturnStmt{expr}, nil
+	return &ReturnStmt{expr, returnToken.position}, nil
 }
 
 func (p *Parser) parseExpression(minPrecedence int) (Expression, error) {
@@ -626,32 +871,26 @@ func (p *Parser) parseExpression(minPrecedence int) (Expression, error) {
 			return nil, err
 		}
 
-		switch binOpToken.lexeme {
-		case "+=", "-=", "*=", "/=", "%=",
-			"&=", "|=", "^=", "<<=", ">>=":
-			// Compound assignment => expand it:
-			op := binOpToken.lexeme[0:1]
-			ret = &BinaryExpression{
-				"=",
-				ret,
-				&BinaryExpression{
-					op,
-					ret,
-					right,
-				},
+		if operator, ok := compoundAssignOperators[binOpToken.tokenType]; ok {
+			ret = &CompoundAssignment{
+				Operator: operator,
+				Left:     ret,
+				Right:    right,
+				Pos:      binOpToken.position,
 			}
-		default:
+		} else {
 			ret = &BinaryExpression{
-				binOpToken.lexeme,
-				ret,
-				right,
+				Operator: binaryOperators[binOpToken.tokenType],
+				Left:     ret,
+				Right:    right,
+				Pos:      binOpToken.position,
 			}
 		}
 	}
 }
 
 func (p *Parser) parseConditional(condition Expression, minPrecedence int) (Expression, error) {
-	_, _ = p.consume(TokTypeQuestionMark)
+	questionMark, _ := p.consume(TokTypeQuestionMark)
 	consequent, err := p.parseExpression(0)
 	if err != nil {
 		return nil, err
@@ -662,9 +901,10 @@ func (p *Parser) parseConditional(condition Expression, minPrecedence int) (Expr
 		return nil, err
 	}
 	return &Conditional{
-		condition,
-		consequent,
-		alternate,
+		Condition:  condition,
+		Consequent: consequent,
+		Alternate:  alternate,
+		Pos:        questionMark.position,
 	}, nil
 }
 
@@ -684,57 +924,55 @@ func (p *Parser) parseFactor() (Expression, error) {
 		if err != nil {
 			return nil, err
 		}
-		ret = &IntegerLiteral{int(value)}
+		ret = &IntegerLiteral{Value: int(value), Pos: token.position}
 	case TokTypeIdentifier:
-		ident, _ := p.consume()
-		nextToken, err := p.peek()
-		if err == nil && nextToken.tokenType == TokTypeLeftParen {
-			args, err := p.parseArguments()
-			if err != nil {
-				return nil, err
-			}
-			ret = &FunctionCall{
-				Callee: ident.lexeme,
-				Args:   args,
-			}
-		} else {
-			ret = &Variable{ident.lexeme}
+		if p.isTypedefName(token.lexeme) {
+			return nil, errors.New(fmt.Sprintf("unexpected type name '%s'", token.lexeme))
 		}
+		ident, _ := p.consume()
+		ret = &Variable{Name: ident.lexeme, Pos: token.position}
 	case TokTypeMinus, TokTypeTilde, TokTypeExclMark:
 		_, _ = p.consume()
-		operator := token.lexeme
 		right, err := p.parseFactor()
 		if err != nil {
 			return nil, err
 		}
-		ret = &UnaryExpression{operator, right}
-	case TokTypePlusPlus, TokTypeMinusMinus:
+		ret = &UnaryExpression{
+			Operator: unaryOperators[token.tokenType],
+			Right:    right,
+			Pos:      token.position,
+		}
+	case TokTypeAsterisk, TokTypeAmpersand:
 		_, _ = p.consume()
-		var operator string
-		if token.tokenType == TokTypePlusPlus {
-			operator = "+"
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		if token.tokenType == TokTypeAsterisk {
+			ret = &Dereference{Operand: operand, Pos: token.position}
 		} else {
-			operator = "-"
+			ret = &AddressOf{Operand: operand, Pos: token.position}
 		}
-		factor, err := p.parseFactor()
+	case TokTypeSizeof:
+		return p.parseSizeOf()
+	case TokTypeVaStart, TokTypeVaArg, TokTypeVaEnd:
+		return p.parseVaBuiltin()
+	case TokTypePlusPlus, TokTypeMinusMinus:
+		_, _ = p.consume()
+		operand, err := p.parseFactor()
 		if err != nil {
 			return nil, err
 		}
-		lvalue, ok := factor.(*Variable)
-		if !ok {
-			return nil, errors.New("unexpected token after increment or decrement")
-		}
-
-		ret = &BinaryExpression{
-			"=",
-			lvalue,
-			&BinaryExpression{
-				operator,
-				lvalue,
-				&IntegerLiteral{1},
-			},
+		ret = &PrefixIncDec{
+			Operator: incDecOperator(token.tokenType),
+			Operand:  operand,
+			Pos:      token.position,
 		}
 	case TokTypeLeftParen:
+		nextTokens := p.peekN(2)
+		if len(nextTokens) == 2 && p.startsTypeName(&nextTokens[1]) {
+			return p.parseCast()
+		}
 		_, _ = p.consume()
 		expr, err := p.parseExpression(0)
 		if err != nil {
@@ -749,21 +987,144 @@ func (p *Parser) parseFactor() (Expression, error) {
 		return nil, errors.New("unexpected token: " + token.lexeme)
 	}
 
-	if lvalue, ok := ret.(*Variable); ok {
+postfixLoop:
+	for {
 		nextToken, err := p.peek()
-		if err == nil &&
-			(nextToken.tokenType == TokTypePlusPlus || nextToken.tokenType == TokTypeMinusMinus) {
+		if err != nil {
+			break
+		}
+		switch nextToken.tokenType {
+		case TokTypeLeftParen:
+			args, err := p.parseArguments()
+			if err != nil {
+				return nil, err
+			}
+			ret = &FunctionCall{
+				Callee: ret,
+				Args:   args,
+				Pos:    token.position,
+			}
+		case TokTypeDot, TokTypeArrow:
+			_, _ = p.consume()
+			member, err := p.consume(TokTypeIdentifier)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("expected member name after '%s'", nextToken.lexeme))
+			}
+			if nextToken.tokenType == TokTypeArrow {
+				ret = &Dereference{Operand: ret, Pos: nextToken.position}
+			}
+			ret = &MemberAccess{Object: ret, Member: member.lexeme, Pos: nextToken.position}
+		case TokTypePlusPlus, TokTypeMinusMinus:
 			_, _ = p.consume()
 			ret = &PostfixIncDec{
-				nextToken.lexeme,
-				*lvalue,
+				Operator: incDecOperator(nextToken.tokenType),
+				Operand:  ret,
+				Pos:      nextToken.position,
 			}
+		default:
+			break postfixLoop
 		}
 	}
 
 	return ret, nil
 }
 
+func incDecOperator(tokenType TokenType) IncDecOp {
+	if tokenType == TokTypeMinusMinus {
+		return DecOp
+	}
+	return IncOp
+}
+
+func (p *Parser) parseCast() (*Cast, error) {
+	leftParen, _ := p.consume(TokTypeLeftParen)
+	targetType, err := p.parseTypeName()
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.consume(TokTypeRightParen)
+	if err != nil {
+		return nil, err
+	}
+	operand, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	return &Cast{TargetType: targetType, Operand: operand, Pos: leftParen.position}, nil
+}
+
+func (p *Parser) parseSizeOf() (Expression, error) {
+	sizeofToken, _ := p.consume(TokTypeSizeof)
+
+	nextTokens := p.peekN(2)
+	if len(nextTokens) == 2 &&
+		nextTokens[0].tokenType == TokTypeLeftParen &&
+		p.startsTypeName(&nextTokens[1]) {
+		_, _ = p.consume()
+		targetType, err := p.parseTypeName()
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.consume(TokTypeRightParen)
+		if err != nil {
+			return nil, err
+		}
+		return &SizeOfType{TargetType: targetType, Pos: sizeofToken.position}, nil
+	}
+
+	operand, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	return &SizeOfExpr{Operand: operand, Pos: sizeofToken.position}, nil
+}
+
+// parseVaBuiltin parses one of the builtins that the macros of <stdarg.h>
+// expand to. The second argument of __builtin_va_arg is a type name.
+func (p *Parser) parseVaBuiltin() (Expression, error) {
+	builtinToken, _ := p.consume()
+	_, err := p.consume(TokTypeLeftParen)
+	if err != nil {
+		return nil, err
+	}
+	vaList, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret Expression
+	switch builtinToken.tokenType {
+	case TokTypeVaStart:
+		_, err = p.consume(TokTypeComma)
+		if err != nil {
+			return nil, err
+		}
+		lastParam, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		ret = &VaStart{VaList: vaList, LastParam: lastParam, Pos: builtinToken.position}
+	case TokTypeVaArg:
+		_, err = p.consume(TokTypeComma)
+		if err != nil {
+			return nil, err
+		}
+		argType, err := p.parseTypeName()
+		if err != nil {
+			return nil, err
+		}
+		ret = &VaArg{VaList: vaList, ArgType: argType, Pos: builtinToken.position}
+	default:
+		ret = &VaEnd{VaList: vaList, Pos: builtinToken.position}
+	}
+
+	_, err = p.consume(TokTypeRightParen)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
 func (p *Parser) parseArguments() ([]Expression, error) {
 	var args []Expression
 	var arg Expression
@@ -831,6 +1192,14 @@ func (p *Parser) consume(expected ...TokenType) (*Token, error) {
 	}
 }
 
+// errorPos returns the position of the token at which parsing failed
+func (p *Parser) errorPos() Position {
+	if len(p.tokens) == 0 {
+		return Position{}
+	}
+	return p.tokens[min(p.currIdx, p.maxIdx)].position
+}
+
 func (p *Parser) peek() (*Token, error) {
 	if p.currIdx > p.maxIdx {
 		return nil, errors.New("no more tokens")
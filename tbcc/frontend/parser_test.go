@@ -1,6 +1,8 @@
 package frontend
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -369,6 +371,14 @@ func TestParser_ParseProgramWithFunctions(t *testing.T) {
 	runParserWithCode(t, code, false)
 }
 
+func TestParser_ImplicitFuncDecl(t *testing.T) {
+	code := `int main(void) {
+		return foo(1, 2);
+	}`
+
+	runParserWithCode(t, code, false)
+}
+
 func TestParser_NestedFuncDef(t *testing.T) {
 	code := `int main(void) {
 		int foo(void) {
@@ -430,6 +440,581 @@ func TestParser_ParameterShadowsFunction(t *testing.T) {
 	runParserWithCode(t, code, false)
 }
 
+func TestParser_VoidFunction(t *testing.T) {
+	code := `void reset(int *p) {
+		*p = 0;
+		return;
+	}
+
+	int main(void) {
+		int x = 42;
+		reset(&x);
+		return x;
+	}`
+	runParserWithCode(t, code, false)
+}
+
+func TestParser_VoidReturnMismatch(t *testing.T) {
+	runParserWithCode(t, `void f(void) { return 1; }`, true)
+	runParserWithCode(t, `int f(void) { return; }`, true)
+	runParserWithCode(t, `void f(void); int main(void) { return f(); }`, true)
+}
+
+func TestParser_VoidPointers(t *testing.T) {
+	code := `void *malloc(int size);
+	void free(void *ptr);
+
+	int main(void) {
+		int *p = malloc(sizeof(int));
+		void *v = p;
+		int **pp = &p;
+		*p = 1;
+		p = v;
+		free(*pp);
+		return p == 0 || v != 0;
+	}`
+	runParserWithCode(t, code, false)
+}
+
+func TestParser_InvalidPointerConversions(t *testing.T) {
+	runParserWithCode(t, `int main(void) { int x; int *p = x; return 0; }`, true)
+	runParserWithCode(t, `int main(void) { int *p; int **q = p; return 0; }`, true)
+	runParserWithCode(t, `int main(void) { void *v; return *v; }`, true)
+	runParserWithCode(t, `int main(void) { int *p; return p + 1; }`, true)
+	runParserWithCode(t, `int main(void) { return &1 != 0; }`, true)
+	runParserWithCode(t, `int main(void) { void v; return 0; }`, true)
+}
+
+func TestParser_SizeOf(t *testing.T) {
+	code := `int main(void) {
+		int x;
+		int *p = &x;
+		return sizeof(int) + sizeof(int *) + sizeof(void **) + sizeof x + sizeof *p + sizeof(x);
+	}`
+	runParserWithCode(t, code, false)
+	runParserWithCode(t, `int main(void) { return sizeof(void); }`, true)
+}
+
+func TestParser_Casts(t *testing.T) {
+	code := `int main(void) {
+		int x = 1;
+		void *v = (void *) &x;
+		int *p = (int *) v;
+		(void) p;
+		return (int) sizeof(int (*));
+	}`
+	runParserWithCode(t, code, false)
+	runParserWithCode(t, `int main(void) { return (int (*)(void)) 0 == 0; }`, false)
+	runParserWithCode(t, `int main(void) { return (int (void)) 0 == 0; }`, true)
+}
+
+func TestParser_IncDecAndCompoundAssignment(t *testing.T) {
+	code := `int main(void) {
+		int x = 1;
+		int *p = &x;
+		++*p;
+		(*p)--;
+		x <<= 2;
+		*p >>= 1;
+		return x;
+	}`
+	tokens, _ := Tokenize(code)
+	program, err := NewParser(tokens).ParseProgram()
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+	items := program.Functions[0].Body.Items
+	if prefix, ok := items[2].(*ExpressionStmt).Expression.(*PrefixIncDec); !ok || prefix.Operator != IncOp {
+		t.Errorf("expected prefix increment")
+	}
+	if _, ok := items[3].(*ExpressionStmt).Expression.(*PostfixIncDec); !ok {
+		t.Errorf("expected postfix decrement")
+	}
+	compound, ok := items[4].(*ExpressionStmt).Expression.(*CompoundAssignment)
+	if !ok || compound.Operator != BinOpShiftLeft {
+		t.Fatalf("expected compound assignment with operator <<")
+	}
+
+	program, _, err = AnalyzeSemantics(program, NewNameCreator())
+	if err != nil {
+		t.Fatalf("AnalyzeSemantics() error = %v", err)
+	}
+	items = program.Functions[0].Body.Items
+	deref := items[2].(*ExpressionStmt).Expression.(*PrefixIncDec).Operand
+	if deref.GetResultType() == nil || deref.GetResultType().GetTypeId() != TypeInt {
+		t.Errorf("expected result type int for *p")
+	}
+
+	runParserWithCode(t, `int main(void) { return ++3; }`, true)
+	runParserWithCode(t, `int main(void) { int x; (x + 1) += 2; return x; }`, true)
+	runParserWithCode(t, `int main(void) { int *p; p *= 2; return 0; }`, true)
+}
+
+func TestParser_Enums(t *testing.T) {
+	code := `enum state { IDLE, RUNNING = 5, STOPPED, FAILED = -1, LAST = STOPPED * 2 };
+
+	int next(enum state s) {
+		switch (s) {
+		case IDLE: return RUNNING;
+		case RUNNING: return STOPPED;
+		case LAST - 6: return IDLE;
+		default: return FAILED;
+		}
+	}
+
+	int main(void) {
+		enum { A, B } local = B;
+		int IDLE = 3;
+		return next(local) + IDLE;
+	}`
+	tokens, _ := Tokenize(code)
+	program, err := NewParser(tokens).ParseProgram()
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+	program, _, err = AnalyzeSemantics(program, NewNameCreator())
+	if err != nil {
+		t.Fatalf("AnalyzeSemantics() error = %v", err)
+	}
+	enumType := program.TypeDecls[0].(*EnumDecl).EnumType
+	want := []EnumConstant{{"IDLE", 0}, {"RUNNING", 5}, {"STOPPED", 6}, {"FAILED", -1}, {"LAST", 12}}
+	if !reflect.DeepEqual(enumType.Constants, want) {
+		t.Errorf("constants = %v, want %v", enumType.Constants, want)
+	}
+
+	runParserWithCode(t, `enum e { A, B = A }; int main(void) { return B; }`, false)
+	runParserWithCode(t, `enum e { A, B }; int main(void) { A = 1; return 0; }`, true)
+	runParserWithCode(t, `enum e { A, A }; int main(void) { return 0; }`, true)
+	runParserWithCode(t, `enum e { A }; enum e { B }; int main(void) { return 0; }`, true)
+	runParserWithCode(t, `int main(void) { int x; enum { A = x }; return 0; }`, true)
+	runParserWithCode(t, `enum e { A, B = 0 }; int main(void) { switch (0) { case A: case B: ; } return 0; }`, true)
+	runParserWithCode(t, `int main(void) { int A; enum { A }; return 0; }`, true)
+	runParserWithCode(t, `enum e { A = 2147483647, B }; int main(void) { return 0; }`, true)
+	runParserWithCode(t, `enum e { A = 2147483646, B, C = -1, D }; int main(void) { return B + D; }`, false)
+}
+
+func TestParser_Typedefs(t *testing.T) {
+	code := `typedef int myint;
+	typedef myint *intptr;
+
+	myint twice(myint x) { return x * 2; }
+
+	int main(void) {
+		myint a = 1;
+		intptr p = &a;
+		{
+			int myint = 2;
+			a = a * myint;
+		}
+	myint:
+		return twice(*p) + (myint) sizeof(intptr);
+	}`
+	tokens, _ := Tokenize(code)
+	program, err := NewParser(tokens).ParseProgram()
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+	program, _, err = AnalyzeSemantics(program, NewNameCreator())
+	if err != nil {
+		t.Fatalf("AnalyzeSemantics() error = %v", err)
+	}
+	if program.Functions[0].ReturnType.GetTypeId() != TypeInt {
+		t.Errorf("return type = %s, want int", program.Functions[0].ReturnType)
+	}
+	varType := program.Functions[1].Body.Items[1].(*VarDecl).VarType
+	if varType.String() != "int *" {
+		t.Errorf("type of p = %s, want int *", varType)
+	}
+
+	runParserWithCode(t, `int main(void) { typedef int T; int T; return 0; }`, true)
+	runParserWithCode(t, `int main(void) { int T; typedef int T; return 0; }`, true)
+	runParserWithCode(t, `int main(void) { typedef int T; return T; }`, true)
+	runParserWithCode(t, `int main(void) { T x; return 0; }`, true)
+	runParserWithCode(t, `typedef int T; typedef int *T; int main(void) { return 0; }`, true)
+	runParserWithCode(t, `typedef int T; typedef int T; int main(void) { T x = 0; return x; }`, false)
+
+	// a parameter named after a typedef hides it in the body
+	code = `typedef int T;
+	int f(int a, int *T) { return a + *T; }
+	int g(int (T));`
+	tokens, _ = Tokenize(code)
+	program, err = NewParser(tokens).ParseProgram()
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+	if program.Functions[0].Params[1].Name != "T" {
+		t.Errorf("second parameter of f must be named T")
+	}
+	if param := program.Functions[1].Params[0]; param.Name != "" || param.Type.String() != "int (*)(T)" {
+		t.Errorf("parameter of g = %s %s, want an unnamed int (*)(T)", param.Type, param.Name)
+	}
+	runParserWithCode(t, `typedef int T; int f(int a, int T) { return T; } int main(void) { return f(1, 2); }`, false)
+	runParserWithCode(t, `typedef int T; int f(int T) { T x = 0; return x; }`, true)
+}
+
+func TestParser_FunctionPointers(t *testing.T) {
+	code := `
+	typedef int (*binop)(int, int);
+	int add(int a, int b) { return a + b; }
+	binop select(int op) { return op ? &add : add; }
+	int apply(int f(int, int), int, int);
+	int main(void) {
+		int (*fp)(int, int) = select(1);
+		void *v = 0;
+		binop g = *add;
+		return fp(1, 2) + (*g)(3, 4) + select(0)(5, 6) + (fp == add) + (v != 0);
+	}`
+	tokens, _ := Tokenize(code)
+	program, err := NewParser(tokens).ParseProgram()
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+	apply := program.Functions[2]
+	if apply.Params[0].Name != "f" || apply.Params[0].Type.String() != "int (*)(int, int)" {
+		t.Errorf("parameter of function type must be adjusted to a function pointer")
+	}
+	if apply.Params[1].Name != "" {
+		t.Errorf("expected unnamed parameter")
+	}
+
+	program, _, err = AnalyzeSemantics(program, NewNameCreator())
+	if err != nil {
+		t.Fatalf("AnalyzeSemantics() error = %v", err)
+	}
+	main := program.Functions[3]
+	items := main.Body.Items
+	returnExpr := items[len(items)-1].(*ReturnStmt).Expression
+	var calls []*FunctionCall
+	for expr := returnExpr; ; {
+		binary, ok := expr.(*BinaryExpression)
+		if !ok {
+			break
+		}
+		if call, ok := binary.Right.(*FunctionCall); ok {
+			calls = append([]*FunctionCall{call}, calls...)
+		}
+		if call, ok := binary.Left.(*FunctionCall); ok {
+			calls = append([]*FunctionCall{call}, calls...)
+		}
+		expr = binary.Left
+	}
+	wantCallees := []string{"int (*)(int, int)", "int (int, int)", "int (*)(int, int)"}
+	if len(calls) != len(wantCallees) {
+		t.Fatalf("expected %d calls, got %d", len(wantCallees), len(calls))
+	}
+	for i, call := range calls {
+		if got := call.Callee.GetResultType().String(); got != wantCallees[i] {
+			t.Errorf("callee %d has type %q, want %q", i, got, wantCallees[i])
+		}
+	}
+
+	runParserWithCode(t, `int f(void); int main(void) { f = 0; return 0; }`, true)
+	runParserWithCode(t, `int main(void) { int x = 0; return x(); }`, true)
+	runParserWithCode(t, `int f(void); int main(void) { return sizeof(f); }`, true)
+	runParserWithCode(t, `int f(int); int main(void) { int (*fp)(int) = f; return fp(); }`, true)
+	runParserWithCode(t, `int f(int) { return 0; }`, true)
+	runParserWithCode(t, `int (*f(void))(void);`, false)
+	runParserWithCode(t, `int f(void)(void);`, true)
+}
+
+func TestParser_Variadic(t *testing.T) {
+	code := `
+	typedef __builtin_va_list va_list;
+	int printf(void *format, ...);
+	int vsum(int count, va_list ap) {
+		int total = 0;
+		while (count-- > 0)
+			total += __builtin_va_arg(ap, int);
+		return total;
+	}
+	int sum(int count, ...) {
+		va_list ap;
+		__builtin_va_start(ap, count);
+		int total = vsum(count, ap);
+		__builtin_va_end(ap);
+		return total;
+	}
+	int main(void) {
+		int (*fp)(int, ...) = sum;
+		return printf(&fp) + sum(2, 1, 2) + fp(1, 42) + sizeof(va_list);
+	}`
+	tokens, _ := Tokenize(code)
+	program, err := NewParser(tokens).ParseProgram()
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+	if !program.Functions[2].Variadic || program.Functions[1].Variadic {
+		t.Errorf("only sum must be variadic")
+	}
+	program, _, err = AnalyzeSemantics(program, NewNameCreator())
+	if err != nil {
+		t.Fatalf("AnalyzeSemantics() error = %v", err)
+	}
+	if got := program.Functions[1].Params[1].Type.String(); got != "__builtin_va_list *" {
+		t.Errorf("parameter of type va_list has type %q, want a pointer", got)
+	}
+
+	runParserWithCode(t, `int f(...);`, true)
+	runParserWithCode(t, `int f(int, ..., int);`, true)
+	runParserWithCode(t, `int f(int, ...); int main(void) { return f(); }`, true)
+	runParserWithCode(t, `int f(int, ...); int f(int);`, true)
+	runParserWithCode(t, `int f(int a) { __builtin_va_list ap; __builtin_va_start(ap, a); return 0; }`, true)
+	runParserWithCode(t, `int f(int a, ...) { int ap; __builtin_va_start(ap, a); return 0; }`, true)
+	runParserWithCode(t, `int f(int a, ...) { __builtin_va_list ap; return __builtin_va_arg(ap, void); }`, true)
+	runParserWithCode(t, `int f(int a, ...) { __builtin_va_list ap; __builtin_va_list aq; ap = aq; return 0; }`, true)
+}
+
+func TestParser_Prototypes(t *testing.T) {
+	code := `
+	enum color { RED, GREEN };
+	int f(enum color c);
+	int f(int c);
+	int g(int (*fp)(int));
+	int main(void) {
+		return f(GREEN) + g(0);
+	}`
+	tokens, _ := Tokenize(code)
+	program, err := NewParser(tokens).ParseProgram()
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+	if _, _, err = AnalyzeSemantics(program, NewNameCreator()); err != nil {
+		t.Fatalf("AnalyzeSemantics() error = %v", err)
+	}
+
+	code = `int f(int a, int *p); int main(void) { int x = 1; return f(1, x); }`
+	tokens, _ = Tokenize(code)
+	program, _ = NewParser(tokens).ParseProgram()
+	_, _, err = AnalyzeSemantics(program, NewNameCreator())
+	want := "argument 2 of 'f' has type 'int', expected 'int *'"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("AnalyzeSemantics() error = %v, want %q", err, want)
+	}
+
+	runParserWithCode(t, `int f(int a); int f(int *a);`, true)
+	runParserWithCode(t, `int f(int a); void f(int a);`, true)
+	runParserWithCode(t, `int f(void); int f(int a);`, true)
+	runParserWithCode(t, `int f(int (*g)(int)); int f(int (*g)(void));`, true)
+	runParserWithCode(t, `int f(int *a); int main(void) { int *p = 0; return f(p) + f(0); }`, false)
+}
+
+func TestParser_StorageClasses(t *testing.T) {
+	code := `
+	extern int counter;
+	int counter = 3;
+	int counter;
+	static int hidden;
+	extern int hidden;
+	int next(void) {
+		static int calls = 2 * 3;
+		extern int counter;
+		int local = 0;
+		{
+			extern int local;
+			local = hidden;
+		}
+		return ++calls + counter + local;
+	}`
+	tokens, _ := Tokenize(code)
+	program, err := NewParser(tokens).ParseProgram()
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+	if len(program.Variables) != 5 {
+		t.Fatalf("expected 5 variables at file scope, got %d", len(program.Variables))
+	}
+	program, _, err = AnalyzeSemantics(program, NewNameCreator())
+	if err != nil {
+		t.Fatalf("AnalyzeSemantics() error = %v", err)
+	}
+	items := program.Functions[0].Body.Items
+	calls := items[0].(*VarDecl)
+	if calls.Name != "calls.0" || calls.StorageClass != StorageStatic {
+		t.Errorf("static variable is %s %q, want static \"calls.0\"", calls.StorageClass, calls.Name)
+	}
+	if literal, ok := calls.InitValue.(*IntegerLiteral); !ok || literal.Value != 6 {
+		t.Errorf("initializer of static variable must be folded to 6")
+	}
+	if counter := items[1].(*VarDecl); counter.Name != "counter" {
+		t.Errorf("extern variable must keep its name, got %q", counter.Name)
+	}
+
+	runParserWithCode(t, `int x = 1; int x = 2;`, true)
+	runParserWithCode(t, `int x; int *x;`, true)
+	runParserWithCode(t, `int x; static int x;`, true)
+	runParserWithCode(t, `static int x; int x;`, true)
+	runParserWithCode(t, `int f(void); int f;`, true)
+	runParserWithCode(t, `int a; int x = a;`, true)
+	runParserWithCode(t, `static int f(void);`, true)
+	runParserWithCode(t, `int f(void) { static int x = f(); return x; }`, true)
+	runParserWithCode(t, `int f(void) { extern int x = 1; return x; }`, true)
+	runParserWithCode(t, `int x; int f(void) { extern int *x; return 0; }`, true)
+	runParserWithCode(t, `int f(void) { int x; extern int x; return x; }`, true)
+	runParserWithCode(t, `int f(void) { for (static int i = 0; i < 3; i++) ; return 0; }`, true)
+	runParserWithCode(t, `int f(void) { static __builtin_va_list ap; return 0; }`, true)
+}
+
+func TestParser_Visibility(t *testing.T) {
+	code := `
+	__attribute__((visibility("hidden"))) int counter;
+	int counter = 1;
+	int limit __attribute__((visibility("protected"))) = 2;
+	int helper(void) __attribute__((visibility("internal")));
+	int helper(void) {
+		extern int counter;
+		return counter + limit;
+	}`
+	tokens, _ := Tokenize(code)
+	program, err := NewParser(tokens).ParseProgram()
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+	if visibility := program.Variables[2].Visibility; visibility != VisibilityProtected {
+		t.Errorf("visibility of limit is %s, want protected", visibility)
+	}
+	_, env, err := AnalyzeSemantics(program, NewNameCreator())
+	if err != nil {
+		t.Fatalf("AnalyzeSemantics() error = %v", err)
+	}
+	for name, expected := range map[string]Visibility{
+		"counter": VisibilityHidden,
+		"limit":   VisibilityProtected,
+		"helper":  VisibilityInternal,
+	} {
+		entry, _ := env.Get(name)
+		if entry == nil || entry.GetVisibility() != expected {
+			t.Errorf("visibility of %s must be %s", name, expected)
+		}
+	}
+
+	runParserWithCode(t, `int x __attribute__((visibility("hidden"))); int x __attribute__((visibility("protected")));`, true)
+	runParserWithCode(t, `int x __attribute__((visibility("secret")));`, true)
+	runParserWithCode(t, `int x __attribute__((aligned(8)));`, true)
+	runParserWithCode(t, `int f(void) { __attribute__((visibility("hidden"))) int x = 0; return x; }`, true)
+}
+
+func TestParser_StructsAndUnions(t *testing.T) {
+	code := `
+	struct list {
+		int value;
+		struct list *next;
+	};
+
+	struct flags {
+		int a : 3;
+		unsigned b : 5;
+		int : 0;
+		int c : 30;
+		unsigned d : 4;
+		int e;
+	};
+
+	union word {
+		struct { int lo : 16; int hi : 16; } parts;
+		struct list *ptr;
+	};
+
+	int sum(struct list *l) {
+		int total = 0;
+		for (; l; l = l->next)
+			total += l->value;
+		return total;
+	}
+
+	int main(void) {
+		struct flags f;
+		union word w;
+		f.b = 7;
+		w.parts.hi = f.a + (*&f).c;
+		return sizeof(union word) + f.d++;
+	}`
+	tokens, _ := Tokenize(code)
+	program, err := NewParser(tokens).ParseProgram()
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+	program, _, err = AnalyzeSemantics(program, NewNameCreator())
+	if err != nil {
+		t.Fatalf("AnalyzeSemantics() error = %v", err)
+	}
+
+	list := program.TypeDecls[0].(*StructDecl).StructType
+	if list.Size != 16 || list.Alignment != 8 || list.FindMember("next").Offset != 8 {
+		t.Errorf("struct list: size = %d, alignment = %d, want 16 and 8", list.Size, list.Alignment)
+	}
+	flags := program.TypeDecls[1].(*StructDecl).StructType
+	if flags.Size != 16 || flags.Alignment != 4 {
+		t.Errorf("struct flags: size = %d, alignment = %d, want 16 and 4", flags.Size, flags.Alignment)
+	}
+	wantMembers := []struct {
+		name      string
+		offset    int
+		bitOffset int
+	}{{"a", 0, 0}, {"b", 0, 3}, {"c", 4, 0}, {"d", 8, 0}, {"e", 12, 0}}
+	for _, want := range wantMembers {
+		member := flags.FindMember(want.name)
+		if member.Offset != want.offset || member.BitOffset != want.bitOffset {
+			t.Errorf("member %s at %d:%d, want %d:%d",
+				want.name, member.Offset, member.BitOffset, want.offset, want.bitOffset)
+		}
+	}
+	word := program.TypeDecls[len(program.TypeDecls)-1].(*StructDecl).StructType
+	if !word.IsUnion || word.Size != 8 || word.FindMember("parts").Offset != 0 {
+		t.Errorf("union word: size = %d, want 8", word.Size)
+	}
+
+	runParserWithCode(t, `struct s { int a; int a; };`, true)
+	runParserWithCode(t, `struct s { int a; }; struct s { int b; };`, true)
+	runParserWithCode(t, `struct s { int a; }; union s *p;`, true)
+	runParserWithCode(t, `struct s { struct s inner; };`, true)
+	runParserWithCode(t, `struct s; struct s x;`, true)
+	runParserWithCode(t, `struct s { int a : 33; };`, true)
+	runParserWithCode(t, `struct s { int a : 0; };`, true)
+	runParserWithCode(t, `struct s { int *a : 3; };`, true)
+	runParserWithCode(t, `struct s { unsigned a; };`, true)
+	runParserWithCode(t, `unsigned x;`, true)
+	runParserWithCode(t, `struct s { int a : 3; }; int f(struct s *p) { return sizeof(p->a); }`, true)
+	runParserWithCode(t, `struct s { int a : 3; }; int *f(struct s *p) { return &p->a; }`, true)
+	runParserWithCode(t, `struct s { int a; }; int f(struct s x) { return 0; }`, true)
+	runParserWithCode(t, `struct s { int a; }; int f(struct s *p) { return p->b; }`, true)
+	runParserWithCode(t, `struct s { int a; }; int f(struct s *p) { return p.a; }`, true)
+	runParserWithCode(t, `struct s { int a; }; int f(struct s *p) { if (*p) return 1; return 0; }`, true)
+	runParserWithCode(t, `struct s { int a; }; int f(struct s *p) { return (int) *p; }`, true)
+	runParserWithCode(t, `struct s { int a; }; int f(struct s *p, struct s *q) { *p = *q; return p->a; }`, false)
+	runParserWithCode(t, `int f(void) { struct s { int a; } x; { struct s; struct s *p = 0; return p == &x; } }`, true)
+}
+
+func TestParseTypeName(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"int", "int"},
+		{"void *", "void *"},
+		{"int**", "int **"},
+		{"int (*)", "int *"},
+		{"int (*)(int, void *)", "int (*)(int, void *)"},
+		{"void (**)(void)", "void (**)(void)"},
+		{"int (int (int))", "int (int (*)(int))"},
+		{"int (*(int))(int, int)", "int (*(int))(int, int)"},
+		{"int (*)(void *, ...)", "int (*)(void *, ...)"},
+		{"__builtin_va_list *", "__builtin_va_list *"},
+	}
+	for _, tt := range tests {
+		typeInfo, err := ParseTypeName(tt.text)
+		if err != nil {
+			t.Errorf("ParseTypeName(%q) error = %v", tt.text, err)
+			continue
+		}
+		if typeInfo.String() != tt.want {
+			t.Errorf("ParseTypeName(%q) = %q, want %q", tt.text, typeInfo.String(), tt.want)
+		}
+	}
+	if _, err := ParseTypeName("int x"); err == nil {
+		t.Errorf("ParseTypeName() should have returned an error")
+	}
+}
+
 func TestParser_ParseLabelMultiple(t *testing.T) {
 	code := `int main(void) {
  	   	int a = 42;
@@ -2,29 +2,52 @@ package frontend
 
 func AnalyzeSemantics(program *Program, nameCreator NameCreator) (*Program, *Environment, error) {
 
-	labeler := newLoopLabeler(nameCreator)
-	err := labeler.addLabels(program)
+	err := LabelLoops(program, nameCreator)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	checker := newLabelChecker()
-	err = checker.check(program)
+	err = CheckLabels(program)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	globalEnv := NewEnvironment(nil)
-	errorList := newTypeChecker(globalEnv).check(program)
-	if len(errorList) > 0 {
-		return nil, nil, errorList[0]
+	err = CheckTypes(program, globalEnv)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	resolver := newIdentifierResolver(nameCreator)
-	program, err = resolver.resolve(program)
+	program, err = ResolveIdentifiers(program, nameCreator)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	return program, globalEnv, nil
 }
+
+// LabelLoops assigns unique labels to loops, switches and their
+// break/continue/case statements
+func LabelLoops(program *Program, nameCreator NameCreator) error {
+	return newLoopLabeler(nameCreator).addLabels(program)
+}
+
+// CheckLabels verifies goto targets, labels and case clauses
+func CheckLabels(program *Program) error {
+	return newLabelChecker().check(program)
+}
+
+// CheckTypes type checks the program and registers the global
+// declarations in globalEnv
+func CheckTypes(program *Program, globalEnv *Environment) error {
+	errorList := newTypeChecker(globalEnv).check(program)
+	if len(errorList) > 0 {
+		return errorList[0]
+	}
+	return nil
+}
+
+// ResolveIdentifiers renames variables and labels to unique names
+func ResolveIdentifiers(program *Program, nameCreator NameCreator) (*Program, error) {
+	return newIdentifierResolver(nameCreator).resolve(program)
+}
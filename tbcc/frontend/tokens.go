@@ -61,6 +61,23 @@ const (
 	TokTypeSwitch
 	TokTypeCase
 	TokTypeDefault
+	TokTypeSizeof
+	TokTypeEnum
+	TokTypeTypedef
+	TokTypeStatic
+	TokTypeExtern
+	TokTypeStruct
+	TokTypeUnion
+	TokTypeUnsigned
+	TokTypeEllipsis
+	TokTypeDot
+	TokTypeArrow
+	TokTypeVaList
+	TokTypeVaStart
+	TokTypeVaArg
+	TokTypeVaEnd
+	TokTypeAttribute
+	TokTypeStringLiteral
 )
 
 var tokenTypeToRegexStr = map[TokenType]string{
@@ -107,6 +124,11 @@ var tokenTypeToRegexStr = map[TokenType]string{
 	TokTypeGreaterGreaterEq: ">>=",
 	TokTypeQuestionMark:     "\\?",
 	TokTypeColon:            ":",
+	TokTypeEllipsis:         "\\.\\.\\.",
+	TokTypeDot:              "\\.",
+	TokTypeArrow:            "->",
+	// string literals only occur as attribute arguments
+	TokTypeStringLiteral: "\"[^\"\\\\\\n]*\"",
 }
 
 var strToKeyword = map[string]TokenType{
@@ -124,6 +146,20 @@ var strToKeyword = map[string]TokenType{
 	"switch":   TokTypeSwitch,
 	"case":     TokTypeCase,
 	"default":  TokTypeDefault,
+	"sizeof":   TokTypeSizeof,
+	"enum":     TokTypeEnum,
+	"typedef":  TokTypeTypedef,
+	"static":   TokTypeStatic,
+	"extern":   TokTypeExtern,
+	"struct":   TokTypeStruct,
+	"union":    TokTypeUnion,
+	"unsigned": TokTypeUnsigned,
+	// the builtins that <stdarg.h> expands to
+	"__builtin_va_list":  TokTypeVaList,
+	"__builtin_va_start": TokTypeVaStart,
+	"__builtin_va_arg":   TokTypeVaArg,
+	"__builtin_va_end":   TokTypeVaEnd,
+	"__attribute__":      TokTypeAttribute,
 }
 
 type Associativity int
@@ -171,15 +207,19 @@ var binOpPreference = map[TokenType]PrefInfo{
 	TokTypeGreaterGreaterEq: {1, AssocRight},
 }
 
+// Position is a position in the source. File is the name of the
+// included file (given by a line marker of the preprocessor) the
+// position belongs to. It is empty for the main file.
 type Position struct {
 	Line, Col int
+	File      string
 }
 
 func (p Position) Advance(ch rune) Position {
 	if string(ch) != "\n" {
-		return Position{p.Line, p.Col + 1}
+		return Position{p.Line, p.Col + 1, p.File}
 	} else {
-		return Position{p.Line + 1, 1}
+		return Position{p.Line + 1, 1, p.File}
 	}
 }
 
@@ -196,3 +236,15 @@ func NewToken(tokenType TokenType, lexeme string, position Position) *Token {
 		position:  position,
 	}
 }
+
+func (t *Token) GetTokenType() TokenType {
+	return t.tokenType
+}
+
+func (t *Token) GetLexeme() string {
+	return t.lexeme
+}
+
+func (t *Token) GetPosition() Position {
+	return t.position
+}
@@ -1,12 +1,16 @@
 package frontend
 
-import (
-	"errors"
-	"fmt"
-)
+import "math"
 
 type typeChecker struct {
-	env       *Environment
+	env             *Environment
+	currentFunction *Function
+	// exprType is the type of the last visited expression
+	exprType TypeInfo
+	// switchCases holds the case values of the enclosing switch statements
+	switchCases []map[int]bool
+	// pos is the position of the innermost node being checked
+	pos       Position
 	errorList []error
 }
 
@@ -23,79 +27,507 @@ func (tc *typeChecker) check(p *Program) []error {
 	return tc.errorList
 }
 
+// addError reports an error at the position of the node being checked
+func (tc *typeChecker) addError(format string, args ...any) {
+	tc.addErrorAt(tc.pos, format, args...)
+}
+
+// addErrorAt reports an error at the position of a declaration that is
+// not visited on its own, e.g. an enumerator or a file scope variable
+func (tc *typeChecker) addErrorAt(pos Position, format string, args ...any) {
+	tc.errorList = append(tc.errorList, errorAt(pos, format, args...))
+}
+
+// at sets the position of the node being checked. The returned
+// function restores the previous one.
+func (tc *typeChecker) at(pos Position) func() {
+	saved := tc.pos
+	tc.pos = pos
+	return func() {
+		tc.pos = saved
+	}
+}
+
+// typeOf visits the expression, records its type as result type
+// and returns it
+func (tc *typeChecker) typeOf(expr Expression) TypeInfo {
+	tc.exprType = &IntInfo{}
+	expr.Accept(tc)
+	expr.SetResultType(tc.exprType)
+	return tc.exprType
+}
+
+// valueTypeOf returns the type of an expression whose value is used.
+// Function designators are converted to function pointers.
+func (tc *typeChecker) valueTypeOf(expr Expression) TypeInfo {
+	exprType := tc.typeOf(expr)
+	switch exprType.GetTypeId() {
+	case TypeVoid:
+		tc.addError("void value not ignored as it ought to be")
+		return &IntInfo{}
+	default:
+		return decay(exprType)
+	}
+}
+
+// conditionTypeOf returns the type of an expression that is compared
+// with zero, e.g. the condition of an if statement
+func (tc *typeChecker) conditionTypeOf(expr Expression) TypeInfo {
+	exprType := tc.valueTypeOf(expr)
+	if !IsScalar(exprType) {
+		tc.addError("used '%s' where a scalar is required", exprType)
+	}
+	return exprType
+}
+
+// checkConversion checks that the value of expr can be implicitly
+// converted to targetType (as in assignments, initializers or returns)
+func (tc *typeChecker) checkConversion(expr Expression, exprType, targetType TypeInfo) {
+	if !isConvertible(expr, exprType, targetType) {
+		tc.addError("cannot convert from '%s' to '%s'", exprType, targetType)
+	}
+}
+
+func isConvertible(expr Expression, exprType, targetType TypeInfo) bool {
+	if exprType.Equal(targetType) || (IsInteger(exprType) && IsInteger(targetType)) {
+		return true
+	}
+	if IsPointer(targetType) {
+		return isNullPointerConstant(expr) || isVoidPointer(exprType) ||
+			(isVoidPointer(targetType) && IsPointer(exprType))
+	}
+	return false
+}
+
+func isNullPointerConstant(expr Expression) bool {
+	literal, ok := expr.(*IntegerLiteral)
+	return ok && literal.Value == 0
+}
+
 func (tc *typeChecker) VisitProgram(p *Program) {
-	for _, f := range p.Functions {
-		f.Accept(tc)
+	for _, decl := range p.TypeDecls {
+		decl.Accept(tc)
+	}
+	for i := range p.Variables {
+		tc.checkFileScopeVarDecl(&p.Variables[i])
+	}
+	for i := range p.Functions {
+		p.Functions[i].Accept(tc)
+	}
+}
+
+// resolveType replaces typedef names by the types they stand for
+func (tc *typeChecker) resolveType(typeInfo TypeInfo) TypeInfo {
+	switch t := typeInfo.(type) {
+	case *TypedefInfo:
+		entry, _ := tc.env.Get(t.Name)
+		if entry == nil || entry.category != idCatTypedef {
+			tc.addError("unknown type name '%s'", t.Name)
+			return &IntInfo{}
+		}
+		return entry.typeInfo
+	case *PointerInfo:
+		referenced := tc.resolveType(t.Referenced)
+		if referenced != t.Referenced {
+			return &PointerInfo{referenced}
+		}
+		return t
+	case *FuncInfo:
+		t.ReturnType = tc.resolveType(t.ReturnType)
+		for i, paramType := range t.ParamTypes {
+			t.ParamTypes[i] = adjustParamType(tc.resolveType(paramType))
+		}
+		return t
+	default:
+		return typeInfo
 	}
 }
 
 func (tc *typeChecker) VisitFunction(f *Function) {
+	defer tc.at(f.Pos)()
+	f.ReturnType = tc.resolveType(f.ReturnType)
+	for i := range f.Params {
+		f.Params[i].Type = adjustParamType(tc.resolveType(f.Params[i].Type))
+	}
+
+	funcInfo := &FuncInfo{
+		ReturnType: f.ReturnType,
+		Variadic:   f.Variadic,
+		IsDefined:  f.Body != nil,
+	}
+	for _, param := range f.Params {
+		funcInfo.ParamTypes = append(funcInfo.ParamTypes, param.Type)
+	}
+
 	entry, _ := tc.env.getGlobal().Get(f.Name)
+	visibility := tc.mergeVisibility(f.Pos, f.Name, entry, f.Visibility)
 
 	if entry == nil {
-		tc.env.set(f.Name, f.Name, true, idCatFunction,
-			&FuncInfo{
-				NumParams: len(f.Params),
-				IsDefined: f.Body != nil,
-			})
+		tc.env.set(f.Name, f.Name, true, idCatFunction, funcInfo)
 	} else {
 		for {
 			if entry.category != idCatFunction {
-				tc.errorList = append(tc.errorList,
-					errors.New(fmt.Sprintf("%s defined as a non-function", f.Name)))
+				tc.addError("%s defined as a non-function", f.Name)
 				break
 			}
 			fnInfo := entry.typeInfo.(*FuncInfo)
-			if fnInfo.NumParams != len(f.Params) {
-				tc.errorList = append(tc.errorList,
-					errors.New(fmt.Sprintf("%s is already declared with different signature", f.Name)))
+			composite := compositeType(fnInfo, funcInfo)
+			if composite == nil {
+				tc.addError("conflicting types for %s: '%s' and '%s'", f.Name, fnInfo, funcInfo)
 				break
 			}
 			if fnInfo.IsDefined && f.Body != nil {
-				tc.errorList = append(tc.errorList,
-					errors.New(fmt.Sprintf("%s is already defined", f.Name)))
+				tc.addError("%s is already defined", f.Name)
 				break
 			}
-			if f.Body != nil {
-				fnInfo.IsDefined = true
-			}
+			// the entry is shared by all declarations of the function
+			*fnInfo = *composite.(*FuncInfo)
+			fnInfo.IsDefined = fnInfo.IsDefined || f.Body != nil
 			break
 		}
 	}
+	tc.env.setVisibility(f.Name, visibility)
+
+	for _, param := range f.Params {
+		switch param.Type.GetTypeId() {
+		case TypeVoid:
+			tc.addError("parameter %s of %s has type void", param.Name, f.Name)
+		case TypeStruct:
+			tc.addError("parameter %s of %s: passing '%s' by value is not supported",
+				param.Name, f.Name, param.Type)
+		}
+	}
+	if f.ReturnType.GetTypeId() == TypeStruct {
+		tc.addError("function %s: returning '%s' by value is not supported", f.Name, f.ReturnType)
+	}
 
 	if f.Body != nil {
 		tc.env = NewEnvironment(tc.env)
+		enclosingFunction := tc.currentFunction
+		tc.currentFunction = f
 
 		for _, param := range f.Params {
-			tc.env.set(param.Name, param.Name, false, idCatParameter, &IntInfo{})
+			tc.env.set(param.Name, param.Name, false, idCatParameter, param.Type)
 		}
 
 		f.Body.Accept(tc)
 
+		tc.currentFunction = enclosingFunction
 		tc.env = tc.env.getParent()
 	}
 }
 
+// checkFileScopeVarDecl checks a variable declaration at file scope.
+// All declarations of a variable must agree in type and linkage.
+func (tc *typeChecker) checkFileScopeVarDecl(v *VarDecl) {
+	defer tc.at(v.Pos)()
+	tc.checkVarType(v)
+	tc.checkStaticVarType(v)
+	tc.checkStaticInit(v)
+
+	isExternal := v.StorageClass != StorageStatic
+	isInitialized := v.InitValue != nil
+	entry, _ := tc.env.Get(v.Name)
+	visibility := tc.mergeVisibility(v.Pos, v.Name, entry, v.Visibility)
+
+	if entry != nil {
+		switch {
+		case entry.category != idCatVariable:
+			tc.addErrorAt(v.Pos, "%s redeclared as different kind of symbol", v.Name)
+		case !entry.typeInfo.Equal(v.VarType):
+			tc.addErrorAt(v.Pos, "conflicting types for %s: '%s' and '%s'", v.Name, entry.typeInfo, v.VarType)
+		case v.StorageClass == StorageStatic && entry.isExternal:
+			tc.addErrorAt(v.Pos, "static declaration of %s follows non-static declaration", v.Name)
+		case v.StorageClass == StorageNone && !entry.isExternal:
+			tc.addErrorAt(v.Pos, "non-static declaration of %s follows static declaration", v.Name)
+		case isInitialized && entry.isInitialized:
+			tc.addErrorAt(v.Pos, "redefinition of %s", v.Name)
+		}
+		if v.StorageClass == StorageExtern {
+			// extern keeps the linkage of a previous declaration
+			isExternal = entry.isExternal
+		}
+		isInitialized = isInitialized || entry.isInitialized
+	}
+
+	tc.env.setStaticVariable(v.Name, isExternal, isInitialized, v.VarType)
+	tc.env.setVisibility(v.Name, visibility)
+}
+
+// mergeVisibility returns the visibility of a function or variable
+// after another declaration. A declaration without visibility
+// attribute keeps the visibility of the previous ones.
+func (tc *typeChecker) mergeVisibility(pos Position, name string, entry *EnvEntry, visibility Visibility) Visibility {
+	if entry == nil || entry.visibility == VisibilityDefault {
+		return visibility
+	}
+	if visibility != VisibilityDefault && visibility != entry.visibility {
+		tc.addErrorAt(pos, "conflicting visibility for %s: '%s' and '%s'", name, entry.visibility, visibility)
+	}
+	return entry.visibility
+}
+
+func (tc *typeChecker) checkVarType(v *VarDecl) {
+	v.VarType = tc.resolveType(v.VarType)
+	if v.VarType.GetTypeId() == TypeVoid {
+		tc.addErrorAt(v.Pos, "variable %s declared void", v.Name)
+	} else if !IsComplete(v.VarType) && v.StorageClass != StorageExtern {
+		tc.addErrorAt(v.Pos, "storage size of %s isn't known", v.Name)
+	}
+}
+
+func (tc *typeChecker) checkStaticVarType(v *VarDecl) {
+	if v.VarType.GetTypeId() == TypeVaList {
+		tc.addErrorAt(v.Pos, "variable %s: static variables of type va_list are not supported", v.Name)
+	}
+}
+
+// checkStaticInit checks the initializer of a variable with static
+// storage duration. It must be a constant which replaces the expression.
+func (tc *typeChecker) checkStaticInit(v *VarDecl) {
+	if v.InitValue == nil {
+		return
+	}
+	initType := tc.valueTypeOf(v.InitValue)
+	tc.checkConversion(v.InitValue, initType, v.VarType)
+	value, err := evalConstant(v.InitValue, tc.env)
+	if err != nil {
+		tc.addErrorAt(v.Pos, "initializer of %s is not constant: %s", v.Name, err)
+		return
+	}
+	literal := &IntegerLiteral{Value: value, Pos: v.Pos}
+	literal.SetResultType(&IntInfo{})
+	v.InitValue = literal
+}
+
+// checkExternVarDecl checks a block scope declaration of a variable
+// that is defined elsewhere
+func (tc *typeChecker) checkExternVarDecl(v *VarDecl) {
+	if v.InitValue != nil {
+		tc.addErrorAt(v.Pos, "%s has both 'extern' and initializer", v.Name)
+	}
+
+	isExternal := true
+	isInitialized := false
+	entry, _ := tc.env.getGlobal().Get(v.Name)
+	visibility := tc.mergeVisibility(v.Pos, v.Name, entry, v.Visibility)
+	if entry != nil {
+		if entry.category != idCatVariable {
+			tc.addErrorAt(v.Pos, "%s redeclared as different kind of symbol", v.Name)
+		} else if !entry.typeInfo.Equal(v.VarType) {
+			tc.addErrorAt(v.Pos, "conflicting types for %s: '%s' and '%s'", v.Name, entry.typeInfo, v.VarType)
+		}
+		isExternal = entry.isExternal
+		isInitialized = entry.isInitialized
+	}
+
+	tc.env.setStaticVariable(v.Name, isExternal, isInitialized, v.VarType)
+	tc.env.setVisibility(v.Name, visibility)
+}
+
 func (tc *typeChecker) VisitVarDecl(v *VarDecl) {
-	tc.env.set(v.Name, v.Name, false, idCatVariable, &IntInfo{})
+	defer tc.at(v.Pos)()
+	tc.checkVarType(v)
+	if v.Visibility != VisibilityDefault && v.StorageClass != StorageExtern {
+		tc.addError("%s: visibility attribute on a variable without linkage", v.Name)
+	}
+
+	switch v.StorageClass {
+	case StorageStatic:
+		tc.checkStaticVarType(v)
+		tc.checkStaticInit(v)
+		tc.env.setStaticVariable(v.Name, false, true, v.VarType)
+		return
+	case StorageExtern:
+		tc.checkStaticVarType(v)
+		tc.checkExternVarDecl(v)
+		return
+	}
+
+	tc.env.set(v.Name, v.Name, false, idCatVariable, v.VarType)
 
 	if v.InitValue != nil {
-		v.InitValue.Accept(tc)
+		initType := tc.valueTypeOf(v.InitValue)
+		tc.checkConversion(v.InitValue, initType, v.VarType)
 	}
 }
 
+func (tc *typeChecker) VisitEnumDecl(e *EnumDecl) {
+	defer tc.at(e.Pos)()
+	var constants []EnumConstant
+	value := 0
+
+	for _, member := range e.Members {
+		if member.Value != nil {
+			tc.valueTypeOf(member.Value)
+			var err error
+			value, err = evalConstant(member.Value, tc.env)
+			if err != nil {
+				tc.addErrorAt(member.Pos, "value of enumerator %s: %s", member.Name, err)
+			}
+		} else if value > math.MaxInt32 {
+			tc.addErrorAt(member.Pos, "overflow in enumeration values")
+		}
+		if _, defined := tc.env.identMap[member.Name]; defined {
+			tc.addErrorAt(member.Pos, "%s already defined", member.Name)
+		}
+		tc.env.setEnumConstant(member.Name, value, &IntInfo{})
+		constants = append(constants, EnumConstant{member.Name, value})
+		value++
+	}
+
+	e.EnumType.Constants = constants
+}
+
+// VisitStructDecl checks the members of a structure or union and
+// lays them out the way GCC does on x86-64: bit-fields are packed into
+// int sized storage units and must not straddle their boundaries.
+func (tc *typeChecker) VisitStructDecl(s *StructDecl) {
+	defer tc.at(s.Pos)()
+	if s.Members == nil {
+		// declaration of the tag only
+		return
+	}
+	structType := s.StructType
+	var members []StructMember
+	names := make(map[string]bool)
+	bitPos := 0
+	size := 0
+	alignment := 1
+
+	for i := range s.Members {
+		decl := &s.Members[i]
+		member := StructMember{Name: decl.Name, Type: tc.resolveType(decl.Type), Unsigned: decl.Unsigned}
+		if decl.Name != "" {
+			if names[decl.Name] {
+				tc.addErrorAt(decl.Pos, "duplicate member %s", decl.Name)
+			}
+			names[decl.Name] = true
+		}
+		switch {
+		case member.Type.GetTypeId() == TypeFunc:
+			tc.addErrorAt(decl.Pos, "member %s declared as a function", decl.Name)
+			member.Type = &PointerInfo{member.Type}
+		case !IsComplete(member.Type):
+			tc.addErrorAt(decl.Pos, "member %s has incomplete type '%s'", decl.Name, member.Type)
+			member.Type = &IntInfo{}
+		}
+
+		if structType.IsUnion {
+			bitPos = 0
+		}
+		if decl.BitWidth != nil {
+			width := tc.checkBitWidth(decl, member.Type)
+			if width == 0 {
+				// an unnamed bit-field of width 0 closes the storage unit
+				bitPos = (bitPos + 31) / 32 * 32
+				continue
+			}
+			if bitPos/32 != (bitPos+width-1)/32 {
+				bitPos = (bitPos + 31) / 32 * 32
+			}
+			member.Offset = bitPos / 32 * 4
+			member.BitOffset = bitPos % 32
+			member.BitWidth = width
+			bitPos += width
+			// unnamed bit-fields do not affect the alignment
+			if decl.Name != "" {
+				alignment = max(alignment, 4)
+			}
+		} else {
+			memberAlignment := AlignmentOf(member.Type)
+			member.Offset = ((bitPos+7)/8 + memberAlignment - 1) / memberAlignment * memberAlignment
+			bitPos = (member.Offset + SizeOf(member.Type)) * 8
+			alignment = max(alignment, memberAlignment)
+		}
+		size = max(size, (bitPos+7)/8)
+		if decl.Name != "" {
+			members = append(members, member)
+		}
+	}
+
+	structType.Members = members
+	structType.Alignment = alignment
+	structType.Size = (size + alignment - 1) / alignment * alignment
+	structType.IsComplete = true
+}
+
+// checkBitWidth evaluates the width of a bit-field. Only int bit-fields
+// are supported, which are signed unless declared as "unsigned".
+func (tc *typeChecker) checkBitWidth(decl *MemberDecl, memberType TypeInfo) int {
+	name := decl.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	if memberType.GetTypeId() != TypeInt {
+		tc.addErrorAt(decl.Pos, "bit-field %s has invalid type '%s'", name, memberType)
+		return 1
+	}
+	tc.valueTypeOf(decl.BitWidth)
+	width, err := evalConstant(decl.BitWidth, tc.env)
+	if err != nil {
+		tc.addErrorAt(decl.Pos, "width of bit-field %s: %s", name, err)
+		return 1
+	}
+	switch {
+	case width < 0:
+		tc.addErrorAt(decl.Pos, "negative width in bit-field %s", name)
+	case width == 0 && decl.Name != "":
+		tc.addErrorAt(decl.Pos, "zero width for bit-field %s", name)
+	case width > 32:
+		tc.addErrorAt(decl.Pos, "width of bit-field %s exceeds its type", name)
+	case width == 32 && decl.Unsigned:
+		tc.addErrorAt(decl.Pos, "bit-field %s: unsigned bit-fields of width 32 are not supported", name)
+	default:
+		return width
+	}
+	return 1
+}
+
+func (tc *typeChecker) VisitTypedefDecl(t *TypedefDecl) {
+	defer tc.at(t.Pos)()
+	t.Type = tc.resolveType(t.Type)
+
+	entry, definingEnv := tc.env.Get(t.Name)
+	if definingEnv == tc.env {
+		if entry.category != idCatTypedef {
+			tc.addError("%s redeclared as different kind of symbol", t.Name)
+		} else if !entry.typeInfo.Equal(t.Type) {
+			tc.addError("conflicting types for typedef %s: '%s' and '%s'", t.Name, entry.typeInfo, t.Type)
+		}
+	}
+	tc.env.set(t.Name, t.Name, false, idCatTypedef, t.Type)
+}
+
 func (tc *typeChecker) VisitReturn(r *ReturnStmt) {
-	if r.Expression != nil {
-		r.Expression.Accept(tc)
+	defer tc.at(r.Pos)()
+	f := tc.currentFunction
+	isVoid := f.ReturnType.GetTypeId() == TypeVoid
+
+	if r.Expression == nil {
+		if !isVoid {
+			tc.addError("non-void function %s should return a value", f.Name)
+		}
+		return
 	}
+
+	if isVoid {
+		tc.typeOf(r.Expression)
+		tc.addError("void function %s should not return a value", f.Name)
+		return
+	}
+	exprType := tc.valueTypeOf(r.Expression)
+	tc.checkConversion(r.Expression, exprType, f.ReturnType)
 }
 
 func (tc *typeChecker) VisitExprStmt(e *ExpressionStmt) {
-	e.Expression.Accept(tc)
+	defer tc.at(e.Pos)()
+	tc.typeOf(e.Expression)
 }
 
 func (tc *typeChecker) VisitIfStmt(i *IfStmt) {
-	i.Condition.Accept(tc)
+	defer tc.at(i.Pos)()
+	tc.conditionTypeOf(i.Condition)
 	i.Consequent.Accept(tc)
 	if i.Alternate != nil {
 		i.Alternate.Accept(tc)
@@ -103,6 +535,7 @@ func (tc *typeChecker) VisitIfStmt(i *IfStmt) {
 }
 
 func (tc *typeChecker) VisitBlockStmt(b *BlockStmt) {
+	defer tc.at(b.Pos)()
 	tc.env = NewEnvironment(tc.env)
 	for _, item := range b.Items {
 		item.Accept(tc)
@@ -115,22 +548,25 @@ func (tc *typeChecker) VisitGotoStmt(*GotoStmt) {}
 func (tc *typeChecker) VisitLabelStmt(*LabelStmt) {}
 
 func (tc *typeChecker) VisitDoWhileStmt(d *DoWhileStmt) {
-	d.Condition.Accept(tc)
+	defer tc.at(d.Pos)()
+	tc.conditionTypeOf(d.Condition)
 	d.Body.Accept(tc)
 }
 
 func (tc *typeChecker) VisitWhileStmt(w *WhileStmt) {
-	w.Condition.Accept(tc)
+	defer tc.at(w.Pos)()
+	tc.conditionTypeOf(w.Condition)
 	w.Body.Accept(tc)
 }
 
 func (tc *typeChecker) VisitForStmt(f *ForStmt) {
+	defer tc.at(f.Pos)()
 	f.InitStmt.Accept(tc)
 	if f.Condition != nil {
-		f.Condition.Accept(tc)
+		tc.conditionTypeOf(f.Condition)
 	}
 	if f.Post != nil {
-		f.Post.Accept(tc)
+		tc.typeOf(f.Post)
 	}
 	f.Body.Accept(tc)
 }
@@ -140,61 +576,394 @@ func (tc *typeChecker) VisitBreakStmt(*BreakStmt) {}
 func (tc *typeChecker) VisitContinueStmt(*ContinueStmt) {}
 
 func (tc *typeChecker) VisitSwitchStmt(s *SwitchStmt) {
-	s.Expr.Accept(tc)
+	defer tc.at(s.Pos)()
+	if !IsInteger(tc.valueTypeOf(s.Expr)) {
+		tc.addError("switch expression must have integer type")
+	}
+	tc.switchCases = append(tc.switchCases, make(map[int]bool))
 	s.Body.Accept(tc)
+	tc.switchCases = tc.switchCases[:len(tc.switchCases)-1]
 }
 
 func (tc *typeChecker) VisitCaseStmt(c *CaseStmt) {
-	if c.Value != nil {
-		c.Value.Accept(tc)
+	defer tc.at(c.Pos)()
+	if c.Value == nil {
+		return
+	}
+	tc.valueTypeOf(c.Value)
+	value, err := evalConstant(c.Value, tc.env)
+	if err != nil {
+		tc.addError("case value: %s", err)
+		return
+	}
+	if len(tc.switchCases) == 0 {
+		return
+	}
+	cases := tc.switchCases[len(tc.switchCases)-1]
+	if cases[value] {
+		tc.addError("there is already a case clause for value %d", value)
 	}
+	cases[value] = true
 }
 
-func (tc *typeChecker) VisitNullStmt() {}
+func (tc *typeChecker) VisitNullStmt(*NullStmt) {}
 
-func (tc *typeChecker) VisitInteger(*IntegerLiteral) {}
+func (tc *typeChecker) VisitInteger(*IntegerLiteral) {
+	tc.exprType = &IntInfo{}
+}
 
 func (tc *typeChecker) VisitVariable(v *Variable) {
+	defer tc.at(v.Pos)()
 	entry, _ := tc.env.Get(v.Name)
-	if entry != nil && entry.category != idCatVariable && entry.category != idCatParameter {
-		tc.errorList = append(tc.errorList, errors.New(fmt.Sprintf("%s defined as a non-variable", v.Name)))
+	if entry == nil {
+		// undeclared variables are reported by the identifier resolution
+		tc.exprType = &IntInfo{}
+		return
+	}
+	if entry.category == idCatTypedef {
+		tc.addError("%s defined as a non-variable", v.Name)
+		tc.exprType = &IntInfo{}
+		return
 	}
+	if entry.category == idCatFunction {
+		// the type of a function designator does not depend on
+		// whether the function is defined
+		funcType := *entry.typeInfo.(*FuncInfo)
+		funcType.IsDefined = false
+		tc.exprType = &funcType
+		return
+	}
+	tc.exprType = entry.typeInfo
 }
 
 func (tc *typeChecker) VisitFunctionCall(f *FunctionCall) {
-	entry, _ := tc.env.Get(f.Callee)
-	if entry != nil {
-		if entry.category != idCatFunction {
-			tc.errorList = append(tc.errorList, errors.New(fmt.Sprintf("%s is not a function", f.Callee)))
-		} else {
-			fnInfo := entry.typeInfo.(*FuncInfo)
-			if len(f.Args) != fnInfo.NumParams {
-				tc.errorList = append(tc.errorList,
-					errors.New(fmt.Sprintf("%s: #arguments <> #params (%d <> %d)",
-						f.Callee, len(f.Args), fnInfo.NumParams)))
+	defer tc.at(f.Pos)()
+	var argTypes []TypeInfo
+	for i, arg := range f.Args {
+		argType := tc.valueTypeOf(arg)
+		if argType.GetTypeId() == TypeStruct {
+			tc.addError("argument %d of '%s': passing '%s' by value is not supported",
+				i+1, calleeName(f.Callee), argType)
+		}
+		argTypes = append(argTypes, argType)
+	}
+
+	if callee, ok := f.Callee.(*Variable); ok {
+		if entry, _ := tc.env.Get(callee.Name); entry == nil {
+			// implicit declaration (reported as a warning)
+			tc.env.getGlobal().set(callee.Name, callee.Name, true, idCatFunction,
+				&FuncInfo{
+					ReturnType:   &IntInfo{},
+					Unprototyped: true,
+				})
+		}
+	}
+
+	var returnType TypeInfo = &IntInfo{}
+
+	calleeType := tc.valueTypeOf(f.Callee)
+	if IsFunctionPointer(calleeType) {
+		fnInfo := calleeType.(*PointerInfo).Referenced.(*FuncInfo)
+		switch {
+		case fnInfo.Unprototyped:
+			// the parameters of an implicitly declared function are unknown
+		case fnInfo.Variadic:
+			if len(f.Args) < fnInfo.NumParams() {
+				tc.addError("%s: #arguments < #params (%d < %d)",
+					calleeName(f.Callee), len(f.Args), fnInfo.NumParams())
 			}
+		case len(f.Args) != fnInfo.NumParams():
+			tc.addError("%s: #arguments <> #params (%d <> %d)",
+				calleeName(f.Callee), len(f.Args), fnInfo.NumParams())
 		}
+		// the arguments are converted to the parameter types
+		for i, paramType := range fnInfo.ParamTypes {
+			if i < len(f.Args) && !isConvertible(f.Args[i], argTypes[i], paramType) {
+				tc.addError("argument %d of '%s' has type '%s', expected '%s'",
+					i+1, calleeName(f.Callee), argTypes[i], paramType)
+			}
+		}
+		returnType = fnInfo.ReturnType
+	} else {
+		tc.addError("called object %s is not a function or function pointer", calleeName(f.Callee))
 	}
-	for _, arg := range f.Args {
-		arg.Accept(tc)
+	tc.exprType = returnType
+}
+
+// calleeName returns the name of the called function for error messages
+func calleeName(callee Expression) string {
+	if variable, ok := callee.(*Variable); ok {
+		return variable.Name
 	}
+	return "(expression)"
 }
 
 func (tc *typeChecker) VisitUnary(u *UnaryExpression) {
-	u.Right.Accept(tc)
+	defer tc.at(u.Pos)()
+	if u.Operator == UnOpNot {
+		tc.conditionTypeOf(u.Right)
+		tc.exprType = &IntInfo{}
+		return
+	}
+	operandType := tc.valueTypeOf(u.Right)
+	if !IsInteger(operandType) {
+		tc.addError("invalid operand to unary %s: '%s'", u.Operator, operandType)
+	}
+	tc.exprType = &IntInfo{}
+}
+
+func (tc *typeChecker) VisitPrefixIncDec(p *PrefixIncDec) {
+	defer tc.at(p.Pos)()
+	tc.checkIncDec(p.Operator, p.Operand)
 }
 
 func (tc *typeChecker) VisitPostfixIncDec(p *PostfixIncDec) {
-	p.Operand.Accept(tc)
+	defer tc.at(p.Pos)()
+	tc.checkIncDec(p.Operator, p.Operand)
+}
+
+func (tc *typeChecker) checkIncDec(operator IncDecOp, operand Expression) {
+	operandType := tc.valueTypeOf(operand)
+	if !IsInteger(operandType) {
+		tc.addError("invalid operand to %s: '%s'", operator, operandType)
+	}
+	tc.exprType = &IntInfo{}
 }
 
 func (tc *typeChecker) VisitBinary(b *BinaryExpression) {
-	b.Left.Accept(tc)
-	b.Right.Accept(tc)
+	defer tc.at(b.Pos)()
+	if b.Operator == BinOpAnd || b.Operator == BinOpOr {
+		tc.conditionTypeOf(b.Left)
+		tc.conditionTypeOf(b.Right)
+		tc.exprType = &IntInfo{}
+		return
+	}
+	leftType := tc.valueTypeOf(b.Left)
+	rightType := tc.valueTypeOf(b.Right)
+
+	switch b.Operator {
+	case BinOpAssign:
+		switch b.Left.GetResultType().GetTypeId() {
+		case TypeFunc:
+			tc.addError("cannot assign to function %s", calleeName(b.Left))
+		case TypeVaList:
+			tc.addError("cannot assign to a variable of type va_list")
+		}
+		tc.checkConversion(b.Right, rightType, leftType)
+		tc.exprType = leftType
+		return
+	case BinOpEqual, BinOpNotEqual:
+		if !IsScalar(leftType) || !IsScalar(rightType) {
+			tc.addError("invalid operands to binary %s: '%s' and '%s'", b.Operator, leftType, rightType)
+		} else if (IsPointer(leftType) || IsPointer(rightType)) &&
+			!isConvertible(b.Right, rightType, leftType) &&
+			!isConvertible(b.Left, leftType, rightType) {
+			tc.addError("comparison of distinct types '%s' and '%s'", leftType, rightType)
+		}
+	case BinOpLess, BinOpLessEq, BinOpGreater, BinOpGreaterEq:
+		if !IsScalar(leftType) || !IsScalar(rightType) {
+			tc.addError("invalid operands to binary %s: '%s' and '%s'", b.Operator, leftType, rightType)
+		} else if !leftType.Equal(rightType) && !(IsInteger(leftType) && IsInteger(rightType)) {
+			tc.addError("comparison of distinct types '%s' and '%s'", leftType, rightType)
+		}
+	default:
+		if !IsInteger(leftType) || !IsInteger(rightType) {
+			tc.addError("invalid operands to binary %s: '%s' and '%s'", b.Operator, leftType, rightType)
+		}
+	}
+	tc.exprType = &IntInfo{}
+}
+
+func (tc *typeChecker) VisitCompoundAssignment(c *CompoundAssignment) {
+	defer tc.at(c.Pos)()
+	leftType := tc.valueTypeOf(c.Left)
+	rightType := tc.valueTypeOf(c.Right)
+	if !IsInteger(leftType) || !IsInteger(rightType) {
+		tc.addError("invalid operands to %s=: '%s' and '%s'", c.Operator, leftType, rightType)
+	}
+	tc.exprType = leftType
 }
 
 func (tc *typeChecker) VisitConditional(c *Conditional) {
-	c.Condition.Accept(tc)
-	c.Consequent.Accept(tc)
-	c.Alternate.Accept(tc)
+	defer tc.at(c.Pos)()
+	tc.conditionTypeOf(c.Condition)
+	consequentType := decay(tc.typeOf(c.Consequent))
+	alternateType := decay(tc.typeOf(c.Alternate))
+
+	switch {
+	case consequentType.Equal(alternateType):
+		tc.exprType = consequentType
+	case IsPointer(consequentType) && isConvertible(c.Alternate, alternateType, consequentType):
+		tc.exprType = consequentType
+		if isVoidPointer(alternateType) {
+			tc.exprType = alternateType
+		}
+	case IsPointer(alternateType) && isConvertible(c.Consequent, consequentType, alternateType):
+		tc.exprType = alternateType
+		if isVoidPointer(consequentType) {
+			tc.exprType = consequentType
+		}
+	case IsInteger(consequentType) && IsInteger(alternateType):
+		tc.exprType = &IntInfo{}
+	default:
+		tc.addError("type mismatch in conditional expression: '%s' and '%s'",
+			consequentType, alternateType)
+		tc.exprType = consequentType
+	}
+}
+
+func (tc *typeChecker) VisitAddressOf(a *AddressOf) {
+	defer tc.at(a.Pos)()
+	operandType := tc.typeOf(a.Operand)
+	if operandType.GetTypeId() == TypeVoid {
+		tc.addError("cannot take the address of a void expression")
+		operandType = &IntInfo{}
+	}
+	if member := bitField(a.Operand); member != nil {
+		tc.addError("cannot take the address of bit-field %s", member.Name)
+	}
+	tc.exprType = &PointerInfo{operandType}
+}
+
+// decay converts a function designator to a function pointer
+// and a va_list to a pointer to the va_list
+func decay(typeInfo TypeInfo) TypeInfo {
+	if typeInfo.GetTypeId() == TypeFunc || typeInfo.GetTypeId() == TypeVaList {
+		return &PointerInfo{typeInfo}
+	}
+	return typeInfo
+}
+
+func (tc *typeChecker) VisitDereference(d *Dereference) {
+	defer tc.at(d.Pos)()
+	operandType := tc.valueTypeOf(d.Operand)
+	switch {
+	case isVoidPointer(operandType):
+		tc.addError("dereferencing 'void *' pointer")
+		tc.exprType = &IntInfo{}
+	case IsPointer(operandType):
+		tc.exprType = operandType.(*PointerInfo).Referenced
+	default:
+		tc.addError("cannot dereference a value of type '%s'", operandType)
+		tc.exprType = &IntInfo{}
+	}
+}
+
+func (tc *typeChecker) VisitMemberAccess(m *MemberAccess) {
+	defer tc.at(m.Pos)()
+	objectType := tc.typeOf(m.Object)
+	structType, ok := objectType.(*StructInfo)
+	if !ok {
+		tc.addError("request for member '%s' in something not a structure or union", m.Member)
+		tc.exprType = &IntInfo{}
+		return
+	}
+	if !structType.IsComplete {
+		tc.addError("invalid use of incomplete type '%s'", structType)
+		tc.exprType = &IntInfo{}
+		return
+	}
+	member := structType.FindMember(m.Member)
+	if member == nil {
+		tc.addError("'%s' has no member named '%s'", structType, m.Member)
+		tc.exprType = &IntInfo{}
+		return
+	}
+	tc.exprType = member.Type
+}
+
+// bitField returns the member if the expression accesses a bit-field
+func bitField(expr Expression) *StructMember {
+	access, ok := expr.(*MemberAccess)
+	if !ok {
+		return nil
+	}
+	structType, ok := access.Object.GetResultType().(*StructInfo)
+	if !ok {
+		return nil
+	}
+	member := structType.FindMember(access.Member)
+	if member == nil || !member.IsBitField() {
+		return nil
+	}
+	return member
+}
+
+func (tc *typeChecker) VisitCast(c *Cast) {
+	defer tc.at(c.Pos)()
+	c.TargetType = tc.resolveType(c.TargetType)
+	switch c.TargetType.GetTypeId() {
+	case TypeFunc:
+		tc.addError("cannot cast to function type '%s'", c.TargetType)
+	case TypeStruct:
+		tc.addError("conversion to non-scalar type '%s' requested", c.TargetType)
+	}
+	if c.TargetType.GetTypeId() == TypeVoid {
+		tc.typeOf(c.Operand)
+	} else if operandType := tc.valueTypeOf(c.Operand); operandType.GetTypeId() == TypeStruct {
+		tc.addError("invalid cast from '%s' to '%s'", operandType, c.TargetType)
+	}
+	tc.exprType = c.TargetType
+}
+
+func (tc *typeChecker) VisitSizeOfType(s *SizeOfType) {
+	defer tc.at(s.Pos)()
+	s.TargetType = tc.resolveType(s.TargetType)
+	tc.checkSizeOf(s.TargetType)
+	tc.exprType = &IntInfo{}
+}
+
+func (tc *typeChecker) VisitSizeOfExpr(s *SizeOfExpr) {
+	defer tc.at(s.Pos)()
+	tc.checkSizeOf(tc.typeOf(s.Operand))
+	if bitField(s.Operand) != nil {
+		tc.addError("'sizeof' applied to a bit-field")
+	}
+	tc.exprType = &IntInfo{}
+}
+
+func (tc *typeChecker) checkSizeOf(typeInfo TypeInfo) {
+	switch typeInfo.GetTypeId() {
+	case TypeVoid:
+		tc.addError("invalid application of 'sizeof' to a void type")
+	case TypeFunc:
+		tc.addError("invalid application of 'sizeof' to a function type")
+	case TypeStruct:
+		if !IsComplete(typeInfo) {
+			tc.addError("invalid application of 'sizeof' to incomplete type '%s'", typeInfo)
+		}
+	}
+}
+
+func (tc *typeChecker) VisitVaStart(v *VaStart) {
+	defer tc.at(v.Pos)()
+	tc.checkVaList(v.VaList, "va_start")
+	tc.typeOf(v.LastParam)
+	if !tc.currentFunction.Variadic {
+		tc.addError("'va_start' used in function %s with fixed arguments", tc.currentFunction.Name)
+	}
+	tc.exprType = &VoidInfo{}
+}
+
+func (tc *typeChecker) VisitVaArg(v *VaArg) {
+	defer tc.at(v.Pos)()
+	tc.checkVaList(v.VaList, "va_arg")
+	v.ArgType = tc.resolveType(v.ArgType)
+	if !IsInteger(v.ArgType) && !IsPointer(v.ArgType) {
+		tc.addError("invalid type '%s' for 'va_arg'", v.ArgType)
+	}
+	tc.exprType = v.ArgType
+}
+
+func (tc *typeChecker) VisitVaEnd(v *VaEnd) {
+	defer tc.at(v.Pos)()
+	tc.checkVaList(v.VaList, "va_end")
+	tc.exprType = &VoidInfo{}
+}
+
+func (tc *typeChecker) checkVaList(vaList Expression, builtin string) {
+	vaListType := tc.valueTypeOf(vaList)
+	if !IsVaListPointer(vaListType) {
+		tc.addError("first argument to '%s' must be of type va_list, not '%s'", builtin, vaListType)
+	}
 }
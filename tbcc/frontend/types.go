@@ -1,15 +1,29 @@
 package frontend
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
 type TypeId int
 
 const (
 	TypeInt TypeId = iota
 	TypeFunc
+	TypeVoid
+	TypePointer
+	TypeEnum
+	TypeTypedef
+	TypeVaList
+	TypeStruct
 )
 
 type TypeInfo interface {
 	GetTypeId() TypeId
 	Equal(other TypeInfo) bool
+	// String returns the type in C notation, e.g. "int *"
+	String() string
 }
 
 type IntInfo struct{}
@@ -18,13 +32,189 @@ func (i *IntInfo) GetTypeId() TypeId {
 	return TypeInt
 }
 
-func (i *IntInfo) Equal(TypeInfo) bool {
-	return true
+func (i *IntInfo) Equal(other TypeInfo) bool {
+	return other.GetTypeId() == TypeInt || other.GetTypeId() == TypeEnum
+}
+
+func (i *IntInfo) String() string {
+	return "int"
+}
+
+type VoidInfo struct{}
+
+func (v *VoidInfo) GetTypeId() TypeId {
+	return TypeVoid
+}
+
+func (v *VoidInfo) Equal(other TypeInfo) bool {
+	return other.GetTypeId() == TypeVoid
+}
+
+func (v *VoidInfo) String() string {
+	return "void"
+}
+
+type PointerInfo struct {
+	Referenced TypeInfo
+}
+
+func (p *PointerInfo) GetTypeId() TypeId {
+	return TypePointer
+}
+
+func (p *PointerInfo) Equal(other TypeInfo) bool {
+	otherPointer, ok := other.(*PointerInfo)
+	return ok && p.Referenced.Equal(otherPointer.Referenced)
+}
+
+func (p *PointerInfo) String() string {
+	return typeString(p, "")
+}
+
+// EnumInfo is an enumeration type. Enumerations are compatible with int.
+type EnumInfo struct {
+	Tag string // empty for anonymous enumerations
+	// Constants are filled in by the type checker. They are
+	// missing for enumerations that are only referenced by tag.
+	Constants []EnumConstant
+}
+
+type EnumConstant struct {
+	Name  string
+	Value int
+}
+
+const anonymousEnum = "enum <anonymous>"
+
+func (e *EnumInfo) GetTypeId() TypeId {
+	return TypeEnum
+}
+
+func (e *EnumInfo) Equal(other TypeInfo) bool {
+	if other.GetTypeId() == TypeInt {
+		return true
+	}
+	otherEnum, ok := other.(*EnumInfo)
+	return ok && (e == otherEnum || (e.Tag != "" && e.Tag == otherEnum.Tag))
+}
+
+func (e *EnumInfo) String() string {
+	if e.Tag == "" {
+		return anonymousEnum
+	}
+	return "enum " + e.Tag
+}
+
+// StructInfo is a structure or union type. Like enumerations, all
+// references to a tag share the same StructInfo.
+type StructInfo struct {
+	Tag     string // empty for anonymous structures and unions
+	IsUnion bool
+	// Members and layout are filled in by the type checker when
+	// it reaches the definition. Until then the type is incomplete.
+	Members    []StructMember
+	Size       int
+	Alignment  int
+	IsComplete bool
+}
+
+// StructMember is a member of a structure or union. Bit-fields are
+// accessed through the int sized storage unit at Offset.
+type StructMember struct {
+	Name      string
+	Type      TypeInfo
+	Offset    int
+	BitOffset int
+	BitWidth  int // 0 for members that are not bit-fields
+	Unsigned  bool
+}
+
+const (
+	anonymousStruct = "struct <anonymous>"
+	anonymousUnion  = "union <anonymous>"
+)
+
+func (s *StructInfo) GetTypeId() TypeId {
+	return TypeStruct
+}
+
+func (s *StructInfo) Equal(other TypeInfo) bool {
+	// every declaration of a tag in a new scope introduces a distinct type
+	otherStruct, ok := other.(*StructInfo)
+	return ok && s == otherStruct
+}
+
+func (s *StructInfo) String() string {
+	keyword := "struct"
+	if s.IsUnion {
+		keyword = "union"
+	}
+	if s.Tag == "" {
+		return keyword + " <anonymous>"
+	}
+	return keyword + " " + s.Tag
+}
+
+// FindMember returns the member with the given name or nil
+func (s *StructInfo) FindMember(name string) *StructMember {
+	for i := range s.Members {
+		if s.Members[i].Name == name {
+			return &s.Members[i]
+		}
+	}
+	return nil
+}
+
+// IsBitField returns true if the member is a bit-field
+func (m *StructMember) IsBitField() bool {
+	return m.BitWidth > 0
+}
+
+// TypedefInfo refers to a type by its typedef name. It is replaced
+// by the type checker with the type the name stands for.
+type TypedefInfo struct {
+	Name string
+}
+
+func (t *TypedefInfo) GetTypeId() TypeId {
+	return TypeTypedef
+}
+
+func (t *TypedefInfo) Equal(other TypeInfo) bool {
+	otherTypedef, ok := other.(*TypedefInfo)
+	return ok && t.Name == otherTypedef.Name
+}
+
+func (t *TypedefInfo) String() string {
+	return t.Name
+}
+
+// VaListInfo is the type __builtin_va_list that va_list is defined as.
+// Like an array, a va_list decays to a pointer in value contexts.
+type VaListInfo struct{}
+
+func (v *VaListInfo) GetTypeId() TypeId {
+	return TypeVaList
 }
 
+func (v *VaListInfo) Equal(other TypeInfo) bool {
+	return other.GetTypeId() == TypeVaList
+}
+
+func (v *VaListInfo) String() string {
+	return "__builtin_va_list"
+}
+
+// FuncInfo is a function type given by a prototype
 type FuncInfo struct {
-	NumParams int
-	IsDefined bool
+	ParamTypes []TypeInfo
+	ReturnType TypeInfo
+	// Variadic is set for functions accepting further arguments ("...")
+	Variadic bool
+	// Unprototyped is set for implicitly declared functions: they are
+	// int f() with unknown parameters, so calls are not checked
+	Unprototyped bool
+	IsDefined    bool
 }
 
 func (f *FuncInfo) GetTypeId() TypeId {
@@ -32,6 +222,225 @@ func (f *FuncInfo) GetTypeId() TypeId {
 }
 
 func (f *FuncInfo) Equal(other TypeInfo) bool {
-	otherFunc := other.(*FuncInfo)
-	return f.NumParams == otherFunc.NumParams
+	otherFunc, ok := other.(*FuncInfo)
+	if !ok || len(f.ParamTypes) != len(otherFunc.ParamTypes) || f.Variadic != otherFunc.Variadic ||
+		f.Unprototyped != otherFunc.Unprototyped || !f.ReturnType.Equal(otherFunc.ReturnType) {
+		return false
+	}
+	for i, paramType := range f.ParamTypes {
+		if !paramType.Equal(otherFunc.ParamTypes[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// NumParams returns the number of named parameters
+func (f *FuncInfo) NumParams() int {
+	return len(f.ParamTypes)
+}
+
+func (f *FuncInfo) String() string {
+	return typeString(f, "")
+}
+
+// compositeType returns the composite type of two compatible types
+// (e.g. of two declarations of the same function) or nil if the types
+// are not compatible
+func compositeType(t1, t2 TypeInfo) TypeInfo {
+	switch t := t1.(type) {
+	case *PointerInfo:
+		other, ok := t2.(*PointerInfo)
+		if !ok {
+			return nil
+		}
+		referenced := compositeType(t.Referenced, other.Referenced)
+		if referenced == nil {
+			return nil
+		}
+		return &PointerInfo{referenced}
+	case *FuncInfo:
+		other, ok := t2.(*FuncInfo)
+		if !ok {
+			return nil
+		}
+		returnType := compositeType(t.ReturnType, other.ReturnType)
+		if returnType == nil {
+			return nil
+		}
+		// a prototype completes an implicit declaration
+		if t.Unprototyped || other.Unprototyped {
+			composite := *other
+			if other.Unprototyped {
+				composite = *t
+			}
+			composite.ReturnType = returnType
+			composite.IsDefined = t.IsDefined || other.IsDefined
+			return &composite
+		}
+		if len(t.ParamTypes) != len(other.ParamTypes) || t.Variadic != other.Variadic {
+			return nil
+		}
+		composite := &FuncInfo{ReturnType: returnType, Variadic: t.Variadic, IsDefined: t.IsDefined}
+		for i, paramType := range t.ParamTypes {
+			compositeParam := compositeType(paramType, other.ParamTypes[i])
+			if compositeParam == nil {
+				return nil
+			}
+			composite.ParamTypes = append(composite.ParamTypes, compositeParam)
+		}
+		return composite
+	default:
+		if !t1.Equal(t2) {
+			return nil
+		}
+		// an enumeration is more specific than the compatible int
+		if t2.GetTypeId() == TypeEnum {
+			return t2
+		}
+		return t1
+	}
+}
+
+// typeString writes a type in C notation. declarator is the part
+// of the (abstract) declarator that has already been written, e.g.
+// "*" for a pointer to a function which results in "int (*)(int)".
+func typeString(typeInfo TypeInfo, declarator string) string {
+	switch t := typeInfo.(type) {
+	case *PointerInfo:
+		return typeString(t.Referenced, "*"+declarator)
+	case *FuncInfo:
+		if strings.HasPrefix(declarator, "*") {
+			declarator = "(" + declarator + ")"
+		}
+		params := "void"
+		if t.Unprototyped {
+			params = ""
+		} else if len(t.ParamTypes) > 0 {
+			paramNames := make([]string, len(t.ParamTypes))
+			for i, paramType := range t.ParamTypes {
+				paramNames[i] = paramType.String()
+			}
+			params = strings.Join(paramNames, ", ")
+		}
+		if t.Variadic {
+			params += ", ..."
+		}
+		return typeString(t.ReturnType, declarator+"("+params+")")
+	default:
+		if declarator == "" {
+			return typeInfo.String()
+		}
+		return typeInfo.String() + " " + declarator
+	}
+}
+
+// SizeOf returns the size of a value of the given type in bytes
+func SizeOf(typeInfo TypeInfo) int {
+	switch typeInfo.GetTypeId() {
+	case TypeInt, TypeEnum:
+		return 4
+	case TypePointer:
+		return 8
+	case TypeVaList:
+		return 24
+	case TypeStruct:
+		return typeInfo.(*StructInfo).Size
+	default:
+		return 0
+	}
+}
+
+// AlignmentOf returns the alignment of the given type in bytes
+func AlignmentOf(typeInfo TypeInfo) int {
+	switch typeInfo.GetTypeId() {
+	case TypeInt, TypeEnum:
+		return 4
+	case TypePointer, TypeVaList:
+		return 8
+	case TypeStruct:
+		return typeInfo.(*StructInfo).Alignment
+	default:
+		return 1
+	}
+}
+
+// IsComplete returns false for void and for structures and unions
+// that have not been defined (yet)
+func IsComplete(typeInfo TypeInfo) bool {
+	switch typeInfo.GetTypeId() {
+	case TypeVoid:
+		return false
+	case TypeStruct:
+		return typeInfo.(*StructInfo).IsComplete
+	default:
+		return true
+	}
+}
+
+// IsScalar returns true for the types that can be used as conditions
+func IsScalar(typeInfo TypeInfo) bool {
+	return IsInteger(typeInfo) || IsPointer(typeInfo)
+}
+
+// IsInteger returns true for int and enumeration types
+func IsInteger(typeInfo TypeInfo) bool {
+	return typeInfo != nil &&
+		(typeInfo.GetTypeId() == TypeInt || typeInfo.GetTypeId() == TypeEnum)
+}
+
+func IsPointer(typeInfo TypeInfo) bool {
+	return typeInfo != nil && typeInfo.GetTypeId() == TypePointer
+}
+
+// IsFunctionPointer returns true for pointers to functions
+func IsFunctionPointer(typeInfo TypeInfo) bool {
+	return IsPointer(typeInfo) && typeInfo.(*PointerInfo).Referenced.GetTypeId() == TypeFunc
+}
+
+// IsVaListPointer returns true for the type a va_list decays to
+func IsVaListPointer(typeInfo TypeInfo) bool {
+	return IsPointer(typeInfo) && typeInfo.(*PointerInfo).Referenced.GetTypeId() == TypeVaList
+}
+
+func isVoidPointer(typeInfo TypeInfo) bool {
+	return IsPointer(typeInfo) && typeInfo.(*PointerInfo).Referenced.GetTypeId() == TypeVoid
+}
+
+// ParseTypeName parses a type name in C notation like "void *".
+// Anonymous enumerations are given as "enum <anonymous>", anonymous
+// structures and unions likewise. Structures and unions are referenced
+// by tag only, i.e. the resulting types are incomplete.
+func ParseTypeName(text string) (TypeInfo, error) {
+	return parseTypeName(text, make(map[string]*StructInfo))
+}
+
+// parseTypeName parses a type name. Structures and unions are looked up
+// in structTags. Unknown tags are added as incomplete types.
+func parseTypeName(text string, structTags map[string]*StructInfo) (TypeInfo, error) {
+	const anonymousTag = "__anonymous"
+	const anonymousUnionTag = "__anonymous_union"
+	text = strings.ReplaceAll(text, anonymousEnum, "enum "+anonymousTag)
+	text = strings.ReplaceAll(text, anonymousStruct, "struct "+anonymousTag)
+	text = strings.ReplaceAll(text, anonymousUnion, "union "+anonymousUnionTag)
+	tokens, err := Tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	parser := NewParser(tokens)
+	parser.currentScope().enumTags[anonymousTag] = &EnumInfo{}
+	// anonymous structures and unions cannot be referenced again
+	structTags[anonymousTag] = &StructInfo{}
+	structTags[anonymousUnionTag] = &StructInfo{IsUnion: true}
+	defer delete(structTags, anonymousTag)
+	defer delete(structTags, anonymousUnionTag)
+	parser.currentScope().structTags = structTags
+	typeInfo, err := parser.parseTypeName()
+	if err != nil {
+		return nil, err
+	}
+	if !parser.endOfInput() {
+		return nil, errors.New(fmt.Sprintf("invalid type name '%s'", text))
+	}
+	return typeInfo, nil
 }
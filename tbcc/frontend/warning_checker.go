@@ -0,0 +1,461 @@
+package frontend
+
+import (
+	"fmt"
+)
+
+type declInfo struct {
+	name    string
+	isParam bool
+	used    bool
+	pos     Position
+}
+
+type warningChecker struct {
+	scopes    []map[string]*declInfo
+	functions map[string]bool
+	warnings  []Warning
+}
+
+func newWarningChecker() *warningChecker {
+	return &warningChecker{}
+}
+
+func (wc *warningChecker) check(program *Program) []Warning {
+	wc.scopes = nil
+	wc.functions = make(map[string]bool)
+	wc.warnings = make([]Warning, 0)
+	program.Accept(wc)
+	return wc.warnings
+}
+
+func (wc *warningChecker) warn(category string, pos Position, message string) {
+	wc.warnings = append(wc.warnings, Warning{category, message, pos})
+}
+
+func (wc *warningChecker) pushScope() {
+	wc.scopes = append(wc.scopes, make(map[string]*declInfo))
+}
+
+func (wc *warningChecker) popScope() {
+	scope := wc.scopes[len(wc.scopes)-1]
+	wc.scopes = wc.scopes[:len(wc.scopes)-1]
+	for _, decl := range scope {
+		if decl.used {
+			continue
+		}
+		if decl.isParam {
+			wc.warn(WarnUnusedParameter, decl.pos, fmt.Sprintf("unused parameter '%s'", decl.name))
+		} else {
+			wc.warn(WarnUnusedVariable, decl.pos, fmt.Sprintf("unused variable '%s'", decl.name))
+		}
+	}
+}
+
+func (wc *warningChecker) declare(name string, isParam bool, pos Position) {
+	wc.scopes[len(wc.scopes)-1][name] = &declInfo{name, isParam, false, pos}
+}
+
+func (wc *warningChecker) lookup(name string) *declInfo {
+	for i := len(wc.scopes) - 1; i >= 0; i-- {
+		if decl, ok := wc.scopes[i][name]; ok {
+			return decl
+		}
+	}
+	return nil
+}
+
+func (wc *warningChecker) checkCondition(condition Expression) {
+	if condition == nil || condition.GetType() != AstBinary {
+		return
+	}
+	binary := condition.(*BinaryExpression)
+	if binary.Operator == BinOpAssign {
+		wc.warn(WarnParentheses, binary.Pos, "assignment used as condition")
+	}
+}
+
+func (wc *warningChecker) VisitProgram(p *Program) {
+	for _, fun := range p.Functions {
+		fun.Accept(wc)
+	}
+}
+
+func (wc *warningChecker) VisitFunction(f *Function) {
+	wc.functions[f.Name] = true
+
+	if f.Body == nil {
+		return
+	}
+
+	wc.pushScope()
+	for _, param := range f.Params {
+		wc.declare(param.Name, true, param.Pos)
+	}
+	f.Body.Accept(wc)
+	wc.popScope()
+
+	lc := newLabelChecker()
+	f.Body.Accept(lc)
+	for _, label := range lc.unusedLabels() {
+		wc.warn(WarnUnusedLabel, label.Pos, fmt.Sprintf("label '%s' defined but not used", label.Name))
+	}
+	wc.warnings = append(wc.warnings, lc.warnings...)
+
+	if f.Name != "main" && f.ReturnType.GetTypeId() != TypeVoid && canComplete(f.Body) {
+		wc.warn(WarnReturnType, f.Pos, fmt.Sprintf("control reaches end of non-void function '%s'", f.Name))
+	}
+}
+
+func (wc *warningChecker) VisitVarDecl(v *VarDecl) {
+	if v.InitValue != nil {
+		v.InitValue.Accept(wc)
+	}
+	wc.declare(v.Name, false, v.Pos)
+	if v.StorageClass == StorageExtern {
+		// the variable is defined elsewhere
+		wc.lookup(v.Name).used = true
+	}
+}
+
+func (wc *warningChecker) VisitEnumDecl(*EnumDecl) {}
+
+func (wc *warningChecker) VisitStructDecl(*StructDecl) {}
+
+func (wc *warningChecker) VisitTypedefDecl(*TypedefDecl) {}
+
+func (wc *warningChecker) VisitReturn(r *ReturnStmt) {
+	if r.Expression != nil {
+		r.Expression.Accept(wc)
+	}
+}
+
+func (wc *warningChecker) VisitExprStmt(e *ExpressionStmt) {
+	e.Expression.Accept(wc)
+}
+
+func (wc *warningChecker) VisitIfStmt(i *IfStmt) {
+	wc.checkCondition(i.Condition)
+	i.Condition.Accept(wc)
+	i.Consequent.Accept(wc)
+	if i.Alternate != nil {
+		i.Alternate.Accept(wc)
+	}
+}
+
+func (wc *warningChecker) VisitBlockStmt(b *BlockStmt) {
+	wc.pushScope()
+
+	afterJump := false
+	for _, item := range b.Items {
+		switch item.GetType() {
+		case AstLabelStmt, AstCaseStmt:
+			afterJump = false
+		case AstNullStmt, AstFunction, AstEnumDecl, AstStructDecl, AstTypedefDecl:
+		case AstVarDecl:
+			varDecl := item.(*VarDecl)
+			if afterJump && varDecl.InitValue != nil && varDecl.StorageClass == StorageNone {
+				wc.warn(WarnUnreachableCode, varDecl.Pos, "statement is unreachable")
+				afterJump = false
+			}
+		default:
+			if afterJump {
+				wc.warn(WarnUnreachableCode, statementPos(item), "statement is unreachable")
+				afterJump = false
+			}
+		}
+
+		item.Accept(wc)
+
+		switch item.GetType() {
+		case AstReturn, AstBreakStmt, AstContinueStmt, AstGotoStmt:
+			afterJump = true
+		default:
+		}
+	}
+
+	wc.popScope()
+}
+
+func (wc *warningChecker) VisitGotoStmt(*GotoStmt) {}
+
+func (wc *warningChecker) VisitLabelStmt(*LabelStmt) {}
+
+func (wc *warningChecker) VisitDoWhileStmt(d *DoWhileStmt) {
+	d.Body.Accept(wc)
+	wc.checkCondition(d.Condition)
+	d.Condition.Accept(wc)
+}
+
+func (wc *warningChecker) VisitWhileStmt(w *WhileStmt) {
+	wc.checkCondition(w.Condition)
+	w.Condition.Accept(wc)
+	w.Body.Accept(wc)
+}
+
+func (wc *warningChecker) VisitForStmt(f *ForStmt) {
+	wc.pushScope()
+	f.InitStmt.Accept(wc)
+	if f.Condition != nil {
+		wc.checkCondition(f.Condition)
+		f.Condition.Accept(wc)
+	}
+	if f.Post != nil {
+		f.Post.Accept(wc)
+	}
+	f.Body.Accept(wc)
+	wc.popScope()
+}
+
+func (wc *warningChecker) VisitBreakStmt(*BreakStmt) {}
+
+func (wc *warningChecker) VisitContinueStmt(*ContinueStmt) {}
+
+func (wc *warningChecker) VisitSwitchStmt(s *SwitchStmt) {
+	s.Expr.Accept(wc)
+	s.Body.Accept(wc)
+}
+
+func (wc *warningChecker) VisitCaseStmt(*CaseStmt) {}
+
+func (wc *warningChecker) VisitNullStmt(*NullStmt) {}
+
+func (wc *warningChecker) VisitInteger(*IntegerLiteral) {}
+
+func (wc *warningChecker) VisitVariable(v *Variable) {
+	if decl := wc.lookup(v.Name); decl != nil {
+		decl.used = true
+	}
+}
+
+func (wc *warningChecker) VisitFunctionCall(f *FunctionCall) {
+	if callee, ok := f.Callee.(*Variable); ok &&
+		!wc.functions[callee.Name] && wc.lookup(callee.Name) == nil {
+		wc.warn(WarnImplicitFunctionDeclaration, f.Pos,
+			fmt.Sprintf("implicit declaration of function '%s'", callee.Name))
+		wc.functions[callee.Name] = true
+	}
+	f.Callee.Accept(wc)
+	for _, arg := range f.Args {
+		arg.Accept(wc)
+	}
+}
+
+func (wc *warningChecker) VisitUnary(u *UnaryExpression) {
+	u.Right.Accept(wc)
+}
+
+func (wc *warningChecker) VisitPrefixIncDec(p *PrefixIncDec) {
+	p.Operand.Accept(wc)
+}
+
+func (wc *warningChecker) VisitPostfixIncDec(p *PostfixIncDec) {
+	p.Operand.Accept(wc)
+}
+
+func (wc *warningChecker) VisitCompoundAssignment(c *CompoundAssignment) {
+	c.Left.Accept(wc)
+	c.Right.Accept(wc)
+}
+
+func (wc *warningChecker) VisitBinary(b *BinaryExpression) {
+	if b.Operator != BinOpAssign {
+		b.Left.Accept(wc)
+		b.Right.Accept(wc)
+		return
+	}
+
+	// Assigning a variable does not count as using it
+	if b.Left.GetType() != AstVariable {
+		b.Left.Accept(wc)
+	}
+	if left, ok := b.Left.(*Variable); ok {
+		if right, ok := b.Right.(*Variable); ok && left.Name == right.Name {
+			wc.warn(WarnSelfAssign, b.Pos, fmt.Sprintf("variable '%s' is assigned to itself", left.Name))
+		}
+	}
+	b.Right.Accept(wc)
+}
+
+func (wc *warningChecker) VisitConditional(c *Conditional) {
+	wc.checkCondition(c.Condition)
+	c.Condition.Accept(wc)
+	c.Consequent.Accept(wc)
+	c.Alternate.Accept(wc)
+}
+
+func (wc *warningChecker) VisitAddressOf(a *AddressOf) {
+	a.Operand.Accept(wc)
+}
+
+func (wc *warningChecker) VisitDereference(d *Dereference) {
+	d.Operand.Accept(wc)
+}
+
+func (wc *warningChecker) VisitMemberAccess(m *MemberAccess) {
+	m.Object.Accept(wc)
+}
+
+func (wc *warningChecker) VisitCast(c *Cast) {
+	c.Operand.Accept(wc)
+}
+
+func (wc *warningChecker) VisitSizeOfType(*SizeOfType) {}
+
+func (wc *warningChecker) VisitSizeOfExpr(s *SizeOfExpr) {
+	s.Operand.Accept(wc)
+}
+
+func (wc *warningChecker) VisitVaStart(v *VaStart) {
+	v.VaList.Accept(wc)
+	v.LastParam.Accept(wc)
+}
+
+func (wc *warningChecker) VisitVaArg(v *VaArg) {
+	v.VaList.Accept(wc)
+}
+
+func (wc *warningChecker) VisitVaEnd(v *VaEnd) {
+	v.VaList.Accept(wc)
+}
+
+func statementPos(stmt AST) Position {
+	switch stmt.GetType() {
+	case AstReturn:
+		return stmt.(*ReturnStmt).Pos
+	case AstExprStmt:
+		return stmt.(*ExpressionStmt).Pos
+	case AstIfStmt:
+		return stmt.(*IfStmt).Pos
+	case AstBlockStmt:
+		return stmt.(*BlockStmt).Pos
+	case AstGotoStmt:
+		return stmt.(*GotoStmt).Pos
+	case AstDoWhileStmt:
+		return stmt.(*DoWhileStmt).Pos
+	case AstWhileStmt:
+		return stmt.(*WhileStmt).Pos
+	case AstForStmt:
+		return stmt.(*ForStmt).Pos
+	case AstBreakStmt:
+		return stmt.(*BreakStmt).Pos
+	case AstContinueStmt:
+		return stmt.(*ContinueStmt).Pos
+	case AstSwitchStmt:
+		return stmt.(*SwitchStmt).Pos
+	default:
+		return Position{}
+	}
+}
+
+// canComplete tells if the execution of the statement can continue
+// with the statement that follows it
+func canComplete(stmt Statement) bool {
+	switch stmt.GetType() {
+	case AstReturn, AstGotoStmt, AstBreakStmt, AstContinueStmt:
+		return false
+	case AstBlockStmt:
+		reachable := true
+		for _, item := range stmt.(*BlockStmt).Items {
+			switch item.GetType() {
+			case AstLabelStmt, AstCaseStmt:
+				reachable = true
+			default:
+				if reachable {
+					reachable = canComplete(item)
+				}
+			}
+		}
+		return reachable
+	case AstIfStmt:
+		ifStmt := stmt.(*IfStmt)
+		return ifStmt.Alternate == nil || canComplete(ifStmt.Consequent) || canComplete(ifStmt.Alternate)
+	case AstWhileStmt:
+		while := stmt.(*WhileStmt)
+		return !isTrue(while.Condition) || containsJump(while.Body, AstBreakStmt, while.Label)
+	case AstDoWhileStmt:
+		doWhile := stmt.(*DoWhileStmt)
+		if containsJump(doWhile.Body, AstBreakStmt, doWhile.Label) {
+			return true
+		}
+		return !isTrue(doWhile.Condition) &&
+			(canComplete(doWhile.Body) || containsJump(doWhile.Body, AstContinueStmt, doWhile.Label))
+	case AstForStmt:
+		forStmt := stmt.(*ForStmt)
+		return (forStmt.Condition != nil && !isTrue(forStmt.Condition)) ||
+			containsJump(forStmt.Body, AstBreakStmt, forStmt.Label)
+	case AstSwitchStmt:
+		switchStmt := stmt.(*SwitchStmt)
+		return !hasDefaultCase(switchStmt.Body) || canComplete(switchStmt.Body) ||
+			containsJump(switchStmt.Body, AstBreakStmt, switchStmt.Label)
+	default:
+		return true
+	}
+}
+
+func isTrue(expr Expression) bool {
+	literal, ok := expr.(*IntegerLiteral)
+	return ok && literal.Value != 0
+}
+
+// containsJump tells if stmt contains a break or continue statement
+// (jumpType) that refers to the loop or switch with the given label
+func containsJump(stmt AST, jumpType AstType, label string) bool {
+	found := false
+	walkStatements(stmt, func(s AST) bool {
+		switch {
+		case s.GetType() == AstBreakStmt && jumpType == AstBreakStmt:
+			found = found || s.(*BreakStmt).Label == label
+		case s.GetType() == AstContinueStmt && jumpType == AstContinueStmt:
+			found = found || s.(*ContinueStmt).Label == label
+		}
+		return true
+	})
+	return found
+}
+
+func hasDefaultCase(body Statement) bool {
+	found := false
+	walkStatements(body, func(s AST) bool {
+		if s.GetType() == AstSwitchStmt {
+			// cases of nested switches do not count
+			return false
+		}
+		if s.GetType() == AstCaseStmt && s.(*CaseStmt).Value == nil {
+			found = true
+		}
+		return true
+	})
+	return found
+}
+
+// walkStatements calls visit for stmt and all statements nested in it.
+// The children of a statement are skipped if visit returns false.
+func walkStatements(stmt AST, visit func(AST) bool) {
+	if stmt == nil {
+		return
+	}
+	if !visit(stmt) {
+		return
+	}
+	switch stmt.GetType() {
+	case AstBlockStmt:
+		for _, item := range stmt.(*BlockStmt).Items {
+			walkStatements(item, visit)
+		}
+	case AstIfStmt:
+		walkStatements(stmt.(*IfStmt).Consequent, visit)
+		if alternate := stmt.(*IfStmt).Alternate; alternate != nil {
+			walkStatements(alternate, visit)
+		}
+	case AstWhileStmt:
+		walkStatements(stmt.(*WhileStmt).Body, visit)
+	case AstDoWhileStmt:
+		walkStatements(stmt.(*DoWhileStmt).Body, visit)
+	case AstForStmt:
+		walkStatements(stmt.(*ForStmt).Body, visit)
+	case AstSwitchStmt:
+		walkStatements(stmt.(*SwitchStmt).Body, visit)
+	default:
+	}
+}
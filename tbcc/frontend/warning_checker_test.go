@@ -0,0 +1,156 @@
+package frontend
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckWarnings(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want []string
+	}{
+		{
+			"no warnings",
+			`int main(void) { int a = 1; return a; }`,
+			nil,
+		},
+		{
+			"unused variable",
+			`int main(void) { int a; int b = 2; a = 1; return b; }`,
+			[]string{WarnUnusedVariable},
+		},
+		{
+			"unused parameter",
+			`int f(int a, int b) { return a; } int main(void) { return f(1, 2); }`,
+			[]string{WarnUnusedParameter},
+		},
+		{
+			"unused label",
+			`int main(void) { goto used; unused: ; used: return 0; }`,
+			[]string{WarnUnusedLabel},
+		},
+		{
+			"implicit function declaration",
+			`int main(void) { return foo(1) + foo(2); }`,
+			[]string{WarnImplicitFunctionDeclaration},
+		},
+		{
+			"implicit function declaration without prototype",
+			`int main(void) { return foo(1) + foo(2, 3) + foo(); }`,
+			[]string{WarnImplicitFunctionDeclaration},
+		},
+		{
+			"implicit function declaration completed by a prototype",
+			`int main(void) { return foo(1); } int foo(int a) { return a; } int g(void) { return foo(2); }`,
+			[]string{WarnImplicitFunctionDeclaration},
+		},
+		{
+			"missing return",
+			`int f(int a) { if (a) return 1; } int main(void) { return f(1); }`,
+			[]string{WarnReturnType},
+		},
+		{
+			"no missing return after infinite loop or exhaustive if",
+			`int f(int a) { while (1) { a++; } }
+			int g(int a) { if (a) return 1; else return 2; }
+			int h(int a) { for (;;) { if (a) break; } return a; }
+			int main(void) { return g(1); }`,
+			nil,
+		},
+		{
+			"missing return after loop with break",
+			`int f(int a) { while (1) { if (a) break; } } int main(void) { return f(1); }`,
+			[]string{WarnReturnType},
+		},
+		{
+			"unreachable statement",
+			`int main(void) { int a = 1; while (a) { break; a = 2; } return a; a = 3; }`,
+			[]string{WarnUnreachableCode, WarnUnreachableCode},
+		},
+		{
+			"no unreachable statement after case",
+			`int main(void) { int a = 1; switch (a) { case 1: return 1; case 2: a = 2; } return a; }`,
+			nil,
+		},
+		{
+			"assignment as condition",
+			`int main(void) { int a = 1; int b = 2; if (a = b) return a; return a ? (b = 0) : 1; }`,
+			[]string{WarnParentheses},
+		},
+		{
+			"no warning for compound assignment as condition",
+			`int main(void) { int a = 1; while (a -= 1) a++; return a; }`,
+			nil,
+		},
+		{
+			"self assignment",
+			`int main(void) { int a = 1; a = a; a += a; return a; }`,
+			[]string{WarnSelfAssign},
+		},
+		{
+			"switch over enum with unhandled values",
+			`enum color { RED, GREEN, BLUE };
+			int f(enum color c) { switch (c) { case RED: return 1; case 1: return 2; } return 0; }
+			int g(enum color c) { switch (c) { case RED: return 1; default: return 0; } }
+			int h(int c) { switch (c) { case RED: return 1; } return 0; }
+			int main(void) { return f(BLUE) + g(RED) + h(0); }`,
+			[]string{WarnSwitch},
+		},
+	}
+
+	options := NewWarningOptions()
+	_ = options.Set("all")
+	_ = options.Set("extra")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := Tokenize(tt.code)
+			if err != nil {
+				t.Fatalf("Tokenize() error = %v", err)
+			}
+			program, err := NewParser(tokens).ParseProgram()
+			if err != nil {
+				t.Fatalf("ParseProgram() error = %v", err)
+			}
+			err = LabelLoops(program, NewNameCreator())
+			if err != nil {
+				t.Fatalf("LabelLoops() error = %v", err)
+			}
+			err = CheckTypes(program, NewEnvironment(nil))
+			if err != nil {
+				t.Fatalf("CheckTypes() error = %v", err)
+			}
+
+			var got []string
+			for _, warning := range CheckWarnings(program, options) {
+				got = append(got, warning.Category)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CheckWarnings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWarningOptions_Set(t *testing.T) {
+	options := NewWarningOptions()
+	if options.IsEnabled(WarnUnusedVariable) || !options.IsEnabled(WarnReturnType) {
+		t.Errorf("unexpected default warnings")
+	}
+
+	for _, option := range []string{"all", "no-unused-variable", "unused-parameter", "error"} {
+		if err := options.Set(option); err != nil {
+			t.Errorf("Set(%s) error = %v", option, err)
+		}
+	}
+	if options.IsEnabled(WarnUnusedVariable) || !options.IsEnabled(WarnUnusedLabel) ||
+		!options.IsEnabled(WarnUnusedParameter) || !options.AsErrors {
+		t.Errorf("options not applied correctly")
+	}
+
+	if err := options.Set("no-such-warning"); err == nil {
+		t.Errorf("Set() expected error for unknown warning")
+	}
+}
@@ -0,0 +1,134 @@
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	WarnUnusedVariable              = "unused-variable"
+	WarnUnusedParameter             = "unused-parameter"
+	WarnUnusedLabel                 = "unused-label"
+	WarnImplicitFunctionDeclaration = "implicit-function-declaration"
+	WarnReturnType                  = "return-type"
+	WarnUnreachableCode             = "unreachable-code"
+	WarnParentheses                 = "parentheses"
+	WarnSelfAssign                  = "self-assign"
+	WarnSwitch                      = "switch"
+)
+
+var warningCategories = []string{
+	WarnUnusedVariable,
+	WarnUnusedParameter,
+	WarnUnusedLabel,
+	WarnImplicitFunctionDeclaration,
+	WarnReturnType,
+	WarnUnreachableCode,
+	WarnParentheses,
+	WarnSelfAssign,
+	WarnSwitch,
+}
+
+// warningGroups can be used like categories to switch
+// several warnings on or off at once
+var warningGroups = map[string][]string{
+	"all": {
+		WarnUnusedVariable,
+		WarnUnusedLabel,
+		WarnImplicitFunctionDeclaration,
+		WarnReturnType,
+		WarnUnreachableCode,
+		WarnParentheses,
+		WarnSelfAssign,
+		WarnSwitch,
+	},
+	"extra":  {WarnUnusedParameter},
+	"unused": {WarnUnusedVariable, WarnUnusedParameter, WarnUnusedLabel},
+}
+
+var defaultWarnings = []string{
+	WarnImplicitFunctionDeclaration,
+	WarnReturnType,
+}
+
+type Warning struct {
+	Category string
+	Message  string
+	Pos      Position
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("%d:%d: warning: %s [-W%s]", w.Pos.Line, w.Pos.Col, w.Message, w.Category)
+}
+
+type WarningOptions struct {
+	enabled map[string]bool
+	// AsErrors makes the compilation fail if any warning is reported
+	AsErrors bool
+}
+
+func NewWarningOptions() *WarningOptions {
+	options := &WarningOptions{enabled: make(map[string]bool)}
+	for _, category := range defaultWarnings {
+		options.enabled[category] = true
+	}
+	return options
+}
+
+// Set applies a warning option given without the leading "-W",
+// e.g. "all", "no-unused-variable" or "error"
+func (wo *WarningOptions) Set(option string) error {
+	switch option {
+	case "error":
+		wo.AsErrors = true
+		return nil
+	case "no-error":
+		wo.AsErrors = false
+		return nil
+	}
+
+	name, enable := option, true
+	if strings.HasPrefix(option, "no-") {
+		name, enable = option[3:], false
+	}
+
+	categories, isGroup := warningGroups[name]
+	if !isGroup {
+		if !slices.Contains(warningCategories, name) {
+			return errors.New(fmt.Sprintf("unknown warning option '-W%s'", option))
+		}
+		categories = []string{name}
+	}
+	for _, category := range categories {
+		wo.enabled[category] = enable
+	}
+	return nil
+}
+
+func (wo *WarningOptions) IsEnabled(category string) bool {
+	return wo.enabled[category]
+}
+
+// CheckWarnings runs the warning checks that are enabled in options.
+// It must be called after the type check and before the identifiers
+// are resolved so that the messages refer to the names of the source.
+func CheckWarnings(program *Program, options *WarningOptions) []Warning {
+	warnings := newWarningChecker().check(program)
+
+	var ret []Warning
+	for _, warning := range warnings {
+		if options.IsEnabled(warning.Category) {
+			ret = append(ret, warning)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Pos.Line != ret[j].Pos.Line {
+			return ret[i].Pos.Line < ret[j].Pos.Line
+		}
+		return ret[i].Pos.Col < ret[j].Pos.Col
+	})
+	return ret
+}
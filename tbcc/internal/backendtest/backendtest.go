@@ -0,0 +1,109 @@
+// Package backendtest holds the helpers the tests of the backends share
+package backendtest
+
+import (
+	"bytes"
+	"errors"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/tacky"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// ExecuteCode is the program run by the execution tests of the
+// backends. Its main function returns ExecuteStatus.
+const ExecuteCode = `
+	struct pair {
+		int first;
+		int second;
+	};
+
+	int sum(int a, int b, int c, int d, int e, int f, int g, int h, int i, int j) {
+		return a / b + c % d + j;
+	}
+
+	int before(int *p, int *q) {
+		return p < q;
+	}
+
+	int main(void) {
+		struct pair s;
+		int i = 0;
+		while (i < 10)
+			i++;
+		if (&s.second > &s.first)
+			i = i + 2;
+		return sum(1, 2, 3, 4, 5, 6, 7, 8, 9, i) + before(&s.first, &s.second) + (i == 12);
+	}`
+
+const ExecuteStatus = 17
+
+// FrontEnd translates the code to TACKY. It returns the environment of
+// the semantic analysis for the code generators.
+func FrontEnd(t *testing.T, code string) (*tacky.Program, *frontend.Environment) {
+	t.Helper()
+	tokens, err := frontend.Tokenize(code)
+	if err != nil {
+		t.Fatalf("Tokenize() error = %v", err)
+	}
+	ast, err := frontend.NewParser(tokens).ParseProgram()
+	if err != nil {
+		t.Fatalf("ParseProgram() error = %v", err)
+	}
+	nameCreator := frontend.NewNameCreator()
+	ast, env, err := frontend.AnalyzeSemantics(ast, nameCreator)
+	if err != nil {
+		t.Fatalf("AnalyzeSemantics() error = %v", err)
+	}
+	return tacky.NewTranslator(nameCreator).Translate(ast), env
+}
+
+// RequireTools skips the test if one of the tools is not installed
+func RequireTools(t *testing.T, tools ...string) {
+	t.Helper()
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found", tool)
+		}
+	}
+}
+
+// WriteFile writes the content to a file of a temporary directory of
+// the test and returns its path
+func WriteFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Run runs the command and returns its standard output. The test fails
+// if the command does.
+func Run(t *testing.T, command ...string) []byte {
+	t.Helper()
+	var stderr bytes.Buffer
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", command[0], err, stderr.String())
+	}
+	return output
+}
+
+// ExitStatus runs the program and returns its exit status
+func ExitStatus(t *testing.T, command ...string) int {
+	t.Helper()
+	err := exec.Command(command[0], command[1:]...).Run()
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		return exitError.ExitCode()
+	} else if err != nil {
+		t.Fatalf("%s: %v", command[0], err)
+	}
+	return 0
+}
@@ -0,0 +1,264 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PassAll can be used in the print options to select every pass
+const PassAll = "all"
+
+type Pass struct {
+	Name        string
+	Description string
+	// Input is the representation the pass reads. It is printed for
+	// --print-before (nothing for the source code).
+	Input IrKind
+	// Output is the representation the pass creates or modifies.
+	// It is printed for --print-after.
+	Output IrKind
+	// Required passes cannot be disabled since later passes
+	// depend on their results
+	Required bool
+	Run      func(unit *Unit) error
+	// Verify checks the unit after the pass has run (optional)
+	Verify func(unit *Unit) error
+}
+
+type Options struct {
+	PrintBefore  []string
+	PrintAfter   []string
+	DisabledPass []string
+	TimePasses   bool
+	// Verify runs the IR verifiers of the passes that provide one
+	Verify bool
+	// VerifyEach checks the unit after every pass
+	VerifyEach bool
+	// StopAfter names the last pass to be run (empty: run all passes)
+	StopAfter string
+	// Target selects the backend passes of NewDefaultManager
+	Target Target
+	// Out receives the IR dumps (default: os.Stdout)
+	Out io.Writer
+	// TimingOut receives the timing report (default: os.Stderr)
+	TimingOut io.Writer
+}
+
+type PassTiming struct {
+	Pass       string
+	WallTime   time.Duration
+	Allocs     uint64
+	AllocBytes uint64
+}
+
+type Manager struct {
+	passes  []Pass
+	options Options
+	timings []PassTiming
+}
+
+func NewManager(options Options) *Manager {
+	if options.Out == nil {
+		options.Out = os.Stdout
+	}
+	if options.TimingOut == nil {
+		options.TimingOut = os.Stderr
+	}
+	return &Manager{
+		passes:  make([]Pass, 0),
+		options: options,
+		timings: make([]PassTiming, 0),
+	}
+}
+
+func (m *Manager) Register(pass Pass) {
+	m.passes = append(m.passes, pass)
+}
+
+func (m *Manager) Passes() []Pass {
+	return m.passes
+}
+
+func (m *Manager) Timings() []PassTiming {
+	return m.timings
+}
+
+func (m *Manager) findPass(name string) *Pass {
+	for i := range m.passes {
+		if m.passes[i].Name == name {
+			return &m.passes[i]
+		}
+	}
+	return nil
+}
+
+func (m *Manager) passNames() []string {
+	var names []string
+	for _, pass := range m.passes {
+		names = append(names, pass.Name)
+	}
+	return names
+}
+
+// Validate checks that all pass names given in the options are known
+func (m *Manager) Validate() error {
+	var names []string
+	names = append(names, m.options.PrintBefore...)
+	names = append(names, m.options.PrintAfter...)
+	for _, name := range names {
+		if name != PassAll && m.findPass(name) == nil {
+			return m.unknownPassError(name)
+		}
+	}
+	for _, name := range m.options.DisabledPass {
+		pass := m.findPass(name)
+		if pass == nil {
+			return m.unknownPassError(name)
+		}
+		if pass.Required {
+			return errors.New(fmt.Sprintf("pass '%s' is required and cannot be disabled", name))
+		}
+	}
+	if m.options.StopAfter != "" && m.findPass(m.options.StopAfter) == nil {
+		return m.unknownPassError(m.options.StopAfter)
+	}
+	return nil
+}
+
+func (m *Manager) unknownPassError(name string) error {
+	return errors.New(fmt.Sprintf("unknown pass '%s' (known passes: %s)",
+		name, strings.Join(m.passNames(), ", ")))
+}
+
+func (m *Manager) Run(unit *Unit) error {
+	return m.RunContext(context.Background(), unit)
+}
+
+// RunContext runs the passes like Run but stops before the next pass
+// once ctx is done
+func (m *Manager) RunContext(ctx context.Context, unit *Unit) error {
+	err := m.Validate()
+	if err != nil {
+		return err
+	}
+
+	m.timings = make([]PassTiming, 0)
+	if m.options.TimePasses {
+		defer m.printTimings()
+	}
+
+	for _, pass := range m.passes {
+		if slices.Contains(m.options.DisabledPass, pass.Name) {
+			if pass.Name == m.options.StopAfter {
+				break
+			}
+			continue
+		}
+
+		err = ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		if m.selected(m.options.PrintBefore, pass.Name) {
+			m.printIr("before", pass, pass.Input, unit)
+		}
+
+		err = m.runPass(pass, unit)
+		if err != nil {
+			return err
+		}
+
+		if m.selected(m.options.PrintAfter, pass.Name) {
+			m.printIr("after", pass, pass.Output, unit)
+		}
+
+		if m.options.VerifyEach || (m.options.Verify && pass.Verify != nil) {
+			err = m.verify(pass, unit)
+			if err != nil {
+				return err
+			}
+		}
+
+		if pass.Name == m.options.StopAfter {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) runPass(pass Pass, unit *Unit) error {
+	if !m.options.TimePasses {
+		return pass.Run(unit)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	err := pass.Run(unit)
+
+	wallTime := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	m.timings = append(m.timings, PassTiming{
+		Pass:       pass.Name,
+		WallTime:   wallTime,
+		Allocs:     after.Mallocs - before.Mallocs,
+		AllocBytes: after.TotalAlloc - before.TotalAlloc,
+	})
+
+	return err
+}
+
+func (m *Manager) verify(pass Pass, unit *Unit) error {
+	if !unit.hasIr(pass.Output) {
+		return errors.New(fmt.Sprintf("verification after pass '%s' failed: no %s created",
+			pass.Name, pass.Output))
+	}
+	if pass.Verify == nil {
+		return nil
+	}
+	err := pass.Verify(unit)
+	if err != nil {
+		return errors.New(fmt.Sprintf("verification after pass '%s' failed: %v", pass.Name, err))
+	}
+	return nil
+}
+
+func (m *Manager) selected(names []string, passName string) bool {
+	return slices.Contains(names, PassAll) || slices.Contains(names, passName)
+}
+
+func (m *Manager) printIr(when string, pass Pass, kind IrKind, unit *Unit) {
+	out := m.options.Out
+	_, _ = fmt.Fprintf(out, "*** IR dump %s %s (%s) ***\n", when, pass.Name, kind)
+	unit.Print(kind, out)
+}
+
+func (m *Manager) printTimings() {
+	out := m.options.TimingOut
+	var totalTime time.Duration
+	var totalAllocs, totalBytes uint64
+
+	_, _ = fmt.Fprintln(out, "===-------------------------------------------------------------===")
+	_, _ = fmt.Fprintln(out, "                   Pass execution timing report")
+	_, _ = fmt.Fprintln(out, "===-------------------------------------------------------------===")
+	_, _ = fmt.Fprintf(out, "%14s %10s %12s  %s\n", "Wall time", "Allocs", "Bytes", "Pass")
+	for _, timing := range m.timings {
+		_, _ = fmt.Fprintf(out, "%14s %10d %12d  %s\n",
+			timing.WallTime, timing.Allocs, timing.AllocBytes, timing.Pass)
+		totalTime += timing.WallTime
+		totalAllocs += timing.Allocs
+		totalBytes += timing.AllocBytes
+	}
+	_, _ = fmt.Fprintf(out, "%14s %10d %12d  %s\n", totalTime, totalAllocs, totalBytes, "Total")
+}
@@ -0,0 +1,352 @@
+package pipeline
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testCode = `
+int add(int a, int b) {
+	return a + b;
+}
+
+int main(void) {
+	return add(40, 2);
+}`
+
+func TestManager_Run(t *testing.T) {
+	unit := NewUnit(testCode)
+	err := NewDefaultManager(Options{}).Run(unit)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !strings.Contains(unit.Assembly, "call add") {
+		t.Errorf("Run() assembly does not contain call of add:\n%s", unit.Assembly)
+	}
+}
+
+func TestManager_RunStopAfter(t *testing.T) {
+	unit := NewUnit(testCode)
+	err := NewDefaultManager(Options{StopAfter: PassTackyGen}).Run(unit)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if unit.Tacky == nil {
+		t.Errorf("Run() did not create TACKY")
+	}
+	if unit.Asm != nil {
+		t.Errorf("Run() did not stop after %s", PassTackyGen)
+	}
+}
+
+func TestManager_RunPrintAfter(t *testing.T) {
+	var out bytes.Buffer
+	unit := NewUnit(testCode)
+	err := NewDefaultManager(Options{
+		PrintBefore: []string{PassInstructionFixup},
+		PrintAfter:  []string{PassTackyGen},
+		Out:         &out,
+	}).Run(unit)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	dump := out.String()
+	for _, expected := range []string{
+		"IR dump after tacky-gen (tacky)",
+		"IR dump before instruction-fixup (asm)",
+	} {
+		if !strings.Contains(dump, expected) {
+			t.Errorf("output does not contain %q", expected)
+		}
+	}
+}
+
+func TestManager_RunPrintBefore(t *testing.T) {
+	var out bytes.Buffer
+	err := NewDefaultManager(Options{
+		PrintBefore: []string{PassTackyGen, PassInstructionSelection, PassCodeEmission},
+		Out:         &out,
+	}).Run(NewUnit(testCode))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	dump := out.String()
+	for _, expected := range []string{
+		"IR dump before tacky-gen (ast)",
+		"IR dump before instruction-selection (tacky)",
+		"IR dump before code-emission (asm)",
+	} {
+		if !strings.Contains(dump, expected) {
+			t.Errorf("output does not contain %q", expected)
+		}
+	}
+	if strings.Contains(dump, "<no ") {
+		t.Errorf("output contains a missing representation:\n%s", dump)
+	}
+}
+
+func TestManager_RunDisablePass(t *testing.T) {
+	code := `int main(void) {
+		goto nowhere;
+		return 0;
+	}`
+
+	err := NewDefaultManager(Options{}).Run(NewUnit(code))
+	if err == nil {
+		t.Errorf("Run() should have returned an error")
+	}
+
+	err = NewDefaultManager(Options{
+		DisabledPass: []string{PassLabelCheck},
+		StopAfter:    PassIdentifierResolution,
+	}).Run(NewUnit(code))
+	if err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+
+	err = NewDefaultManager(Options{DisabledPass: []string{PassParse}}).Run(NewUnit(code))
+	if err == nil {
+		t.Errorf("Run() should not allow to disable a required pass")
+	}
+
+	err = NewDefaultManager(Options{DisabledPass: []string{PassInstructionFixup}}).Run(NewUnit(testCode))
+	if err == nil {
+		t.Errorf("Run() should not allow to disable %s", PassInstructionFixup)
+	}
+
+	unit := NewUnit(code)
+	err = NewDefaultManager(Options{
+		DisabledPass: []string{PassLabelCheck, PassWarnings},
+		StopAfter:    PassWarnings,
+	}).Run(unit)
+	if err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+	if unit.Tacky != nil {
+		t.Errorf("Run() should stop after the disabled pass %s", PassWarnings)
+	}
+}
+
+func TestManager_RunTimePasses(t *testing.T) {
+	var out bytes.Buffer
+	manager := NewDefaultManager(Options{
+		TimePasses: true,
+		VerifyEach: true,
+		TimingOut:  &out,
+	})
+	err := manager.Run(NewUnit(testCode))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(manager.Timings()) != len(manager.Passes()) {
+		t.Errorf("got %d timings, want %d", len(manager.Timings()), len(manager.Passes()))
+	}
+	if !strings.Contains(out.String(), PassCodeEmission) {
+		t.Errorf("timing report does not contain %s", PassCodeEmission)
+	}
+}
+
+func TestManager_RunTarget(t *testing.T) {
+	for name, call := range map[string]string{
+		"aarch64-linux": "bl add",
+		"riscv64-linux": "call add",
+		"wasm32":        "call $add",
+	} {
+		target, err := LookupTarget(name)
+		if err != nil {
+			t.Fatalf("LookupTarget() error = %v", err)
+		}
+		unit := NewUnit(testCode)
+		err = NewDefaultManager(Options{Target: target, VerifyEach: true}).Run(unit)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if !strings.Contains(unit.Assembly, call) {
+			t.Errorf("Run() assembly for %s does not contain call of add:\n%s", name, unit.Assembly)
+		}
+	}
+
+	if _, err := LookupTarget("pdp11-unix"); err == nil {
+		t.Errorf("LookupTarget() should have returned an error")
+	}
+}
+
+func TestTarget_LinkCommand(t *testing.T) {
+	command, err := DefaultTarget().LinkCommand([]string{"main.o", "add.o"}, []string{"-Llib", "-lm"}, "app",
+		OutputExecutable)
+	if err != nil {
+		t.Fatalf("LinkCommand() error = %v", err)
+	}
+	if got := strings.Join(command, " "); got != "gcc main.o add.o -Llib -lm -o app" {
+		t.Errorf("LinkCommand() = %s", got)
+	}
+	command, _ = DefaultTarget().LinkCommand([]string{"add.o"}, nil, "libadd.so", OutputSharedLibrary)
+	if got := strings.Join(command, " "); got != "gcc -shared add.o -o libadd.so" {
+		t.Errorf("LinkCommand() = %s", got)
+	}
+
+	wasm, _ := LookupTarget("wasm32")
+	command, err = wasm.LinkCommand([]string{"main.wasm"}, nil, "app.wasm", OutputExecutable)
+	if command != nil || err != nil {
+		t.Errorf("LinkCommand() = %v, %v; a single module should not be linked", command, err)
+	}
+	if _, err = wasm.LinkCommand([]string{"main.wasm", "add.wasm"}, nil, "app.wasm", OutputExecutable); err == nil {
+		t.Errorf("LinkCommand() should have returned an error")
+	}
+}
+
+func TestManager_RunPointerComparisons(t *testing.T) {
+	code := `
+	int before(int *p, int *q) {
+		return p < q;
+	}
+
+	int after(int *p, int *q) {
+		if (p > q)
+			return 1;
+		return 0;
+	}`
+
+	// pointers are compared as unsigned values, in values and in jumps
+	for _, test := range []struct {
+		target           string
+		unsigned, signed []string
+	}{
+		{"x86_64-linux", []string{"\tsetb ", "\tjbe .L"}, []string{"\tsetl ", "\tjle .L"}},
+		{"aarch64-linux", []string{"\tcset w9, lo\n", "\tb.ls .L"}, []string{"\tcset w9, lt\n", "\tb.le .L"}},
+		{"riscv64-linux", []string{"\tsltu ", "\tbleu "}, []string{"\tslt ", "\tble "}},
+		{"wasm32", []string{"i32.lt_u\n", "i32.le_u\n"}, []string{"i32.lt_s\n", "i32.le_s\n"}},
+		// textual LLVM IR is emitted from TACKY for every target
+		{"llvm", []string{"icmp ult i64 ", "icmp ule i64 "}, []string{"icmp slt i64 ", "icmp sle i64 "}},
+	} {
+		var options Options
+		if test.target == "llvm" {
+			options.StopAfter = PassTackyGen
+		} else {
+			target, err := LookupTarget(test.target)
+			if err != nil {
+				t.Fatalf("LookupTarget() error = %v", err)
+			}
+			options.Target = target
+		}
+		unit := NewUnit(code)
+		if err := NewDefaultManager(options).Run(unit); err != nil {
+			t.Fatalf("Run() for %s error = %v", test.target, err)
+		}
+		output := unit.Assembly
+		if test.target == "llvm" {
+			var out strings.Builder
+			if err := unit.WriteLlvm(&out); err != nil {
+				t.Fatalf("WriteLlvm() error = %v", err)
+			}
+			output = out.String()
+		}
+		for _, want := range test.unsigned {
+			if !strings.Contains(output, want) {
+				t.Errorf("%s: expected %q in generated code:\n%s", test.target, want, output)
+			}
+		}
+		for _, signed := range test.signed {
+			if strings.Contains(output, signed) {
+				t.Errorf("%s: unexpected signed comparison %q in generated code:\n%s", test.target, signed, output)
+			}
+		}
+	}
+}
+
+func TestManager_RunDebugInfo(t *testing.T) {
+	unit := NewUnit(testCode)
+	unit.DebugInfo = true
+	unit.SourceFile = "add.c"
+	unit.Directory = "/src/add"
+	err := NewDefaultManager(Options{VerifyEach: true}).Run(unit)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	for _, expected := range []string{
+		".file 1 \"add.c\"",
+		".loc 1 3 2",
+		".cfi_startproc",
+		".section .debug_info",
+		".string \"add\"",
+		".string \"/src/add\"",
+		".string \"a\"",
+		".section .debug_line",
+	} {
+		if !strings.Contains(unit.Assembly, expected) {
+			t.Errorf("assembly does not contain %q:\n%s", expected, unit.Assembly)
+		}
+	}
+
+	// code of included files refers to their own file entries
+	unit = NewUnit("# 1 \"main.c\"\n# 1 \"add.h\" 1\n" +
+		"int add(int a, int b) {\n\treturn a + b;\n}\n" +
+		"# 2 \"main.c\" 2\n" +
+		"int main(void) {\n\treturn add(1, 2);\n}\n")
+	unit.DebugInfo = true
+	unit.SourceFile = "main.c"
+	err = NewDefaultManager(Options{}).Run(unit)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	for _, expected := range []string{
+		".file 1 \"main.c\"",
+		".file 2 \"add.h\"",
+		".loc 2 2 2",
+		".loc 1 3 2",
+	} {
+		if !strings.Contains(unit.Assembly, expected) {
+			t.Errorf("assembly does not contain %q:\n%s", expected, unit.Assembly)
+		}
+	}
+	if strings.Count(unit.Assembly, ".file 2") != 1 {
+		t.Errorf("add.h must be declared once:\n%s", unit.Assembly)
+	}
+
+	unit = NewUnit(testCode)
+	err = NewDefaultManager(Options{}).Run(unit)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if strings.Contains(unit.Assembly, ".loc") || strings.Contains(unit.Assembly, ".cfi_startproc") {
+		t.Errorf("assembly without debug info contains debug directives")
+	}
+}
+
+func TestManager_RunPIC(t *testing.T) {
+	code := `
+	int counter;
+	int limit __attribute__((visibility("hidden"))) = 10;
+	int add(int a, int b) {
+		return a + b;
+	}
+	__attribute__((visibility("hidden"))) int twice(int a) {
+		return add(a, a);
+	}
+	int next(void) {
+		counter = twice(counter) + limit;
+		return counter;
+	}`
+	unit := NewUnit(code)
+	unit.PIC = true
+	err := NewDefaultManager(Options{VerifyEach: true}).Run(unit)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	for _, expected := range []string{
+		"call add@PLT",
+		"call twice\n",
+		"counter@GOTPCREL(%rip)",
+		"limit(%rip)",
+		".hidden twice",
+		".type counter, @object",
+	} {
+		if !strings.Contains(unit.Assembly, expected) {
+			t.Errorf("assembly does not contain %q:\n%s", expected, unit.Assembly)
+		}
+	}
+	if strings.Contains(unit.Assembly, "\tcounter(%rip)") || strings.Contains(unit.Assembly, " counter(%rip)") {
+		t.Errorf("preemptible variable counter must be accessed through the GOT:\n%s", unit.Assembly)
+	}
+}
@@ -0,0 +1,153 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/tacky"
+)
+
+const (
+	PassLex                  = "lex"
+	PassParse                = "parse"
+	PassLoopLabeling         = "loop-labeling"
+	PassLabelCheck           = "label-check"
+	PassTypeCheck            = "type-check"
+	PassWarnings             = "warnings"
+	PassIdentifierResolution = "identifier-resolution"
+	PassTackyGen             = "tacky-gen"
+	PassInstructionSelection = "instruction-selection"
+	PassPseudoRegReplacement = "pseudo-reg-replacement"
+	PassInstructionFixup     = "instruction-fixup"
+	PassCodeEmission         = "code-emission"
+)
+
+// NewDefaultManager creates a pass manager with all passes of the
+// compiler registered in execution order. The backend passes are the
+// ones of options.Target (x86-64 by default).
+func NewDefaultManager(options Options) *Manager {
+	if options.Target == nil {
+		options.Target = DefaultTarget()
+	}
+	m := NewManager(options)
+	for _, pass := range FrontendPasses() {
+		m.Register(pass)
+	}
+	for _, pass := range options.Target.Passes() {
+		m.Register(pass)
+	}
+	return m
+}
+
+// FrontendPasses returns the passes which translate the source code to
+// TACKY. They do not depend on the target.
+func FrontendPasses() []Pass {
+	return []Pass{
+		{
+			Name:        PassLex,
+			Description: "split the source code into tokens",
+			Input:       IrNone,
+			Output:      IrTokens,
+			Required:    true,
+			Run: func(unit *Unit) error {
+				tokens, err := frontend.Tokenize(unit.Source)
+				if err != nil {
+					return err
+				}
+				unit.Tokens = tokens
+				return nil
+			},
+		},
+		{
+			Name:        PassParse,
+			Description: "build the abstract syntax tree",
+			Input:       IrTokens,
+			Output:      IrAst,
+			Required:    true,
+			Run: func(unit *Unit) error {
+				program, err := frontend.NewParser(unit.Tokens).ParseProgram()
+				if err != nil {
+					return err
+				}
+				unit.Ast = program
+				return nil
+			},
+		},
+		{
+			Name:        PassLoopLabeling,
+			Description: "label loops, switches and their break/continue/case statements",
+			Input:       IrAst,
+			Output:      IrAst,
+			Required:    true,
+			Run: func(unit *Unit) error {
+				return frontend.LabelLoops(unit.Ast, unit.NameCreator)
+			},
+		},
+		{
+			Name:        PassLabelCheck,
+			Description: "check goto targets, labels and case clauses",
+			Input:       IrAst,
+			Output:      IrAst,
+			Run: func(unit *Unit) error {
+				return frontend.CheckLabels(unit.Ast)
+			},
+		},
+		{
+			Name:        PassTypeCheck,
+			Description: "check types and collect global declarations",
+			Input:       IrAst,
+			Output:      IrAst,
+			Required:    true,
+			Run: func(unit *Unit) error {
+				unit.GlobalEnv = frontend.NewEnvironment(nil)
+				return frontend.CheckTypes(unit.Ast, unit.GlobalEnv)
+			},
+		},
+		{
+			Name:        PassWarnings,
+			Description: "report suspicious code",
+			Input:       IrAst,
+			Output:      IrAst,
+			Run: func(unit *Unit) error {
+				unit.Warnings = frontend.CheckWarnings(unit.Ast, unit.WarningOptions)
+				if unit.WarningOptions.AsErrors && len(unit.Warnings) > 0 {
+					return errors.New(fmt.Sprintf("%d warning(s) treated as errors", len(unit.Warnings)))
+				}
+				return nil
+			},
+		},
+		{
+			Name:        PassIdentifierResolution,
+			Description: "give variables and labels unique names",
+			Input:       IrAst,
+			Output:      IrAst,
+			Required:    true,
+			Run: func(unit *Unit) error {
+				program, err := frontend.ResolveIdentifiers(unit.Ast, unit.NameCreator)
+				if err != nil {
+					return err
+				}
+				unit.Ast = program
+				return nil
+			},
+		},
+		{
+			Name:        PassTackyGen,
+			Description: "translate the AST to TACKY",
+			Input:       IrAst,
+			Output:      IrTacky,
+			Required:    true,
+			Run: func(unit *Unit) error {
+				translator := tacky.NewTranslator(unit.NameCreator)
+				if unit.DebugInfo {
+					translator = tacky.NewTranslatorWithDebugInfo(unit.NameCreator)
+				}
+				unit.Tacky = translator.Translate(unit.Ast)
+				return nil
+			},
+			Verify: func(unit *Unit) error {
+				return tacky.Verify(unit.Tacky, unit.GlobalEnv)
+			},
+		},
+	}
+}
@@ -0,0 +1,331 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/backend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/backend/aarch64"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/backend/riscv64"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/backend/wasm"
+	"strings"
+)
+
+// Target is a processor architecture and operating system which tbcc
+// generates code for
+type Target interface {
+	// Name is the name used with --target, e.g. "x86_64-linux"
+	Name() string
+	// Passes returns the backend passes. They translate unit.Tacky
+	// into unit.Assembly.
+	Passes() []Pass
+	// CC is the gcc driver that preprocesses the source files
+	CC() string
+	// AssemblySuffix is the suffix of the file unit.Assembly is
+	// written to
+	AssemblySuffix() string
+	// OutputSuffix is the suffix of the files of the given kind
+	OutputSuffix(output OutputKind) string
+	// AssembleCommand returns the command line that assembles the
+	// emitted code into an object file
+	AssembleCommand(assemblyFile, objectFile string) []string
+	// LinkCommand returns the command line that links the object files
+	// into outputFile. linkOptions (-l and -L) are passed to the linker.
+	// A nil command means that the only object file is the output.
+	LinkCommand(objectFiles, linkOptions []string, outputFile string, output OutputKind) ([]string, error)
+}
+
+// OutputKind is the kind of file the emitted code is turned into
+type OutputKind int
+
+const (
+	OutputExecutable OutputKind = iota
+	OutputObject
+	OutputSharedLibrary
+)
+
+var targets = []Target{&x86_64Target{}, &aarch64Target{}, &riscv64Target{}, &wasm32Target{}}
+
+func DefaultTarget() Target {
+	return targets[0]
+}
+
+// LookupTarget returns the target with the given name
+func LookupTarget(name string) (Target, error) {
+	var names []string
+	for _, target := range targets {
+		if target.Name() == name {
+			return target, nil
+		}
+		names = append(names, target.Name())
+	}
+	return nil, errors.New(fmt.Sprintf("unknown target '%s' (known targets: %s)",
+		name, strings.Join(names, ", ")))
+}
+
+// gccOutputSuffix, gccAssembleCommand and gccLinkCommand serve the
+// targets which assemble and link with the gcc driver
+func gccOutputSuffix(output OutputKind) string {
+	switch output {
+	case OutputObject:
+		return ".o"
+	case OutputSharedLibrary:
+		return ".so"
+	}
+	return ""
+}
+
+func gccAssembleCommand(cc, assemblyFile, objectFile string) []string {
+	return []string{cc, "-c", assemblyFile, "-o", objectFile}
+}
+
+func gccLinkCommand(cc string, objectFiles, linkOptions []string, outputFile string, output OutputKind) []string {
+	ret := []string{cc}
+	if output == OutputSharedLibrary {
+		ret = append(ret, "-shared")
+	}
+	ret = append(ret, objectFiles...)
+	ret = append(ret, linkOptions...)
+	return append(ret, "-o", outputFile)
+}
+
+type x86_64Target struct{}
+
+func (t *x86_64Target) Name() string {
+	return "x86_64-linux"
+}
+
+func (t *x86_64Target) CC() string {
+	return "gcc"
+}
+
+func (t *x86_64Target) AssemblySuffix() string {
+	return ".s"
+}
+
+func (t *x86_64Target) OutputSuffix(output OutputKind) string {
+	return gccOutputSuffix(output)
+}
+
+func (t *x86_64Target) AssembleCommand(assemblyFile, objectFile string) []string {
+	return gccAssembleCommand(t.CC(), assemblyFile, objectFile)
+}
+
+func (t *x86_64Target) LinkCommand(objectFiles, linkOptions []string, outputFile string, output OutputKind) (
+	[]string, error) {
+	return gccLinkCommand(t.CC(), objectFiles, linkOptions, outputFile, output), nil
+}
+
+func (t *x86_64Target) Passes() []Pass {
+	return []Pass{
+		{
+			Name:        PassInstructionSelection,
+			Description: "translate TACKY to assembly instructions on pseudo registers",
+			Input:       IrTacky,
+			Output:      IrAsm,
+			Required:    true,
+			Run: func(unit *Unit) error {
+				translator := backend.NewTranslator()
+				if unit.PIC {
+					translator = backend.NewTranslatorWithPIC(unit.GlobalEnv)
+				}
+				unit.Asm = translator.SelectInstructions(unit.Tacky)
+				return nil
+			},
+		},
+		{
+			Name:        PassPseudoRegReplacement,
+			Description: "replace pseudo registers by stack locations",
+			Input:       IrAsm,
+			Output:      IrAsm,
+			Required:    true,
+			Run: func(unit *Unit) error {
+				replacer := backend.NewPseudoRegReplacer()
+				unit.Asm, unit.StackSizes = replacer.Replace(unit.Asm)
+				unit.VarOffsets = replacer.Offsets()
+				return nil
+			},
+		},
+		{
+			Name:        PassInstructionFixup,
+			Description: "allocate stack frames and fix invalid operand combinations",
+			Input:       IrAsm,
+			Output:      IrAsm,
+			Required:    true,
+			Run: func(unit *Unit) error {
+				unit.Asm = backend.NewInstructionAdapter(unit.StackSizes).Adapt(unit.Asm)
+				return nil
+			},
+			Verify: func(unit *Unit) error {
+				return backend.Verify(unit.Asm)
+			},
+		},
+		{
+			Name:        PassCodeEmission,
+			Description: "emit the assembly code",
+			Input:       IrAsm,
+			Output:      IrAssembly,
+			Required:    true,
+			Run: func(unit *Unit) error {
+				codeGenerator := backend.NewCodeGeneratorWithSyntax(unit.GlobalEnv, unit.AsmSyntax)
+				if unit.PIC {
+					codeGenerator.SetPIC()
+				}
+				if unit.DebugInfo {
+					codeGenerator.SetDebugInfo(&backend.DebugInfo{
+						FileName:  unit.SourceFile,
+						Directory: unit.Directory,
+						Tacky:     unit.Tacky,
+						Offsets:   unit.VarOffsets,
+					})
+				}
+				unit.Assembly = codeGenerator.GenerateCode(*unit.Asm)
+				return nil
+			},
+		},
+	}
+}
+
+// aarch64Target generates A64 code directly from TACKY, so there is
+// no assembly AST to print or verify
+type aarch64Target struct{}
+
+func (t *aarch64Target) Name() string {
+	return "aarch64-linux"
+}
+
+func (t *aarch64Target) CC() string {
+	return "aarch64-linux-gnu-gcc"
+}
+
+func (t *aarch64Target) AssemblySuffix() string {
+	return ".s"
+}
+
+func (t *aarch64Target) OutputSuffix(output OutputKind) string {
+	return gccOutputSuffix(output)
+}
+
+func (t *aarch64Target) AssembleCommand(assemblyFile, objectFile string) []string {
+	return gccAssembleCommand(t.CC(), assemblyFile, objectFile)
+}
+
+func (t *aarch64Target) LinkCommand(objectFiles, linkOptions []string, outputFile string, output OutputKind) (
+	[]string, error) {
+	return gccLinkCommand(t.CC(), objectFiles, linkOptions, outputFile, output), nil
+}
+
+func (t *aarch64Target) Passes() []Pass {
+	return []Pass{
+		{
+			Name:        PassCodeEmission,
+			Description: "emit the A64 assembly code",
+			Input:       IrTacky,
+			Output:      IrAssembly,
+			Required:    true,
+			Run: func(unit *Unit) error {
+				unit.Assembly = aarch64.NewCodeGenerator().GenerateCode(unit.Tacky)
+				return nil
+			},
+		},
+	}
+}
+
+// riscv64Target generates RV64GC code directly from TACKY
+type riscv64Target struct{}
+
+func (t *riscv64Target) Name() string {
+	return "riscv64-linux"
+}
+
+func (t *riscv64Target) CC() string {
+	return "riscv64-linux-gnu-gcc"
+}
+
+func (t *riscv64Target) AssemblySuffix() string {
+	return ".s"
+}
+
+func (t *riscv64Target) OutputSuffix(output OutputKind) string {
+	return gccOutputSuffix(output)
+}
+
+func (t *riscv64Target) AssembleCommand(assemblyFile, objectFile string) []string {
+	return gccAssembleCommand(t.CC(), assemblyFile, objectFile)
+}
+
+func (t *riscv64Target) LinkCommand(objectFiles, linkOptions []string, outputFile string, output OutputKind) (
+	[]string, error) {
+	return gccLinkCommand(t.CC(), objectFiles, linkOptions, outputFile, output), nil
+}
+
+func (t *riscv64Target) Passes() []Pass {
+	return []Pass{
+		{
+			Name:        PassCodeEmission,
+			Description: "emit the RISC-V assembly code",
+			Input:       IrTacky,
+			Output:      IrAssembly,
+			Required:    true,
+			Run: func(unit *Unit) error {
+				unit.Assembly = riscv64.NewCodeGenerator().GenerateCode(unit.Tacky)
+				return nil
+			},
+		},
+	}
+}
+
+// wasm32Target generates a WebAssembly module in text format. There is
+// no linker, wat2wasm translates the module to the binary format.
+type wasm32Target struct{}
+
+func (t *wasm32Target) Name() string {
+	return "wasm32"
+}
+
+func (t *wasm32Target) CC() string {
+	return "gcc"
+}
+
+func (t *wasm32Target) AssemblySuffix() string {
+	return ".wat"
+}
+
+// OutputSuffix is the same for all kinds since a WebAssembly module
+// is not linked any further
+func (t *wasm32Target) OutputSuffix(_ OutputKind) string {
+	return ".wasm"
+}
+
+func (t *wasm32Target) AssembleCommand(assemblyFile, objectFile string) []string {
+	return []string{"wat2wasm", assemblyFile, "-o", objectFile}
+}
+
+func (t *wasm32Target) LinkCommand(objectFiles, linkOptions []string, _ string, output OutputKind) (
+	[]string, error) {
+	switch {
+	case len(objectFiles) != 1:
+		return nil, errors.New(fmt.Sprintf("target %s cannot link several modules", t.Name()))
+	case len(linkOptions) > 0:
+		return nil, errors.New(fmt.Sprintf("libraries are not supported for target %s", t.Name()))
+	case output == OutputSharedLibrary:
+		return nil, errors.New(fmt.Sprintf("shared libraries are not supported for target %s", t.Name()))
+	}
+	return nil, nil
+}
+
+func (t *wasm32Target) Passes() []Pass {
+	return []Pass{
+		{
+			Name:        PassCodeEmission,
+			Description: "emit the WebAssembly module",
+			Input:       IrTacky,
+			Output:      IrAssembly,
+			Required:    true,
+			Run: func(unit *Unit) error {
+				code, err := wasm.NewCodeGenerator(unit.GlobalEnv).GenerateCode(unit.Tacky)
+				unit.Assembly = code
+				return err
+			},
+		},
+	}
+}
@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/backend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/backend/csource"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/backend/llvm"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/tacky"
+	"io"
+)
+
+type IrKind int
+
+const (
+	IrNone IrKind = iota
+	IrTokens
+	IrAst
+	IrTacky
+	IrAsm
+	IrAssembly
+)
+
+func (k IrKind) String() string {
+	switch k {
+	case IrTokens:
+		return "tokens"
+	case IrAst:
+		return "ast"
+	case IrTacky:
+		return "tacky"
+	case IrAsm:
+		return "asm"
+	case IrAssembly:
+		return "assembly"
+	default:
+		return "none"
+	}
+}
+
+// Unit holds the state of a translation unit while it is passed
+// through the pipeline. Every pass reads its input from the unit
+// and stores its output there.
+type Unit struct {
+	Source         string
+	Tokens         []frontend.Token
+	Ast            *frontend.Program
+	GlobalEnv      *frontend.Environment
+	NameCreator    frontend.NameCreator
+	WarningOptions *frontend.WarningOptions
+	Warnings       []frontend.Warning
+	Tacky          *tacky.Program
+	Asm            *backend.Program
+	StackSizes     backend.VarSizesPerFunc
+	VarOffsets     map[string]backend.VarOffsets
+	AsmSyntax      backend.Syntax
+	// PIC requests position-independent code (-fPIC)
+	PIC bool
+	// DebugInfo requests debug information for SourceFile (-g), which
+	// was compiled in Directory
+	DebugInfo  bool
+	SourceFile string
+	Directory  string
+	Assembly   string
+}
+
+func NewUnit(source string) *Unit {
+	return &Unit{
+		Source:         source,
+		NameCreator:    frontend.NewNameCreator(),
+		WarningOptions: frontend.NewWarningOptions(),
+	}
+}
+
+func (u *Unit) hasIr(kind IrKind) bool {
+	switch kind {
+	case IrTokens:
+		return u.Tokens != nil
+	case IrAst:
+		return u.Ast != nil
+	case IrTacky:
+		return u.Tacky != nil
+	case IrAsm:
+		return u.Asm != nil
+	case IrAssembly:
+		return u.Assembly != ""
+	default:
+		return true
+	}
+}
+
+// Print writes the given representation of the unit to out
+func (u *Unit) Print(kind IrKind, out io.Writer) {
+	if !u.hasIr(kind) {
+		_, _ = fmt.Fprintf(out, "<no %s available>\n", kind)
+		return
+	}
+	switch kind {
+	case IrTokens:
+		for _, token := range u.Tokens {
+			pos := token.GetPosition()
+			_, _ = fmt.Fprintf(out, "%d:%d\t%s\n", pos.Line, pos.Col, token.GetLexeme())
+		}
+	case IrAst:
+		u.Ast.Accept(frontend.NewAstPrinterWithWriter(4, out))
+	case IrTacky:
+		u.Tacky.Accept(tacky.NewAstPrinterWithWriter(4, out))
+	case IrAsm:
+		u.Asm.Accept(backend.NewAsmPrinterWithWriter(4, out))
+	case IrAssembly:
+		_, _ = fmt.Fprint(out, u.Assembly)
+	default:
+	}
+}
+
+// WriteJson writes the given representation of the unit as JSON
+// (see docs/ir-json.md) to out
+func (u *Unit) WriteJson(kind IrKind, out io.Writer) error {
+	var ir any
+	switch kind {
+	case IrAst:
+		ir = u.Ast
+	case IrTacky:
+		ir = u.Tacky
+	case IrAsm:
+		ir = u.Asm
+	default:
+		return errors.New(fmt.Sprintf("no JSON representation for %s", kind))
+	}
+	if !u.hasIr(kind) {
+		return errors.New(fmt.Sprintf("no %s available", kind))
+	}
+	data, err := json.MarshalIndent(ir, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
+
+// WriteDot writes the control flow graphs ("cfg") or the call graph
+// ("callgraph") of the TACKY program in DOT format to out
+func (u *Unit) WriteDot(graph string, out io.Writer) error {
+	if !u.hasIr(IrTacky) {
+		return errors.New(fmt.Sprintf("no %s available", IrTacky))
+	}
+	switch graph {
+	case "cfg":
+		tacky.WriteCfgDot(u.Tacky, out)
+	case "callgraph":
+		tacky.WriteCallGraphDot(u.Tacky, u.GlobalEnv, out)
+	default:
+		return errors.New(fmt.Sprintf("unknown graph '%s' (cfg or callgraph expected)", graph))
+	}
+	return nil
+}
+
+// WriteLlvm writes the TACKY program as textual LLVM IR to out
+func (u *Unit) WriteLlvm(out io.Writer) error {
+	if !u.hasIr(IrTacky) {
+		return errors.New(fmt.Sprintf("no %s available", IrTacky))
+	}
+	code, err := llvm.NewCodeGenerator(u.GlobalEnv).GenerateCode(u.Tacky)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(out, code)
+	return err
+}
+
+// WriteC writes the TACKY program as C source code to out
+func (u *Unit) WriteC(out io.Writer) error {
+	if !u.hasIr(IrTacky) {
+		return errors.New(fmt.Sprintf("no %s available", IrTacky))
+	}
+	code, err := csource.NewCodeGenerator(u.GlobalEnv).GenerateCode(u.Tacky)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(out, code)
+	return err
+}
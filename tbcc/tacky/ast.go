@@ -1,5 +1,7 @@
 package tacky
 
+import "github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+
 // Intermediate representation (IR): three address code (TAC)
 
 type TacType int
@@ -7,6 +9,7 @@ type TacType int
 const (
 	TacProgram TacType = iota
 	TacFunction
+	TacStaticVariable
 	TacReturn
 	TacUnary
 	TacBinary
@@ -14,8 +17,19 @@ const (
 	TacJump
 	TacJumpIfZero
 	TacJumpIfNotZero
+	TacCompareAndJump
 	TacLabel
 	TacFunCall
+	TacIndirectCall
+	TacGetAddress
+	TacLoad
+	TacStore
+	TacAddOffset
+	TacSignExtend
+	TacTruncate
+	TacVaStart
+	TacVaArg
+	TacLocation
 	TacIntConstant
 	TacVar
 	TacComplement
@@ -44,6 +58,7 @@ const (
 type TacVisitor interface {
 	visitProgram(p *Program)
 	visitFunction(f *Function)
+	visitStaticVariable(s *StaticVariable)
 	visitReturn(r *Return)
 	visitUnary(u *Unary)
 	visitBinary(b *Binary)
@@ -51,8 +66,19 @@ type TacVisitor interface {
 	visitJump(j *Jump)
 	visitJumpIfZero(j *JumpIfZero)
 	visitJumpIfNotZero(j *JumpIfNotZero)
+	visitCompareAndJump(c *CompareAndJump)
 	visitLabel(l *Label)
 	visitFunctionCall(f *FunctionCall)
+	visitIndirectCall(i *IndirectCall)
+	visitGetAddress(g *GetAddress)
+	visitLoad(l *Load)
+	visitStore(s *Store)
+	visitAddOffset(a *AddOffset)
+	visitSignExtend(s *SignExtend)
+	visitTruncate(t *Truncate)
+	visitVaStart(v *VaStart)
+	visitVaArg(v *VaArg)
+	visitLocation(l *Location)
 	visitIntConstant(i *IntConstant)
 	visitVar(v *Var)
 	visitComplement()
@@ -84,7 +110,8 @@ type TacNode interface {
 }
 
 type Program struct {
-	Funs []Function
+	Funs       []Function
+	StaticVars []StaticVariable
 }
 
 func (p *Program) GetType() TacType {
@@ -97,8 +124,25 @@ func (p *Program) Accept(visitor TacVisitor) {
 
 type Function struct {
 	Ident      string
-	Parameters []string
-	Body       []Instruction
+	Parameters []*Var
+	// Variadic functions get a register save area for va_start
+	Variadic bool
+	Body     []Instruction
+	// Pos and Locals are only set if debug information is requested
+	Pos    frontend.Position
+	Locals []Local
+}
+
+// Local is a parameter or local variable as declared in the source code
+type Local struct {
+	Ident      string // name of the variable in TACKY
+	SourceName string
+	Type       frontend.TypeInfo
+	IsParam    bool
+	// IsStatic is set for local variables with static storage
+	// duration. Ident is the name of the static variable then.
+	IsStatic bool
+	Pos      frontend.Position
 }
 
 func (f *Function) GetType() TacType {
@@ -109,12 +153,30 @@ func (f *Function) Accept(visitor TacVisitor) {
 	visitor.visitFunction(f)
 }
 
+// StaticVariable is a variable with static storage duration. Variables
+// that are declared but not defined live in another translation unit.
+type StaticVariable struct {
+	Ident   string
+	Type    frontend.TypeInfo
+	Global  bool
+	Defined bool
+	Init    int
+}
+
+func (s *StaticVariable) GetType() TacType {
+	return TacStaticVariable
+}
+
+func (s *StaticVariable) Accept(visitor TacVisitor) {
+	visitor.visitStaticVariable(s)
+}
+
 type Instruction interface {
 	TacNode
 }
 
 type Return struct {
-	Val Value
+	Val Value // nil in functions returning void
 }
 
 func (r *Return) GetType() TacType {
@@ -205,6 +267,23 @@ func (j *JumpIfNotZero) Accept(visitor TacVisitor) {
 	visitor.visitJumpIfNotZero(j)
 }
 
+// CompareAndJump jumps to the target if the relation "src1 op src2"
+// holds. It is emitted for conditions of branches and loops.
+type CompareAndJump struct {
+	Op     BinaryOp
+	Src1   Value
+	Src2   Value
+	Target string
+}
+
+func (c *CompareAndJump) GetType() TacType {
+	return TacCompareAndJump
+}
+
+func (c *CompareAndJump) Accept(visitor TacVisitor) {
+	visitor.visitCompareAndJump(c)
+}
+
 type Label struct {
 	Name string
 }
@@ -220,7 +299,9 @@ func (l *Label) Accept(visitor TacVisitor) {
 type FunctionCall struct {
 	Name string
 	Args []Value
-	Dst  Value
+	Dst  Value // nil for calls of functions returning void
+	// Variadic is set for calls of functions with a variable argument count
+	Variadic bool
 }
 
 func (f *FunctionCall) GetType() TacType {
@@ -231,6 +312,148 @@ func (f *FunctionCall) Accept(visitor TacVisitor) {
 	visitor.visitFunctionCall(f)
 }
 
+// IndirectCall calls the function FunPtr points to
+type IndirectCall struct {
+	FunPtr   Value
+	Args     []Value
+	Dst      Value // nil for calls of functions returning void
+	Variadic bool
+}
+
+func (i *IndirectCall) GetType() TacType {
+	return TacIndirectCall
+}
+
+func (i *IndirectCall) Accept(visitor TacVisitor) {
+	visitor.visitIndirectCall(i)
+}
+
+// GetAddress stores the address of the variable (or function) Src in Dst
+type GetAddress struct {
+	Src Value
+	Dst Value
+}
+
+func (g *GetAddress) GetType() TacType {
+	return TacGetAddress
+}
+
+func (g *GetAddress) Accept(visitor TacVisitor) {
+	visitor.visitGetAddress(g)
+}
+
+// Load copies the value SrcPtr points to into Dst
+type Load struct {
+	SrcPtr Value
+	Dst    Value
+}
+
+func (l *Load) GetType() TacType {
+	return TacLoad
+}
+
+func (l *Load) Accept(visitor TacVisitor) {
+	visitor.visitLoad(l)
+}
+
+// Store copies Src to the location DstPtr points to
+type Store struct {
+	Src    Value
+	DstPtr Value
+}
+
+func (s *Store) GetType() TacType {
+	return TacStore
+}
+
+func (s *Store) Accept(visitor TacVisitor) {
+	visitor.visitStore(s)
+}
+
+// AddOffset stores the address Ptr + Offset (in bytes) in Dst
+type AddOffset struct {
+	Ptr    Value
+	Offset int
+	Dst    Value
+}
+
+func (a *AddOffset) GetType() TacType {
+	return TacAddOffset
+}
+
+func (a *AddOffset) Accept(visitor TacVisitor) {
+	visitor.visitAddOffset(a)
+}
+
+type SignExtend struct {
+	Src Value
+	Dst Value
+}
+
+func (s *SignExtend) GetType() TacType {
+	return TacSignExtend
+}
+
+func (s *SignExtend) Accept(visitor TacVisitor) {
+	visitor.visitSignExtend(s)
+}
+
+type Truncate struct {
+	Src Value
+	Dst Value
+}
+
+func (t *Truncate) GetType() TacType {
+	return TacTruncate
+}
+
+func (t *Truncate) Accept(visitor TacVisitor) {
+	visitor.visitTruncate(t)
+}
+
+// VaStart initializes the va_list VaList points to with the
+// position of the first unnamed argument
+type VaStart struct {
+	VaList Value
+}
+
+func (v *VaStart) GetType() TacType {
+	return TacVaStart
+}
+
+func (v *VaStart) Accept(visitor TacVisitor) {
+	visitor.visitVaStart(v)
+}
+
+// VaArg fetches the next argument from the va_list VaList points to.
+// The type of Dst determines the type of the argument.
+type VaArg struct {
+	VaList Value
+	Dst    Value
+}
+
+func (v *VaArg) GetType() TacType {
+	return TacVaArg
+}
+
+func (v *VaArg) Accept(visitor TacVisitor) {
+	visitor.visitVaArg(v)
+}
+
+// Location marks the start of the instructions translated from the
+// statement at Pos. It is only emitted if debug information is requested.
+type Location struct {
+	Pos frontend.Position
+}
+
+func (l *Location) GetType() TacType {
+	return TacLocation
+}
+
+func (l *Location) Accept(visitor TacVisitor) {
+	visitor.visitLocation(l)
+}
+
 type Value interface {
 	TacNode
 }
@@ -249,6 +472,7 @@ func (i *IntConstant) Accept(visitor TacVisitor) {
 
 type Var struct {
 	Ident string
+	Type  frontend.TypeInfo
 }
 
 func (v *Var) GetType() TacType {
@@ -1,20 +1,32 @@
 package tacky
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+)
 
 type AstPrinter struct {
 	offset          int
 	delta           int
 	suppressPadding bool
+	out             io.Writer
 }
 
 func NewAstPrinter(delta int) *AstPrinter {
-	return &AstPrinter{0, delta, false}
+	return NewAstPrinterWithWriter(delta, os.Stdout)
+}
+
+func NewAstPrinterWithWriter(delta int, out io.Writer) *AstPrinter {
+	return &AstPrinter{0, delta, false, out}
 }
 
 func (ap *AstPrinter) visitProgram(p *Program) {
 	ap.println("Program(")
 	ap.indent()
+	for _, staticVar := range p.StaticVars {
+		staticVar.Accept(ap)
+	}
 	for _, fun := range p.Funs {
 		fun.Accept(ap)
 	}
@@ -22,6 +34,19 @@ func (ap *AstPrinter) visitProgram(p *Program) {
 	ap.println(")")
 }
 
+func (ap *AstPrinter) visitStaticVariable(s *StaticVariable) {
+	ap.println("StaticVariable(")
+	ap.indent()
+	ap.println("name=" + s.Ident)
+	ap.println("type=" + s.Type.String())
+	ap.println(fmt.Sprintf("global=%t", s.Global))
+	if s.Defined {
+		ap.println(fmt.Sprintf("init=%d", s.Init))
+	}
+	ap.dedent()
+	ap.println(")")
+}
+
 func (ap *AstPrinter) visitFunction(f *Function) {
 	ap.println("Function(")
 	ap.indent()
@@ -30,13 +55,16 @@ func (ap *AstPrinter) visitFunction(f *Function) {
 		ap.println("parameters=[")
 		ap.indent()
 		for _, param := range f.Parameters {
-			ap.println(param)
+			ap.println(fmt.Sprintf("%s: %s", param.Ident, param.Type))
 		}
 		ap.dedent()
 		ap.println("]")
 	} else {
 		ap.println("parameters=[]")
 	}
+	if f.Variadic {
+		ap.println("variadic=true")
+	}
 	ap.println("body=[")
 	ap.indent()
 	for _, inst := range f.Body {
@@ -51,8 +79,10 @@ func (ap *AstPrinter) visitFunction(f *Function) {
 func (ap *AstPrinter) visitReturn(r *Return) {
 	ap.println("Return(")
 	ap.indent()
-	r.Val.Accept(ap)
-	ap.println("")
+	if r.Val != nil {
+		r.Val.Accept(ap)
+		ap.println("")
+	}
 	ap.dedent()
 	ap.println(")")
 }
@@ -146,6 +176,26 @@ func (ap *AstPrinter) visitJumpIfNotZero(j *JumpIfNotZero) {
 	ap.println(")")
 }
 
+func (ap *AstPrinter) visitCompareAndJump(c *CompareAndJump) {
+	ap.println("CompareAndJump(")
+	ap.indent()
+	ap.print("operator=")
+	ap.suppressPadding = true
+	c.Op.Accept(ap)
+	ap.println("")
+	ap.print("src1=")
+	ap.suppressPadding = true
+	c.Src1.Accept(ap)
+	ap.println("")
+	ap.print("src2=")
+	ap.suppressPadding = true
+	c.Src2.Accept(ap)
+	ap.println("")
+	ap.println("target=" + c.Target)
+	ap.dedent()
+	ap.println(")")
+}
+
 func (ap *AstPrinter) visitLabel(l *Label) {
 	ap.println("Label(name=" + l.Name + ")")
 }
@@ -154,10 +204,28 @@ func (ap *AstPrinter) visitFunctionCall(f *FunctionCall) {
 	ap.println("FunctionCall(")
 	ap.indent()
 	ap.println("name=" + f.Name)
-	if len(f.Args) > 0 {
+	ap.printCallArgs(f.Args, f.Dst, f.Variadic)
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AstPrinter) visitIndirectCall(i *IndirectCall) {
+	ap.println("IndirectCall(")
+	ap.indent()
+	ap.print("funPtr=")
+	ap.suppressPadding = true
+	i.FunPtr.Accept(ap)
+	ap.println("")
+	ap.printCallArgs(i.Args, i.Dst, i.Variadic)
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AstPrinter) printCallArgs(args []Value, dst Value, variadic bool) {
+	if len(args) > 0 {
 		ap.println("arguments=[")
 		ap.indent()
-		for _, arg := range f.Args {
+		for _, arg := range args {
 			arg.Accept(ap)
 			ap.println("")
 		}
@@ -166,9 +234,82 @@ func (ap *AstPrinter) visitFunctionCall(f *FunctionCall) {
 	} else {
 		ap.println("arguments=[]")
 	}
+	if dst != nil {
+		ap.print("dst=")
+		ap.suppressPadding = true
+		dst.Accept(ap)
+		ap.println("")
+	}
+	if variadic {
+		ap.println("variadic=true")
+	}
+}
+
+func (ap *AstPrinter) visitGetAddress(g *GetAddress) {
+	ap.printSrcDst("GetAddress", "src", g.Src, "dst", g.Dst)
+}
+
+func (ap *AstPrinter) visitLoad(l *Load) {
+	ap.printSrcDst("Load", "srcPtr", l.SrcPtr, "dst", l.Dst)
+}
+
+func (ap *AstPrinter) visitStore(s *Store) {
+	ap.printSrcDst("Store", "src", s.Src, "dstPtr", s.DstPtr)
+}
+
+func (ap *AstPrinter) visitAddOffset(a *AddOffset) {
+	ap.println("AddOffset(")
+	ap.indent()
+	ap.print("ptr=")
+	ap.suppressPadding = true
+	a.Ptr.Accept(ap)
+	ap.println("")
+	ap.println(fmt.Sprintf("offset=%d", a.Offset))
 	ap.print("dst=")
 	ap.suppressPadding = true
-	f.Dst.Accept(ap)
+	a.Dst.Accept(ap)
+	ap.println("")
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AstPrinter) visitSignExtend(s *SignExtend) {
+	ap.printSrcDst("SignExtend", "src", s.Src, "dst", s.Dst)
+}
+
+func (ap *AstPrinter) visitTruncate(t *Truncate) {
+	ap.printSrcDst("Truncate", "src", t.Src, "dst", t.Dst)
+}
+
+func (ap *AstPrinter) visitVaStart(v *VaStart) {
+	ap.println("VaStart(")
+	ap.indent()
+	ap.print("vaList=")
+	ap.suppressPadding = true
+	v.VaList.Accept(ap)
+	ap.println("")
+	ap.dedent()
+	ap.println(")")
+}
+
+func (ap *AstPrinter) visitVaArg(v *VaArg) {
+	ap.printSrcDst("VaArg", "vaList", v.VaList, "dst", v.Dst)
+}
+
+func (ap *AstPrinter) visitLocation(l *Location) {
+	ap.println(fmt.Sprintf("Location(line=%d, col=%d)", l.Pos.Line, l.Pos.Col))
+}
+
+func (ap *AstPrinter) printSrcDst(name, srcName string, src Value, dstName string, dst Value) {
+	ap.println(name + "(")
+	ap.indent()
+	ap.print(srcName + "=")
+	ap.suppressPadding = true
+	src.Accept(ap)
+	ap.println("")
+	ap.print(dstName + "=")
+	ap.suppressPadding = true
+	dst.Accept(ap)
 	ap.println("")
 	ap.dedent()
 	ap.println(")")
@@ -276,7 +417,7 @@ func (ap *AstPrinter) dedent() {
 
 func (ap *AstPrinter) print(text string) {
 	if ap.suppressPadding {
-		fmt.Print(text)
+		_, _ = fmt.Fprint(ap.out, text)
 		ap.suppressPadding = false
 		return
 	}
@@ -284,7 +425,7 @@ func (ap *AstPrinter) print(text string) {
 	for i := 0; i < ap.offset; i++ {
 		leftPadding += " "
 	}
-	fmt.Printf("%s%s", leftPadding, text)
+	_, _ = fmt.Fprintf(ap.out, "%s%s", leftPadding, text)
 }
 
 func (ap *AstPrinter) println(text string) {
@@ -0,0 +1,148 @@
+package tacky
+
+// Control flow graph (CFG) of a TACKY function
+
+type EdgeKind int
+
+const (
+	EdgeFallThrough EdgeKind = iota
+	EdgeJump
+	EdgeTrue
+	EdgeFalse
+)
+
+type Edge struct {
+	Target int
+	Kind   EdgeKind
+}
+
+type BasicBlock struct {
+	Id           int
+	Instructions []Instruction
+	Successors   []Edge
+	Predecessors []int
+}
+
+// Label returns the name of the label that starts the block
+// or "" if the block does not start with a label
+func (b *BasicBlock) Label() string {
+	if len(b.Instructions) > 0 && b.Instructions[0].GetType() == TacLabel {
+		return b.Instructions[0].(*Label).Name
+	}
+	return ""
+}
+
+// IsExit tells if the block leaves the function
+func (b *BasicBlock) IsExit() bool {
+	size := len(b.Instructions)
+	return size > 0 && b.Instructions[size-1].GetType() == TacReturn
+}
+
+type Cfg struct {
+	Function *Function
+	Blocks   []BasicBlock
+}
+
+// BuildCfg splits the function body into basic blocks and connects
+// them. Jumps to unknown labels are ignored.
+func BuildCfg(f *Function) *Cfg {
+	cfg := &Cfg{Function: f}
+
+	var current []Instruction
+	closeBlock := func() {
+		if len(current) > 0 {
+			cfg.Blocks = append(cfg.Blocks, BasicBlock{
+				Id:           len(cfg.Blocks),
+				Instructions: current,
+			})
+			current = nil
+		}
+	}
+
+	for _, instr := range f.Body {
+		if instr.GetType() == TacLabel {
+			closeBlock()
+		}
+		current = append(current, instr)
+		switch instr.GetType() {
+		case TacJump, TacJumpIfZero, TacJumpIfNotZero, TacCompareAndJump, TacReturn:
+			closeBlock()
+		default:
+		}
+	}
+	closeBlock()
+
+	labelBlocks := make(map[string]int)
+	for _, block := range cfg.Blocks {
+		if label := block.Label(); label != "" {
+			labelBlocks[label] = block.Id
+		}
+	}
+
+	for i := range cfg.Blocks {
+		block := &cfg.Blocks[i]
+		last := block.Instructions[len(block.Instructions)-1]
+		hasNext := i+1 < len(cfg.Blocks)
+		switch last.GetType() {
+		case TacReturn:
+		case TacJump:
+			if target, ok := labelBlocks[last.(*Jump).Target]; ok {
+				cfg.addEdge(block.Id, target, EdgeJump)
+			}
+		case TacJumpIfZero:
+			if target, ok := labelBlocks[last.(*JumpIfZero).Target]; ok {
+				cfg.addEdge(block.Id, target, EdgeFalse)
+			}
+			if hasNext {
+				cfg.addEdge(block.Id, i+1, EdgeTrue)
+			}
+		case TacJumpIfNotZero:
+			if target, ok := labelBlocks[last.(*JumpIfNotZero).Target]; ok {
+				cfg.addEdge(block.Id, target, EdgeTrue)
+			}
+			if hasNext {
+				cfg.addEdge(block.Id, i+1, EdgeFalse)
+			}
+		case TacCompareAndJump:
+			if target, ok := labelBlocks[last.(*CompareAndJump).Target]; ok {
+				cfg.addEdge(block.Id, target, EdgeTrue)
+			}
+			if hasNext {
+				cfg.addEdge(block.Id, i+1, EdgeFalse)
+			}
+		default:
+			if hasNext {
+				cfg.addEdge(block.Id, i+1, EdgeFallThrough)
+			}
+		}
+	}
+
+	return cfg
+}
+
+func (cfg *Cfg) addEdge(from, to int, kind EdgeKind) {
+	cfg.Blocks[from].Successors = append(cfg.Blocks[from].Successors, Edge{to, kind})
+	cfg.Blocks[to].Predecessors = append(cfg.Blocks[to].Predecessors, from)
+}
+
+// Reachable returns the ids of all blocks that can be reached
+// from the entry block
+func (cfg *Cfg) Reachable() map[int]bool {
+	reachable := make(map[int]bool)
+	if len(cfg.Blocks) == 0 {
+		return reachable
+	}
+	stack := []int{0}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if reachable[id] {
+			continue
+		}
+		reachable[id] = true
+		for _, edge := range cfg.Blocks[id].Successors {
+			stack = append(stack, edge.Target)
+		}
+	}
+	return reachable
+}
@@ -0,0 +1,267 @@
+package tacky
+
+import (
+	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Graphviz (DOT) export of control flow graphs and call graphs
+
+// WriteCfgDot writes one digraph per function of the program. The nodes
+// are the basic blocks of the function showing their instructions.
+func WriteCfgDot(program *Program, out io.Writer) {
+	for i := range program.Funs {
+		writeFunctionCfg(BuildCfg(&program.Funs[i]), out)
+	}
+}
+
+func writeFunctionCfg(cfg *Cfg, out io.Writer) {
+	_, _ = fmt.Fprintf(out, "digraph %s {\n", dotQuote("cfg_"+cfg.Function.Ident))
+	_, _ = fmt.Fprintf(out, "    label=%s;\n", dotQuote(cfg.Function.Ident))
+	_, _ = fmt.Fprintln(out, "    node [shape=box, fontname=\"monospace\"];")
+	_, _ = fmt.Fprintln(out, "    entry [shape=oval];")
+
+	if len(cfg.Blocks) > 0 {
+		_, _ = fmt.Fprintln(out, "    entry -> B0;")
+	}
+
+	for _, block := range cfg.Blocks {
+		lines := []string{fmt.Sprintf("B%d:", block.Id)}
+		for _, instr := range block.Instructions {
+			if instr.GetType() != TacLabel {
+				lines = append(lines, "  "+formatInstruction(instr))
+			} else {
+				lines = append(lines, formatInstruction(instr))
+			}
+		}
+		_, _ = fmt.Fprintf(out, "    B%d [label=\"%s\\l\"];\n", block.Id,
+			strings.Join(dotEscapeAll(lines), "\\l"))
+	}
+
+	for _, block := range cfg.Blocks {
+		for _, edge := range block.Successors {
+			switch edge.Kind {
+			case EdgeTrue:
+				_, _ = fmt.Fprintf(out, "    B%d -> B%d [label=\"true\", color=\"darkgreen\"];\n",
+					block.Id, edge.Target)
+			case EdgeFalse:
+				_, _ = fmt.Fprintf(out, "    B%d -> B%d [label=\"false\", color=\"red\"];\n",
+					block.Id, edge.Target)
+			default:
+				_, _ = fmt.Fprintf(out, "    B%d -> B%d;\n", block.Id, edge.Target)
+			}
+		}
+	}
+
+	_, _ = fmt.Fprintln(out, "}")
+}
+
+// WriteCallGraphDot writes the call graph of the program. Functions
+// defined in the translation unit and external functions are placed
+// in separate clusters. Calls through function pointers are not part
+// of the graph since their callees are not known.
+func WriteCallGraphDot(program *Program, globalEnv *frontend.Environment, out io.Writer) {
+	var defined, external []string
+	addFunction := func(name string) {
+		if slices.Contains(defined, name) || slices.Contains(external, name) {
+			return
+		}
+		if isDefinedFunction(name, globalEnv) {
+			defined = append(defined, name)
+		} else {
+			external = append(external, name)
+		}
+	}
+
+	type call struct{ caller, callee string }
+	var calls []call
+
+	for _, fun := range program.Funs {
+		addFunction(fun.Ident)
+		for _, instr := range fun.Body {
+			if instr.GetType() != TacFunCall {
+				continue
+			}
+			callee := instr.(*FunctionCall).Name
+			addFunction(callee)
+			c := call{fun.Ident, callee}
+			if !slices.Contains(calls, c) {
+				calls = append(calls, c)
+			}
+		}
+	}
+
+	_, _ = fmt.Fprintln(out, "digraph callgraph {")
+	_, _ = fmt.Fprintln(out, "    node [shape=box];")
+
+	_, _ = fmt.Fprintln(out, "    subgraph cluster_defined {")
+	_, _ = fmt.Fprintln(out, "        label=\"defined\";")
+	for _, name := range defined {
+		_, _ = fmt.Fprintf(out, "        %s;\n", dotQuote(name))
+	}
+	_, _ = fmt.Fprintln(out, "    }")
+
+	_, _ = fmt.Fprintln(out, "    subgraph cluster_external {")
+	_, _ = fmt.Fprintln(out, "        label=\"external\";")
+	_, _ = fmt.Fprintln(out, "        node [style=dashed];")
+	for _, name := range external {
+		_, _ = fmt.Fprintf(out, "        %s;\n", dotQuote(name))
+	}
+	_, _ = fmt.Fprintln(out, "    }")
+
+	for _, c := range calls {
+		_, _ = fmt.Fprintf(out, "    %s -> %s;\n", dotQuote(c.caller), dotQuote(c.callee))
+	}
+
+	_, _ = fmt.Fprintln(out, "}")
+}
+
+func isDefinedFunction(name string, globalEnv *frontend.Environment) bool {
+	if globalEnv == nil {
+		return false
+	}
+	entry, _ := globalEnv.Get(name)
+	if entry == nil || entry.GetTypeInfo() == nil || entry.GetTypeInfo().GetTypeId() != frontend.TypeFunc {
+		return false
+	}
+	return entry.GetTypeInfo().(*frontend.FuncInfo).IsDefined
+}
+
+func formatInstruction(instr Instruction) string {
+	switch instr.GetType() {
+	case TacReturn:
+		if instr.(*Return).Val == nil {
+			return "return"
+		}
+		return "return " + formatValue(instr.(*Return).Val)
+	case TacUnary:
+		unary := instr.(*Unary)
+		return fmt.Sprintf("%s = %s%s", formatValue(unary.Dst), operatorSymbols[unary.Op.GetType()],
+			formatValue(unary.Src))
+	case TacBinary:
+		binary := instr.(*Binary)
+		return fmt.Sprintf("%s = %s %s %s", formatValue(binary.Dst), formatValue(binary.Src1),
+			operatorSymbols[binary.Op.GetType()], formatValue(binary.Src2))
+	case TacCopy:
+		cp := instr.(*Copy)
+		return fmt.Sprintf("%s = %s", formatValue(cp.Dst), formatValue(cp.Src))
+	case TacJump:
+		return "jump " + instr.(*Jump).Target
+	case TacJumpIfZero:
+		jump := instr.(*JumpIfZero)
+		return fmt.Sprintf("if %s == 0 jump %s", formatValue(jump.Condition), jump.Target)
+	case TacJumpIfNotZero:
+		jump := instr.(*JumpIfNotZero)
+		return fmt.Sprintf("if %s != 0 jump %s", formatValue(jump.Condition), jump.Target)
+	case TacCompareAndJump:
+		jump := instr.(*CompareAndJump)
+		return fmt.Sprintf("if %s %s %s jump %s", formatValue(jump.Src1),
+			operatorSymbols[jump.Op.GetType()], formatValue(jump.Src2), jump.Target)
+	case TacLabel:
+		return instr.(*Label).Name + ":"
+	case TacFunCall:
+		call := instr.(*FunctionCall)
+		var args []string
+		for _, arg := range call.Args {
+			args = append(args, formatValue(arg))
+		}
+		if call.Dst == nil {
+			return fmt.Sprintf("%s(%s)", call.Name, strings.Join(args, ", "))
+		}
+		return fmt.Sprintf("%s = %s(%s)", formatValue(call.Dst), call.Name, strings.Join(args, ", "))
+	case TacIndirectCall:
+		call := instr.(*IndirectCall)
+		var args []string
+		for _, arg := range call.Args {
+			args = append(args, formatValue(arg))
+		}
+		callee := "(*" + formatValue(call.FunPtr) + ")"
+		if call.Dst == nil {
+			return fmt.Sprintf("%s(%s)", callee, strings.Join(args, ", "))
+		}
+		return fmt.Sprintf("%s = %s(%s)", formatValue(call.Dst), callee, strings.Join(args, ", "))
+	case TacGetAddress:
+		getAddress := instr.(*GetAddress)
+		return fmt.Sprintf("%s = &%s", formatValue(getAddress.Dst), formatValue(getAddress.Src))
+	case TacLoad:
+		load := instr.(*Load)
+		return fmt.Sprintf("%s = *%s", formatValue(load.Dst), formatValue(load.SrcPtr))
+	case TacStore:
+		store := instr.(*Store)
+		return fmt.Sprintf("*%s = %s", formatValue(store.DstPtr), formatValue(store.Src))
+	case TacAddOffset:
+		addOffset := instr.(*AddOffset)
+		return fmt.Sprintf("%s = %s + %d", formatValue(addOffset.Dst), formatValue(addOffset.Ptr), addOffset.Offset)
+	case TacSignExtend:
+		signExtend := instr.(*SignExtend)
+		return fmt.Sprintf("%s = sext %s", formatValue(signExtend.Dst), formatValue(signExtend.Src))
+	case TacTruncate:
+		truncate := instr.(*Truncate)
+		return fmt.Sprintf("%s = trunc %s", formatValue(truncate.Dst), formatValue(truncate.Src))
+	case TacVaStart:
+		return fmt.Sprintf("va_start %s", formatValue(instr.(*VaStart).VaList))
+	case TacVaArg:
+		vaArg := instr.(*VaArg)
+		return fmt.Sprintf("%s = va_arg %s", formatValue(vaArg.Dst), formatValue(vaArg.VaList))
+	case TacLocation:
+		pos := instr.(*Location).Pos
+		return fmt.Sprintf("# line %d", pos.Line)
+	default:
+		return fmt.Sprintf("<%v>", instr.GetType())
+	}
+}
+
+func formatValue(value Value) string {
+	switch value.GetType() {
+	case TacIntConstant:
+		return fmt.Sprintf("%d", value.(*IntConstant).Val)
+	case TacVar:
+		return value.(*Var).Ident
+	default:
+		return "?"
+	}
+}
+
+var operatorSymbols = map[TacType]string{
+	TacComplement:    "~",
+	TacNegate:        "-",
+	TacNot:           "!",
+	TacAdd:           "+",
+	TacSub:           "-",
+	TacMul:           "*",
+	TacDiv:           "/",
+	TacRemainder:     "%",
+	TacBitAnd:        "&",
+	TacBitOr:         "|",
+	TacBitXor:        "^",
+	TacBitShiftLeft:  "<<",
+	TacBitShiftRight: ">>",
+	TacAnd:           "&&",
+	TacOr:            "||",
+	TacEq:            "==",
+	TacNotEq:         "!=",
+	TacGt:            ">",
+	TacGtEq:          ">=",
+	TacLt:            "<",
+	TacLtEq:          "<=",
+}
+
+func dotEscape(text string) string {
+	text = strings.ReplaceAll(text, "\\", "\\\\")
+	return strings.ReplaceAll(text, "\"", "\\\"")
+}
+
+func dotEscapeAll(lines []string) []string {
+	escaped := make([]string, len(lines))
+	for i, line := range lines {
+		escaped[i] = dotEscape(line)
+	}
+	return escaped
+}
+
+func dotQuote(text string) string {
+	return "\"" + dotEscape(text) + "\""
+}
@@ -0,0 +1,74 @@
+package tacky
+
+import (
+	"bytes"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+	"strings"
+	"testing"
+)
+
+func TestWriteCfgDot(t *testing.T) {
+	code := `
+int main(void) {
+	int x = 0;
+	while (x < 10) {
+		if (x == 5)
+			break;
+		x++;
+	}
+	return x;
+}`
+	var out bytes.Buffer
+	WriteCfgDot(translate(code), &out)
+	dot := out.String()
+
+	for _, want := range []string{
+		"digraph \"cfg_main\" {",
+		"entry -> B0;",
+		"[label=\"true\", color=\"darkgreen\"]",
+		"[label=\"false\", color=\"red\"]",
+		"return tmp.0",
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("WriteCfgDot() output does not contain %q:\n%s", want, dot)
+		}
+	}
+}
+
+func TestWriteCallGraphDot(t *testing.T) {
+	code := `
+int putchar(int c);
+
+int twice(int x) {
+	return 2 * x;
+}
+
+int main(void) {
+	putchar(twice(33));
+	return twice(putchar(10));
+}`
+	nameCreator := frontend.NewNameCreator()
+	tokens, _ := frontend.Tokenize(code)
+	ast, _ := frontend.NewParser(tokens).ParseProgram()
+	ast, globalEnv, err := frontend.AnalyzeSemantics(ast, nameCreator)
+	if err != nil {
+		t.Fatalf("AnalyzeSemantics() error = %v", err)
+	}
+	program := NewTranslator(nameCreator).Translate(ast)
+
+	var out bytes.Buffer
+	WriteCallGraphDot(program, globalEnv, &out)
+	dot := out.String()
+
+	defined := dot[strings.Index(dot, "cluster_defined"):strings.Index(dot, "cluster_external")]
+	external := dot[strings.Index(dot, "cluster_external"):]
+	if !strings.Contains(defined, "\"twice\";") || !strings.Contains(defined, "\"main\";") {
+		t.Errorf("defined functions missing:\n%s", dot)
+	}
+	if !strings.Contains(external, "\"putchar\";") || strings.Contains(defined, "\"putchar\";") {
+		t.Errorf("putchar must be listed as external function:\n%s", dot)
+	}
+	if strings.Count(dot, "\"main\" -> \"twice\";") != 1 {
+		t.Errorf("call edge main -> twice must be written once:\n%s", dot)
+	}
+}
@@ -0,0 +1,482 @@
+package tacky
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+)
+
+// JSON representation of TACKY programs (see docs/ir-json.md)
+
+type jsonObject = map[string]any
+
+var unaryOpNames = map[TacType]string{
+	TacComplement: "Complement",
+	TacNegate:     "Negate",
+	TacNot:        "Not",
+}
+
+var binaryOpNames = map[TacType]string{
+	TacAdd:           "Add",
+	TacSub:           "Sub",
+	TacMul:           "Mul",
+	TacDiv:           "Div",
+	TacRemainder:     "Remainder",
+	TacBitAnd:        "BitAnd",
+	TacBitOr:         "BitOr",
+	TacBitXor:        "BitXor",
+	TacBitShiftLeft:  "BitShiftLeft",
+	TacBitShiftRight: "BitShiftRight",
+	TacAnd:           "And",
+	TacOr:            "Or",
+	TacEq:            "Equal",
+	TacNotEq:         "NotEqual",
+	TacGt:            "Greater",
+	TacGtEq:          "GreaterEq",
+	TacLt:            "Less",
+	TacLtEq:          "LessEq",
+}
+
+func (p *Program) MarshalJSON() ([]byte, error) {
+	staticVars := make([]any, 0)
+	for _, staticVar := range p.StaticVars {
+		staticVars = append(staticVars, jsonObject{
+			"kind":    "StaticVariable",
+			"name":    staticVar.Ident,
+			"type":    staticVar.Type.String(),
+			"global":  staticVar.Global,
+			"defined": staticVar.Defined,
+			"init":    staticVar.Init,
+		})
+	}
+	functions := make([]any, 0)
+	for _, fun := range p.Funs {
+		functions = append(functions, functionToJson(&fun))
+	}
+	return json.Marshal(jsonObject{"kind": "Program", "staticVars": staticVars, "functions": functions})
+}
+
+func (p *Program) UnmarshalJSON(data []byte) error {
+	var obj jsonObject
+	err := json.Unmarshal(data, &obj)
+	if err != nil {
+		return err
+	}
+	if kind, _ := obj["kind"].(string); kind != "Program" {
+		return errors.New("JSON does not contain a program")
+	}
+
+	loader := &jsonLoader{}
+	var staticVars []StaticVariable
+	for _, item := range loader.getList(obj, "staticVars") {
+		staticVars = append(staticVars, loader.loadStaticVariable(item))
+	}
+	var funs []Function
+	for _, item := range loader.getList(obj, "functions") {
+		funs = append(funs, loader.loadFunction(item))
+	}
+	if loader.err != nil {
+		return loader.err
+	}
+	p.Funs = funs
+	p.StaticVars = staticVars
+	return nil
+}
+
+func functionToJson(f *Function) jsonObject {
+	params := make([]any, 0)
+	for _, param := range f.Parameters {
+		params = append(params, valueToJson(param))
+	}
+	body := make([]any, 0)
+	for _, instr := range f.Body {
+		body = append(body, instructionToJson(instr))
+	}
+	return jsonObject{
+		"kind":       "Function",
+		"name":       f.Ident,
+		"parameters": params,
+		"variadic":   f.Variadic,
+		"body":       body,
+	}
+}
+
+func instructionToJson(instr Instruction) jsonObject {
+	switch instr.GetType() {
+	case TacReturn:
+		return jsonObject{"kind": "Return", "value": valueToJson(instr.(*Return).Val)}
+	case TacUnary:
+		unary := instr.(*Unary)
+		return jsonObject{
+			"kind":     "Unary",
+			"operator": unaryOpNames[unary.Op.GetType()],
+			"src":      valueToJson(unary.Src),
+			"dst":      valueToJson(unary.Dst),
+		}
+	case TacBinary:
+		binary := instr.(*Binary)
+		return jsonObject{
+			"kind":     "Binary",
+			"operator": binaryOpNames[binary.Op.GetType()],
+			"src1":     valueToJson(binary.Src1),
+			"src2":     valueToJson(binary.Src2),
+			"dst":      valueToJson(binary.Dst),
+		}
+	case TacCopy:
+		cp := instr.(*Copy)
+		return jsonObject{"kind": "Copy", "src": valueToJson(cp.Src), "dst": valueToJson(cp.Dst)}
+	case TacJump:
+		return jsonObject{"kind": "Jump", "target": instr.(*Jump).Target}
+	case TacJumpIfZero:
+		jump := instr.(*JumpIfZero)
+		return jsonObject{"kind": "JumpIfZero", "condition": valueToJson(jump.Condition), "target": jump.Target}
+	case TacJumpIfNotZero:
+		jump := instr.(*JumpIfNotZero)
+		return jsonObject{"kind": "JumpIfNotZero", "condition": valueToJson(jump.Condition), "target": jump.Target}
+	case TacCompareAndJump:
+		jump := instr.(*CompareAndJump)
+		return jsonObject{
+			"kind":     "CompareAndJump",
+			"operator": binaryOpNames[jump.Op.GetType()],
+			"src1":     valueToJson(jump.Src1),
+			"src2":     valueToJson(jump.Src2),
+			"target":   jump.Target,
+		}
+	case TacLabel:
+		return jsonObject{"kind": "Label", "name": instr.(*Label).Name}
+	case TacFunCall:
+		call := instr.(*FunctionCall)
+		args := make([]any, 0)
+		for _, arg := range call.Args {
+			args = append(args, valueToJson(arg))
+		}
+		return jsonObject{
+			"kind":     "FunctionCall",
+			"name":     call.Name,
+			"args":     args,
+			"dst":      valueToJson(call.Dst),
+			"variadic": call.Variadic,
+		}
+	case TacIndirectCall:
+		call := instr.(*IndirectCall)
+		args := make([]any, 0)
+		for _, arg := range call.Args {
+			args = append(args, valueToJson(arg))
+		}
+		return jsonObject{
+			"kind":     "IndirectCall",
+			"funPtr":   valueToJson(call.FunPtr),
+			"args":     args,
+			"dst":      valueToJson(call.Dst),
+			"variadic": call.Variadic,
+		}
+	case TacGetAddress:
+		getAddress := instr.(*GetAddress)
+		return jsonObject{"kind": "GetAddress", "src": valueToJson(getAddress.Src), "dst": valueToJson(getAddress.Dst)}
+	case TacLoad:
+		load := instr.(*Load)
+		return jsonObject{"kind": "Load", "srcPtr": valueToJson(load.SrcPtr), "dst": valueToJson(load.Dst)}
+	case TacStore:
+		store := instr.(*Store)
+		return jsonObject{"kind": "Store", "src": valueToJson(store.Src), "dstPtr": valueToJson(store.DstPtr)}
+	case TacAddOffset:
+		addOffset := instr.(*AddOffset)
+		return jsonObject{
+			"kind":   "AddOffset",
+			"ptr":    valueToJson(addOffset.Ptr),
+			"offset": addOffset.Offset,
+			"dst":    valueToJson(addOffset.Dst),
+		}
+	case TacSignExtend:
+		signExtend := instr.(*SignExtend)
+		return jsonObject{"kind": "SignExtend", "src": valueToJson(signExtend.Src), "dst": valueToJson(signExtend.Dst)}
+	case TacTruncate:
+		truncate := instr.(*Truncate)
+		return jsonObject{"kind": "Truncate", "src": valueToJson(truncate.Src), "dst": valueToJson(truncate.Dst)}
+	case TacVaStart:
+		return jsonObject{"kind": "VaStart", "vaList": valueToJson(instr.(*VaStart).VaList)}
+	case TacVaArg:
+		vaArg := instr.(*VaArg)
+		return jsonObject{"kind": "VaArg", "vaList": valueToJson(vaArg.VaList), "dst": valueToJson(vaArg.Dst)}
+	case TacLocation:
+		pos := instr.(*Location).Pos
+		ret := jsonObject{"kind": "Location", "line": pos.Line, "col": pos.Col}
+		if pos.File != "" {
+			ret["file"] = pos.File
+		}
+		return ret
+	default:
+		panic(fmt.Sprintf("unsupported instruction type: %v", instr.GetType()))
+	}
+}
+
+// valueToJson returns nil for missing values (e.g. the result of a void call)
+func valueToJson(value Value) jsonObject {
+	if value == nil {
+		return nil
+	}
+	switch value.GetType() {
+	case TacIntConstant:
+		return jsonObject{"kind": "IntConstant", "value": value.(*IntConstant).Val}
+	case TacVar:
+		variable := value.(*Var)
+		return jsonObject{"kind": "Var", "name": variable.Ident, "type": variable.Type.String()}
+	default:
+		panic(fmt.Sprintf("unsupported value type: %v", value.GetType()))
+	}
+}
+
+type jsonLoader struct {
+	err error
+}
+
+func (jl *jsonLoader) loadFunction(value any) Function {
+	obj := jl.getObject(value)
+	var params []*Var
+	for _, item := range jl.getList(obj, "parameters") {
+		param, ok := jl.loadValue(item).(*Var)
+		if !ok {
+			jl.fail("parameters must be variables")
+			continue
+		}
+		params = append(params, param)
+	}
+	var body []Instruction
+	for _, item := range jl.getList(obj, "body") {
+		body = append(body, jl.loadInstruction(item))
+	}
+	return Function{
+		Ident:      jl.getString(obj, "name"),
+		Parameters: params,
+		Variadic:   jl.getBool(obj, "variadic"),
+		Body:       body,
+	}
+}
+
+func (jl *jsonLoader) loadStaticVariable(value any) StaticVariable {
+	obj := jl.getObject(value)
+	init, ok := obj["init"].(float64)
+	if !ok {
+		jl.fail("init of StaticVariable must be a number")
+	}
+	return StaticVariable{
+		Ident:   jl.getString(obj, "name"),
+		Type:    jl.getType(obj),
+		Global:  jl.getBool(obj, "global"),
+		Defined: jl.getBool(obj, "defined"),
+		Init:    int(init),
+	}
+}
+
+func (jl *jsonLoader) loadInstruction(value any) Instruction {
+	obj := jl.getObject(value)
+	kind := jl.getString(obj, "kind")
+
+	switch kind {
+	case "Return":
+		return &Return{jl.loadOptionalValue(obj["value"])}
+	case "Unary":
+		return &Unary{jl.loadUnaryOp(obj), jl.loadValue(obj["src"]), jl.loadValue(obj["dst"])}
+	case "Binary":
+		return &Binary{
+			jl.loadBinaryOp(obj),
+			jl.loadValue(obj["src1"]),
+			jl.loadValue(obj["src2"]),
+			jl.loadValue(obj["dst"]),
+		}
+	case "Copy":
+		return &Copy{jl.loadValue(obj["src"]), jl.loadValue(obj["dst"])}
+	case "Jump":
+		return &Jump{jl.getString(obj, "target")}
+	case "JumpIfZero":
+		return &JumpIfZero{jl.loadValue(obj["condition"]), jl.getString(obj, "target")}
+	case "JumpIfNotZero":
+		return &JumpIfNotZero{jl.loadValue(obj["condition"]), jl.getString(obj, "target")}
+	case "CompareAndJump":
+		return &CompareAndJump{
+			jl.loadBinaryOp(obj),
+			jl.loadValue(obj["src1"]),
+			jl.loadValue(obj["src2"]),
+			jl.getString(obj, "target"),
+		}
+	case "Label":
+		return &Label{jl.getString(obj, "name")}
+	case "FunctionCall":
+		var args []Value
+		for _, item := range jl.getList(obj, "args") {
+			args = append(args, jl.loadValue(item))
+		}
+		return &FunctionCall{
+			jl.getString(obj, "name"),
+			args,
+			jl.loadOptionalValue(obj["dst"]),
+			jl.getBool(obj, "variadic"),
+		}
+	case "IndirectCall":
+		var args []Value
+		for _, item := range jl.getList(obj, "args") {
+			args = append(args, jl.loadValue(item))
+		}
+		return &IndirectCall{
+			jl.loadValue(obj["funPtr"]),
+			args,
+			jl.loadOptionalValue(obj["dst"]),
+			jl.getBool(obj, "variadic"),
+		}
+	case "GetAddress":
+		return &GetAddress{jl.loadValue(obj["src"]), jl.loadValue(obj["dst"])}
+	case "Load":
+		return &Load{jl.loadValue(obj["srcPtr"]), jl.loadValue(obj["dst"])}
+	case "Store":
+		return &Store{jl.loadValue(obj["src"]), jl.loadValue(obj["dstPtr"])}
+	case "AddOffset":
+		return &AddOffset{jl.loadValue(obj["ptr"]), jl.getInt(obj, "offset"), jl.loadValue(obj["dst"])}
+	case "SignExtend":
+		return &SignExtend{jl.loadValue(obj["src"]), jl.loadValue(obj["dst"])}
+	case "Truncate":
+		return &Truncate{jl.loadValue(obj["src"]), jl.loadValue(obj["dst"])}
+	case "VaStart":
+		return &VaStart{jl.loadValue(obj["vaList"])}
+	case "VaArg":
+		return &VaArg{jl.loadValue(obj["vaList"]), jl.loadValue(obj["dst"])}
+	case "Location":
+		return &Location{frontend.Position{Line: jl.getInt(obj, "line"), Col: jl.getInt(obj, "col"),
+			File: jl.getString(obj, "file")}}
+	default:
+		jl.fail(fmt.Sprintf("unknown instruction kind '%s'", kind))
+		return nil
+	}
+}
+
+func (jl *jsonLoader) loadValue(value any) Value {
+	obj := jl.getObject(value)
+	kind := jl.getString(obj, "kind")
+
+	switch kind {
+	case "IntConstant":
+		val, ok := obj["value"].(float64)
+		if !ok {
+			jl.fail("value of IntConstant must be a number")
+		}
+		return &IntConstant{int(val)}
+	case "Var":
+		return &Var{jl.getString(obj, "name"), jl.getType(obj)}
+	default:
+		jl.fail(fmt.Sprintf("unknown value kind '%s'", kind))
+		return nil
+	}
+}
+
+func (jl *jsonLoader) loadOptionalValue(value any) Value {
+	if value == nil {
+		return nil
+	}
+	return jl.loadValue(value)
+}
+
+func (jl *jsonLoader) loadUnaryOp(obj jsonObject) UnaryOp {
+	switch jl.getString(obj, "operator") {
+	case "Complement":
+		return &Complement{}
+	case "Negate":
+		return &Negate{}
+	case "Not":
+		return &Not{}
+	default:
+		jl.fail("unknown unary operator")
+		return nil
+	}
+}
+
+func (jl *jsonLoader) loadBinaryOp(obj jsonObject) BinaryOp {
+	switch jl.getString(obj, "operator") {
+	case "Add":
+		return &Add{}
+	case "Sub":
+		return &Sub{}
+	case "Mul":
+		return &Mul{}
+	case "Div":
+		return &Div{}
+	case "Remainder":
+		return &Remainder{}
+	case "BitAnd":
+		return &BitAnd{}
+	case "BitOr":
+		return &BitOr{}
+	case "BitXor":
+		return &BitXor{}
+	case "BitShiftLeft":
+		return &BitShiftLeft{}
+	case "BitShiftRight":
+		return &BitShiftRight{}
+	case "And":
+		return &And{}
+	case "Or":
+		return &Or{}
+	case "Equal":
+		return &Equal{}
+	case "NotEqual":
+		return &NotEqual{}
+	case "Greater":
+		return &Greater{}
+	case "GreaterEq":
+		return &GreaterEq{}
+	case "Less":
+		return &Less{}
+	case "LessEq":
+		return &LessEq{}
+	default:
+		jl.fail("unknown binary operator")
+		return nil
+	}
+}
+
+func (jl *jsonLoader) getType(obj jsonObject) frontend.TypeInfo {
+	typeInfo, err := frontend.ParseTypeName(jl.getString(obj, "type"))
+	if err != nil {
+		jl.fail(fmt.Sprintf("type of %s must be a type name", jl.getString(obj, "kind")))
+		return &frontend.IntInfo{}
+	}
+	return typeInfo
+}
+
+func (jl *jsonLoader) getObject(value any) jsonObject {
+	obj, ok := value.(jsonObject)
+	if !ok {
+		jl.fail("expected a JSON object")
+		return jsonObject{}
+	}
+	return obj
+}
+
+func (jl *jsonLoader) getString(obj jsonObject, key string) string {
+	value, _ := obj[key].(string)
+	return value
+}
+
+func (jl *jsonLoader) getBool(obj jsonObject, key string) bool {
+	value, _ := obj[key].(bool)
+	return value
+}
+
+func (jl *jsonLoader) getInt(obj jsonObject, key string) int {
+	value, ok := obj[key].(float64)
+	if !ok {
+		jl.fail(fmt.Sprintf("%s of %s must be a number", key, jl.getString(obj, "kind")))
+	}
+	return int(value)
+}
+
+func (jl *jsonLoader) getList(obj jsonObject, key string) []any {
+	value, _ := obj[key].([]any)
+	return value
+}
+
+func (jl *jsonLoader) fail(message string) {
+	if jl.err == nil {
+		jl.err = errors.New("invalid TACKY JSON: " + message)
+	}
+}
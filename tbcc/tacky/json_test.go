@@ -0,0 +1,75 @@
+package tacky
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProgram_JsonRoundTrip(t *testing.T) {
+	code := `
+int total = 3;
+extern int other;
+
+int add(int a, int b) {
+	static int calls;
+	calls += other;
+	return a + b + total;
+}
+
+void store(int *p, int v) {
+	*p = v;
+}
+
+int main(void) {
+	int x = 0;
+	for (int i = 0; i < 10; i++) {
+		x = x + add(i, -i) * 2;
+	}
+	int *p = &x;
+	void *v = (void *) p;
+	store(v, *p + (int) sizeof(int *));
+	int (*f)(int, int) = add;
+	x = f(x, 1);
+	return x && !x || x << 2;
+}
+
+int first(int n, ...) {
+	__builtin_va_list ap;
+	__builtin_va_start(ap, n);
+	int x = __builtin_va_arg(ap, int);
+	__builtin_va_end(ap);
+	return first(0, x, n);
+}`
+	program := translate(code)
+
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	var loaded Program
+	err = json.Unmarshal(data, &loaded)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(*program, loaded) {
+		t.Errorf("program differs after round trip")
+		loaded.Accept(NewAstPrinter(2))
+	}
+}
+
+func TestProgram_UnmarshalJSON_Errors(t *testing.T) {
+	tests := []string{
+		`{"kind": "Function"}`,
+		`{"kind": "Program", "functions": [{"kind": "Function", "body": [{"kind": "Nop"}]}]}`,
+		`{"kind": "Program", "functions": [{"kind": "Function", "body": [{"kind": "Return", "value": {"kind": "IntConstant"}}]}]}`,
+	}
+	for _, data := range tests {
+		var program Program
+		if err := json.Unmarshal([]byte(data), &program); err == nil {
+			t.Errorf("json.Unmarshal(%s) expected error", data)
+		}
+	}
+}
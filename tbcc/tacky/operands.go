@@ -0,0 +1,109 @@
+package tacky
+
+import "github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+
+// Operands returns the values an instruction reads or writes. Values
+// that are absent (like the destination of a call of a void function)
+// are left out.
+func Operands(instr Instruction) []Value {
+	var values []Value
+	switch i := instr.(type) {
+	case *Return:
+		values = []Value{i.Val}
+	case *Unary:
+		values = []Value{i.Src, i.Dst}
+	case *Binary:
+		values = []Value{i.Src1, i.Src2, i.Dst}
+	case *Copy:
+		values = []Value{i.Src, i.Dst}
+	case *JumpIfZero:
+		values = []Value{i.Condition}
+	case *JumpIfNotZero:
+		values = []Value{i.Condition}
+	case *CompareAndJump:
+		values = []Value{i.Src1, i.Src2}
+	case *FunctionCall:
+		values = append(append(values, i.Args...), i.Dst)
+	case *IndirectCall:
+		values = append(append([]Value{i.FunPtr}, i.Args...), i.Dst)
+	case *GetAddress:
+		values = []Value{i.Src, i.Dst}
+	case *Load:
+		values = []Value{i.SrcPtr, i.Dst}
+	case *Store:
+		values = []Value{i.Src, i.DstPtr}
+	case *AddOffset:
+		values = []Value{i.Ptr, i.Dst}
+	case *SignExtend:
+		values = []Value{i.Src, i.Dst}
+	case *Truncate:
+		values = []Value{i.Src, i.Dst}
+	case *VaStart:
+		values = []Value{i.VaList}
+	case *VaArg:
+		values = []Value{i.VaList, i.Dst}
+	}
+
+	var ret []Value
+	for _, value := range values {
+		if value != nil {
+			ret = append(ret, value)
+		}
+	}
+	return ret
+}
+
+// Variables returns the distinct variables of a function in the order
+// of their first occurrence, starting with the parameters
+func Variables(f *Function) []*Var {
+	var variables []*Var
+	seen := make(map[string]bool)
+	add := func(v *Var) {
+		if !seen[v.Ident] {
+			seen[v.Ident] = true
+			variables = append(variables, v)
+		}
+	}
+	for _, param := range f.Parameters {
+		add(param)
+	}
+	for _, instr := range f.Body {
+		for _, value := range Operands(instr) {
+			if v, ok := value.(*Var); ok {
+				add(v)
+			}
+		}
+	}
+	return variables
+}
+
+// IsAggregate tells whether the value is a structure (or union)
+func IsAggregate(value Value) bool {
+	v, ok := value.(*Var)
+	return ok && v.Type.GetTypeId() == frontend.TypeStruct
+}
+
+// SizeOfValue returns the size of a value in bytes. Constants are ints.
+// The size of va_list depends on the target.
+func SizeOfValue(value Value, vaListSize int) int {
+	if v, ok := value.(*Var); ok {
+		return SizeOf(v.Type, vaListSize)
+	}
+	return 4
+}
+
+func SizeOf(typeInfo frontend.TypeInfo, vaListSize int) int {
+	if typeInfo.GetTypeId() == frontend.TypeVaList {
+		return vaListSize
+	}
+	return frontend.SizeOf(typeInfo)
+}
+
+func AlignmentOf(typeInfo frontend.TypeInfo) int {
+	return max(frontend.AlignmentOf(typeInfo), 1)
+}
+
+// AlignTo rounds n up to a multiple of the alignment
+func AlignTo(n, alignment int) int {
+	return (n + alignment - 1) / alignment * alignment
+}
@@ -5,42 +5,163 @@ import (
 	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
 )
 
+var intType = &frontend.IntInfo{}
+
 type Translator struct {
 	nameCreator  frontend.NameCreator
 	switchValues []Value
+	staticVars   []StaticVariable
+	// staticIndex maps the names of static variables to their index
+	staticIndex map[string]int
+	// debugInfo enables the Location instructions and the Locals of functions
+	debugInfo bool
+	locals    []Local
 }
 
 func NewTranslator(nameCreator frontend.NameCreator) *Translator {
-	return &Translator{nameCreator, make([]Value, 0)}
+	return &Translator{
+		nameCreator:  nameCreator,
+		switchValues: make([]Value, 0),
+		staticIndex:  make(map[string]int),
+	}
+}
+
+// NewTranslatorWithDebugInfo returns a translator that records the
+// source positions of statements and the declared local variables
+func NewTranslatorWithDebugInfo(nameCreator frontend.NameCreator) *Translator {
+	t := NewTranslator(nameCreator)
+	t.debugInfo = true
+	return t
 }
 
 func (t *Translator) Translate(program *frontend.Program) *Program {
 	var funs []Function
 
+	for _, v := range program.Variables {
+		defined := v.StorageClass != frontend.StorageExtern || v.InitValue != nil
+		t.addStaticVar(&v, v.StorageClass != frontend.StorageStatic, defined)
+	}
+
 	for _, fun := range program.Functions {
 		if fun.Body != nil {
 			funs = append(funs, t.translateFunction(&fun))
 		}
 	}
 
-	return &Program{funs}
+	return &Program{funs, t.staticVars}
+}
+
+// addStaticVar records a variable with static storage duration. All
+// declarations of a variable are merged into one static variable. The
+// type checker has made sure that they are compatible.
+func (t *Translator) addStaticVar(v *frontend.VarDecl, global, defined bool) {
+	i, ok := t.staticIndex[v.Name]
+	if !ok {
+		i = len(t.staticVars)
+		t.staticIndex[v.Name] = i
+		t.staticVars = append(t.staticVars, StaticVariable{Ident: v.Name, Type: v.VarType, Global: global})
+	}
+	staticVar := &t.staticVars[i]
+	staticVar.Global = staticVar.Global && global
+	staticVar.Defined = staticVar.Defined || defined
+	if v.InitValue != nil {
+		// static initializers have been evaluated by the type checker
+		staticVar.Init = v.InitValue.(*frontend.IntegerLiteral).Value
+	}
 }
 
 func (t *Translator) translateFunction(f *frontend.Function) Function {
 
-	var parameters []string
+	var parameters []*Var
+	t.locals = nil
 	for _, param := range f.Params {
-		parameters = append(parameters, param.Name)
+		parameters = append(parameters, &Var{param.Name, param.Type})
+		t.addLocal(Local{Ident: param.Name, SourceName: param.SourceName, Type: param.Type, IsParam: true, Pos: param.Pos})
 	}
 
 	bodyInstructions := t.translateBlock(f.Body)
-	bodyInstructions = append(bodyInstructions, &Return{&IntConstant{0}})
+	if f.ReturnType.GetTypeId() == frontend.TypeVoid {
+		bodyInstructions = append(bodyInstructions, &Return{nil})
+	} else {
+		bodyInstructions = append(bodyInstructions, &Return{&IntConstant{0}})
+	}
 
-	return Function{
+	function := Function{
 		Ident:      f.Name,
 		Parameters: parameters,
+		Variadic:   f.Variadic,
 		Body:       bodyInstructions,
 	}
+	if t.debugInfo {
+		function.Pos = f.Pos
+		function.Locals = t.locals
+	}
+	return function
+}
+
+func (t *Translator) addLocal(local Local) {
+	if t.debugInfo {
+		t.locals = append(t.locals, local)
+	}
+}
+
+// location returns the Location instruction for a statement if debug
+// information is requested
+func (t *Translator) location(pos frontend.Position) []Instruction {
+	if !t.debugInfo {
+		return nil
+	}
+	return []Instruction{&Location{pos}}
+}
+
+// statementPos returns the position of a statement which code is
+// generated for
+func statementPos(stmt frontend.Statement) (frontend.Position, bool) {
+	switch s := stmt.(type) {
+	case *frontend.ReturnStmt:
+		return s.Pos, true
+	case *frontend.ExpressionStmt:
+		return s.Pos, true
+	case *frontend.IfStmt:
+		return s.Pos, true
+	case *frontend.GotoStmt:
+		return s.Pos, true
+	case *frontend.DoWhileStmt:
+		return s.Pos, true
+	case *frontend.WhileStmt:
+		return s.Pos, true
+	case *frontend.ForStmt:
+		return s.Pos, true
+	case *frontend.BreakStmt:
+		return s.Pos, true
+	case *frontend.ContinueStmt:
+		return s.Pos, true
+	case *frontend.SwitchStmt:
+		return s.Pos, true
+	case *frontend.CaseStmt:
+		return s.Pos, true
+	default:
+		return frontend.Position{}, false
+	}
+}
+
+// conditionPos returns the position of the condition of a do-while
+// loop, which is usually not on the line of the "do"
+func conditionPos(condition frontend.Expression, loopPos frontend.Position) frontend.Position {
+	switch c := condition.(type) {
+	case *frontend.BinaryExpression:
+		return c.Pos
+	case *frontend.UnaryExpression:
+		return c.Pos
+	case *frontend.Variable:
+		return c.Pos
+	case *frontend.IntegerLiteral:
+		return c.Pos
+	case *frontend.FunctionCall:
+		return c.Pos
+	default:
+		return loopPos
+	}
 }
 
 func (t *Translator) translateBlock(b *frontend.BlockStmt) []Instruction {
@@ -58,10 +179,23 @@ func (t *Translator) translateBodyItem(item frontend.BodyItem) []Instruction {
 	case frontend.AstVarDecl:
 		var ret []Instruction
 		varDecl := item.(*frontend.VarDecl)
+		switch varDecl.StorageClass {
+		case frontend.StorageStatic:
+			t.addStaticVar(varDecl, false, true)
+			t.addLocal(Local{Ident: varDecl.Name, SourceName: varDecl.SourceName, Type: varDecl.VarType,
+				IsStatic: true, Pos: varDecl.Pos})
+			return nil
+		case frontend.StorageExtern:
+			t.addStaticVar(varDecl, true, false)
+			return nil
+		}
+		t.addLocal(Local{Ident: varDecl.Name, SourceName: varDecl.SourceName, Type: varDecl.VarType,
+			Pos: varDecl.Pos})
 		if varDecl.InitValue != nil {
+			ret = t.location(varDecl.Pos)
 			val, instructions := t.translateExpr(varDecl.InitValue)
 			ret = append(ret, instructions...)
-			ret = append(ret, &Copy{val, &Var{varDecl.Name}})
+			ret = append(ret, &Copy{val, &Var{varDecl.Name, varDecl.VarType}})
 		}
 		return ret
 	default:
@@ -74,11 +208,13 @@ func (t *Translator) translateStatement(stmt frontend.Statement) []Instruction {
 	var val Value
 
 	switch stmt.GetType() {
-	case frontend.AstFunction:
+	case frontend.AstFunction, frontend.AstEnumDecl, frontend.AstStructDecl, frontend.AstTypedefDecl:
 		return ret
 	case frontend.AstReturn:
 		retStmt := stmt.(*frontend.ReturnStmt)
-		val, ret = t.translateExpr(retStmt.Expression)
+		if retStmt.Expression != nil {
+			val, ret = t.translateExpr(retStmt.Expression)
+		}
 		ret = append(ret, &Return{val})
 	case frontend.AstExprStmt:
 		exprStmt := stmt.(*frontend.ExpressionStmt)
@@ -114,6 +250,9 @@ func (t *Translator) translateStatement(stmt frontend.Statement) []Instruction {
 		panic(fmt.Sprintf("unsupported statement type: %v", stmt.GetType()))
 	}
 
+	if pos, ok := statementPos(stmt); ok {
+		ret = append(t.location(pos), ret...)
+	}
 	return ret
 }
 
@@ -132,8 +271,8 @@ func (t *Translator) translateCaseStmt(stmt *frontend.CaseStmt) []Instruction {
 
 		switchNestingLevel := len(t.switchValues)
 		selectVar := t.switchValues[switchNestingLevel-1]
-		caseVar := &Var{t.createVarName()}
-		resultVar := &Var{t.createVarName()}
+		caseVar := t.createVar(intType)
+		resultVar := t.createVar(intType)
 		ret = append(ret,
 			&Copy{caseVal, caseVar},
 			&Binary{
@@ -166,7 +305,7 @@ func (t *Translator) translateSwitchStmt(stmt *frontend.SwitchStmt) []Instructio
 		return ret
 	}
 
-	selectVar := &Var{t.createVarName()}
+	selectVar := t.createVar(intType)
 
 	// Push current selection var to stack to make it available
 	// for case statements
@@ -215,18 +354,14 @@ func (t *Translator) translateForStmt(stmt *frontend.ForStmt) []Instruction {
 	ret = append(ret, &Label{startLabel})
 
 	if stmt.Condition != nil {
-		condVal, condInstructions := t.translateExpr(stmt.Condition)
-		condResult := &Var{t.createVarName()}
-		ret = append(ret, condInstructions...)
-		ret = append(ret,
-			&Copy{condVal, condResult},
-			&JumpIfZero{condResult, breakLabel},
-		)
+		ret = append(ret, t.location(stmt.Pos)...)
+		ret = append(ret, t.translateJump(stmt.Condition, breakLabel, false)...)
 	}
 	ret = append(ret, t.translateStatement(stmt.Body)...)
 	ret = append(ret, &Label{continueLabel})
 
 	if stmt.Post != nil {
+		ret = append(ret, t.location(stmt.Pos)...)
 		_, postInstructions := t.translateExpr(stmt.Post)
 		ret = append(ret, postInstructions...)
 	}
@@ -244,13 +379,7 @@ func (t *Translator) translateWhileStmt(stmt *frontend.WhileStmt) []Instruction
 	breakLabel := t.loopLabelBreak(stmt.Label)
 
 	ret := []Instruction{&Label{continueLabel}}
-	condVal, condInstructions := t.translateExpr(stmt.Condition)
-	condResult := &Var{t.createVarName()}
-	ret = append(ret, condInstructions...)
-	ret = append(ret,
-		&Copy{condVal, condResult},
-		&JumpIfZero{condResult, breakLabel},
-	)
+	ret = append(ret, t.translateJump(stmt.Condition, breakLabel, false)...)
 	ret = append(ret, t.translateStatement(stmt.Body)...)
 	ret = append(ret,
 		&Jump{continueLabel},
@@ -265,14 +394,9 @@ func (t *Translator) translateDoWhileStmt(stmt *frontend.DoWhileStmt) []Instruct
 	ret := []Instruction{&Label{startLabel}}
 	ret = append(ret, t.translateStatement(stmt.Body)...)
 	ret = append(ret, &Label{t.loopLabelContinue(stmt.Label)})
-	condVal, condInstructions := t.translateExpr(stmt.Condition)
-	condResult := &Var{t.createVarName()}
-	ret = append(ret, condInstructions...)
-	ret = append(ret,
-		&Copy{condVal, condResult},
-		&JumpIfNotZero{condResult, startLabel},
-		&Label{t.loopLabelBreak(stmt.Label)},
-	)
+	ret = append(ret, t.location(conditionPos(stmt.Condition, stmt.Pos))...)
+	ret = append(ret, t.translateJump(stmt.Condition, startLabel, true)...)
+	ret = append(ret, &Label{t.loopLabelBreak(stmt.Label)})
 
 	return ret
 }
@@ -295,19 +419,16 @@ func (t *Translator) loopLabelContinue(loopLabel string) string {
 
 func (t *Translator) translateIfStmt(ifStmt *frontend.IfStmt) []Instruction {
 	var ret []Instruction
-	var condValue Value
 
 	if ifStmt.Alternate == nil {
-		condValue, ret = t.translateExpr(ifStmt.Condition)
 		endLabelName := t.createLabelName("end")
-		ret = append(ret, &JumpIfZero{condValue, endLabelName})
+		ret = t.translateJump(ifStmt.Condition, endLabelName, false)
 		ret = append(ret, t.translateStatement(ifStmt.Consequent)...)
 		ret = append(ret, &Label{endLabelName})
 	} else {
-		condValue, ret = t.translateExpr(ifStmt.Condition)
 		endLabelName := t.createLabelName("end")
 		elseLabelName := t.createLabelName("else")
-		ret = append(ret, &JumpIfZero{condValue, elseLabelName})
+		ret = t.translateJump(ifStmt.Condition, elseLabelName, false)
 		ret = append(ret, t.translateStatement(ifStmt.Consequent)...)
 		ret = append(ret, &Jump{endLabelName})
 		ret = append(ret, &Label{elseLabelName})
@@ -318,6 +439,76 @@ func (t *Translator) translateIfStmt(ifStmt *frontend.IfStmt) []Instruction {
 	return ret
 }
 
+// translateJump translates a condition into a jump to target which is
+// taken if the truth value of the condition equals jumpIf. Otherwise,
+// control falls through. &&, || and ! become branches, and relations
+// are compared directly instead of computing 0 or 1 first.
+func (t *Translator) translateJump(cond frontend.Expression, target string, jumpIf bool) []Instruction {
+	switch c := cond.(type) {
+	case *frontend.IntegerLiteral:
+		if (c.Value != 0) == jumpIf {
+			return []Instruction{&Jump{target}}
+		}
+		return nil
+	case *frontend.UnaryExpression:
+		if c.Operator == frontend.UnOpNot {
+			return t.translateJump(c.Right, target, !jumpIf)
+		}
+	case *frontend.BinaryExpression:
+		switch c.Operator {
+		case frontend.BinOpAnd, frontend.BinOpOr:
+			// the truth value of the left operand that decides the result
+			decisive := c.Operator == frontend.BinOpOr
+			if jumpIf == decisive {
+				ret := t.translateJump(c.Left, target, jumpIf)
+				return append(ret, t.translateJump(c.Right, target, jumpIf)...)
+			}
+			skipLabel := t.createLabelName("skip")
+			ret := t.translateJump(c.Left, skipLabel, decisive)
+			ret = append(ret, t.translateJump(c.Right, target, jumpIf)...)
+			return append(ret, &Label{skipLabel})
+		case frontend.BinOpEqual, frontend.BinOpNotEqual,
+			frontend.BinOpGreater, frontend.BinOpGreaterEq,
+			frontend.BinOpLess, frontend.BinOpLessEq:
+			src1, ret := t.translateExpr(c.Left)
+			src2, instructions2 := t.translateExpr(c.Right)
+			ret = append(ret, instructions2...)
+			op := c.Operator
+			if !jumpIf {
+				op = negatedRelation(op)
+			}
+			return append(ret, &CompareAndJump{t.getBinaryOp(op), src1, src2, target})
+		}
+	}
+
+	value, ret := t.translateExpr(cond)
+	if jumpIf {
+		return append(ret, &JumpIfNotZero{value, target})
+	}
+	return append(ret, &JumpIfZero{value, target})
+}
+
+func negatedRelation(op frontend.BinaryOp) frontend.BinaryOp {
+	switch op {
+	case frontend.BinOpEqual:
+		return frontend.BinOpNotEqual
+	case frontend.BinOpNotEqual:
+		return frontend.BinOpEqual
+	case frontend.BinOpGreater:
+		return frontend.BinOpLessEq
+	case frontend.BinOpGreaterEq:
+		return frontend.BinOpLess
+	case frontend.BinOpLess:
+		return frontend.BinOpGreaterEq
+	case frontend.BinOpLessEq:
+		return frontend.BinOpGreater
+	default:
+		panic("not a relational operator: " + op.String())
+	}
+}
+
+// translateExpr returns the value of the expression and the instructions
+// computing it. The value is nil for expressions of type void.
 func (t *Translator) translateExpr(expr frontend.Expression) (Value, []Instruction) {
 	switch expr.GetType() {
 	case frontend.AstInteger:
@@ -325,107 +516,447 @@ func (t *Translator) translateExpr(expr frontend.Expression) (Value, []Instructi
 		return &IntConstant{val}, nil
 	case frontend.AstVariable:
 		variable := expr.(*frontend.Variable)
-		return &Var{variable.Name}, nil
-	case frontend.AstFunctionCall:
-		functionCall := expr.(*frontend.FunctionCall)
-		var instructions []Instruction
-		arguments := make([]Value, len(functionCall.Args))
-		for i, arg := range functionCall.Args {
-			argVal, argInstructions := t.translateExpr(arg)
-			arguments[i] = argVal
-			instructions = append(instructions, argInstructions...)
+		varType := variable.GetResultType()
+		if varType.GetTypeId() == frontend.TypeFunc || varType.GetTypeId() == frontend.TypeVaList {
+			// function designators and va_lists are converted to pointers
+			dst := t.createVar(&frontend.PointerInfo{Referenced: varType})
+			return dst, []Instruction{&GetAddress{&Var{variable.Name, varType}, dst}}
 		}
-		dst := &Var{t.createVarName()}
-		instructions = append(instructions, &FunctionCall{
-			Name: functionCall.Callee,
-			Args: arguments,
-			Dst:  dst,
-		})
-		return dst, instructions
+		return &Var{variable.Name, varType}, nil
+	case frontend.AstFunctionCall:
+		return t.translateFunctionCall(expr.(*frontend.FunctionCall))
 	case frontend.AstUnary:
 		unary := expr.(*frontend.UnaryExpression)
 		unaryOp := t.getUnaryOp(unary.Operator)
 		src, instructions := t.translateExpr(unary.Right)
-		dst := &Var{t.createVarName()}
+		dst := t.createVar(unary.GetResultType())
 		instructions = append(instructions, &Unary{unaryOp, src, dst})
 		return dst, instructions
+	case frontend.AstPrefixIncDec:
+		prefixIncDec := expr.(*frontend.PrefixIncDec)
+		return t.translateIncDec(prefixIncDec.Operator, prefixIncDec.Operand, false)
 	case frontend.AstPostfixIncDec:
-		return t.translatePostfixIncDec(expr.(*frontend.PostfixIncDec))
+		postfixIncDec := expr.(*frontend.PostfixIncDec)
+		return t.translateIncDec(postfixIncDec.Operator, postfixIncDec.Operand, true)
 	case frontend.AstBinary:
 		binary := expr.(*frontend.BinaryExpression)
-		if binary.Operator == "=" {
+		switch binary.Operator {
+		case frontend.BinOpAssign:
 			return t.translateAssignment(binary)
-		} else {
-			binaryOp := t.getBinaryOp(binary.Operator)
-			binaryOpType := binaryOp.GetType()
-			if binaryOpType != TacAnd && binaryOpType != TacOr {
-				src1, instructions := t.translateExpr(binary.Left)
-				src2, instructions2 := t.translateExpr(binary.Right)
-				instructions = append(instructions, instructions2...)
-				dst := &Var{t.createVarName()}
-				instructions = append(instructions, &Binary{binaryOp, src1, src2, dst})
-				return dst, instructions
-			} else {
-				return t.translateExprWithShortCircuit(binaryOp, binary.Left, binary.Right)
-			}
+		case frontend.BinOpAnd:
+			return t.translateExprWithShortCircuit(&And{}, binary.Left, binary.Right)
+		case frontend.BinOpOr:
+			return t.translateExprWithShortCircuit(&Or{}, binary.Left, binary.Right)
+		default:
+			src1, instructions := t.translateExpr(binary.Left)
+			src2, instructions2 := t.translateExpr(binary.Right)
+			instructions = append(instructions, instructions2...)
+			dst := t.createVar(binary.GetResultType())
+			instructions = append(instructions, &Binary{t.getBinaryOp(binary.Operator), src1, src2, dst})
+			return dst, instructions
 		}
+	case frontend.AstCompoundAssignment:
+		return t.translateCompoundAssignment(expr.(*frontend.CompoundAssignment))
 	case frontend.AstConditional:
 		conditional := expr.(*frontend.Conditional)
 		return t.translateConditional(conditional)
+	case frontend.AstAddressOf:
+		addressOf := expr.(*frontend.AddressOf)
+		if deref, ok := addressOf.Operand.(*frontend.Dereference); ok {
+			return t.translateExpr(deref.Operand)
+		}
+		if _, ok := addressOf.Operand.(*frontend.MemberAccess); ok {
+			lv, instructions := t.translateLvalue(addressOf.Operand)
+			return lv.ptr, instructions
+		}
+		if operandType := addressOf.Operand.GetResultType().GetTypeId(); operandType == frontend.TypeFunc ||
+			operandType == frontend.TypeVaList {
+			return t.translateExpr(addressOf.Operand)
+		}
+		src, instructions := t.translateExpr(addressOf.Operand)
+		dst := t.createVar(addressOf.GetResultType())
+		instructions = append(instructions, &GetAddress{src, dst})
+		return dst, instructions
+	case frontend.AstDereference:
+		deref := expr.(*frontend.Dereference)
+		ptr, instructions := t.translateExpr(deref.Operand)
+		if deref.GetResultType().GetTypeId() == frontend.TypeFunc {
+			// the function designator is converted back to the pointer
+			return ptr, instructions
+		}
+		dst := t.createVar(deref.GetResultType())
+		instructions = append(instructions, &Load{ptr, dst})
+		return dst, instructions
+	case frontend.AstMemberAccess:
+		lv, instructions := t.translateLvalue(expr)
+		value, loadInstructions := t.load(lv)
+		return value, append(instructions, loadInstructions...)
+	case frontend.AstCast:
+		return t.translateCast(expr.(*frontend.Cast))
+	case frontend.AstSizeOfType:
+		return &IntConstant{frontend.SizeOf(expr.(*frontend.SizeOfType).TargetType)}, nil
+	case frontend.AstSizeOfExpr:
+		operand := expr.(*frontend.SizeOfExpr).Operand
+		return &IntConstant{frontend.SizeOf(operand.GetResultType())}, nil
+	case frontend.AstVaStart:
+		vaList, instructions := t.translateExpr(expr.(*frontend.VaStart).VaList)
+		return nil, append(instructions, &VaStart{vaList})
+	case frontend.AstVaArg:
+		vaArg := expr.(*frontend.VaArg)
+		vaList, instructions := t.translateExpr(vaArg.VaList)
+		dst := t.createVar(vaArg.GetResultType())
+		return dst, append(instructions, &VaArg{vaList, dst})
+	case frontend.AstVaEnd:
+		// nothing to clean up in the System V ABI
+		_, instructions := t.translateExpr(expr.(*frontend.VaEnd).VaList)
+		return nil, instructions
 	default:
 		panic("unsupported expression type")
 	}
 }
 
-func (t *Translator) translateConditional(conditional *frontend.Conditional) (Value, []Instruction) {
-	resultValue := &Var{t.createVarName()}
+// translateFunctionCall emits a direct call if the callee is a function
+// designator and an indirect call through a function pointer otherwise
+func (t *Translator) translateFunctionCall(functionCall *frontend.FunctionCall) (Value, []Instruction) {
+	var instructions []Instruction
+
+	funcName, isDirect := directCallee(functionCall.Callee)
+	var funPtr Value
+	if !isDirect {
+		funPtr, instructions = t.translateExpr(functionCall.Callee)
+	}
+
+	funcInfo := calleeType(functionCall.Callee)
+	arguments := make([]Value, len(functionCall.Args))
+	for i, arg := range functionCall.Args {
+		argVal, argInstructions := t.translateExpr(arg)
+		instructions = append(instructions, argInstructions...)
+		if i < funcInfo.NumParams() {
+			// arguments are converted as if by assignment
+			argVal, argInstructions = t.convertValue(argVal, funcInfo.ParamTypes[i])
+			instructions = append(instructions, argInstructions...)
+		}
+		arguments[i] = argVal
+	}
+	var dst Value
+	if functionCall.GetResultType().GetTypeId() != frontend.TypeVoid {
+		dst = t.createVar(functionCall.GetResultType())
+	}
+	variadic := funcInfo.Variadic
+	if isDirect {
+		instructions = append(instructions, &FunctionCall{
+			Name:     funcName,
+			Args:     arguments,
+			Dst:      dst,
+			Variadic: variadic,
+		})
+	} else {
+		instructions = append(instructions, &IndirectCall{
+			FunPtr:   funPtr,
+			Args:     arguments,
+			Dst:      dst,
+			Variadic: variadic,
+		})
+	}
+	return dst, instructions
+}
+
+// directCallee returns the name of the called function if the callee is
+// a function designator like "f" or "(*f)"
+func directCallee(callee frontend.Expression) (string, bool) {
+	switch c := callee.(type) {
+	case *frontend.Variable:
+		return c.Name, c.GetResultType().GetTypeId() == frontend.TypeFunc
+	case *frontend.Dereference:
+		if c.Operand.GetResultType().GetTypeId() == frontend.TypeFunc {
+			return directCallee(c.Operand)
+		}
+	}
+	return "", false
+}
 
-	condValue, instructions := t.translateExpr(conditional.Condition)
+// calleeType returns the type of the called function
+func calleeType(callee frontend.Expression) *frontend.FuncInfo {
+	calleeType := callee.GetResultType()
+	if frontend.IsPointer(calleeType) {
+		calleeType = calleeType.(*frontend.PointerInfo).Referenced
+	}
+	return calleeType.(*frontend.FuncInfo)
+}
+
+func (t *Translator) translateConditional(conditional *frontend.Conditional) (Value, []Instruction) {
 	endLabelName := t.createLabelName("end")
 	elseLabelName := t.createLabelName("else")
-
-	instructions = append(instructions, &JumpIfZero{condValue, elseLabelName})
+	instructions := t.translateJump(conditional.Condition, elseLabelName, false)
 	consValue, consInstructions := t.translateExpr(conditional.Consequent)
+	altValue, altInstructions := t.translateExpr(conditional.Alternate)
+
+	var resultValue *Var
+	if conditional.GetResultType().GetTypeId() != frontend.TypeVoid {
+		resultValue = t.createVar(conditional.GetResultType())
+		consInstructions = append(consInstructions, &Copy{consValue, resultValue})
+		altInstructions = append(altInstructions, &Copy{altValue, resultValue})
+	}
+
 	instructions = append(instructions, consInstructions...)
-	instructions = append(instructions, &Copy{consValue, resultValue})
 	instructions = append(instructions, &Jump{endLabelName})
 	instructions = append(instructions, &Label{elseLabelName})
-	altValue, altInstructions := t.translateExpr(conditional.Alternate)
 	instructions = append(instructions, altInstructions...)
-	instructions = append(instructions, &Copy{altValue, resultValue})
 	instructions = append(instructions, &Label{endLabelName})
 
+	if resultValue == nil {
+		return nil, instructions
+	}
 	return resultValue, instructions
 }
 
-func (t *Translator) translatePostfixIncDec(postfixIncDec *frontend.PostfixIncDec) (Value, []Instruction) {
-	resultValue := &Var{t.createVarName()}
-	value := &Var{postfixIncDec.Operand.Name}
+// lvalue is the translated target of an assignment: either a variable
+// or the location a pointer points to. For bit-fields ptr points to the
+// int unit that contains the bit-field.
+type lvalue struct {
+	variable *Var
+	ptr      Value
+	lvType   frontend.TypeInfo
+	bitField *frontend.StructMember
+}
+
+func (t *Translator) translateLvalue(expr frontend.Expression) (lvalue, []Instruction) {
+	switch e := expr.(type) {
+	case *frontend.Dereference:
+		ptr, instructions := t.translateExpr(e.Operand)
+		return lvalue{ptr: ptr, lvType: e.GetResultType()}, instructions
+	case *frontend.MemberAccess:
+		objectPtr, instructions := t.objectAddress(e.Object)
+		member := e.Object.GetResultType().(*frontend.StructInfo).FindMember(e.Member)
+		ptr := t.createVar(&frontend.PointerInfo{Referenced: member.Type})
+		instructions = append(instructions, &AddOffset{objectPtr, member.Offset, ptr})
+		lv := lvalue{ptr: ptr, lvType: member.Type}
+		if member.IsBitField() {
+			lv.bitField = member
+		}
+		return lv, instructions
+	}
+	variable := expr.(*frontend.Variable)
+	return lvalue{
+		variable: &Var{variable.Name, variable.GetResultType()},
+		lvType:   variable.GetResultType(),
+	}, nil
+}
+
+// objectAddress returns a pointer to the structure or union the
+// expression designates. Values that are not lvalues (like the result
+// of an assignment) are held in a temporary variable.
+func (t *Translator) objectAddress(object frontend.Expression) (Value, []Instruction) {
+	ptrType := &frontend.PointerInfo{Referenced: object.GetResultType()}
+	switch o := object.(type) {
+	case *frontend.Dereference:
+		return t.translateExpr(o.Operand)
+	case *frontend.MemberAccess:
+		lv, instructions := t.translateLvalue(o)
+		return lv.ptr, instructions
+	}
+	value, instructions := t.translateExpr(object)
+	dst := t.createVar(ptrType)
+	return dst, append(instructions, &GetAddress{value, dst})
+}
+
+// load returns the current value of the lvalue
+func (t *Translator) load(lv lvalue) (Value, []Instruction) {
+	if lv.variable != nil {
+		return lv.variable, nil
+	}
+	if lv.bitField != nil {
+		return t.loadBitField(lv)
+	}
+	dst := t.createVar(lv.lvType)
+	return dst, []Instruction{&Load{lv.ptr, dst}}
+}
+
+// loadBitField extracts the bit-field from its unit. Signed bit-fields
+// are sign extended by shifting them to the top of the unit and back.
+func (t *Translator) loadBitField(lv lvalue) (Value, []Instruction) {
+	unit := t.createVar(intType)
+	instructions := []Instruction{&Load{lv.ptr, unit}}
+	var value Value = unit
+	shift := func(op BinaryOp, amount int) {
+		if amount == 0 {
+			return
+		}
+		dst := t.createVar(intType)
+		instructions = append(instructions, &Binary{op, value, &IntConstant{amount}, dst})
+		value = dst
+	}
+
+	member := lv.bitField
+	if member.Unsigned {
+		shift(&BitShiftRight{}, member.BitOffset)
+		dst := t.createVar(intType)
+		instructions = append(instructions, &Binary{&BitAnd{}, value, &IntConstant{1<<member.BitWidth - 1}, dst})
+		return dst, instructions
+	}
+	shift(&BitShiftLeft{}, 32-member.BitOffset-member.BitWidth)
+	shift(&BitShiftRight{}, 32-member.BitWidth)
+	return value, instructions
+}
+
+// storeBitField replaces the bits of the bit-field in its unit and
+// leaves the other bits of the unit unchanged
+func (t *Translator) storeBitField(lv lvalue, value Value) []Instruction {
+	member := lv.bitField
+	mask := uint32(1<<member.BitWidth-1) << member.BitOffset
+
+	unit := t.createVar(intType)
+	kept := t.createVar(intType)
+	instructions := []Instruction{
+		&Load{lv.ptr, unit},
+		&Binary{&BitAnd{}, unit, &IntConstant{int(int32(^mask))}, kept},
+	}
+	if member.BitOffset > 0 {
+		shifted := t.createVar(intType)
+		instructions = append(instructions, &Binary{&BitShiftLeft{}, value, &IntConstant{member.BitOffset}, shifted})
+		value = shifted
+	}
+	masked := t.createVar(intType)
+	newUnit := t.createVar(intType)
+	return append(instructions,
+		&Binary{&BitAnd{}, value, &IntConstant{int(int32(mask))}, masked},
+		&Binary{&BitOr{}, kept, masked, newUnit},
+		&Store{newUnit, lv.ptr},
+	)
+}
+
+// updateTarget returns the variable that receives the new value of the
+// lvalue. It has to be stored afterwards.
+func (t *Translator) updateTarget(lv lvalue) *Var {
+	if lv.variable != nil {
+		return lv.variable
+	}
+	return t.createVar(lv.lvType)
+}
+
+func (t *Translator) store(lv lvalue, value Value) []Instruction {
+	if lv.bitField != nil {
+		return t.storeBitField(lv, value)
+	}
+	if lv.variable == nil {
+		return []Instruction{&Store{value, lv.ptr}}
+	}
+	if value != lv.variable {
+		return []Instruction{&Copy{value, lv.variable}}
+	}
+	return nil
+}
+
+func (t *Translator) translateIncDec(operator frontend.IncDecOp, operand frontend.Expression, postfix bool) (Value, []Instruction) {
+	lv, instructions := t.translateLvalue(operand)
+	oldValue, loadInstructions := t.load(lv)
+	instructions = append(instructions, loadInstructions...)
+
+	var resultValue Value
+	if postfix {
+		if lv.variable != nil {
+			oldCopy := t.createVar(lv.lvType)
+			instructions = append(instructions, &Copy{oldValue, oldCopy})
+			oldValue = oldCopy
+		}
+		resultValue = oldValue
+	}
 
 	var binOp BinaryOp
-	if postfixIncDec.Operator == "++" {
+	if operator == frontend.IncOp {
 		binOp = &Add{}
 	} else {
 		binOp = &Sub{}
 	}
 
-	instructions := []Instruction{&Copy{value, resultValue}}
-	instructions = append(instructions, &Binary{
-		binOp,
-		value,
-		&IntConstant{1},
-		value,
-	})
+	newValue := t.updateTarget(lv)
+	instructions = append(instructions, &Binary{binOp, oldValue, &IntConstant{1}, newValue})
+	instructions = append(instructions, t.store(lv, newValue)...)
+	if !postfix {
+		resultValue = newValue
+		if lv.bitField != nil {
+			// the new value may have been truncated to the width of the bit-field
+			var loadInstructions []Instruction
+			resultValue, loadInstructions = t.load(lv)
+			instructions = append(instructions, loadInstructions...)
+		}
+	}
 
 	return resultValue, instructions
 }
 
 func (t *Translator) translateAssignment(assignment *frontend.BinaryExpression) (Value, []Instruction) {
 	rhsValue, instructions := t.translateExpr(assignment.Right)
-	v := assignment.Left.(*frontend.Variable)
-	variable := &Var{v.Name}
-	instructions = append(instructions, &Copy{rhsValue, variable})
-	return variable, instructions
+	lv, lvInstructions := t.translateLvalue(assignment.Left)
+	instructions = append(instructions, lvInstructions...)
+	instructions = append(instructions, t.store(lv, rhsValue)...)
+	if lv.variable != nil {
+		return lv.variable, instructions
+	}
+	if lv.bitField != nil {
+		value, loadInstructions := t.load(lv)
+		return value, append(instructions, loadInstructions...)
+	}
+	return rhsValue, instructions
+}
+
+func (t *Translator) translateCompoundAssignment(assignment *frontend.CompoundAssignment) (Value, []Instruction) {
+	lv, instructions := t.translateLvalue(assignment.Left)
+	rhsValue, rhsInstructions := t.translateExpr(assignment.Right)
+	instructions = append(instructions, rhsInstructions...)
+	oldValue, loadInstructions := t.load(lv)
+	instructions = append(instructions, loadInstructions...)
+
+	newValue := t.updateTarget(lv)
+	instructions = append(instructions, &Binary{t.getBinaryOp(assignment.Operator), oldValue, rhsValue, newValue})
+	instructions = append(instructions, t.store(lv, newValue)...)
+	if lv.bitField != nil {
+		value, loadInstructions := t.load(lv)
+		return value, append(instructions, loadInstructions...)
+	}
+
+	return newValue, instructions
+}
+
+func (t *Translator) translateCast(cast *frontend.Cast) (Value, []Instruction) {
+	value, instructions := t.translateExpr(cast.Operand)
+	if cast.TargetType.GetTypeId() == frontend.TypeVoid {
+		return nil, instructions
+	}
+	value, convInstructions := t.convertValue(value, cast.TargetType)
+	return value, append(instructions, convInstructions...)
+}
+
+// convertValue converts a value to the target type
+func (t *Translator) convertValue(value Value, targetType frontend.TypeInfo) (Value, []Instruction) {
+	// function designators have already been converted to pointers
+	srcType := valueType(value)
+	if srcType.Equal(targetType) {
+		return value, nil
+	}
+
+	dst := t.createVar(targetType)
+	srcSize := frontend.SizeOf(srcType)
+	dstSize := frontend.SizeOf(targetType)
+	switch {
+	case value.GetType() == TacIntConstant || srcSize == dstSize:
+		return dst, []Instruction{&Copy{value, dst}}
+	case srcSize < dstSize:
+		return dst, []Instruction{&SignExtend{value, dst}}
+	default:
+		return dst, []Instruction{&Truncate{value, dst}}
+	}
+}
+
+func valueType(value Value) frontend.TypeInfo {
+	switch value.(type) {
+	case *Var:
+		return value.(*Var).Type
+	case nil:
+		return &frontend.VoidInfo{}
+	default:
+		return intType
+	}
 }
 
 func (t *Translator) translateExprWithShortCircuit(
@@ -434,11 +965,11 @@ func (t *Translator) translateExprWithShortCircuit(
 
 	var instructions []Instruction
 
-	varResult := &Var{t.createVarName()}
+	varResult := t.createVar(intType)
 	valLeft, instructionsLeft := t.translateExpr(left)
-	varLeft := &Var{t.createVarName()}
+	varLeft := t.createVar(valueType(valLeft))
 	valRight, instructionsRight := t.translateExpr(right)
-	varRight := &Var{t.createVarName()}
+	varRight := t.createVar(valueType(valRight))
 	labelEnd := t.createLabelName("end")
 	labelFalse := t.createLabelName("false")
 	labelTrue := t.createLabelName("true")
@@ -483,64 +1014,64 @@ func (t *Translator) translateExprWithShortCircuit(
 	return varResult, instructions
 }
 
-func (t *Translator) getUnaryOp(op string) UnaryOp {
+func (t *Translator) getUnaryOp(op frontend.UnaryOp) UnaryOp {
 	switch op {
-	case "-":
+	case frontend.UnOpNegate:
 		return &Negate{}
-	case "~":
+	case frontend.UnOpComplement:
 		return &Complement{}
-	case "!":
+	case frontend.UnOpNot:
 		return &Not{}
 	default:
 		panic("unsupported operator")
 	}
 }
 
-func (t *Translator) getBinaryOp(op string) BinaryOp {
+func (t *Translator) getBinaryOp(op frontend.BinaryOp) BinaryOp {
 	switch op {
-	case "+":
+	case frontend.BinOpAdd:
 		return &Add{}
-	case "-":
+	case frontend.BinOpSub:
 		return &Sub{}
-	case "*":
+	case frontend.BinOpMul:
 		return &Mul{}
-	case "/":
+	case frontend.BinOpDiv:
 		return &Div{}
-	case "%":
+	case frontend.BinOpRemainder:
 		return &Remainder{}
-	case "&":
+	case frontend.BinOpBitAnd:
 		return &BitAnd{}
-	case "|":
+	case frontend.BinOpBitOr:
 		return &BitOr{}
-	case "^":
+	case frontend.BinOpBitXor:
 		return &BitXor{}
-	case "<<":
+	case frontend.BinOpShiftLeft:
 		return &BitShiftLeft{}
-	case ">>":
+	case frontend.BinOpShiftRight:
 		return &BitShiftRight{}
-	case "==":
+	case frontend.BinOpEqual:
 		return &Equal{}
-	case "!=":
+	case frontend.BinOpNotEqual:
 		return &NotEqual{}
-	case ">":
+	case frontend.BinOpGreater:
 		return &Greater{}
-	case ">=":
+	case frontend.BinOpGreaterEq:
 		return &GreaterEq{}
-	case "<":
+	case frontend.BinOpLess:
 		return &Less{}
-	case "<=":
+	case frontend.BinOpLessEq:
 		return &LessEq{}
-	case "&&":
+	case frontend.BinOpAnd:
 		return &And{}
-	case "||":
+	case frontend.BinOpOr:
 		return &Or{}
 	default:
-		panic("unsupported operator: " + op)
+		panic("unsupported operator: " + op.String())
 	}
 }
 
-func (t *Translator) createVarName() string {
-	return t.nameCreator.VarName()
+func (t *Translator) createVar(varType frontend.TypeInfo) *Var {
+	return &Var{t.nameCreator.TempName(), varType}
 }
 
 func (t *Translator) createLabelName(prefix string) string {
@@ -3,6 +3,7 @@ package tacky
 import (
 	"fmt"
 	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+	"reflect"
 	"testing"
 )
 
@@ -25,6 +26,25 @@ int main(void) {
 	fmt.Println(program)
 }
 
+func TestTranslator_Translate_CompoundShiftLeft(t *testing.T) {
+	code := `
+int main(void) {
+	int x = 3;
+	x <<= 2;
+	return x;
+}`
+	program := translate(code)
+	var shift *Binary
+	for _, instr := range program.Funs[0].Body {
+		if binary, ok := instr.(*Binary); ok {
+			shift = binary
+		}
+	}
+	if shift == nil || shift.Op.GetType() != TacBitShiftLeft {
+		t.Errorf("expected x <<= 2 to be translated to a left shift")
+	}
+}
+
 func TestTranslator_Translate_VarDecl(t *testing.T) {
 	code := `
 int main(void) {
@@ -101,6 +121,249 @@ func TestTranslator_TranslateFunctionCall(t *testing.T) {
 	program.Accept(NewAstPrinter(2))
 }
 
+func TestTranslator_TranslateIndirectCall(t *testing.T) {
+	code := `
+	int add(int a, int b) {
+		return a + b;
+	}
+
+	int main(void) {
+		int (*fp)(int, int) = add;
+		return fp(1, 2) + (*fp)(3, 4) + (*add)(5, 6) + add(7, 8);
+	}`
+
+	program := translate(code)
+	program.Accept(NewAstPrinter(2))
+
+	counts := make(map[TacType]int)
+	for _, instr := range program.Funs[1].Body {
+		counts[instr.GetType()]++
+		if getAddress, ok := instr.(*GetAddress); ok {
+			if src := getAddress.Src.(*Var); src.Ident != "add" {
+				t.Errorf("expected the address of add, got %s", src.Ident)
+			}
+		}
+	}
+	if counts[TacIndirectCall] != 2 || counts[TacFunCall] != 2 {
+		t.Errorf("expected two indirect and two direct calls")
+	}
+	if counts[TacGetAddress] != 1 {
+		t.Errorf("expected one GetAddress instruction")
+	}
+}
+
+func TestTranslator_TranslateVariadic(t *testing.T) {
+	code := `
+	int printf(void *format, ...);
+
+	int sum(int count, ...) {
+		__builtin_va_list ap;
+		__builtin_va_start(ap, count);
+		int total = __builtin_va_arg(ap, int) + __builtin_va_arg(ap, int);
+		__builtin_va_end(ap);
+		return total;
+	}
+
+	int main(void) {
+		int (*fp)(int, ...) = sum;
+		return printf(&fp, 1) + sum(2, 1, 2) + fp(1, 42);
+	}`
+
+	program := translate(code)
+	program.Accept(NewAstPrinter(2))
+
+	if !program.Funs[0].Variadic || program.Funs[1].Variadic {
+		t.Errorf("only sum must be variadic")
+	}
+	counts := make(map[TacType]int)
+	for _, instr := range program.Funs[0].Body {
+		counts[instr.GetType()]++
+	}
+	if counts[TacVaStart] != 1 || counts[TacVaArg] != 2 {
+		t.Errorf("expected one VaStart and two VaArg instructions")
+	}
+	for _, instr := range program.Funs[1].Body {
+		switch call := instr.(type) {
+		case *FunctionCall:
+			if !call.Variadic {
+				t.Errorf("call of %s must be variadic", call.Name)
+			}
+		case *IndirectCall:
+			if !call.Variadic {
+				t.Errorf("indirect call must be variadic")
+			}
+		}
+	}
+}
+
+func TestTranslator_TranslateStaticVariables(t *testing.T) {
+	code := `
+	extern int limit;
+	int limit = 10;
+	static int total;
+
+	int count(void) {
+		static int calls = 1;
+		extern int other;
+		total += other;
+		return calls++ < limit;
+	}
+
+	int reset(void) {
+		static int calls;
+		return calls;
+	}`
+
+	program := translate(code)
+	program.Accept(NewAstPrinter(2))
+
+	want := []StaticVariable{
+		{"limit", intType, true, true, 10},
+		{"total", intType, false, true, 0},
+		{"calls.0", intType, false, true, 1},
+		{"other", intType, true, false, 0},
+		{"calls.1", intType, false, true, 0},
+	}
+	if !reflect.DeepEqual(program.StaticVars, want) {
+		t.Errorf("StaticVars = %v, want %v", program.StaticVars, want)
+	}
+	for _, instr := range program.Funs[0].Body {
+		if instr.GetType() == TacCopy && instr.(*Copy).Src.GetType() == TacIntConstant {
+			t.Errorf("static variables must not be initialized in the function body")
+		}
+	}
+	if err := Verify(program, nil); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestTranslator_TranslatePointers(t *testing.T) {
+	code := `
+	void set(int *p, int value) {
+		*p = value;
+	}
+
+	int main(void) {
+		int x = 0;
+		int *p = &x;
+		set(p, sizeof(int *));
+		return *p;
+	}`
+
+	program := translate(code)
+	program.Accept(NewAstPrinter(2))
+
+	set := program.Funs[0]
+	if ret := set.Body[len(set.Body)-1].(*Return); ret.Val != nil {
+		t.Errorf("void function must return no value")
+	}
+	if !frontend.IsPointer(set.Parameters[0].Type) {
+		t.Errorf("parameter p must have a pointer type")
+	}
+
+	counts := make(map[TacType]int)
+	for _, instr := range program.Funs[1].Body {
+		counts[instr.GetType()]++
+		if call, ok := instr.(*FunctionCall); ok {
+			if call.Dst != nil {
+				t.Errorf("call of void function must not have a destination")
+			}
+			if arg := call.Args[1].(*IntConstant); arg.Val != 8 {
+				t.Errorf("sizeof(int *) = %d, want 8", arg.Val)
+			}
+		}
+	}
+	if counts[TacGetAddress] != 1 || counts[TacLoad] != 1 {
+		t.Errorf("expected one GetAddress and one Load instruction")
+	}
+}
+
+func TestTranslator_TranslateConditions(t *testing.T) {
+	code := `
+	int f(int a, int b) {
+		int n = 0;
+		if (a && !(b > 3))
+			n = 1;
+		while (a < b || b == 0)
+			a++;
+		do {
+			b--;
+		} while (!b);
+		for (;;)
+			return n ? a : b;
+	}`
+
+	program := translate(code)
+	program.Accept(NewAstPrinter(2))
+
+	counts := make(map[TacType]int)
+	for _, instr := range program.Funs[0].Body {
+		counts[instr.GetType()]++
+		if binary, ok := instr.(*Binary); ok && binary.Op.GetType() != TacAdd && binary.Op.GetType() != TacSub {
+			t.Errorf("conditions must not be materialized, found %T", binary.Op)
+		}
+	}
+	if counts[TacCompareAndJump] != 3 {
+		t.Errorf("expected 3 CompareAndJump instructions, got %d", counts[TacCompareAndJump])
+	}
+	// "a", "!b" and "n"
+	if counts[TacJumpIfZero] != 3 || counts[TacJumpIfNotZero] != 0 {
+		t.Errorf("expected 3 JumpIfZero and no JumpIfNotZero instructions, got %d and %d",
+			counts[TacJumpIfZero], counts[TacJumpIfNotZero])
+	}
+	if err := Verify(program, nil); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestTranslator_TranslateMemberAccess(t *testing.T) {
+	code := `
+	struct s {
+		int x;
+		int a : 3;
+		unsigned b : 4;
+	};
+
+	int f(struct s *p) {
+		struct s copy = *p;
+		p->a = -1;
+		return copy.x + p->b;
+	}`
+
+	program := translate(code)
+	program.Accept(NewAstPrinter(2))
+
+	counts := make(map[TacType]int)
+	var offsets []int
+	var constants []int
+	for _, instr := range program.Funs[0].Body {
+		counts[instr.GetType()]++
+		switch i := instr.(type) {
+		case *AddOffset:
+			offsets = append(offsets, i.Offset)
+		case *Binary:
+			if c, ok := i.Src2.(*IntConstant); ok {
+				constants = append(constants, c.Val)
+			}
+		}
+	}
+	if !reflect.DeepEqual(offsets, []int{4, 0, 4}) {
+		t.Errorf("offsets = %v, want [4 0 4]", offsets)
+	}
+	// store a: clear bits 0-2 and mask the new value,
+	// reload a: sign extend bits 0-2 by shifting left and right,
+	// load b: shift bits 3-6 down and mask them
+	if !reflect.DeepEqual(constants, []int{-8, 7, 29, 29, 3, 15}) {
+		t.Errorf("bit-field constants = %v, want [-8 7 29 29 3 15]", constants)
+	}
+	if counts[TacStore] != 1 || counts[TacLoad] != 5 {
+		t.Errorf("expected one Store and 5 Load instructions, got %d and %d", counts[TacStore], counts[TacLoad])
+	}
+	if err := Verify(program, nil); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
 func translate(code string) *Program {
 	nameCreator := frontend.NewNameCreator()
 	tokens, _ := frontend.Tokenize(code)
@@ -0,0 +1,308 @@
+package tacky
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thomasbollmeier/writing-a-c-compiler/tbcc/frontend"
+)
+
+type verifier struct {
+	globalEnv  *frontend.Environment
+	arities    map[string]int
+	staticVars map[string]bool
+	labels     map[string]string
+	errorList  []error
+}
+
+// Verify checks the program for structural errors:
+//   - every jump target must have a matching label in the same function
+//   - labels must be unique
+//   - temporaries must be defined before they are used. Variables of
+//     the source may be read uninitialized, which is valid C.
+//   - function calls must match the arity of the called function
+//     (variadic functions need at least as many arguments)
+//
+// The global environment is used to look up the arity of functions
+// that are declared but not defined in the program. It may be nil.
+func Verify(program *Program, globalEnv *frontend.Environment) error {
+	v := &verifier{
+		globalEnv:  globalEnv,
+		arities:    make(map[string]int),
+		staticVars: make(map[string]bool),
+		labels:     make(map[string]string),
+		errorList:  make([]error, 0),
+	}
+	return v.verify(program)
+}
+
+func (v *verifier) verify(program *Program) error {
+	for _, staticVar := range program.StaticVars {
+		v.staticVars[staticVar.Ident] = true
+	}
+	for _, f := range program.Funs {
+		if _, ok := v.arities[f.Ident]; ok {
+			v.addError(f.Ident, "function is defined more than once")
+		}
+		v.arities[f.Ident] = len(f.Parameters)
+	}
+
+	for i := range program.Funs {
+		f := &program.Funs[i]
+		v.verifyLabels(f)
+		v.verifyCalls(f)
+		v.verifyDefinitions(f)
+	}
+
+	return errors.Join(v.errorList...)
+}
+
+func (v *verifier) verifyLabels(f *Function) {
+	ownLabels := make(map[string]bool)
+	for _, instr := range f.Body {
+		if instr.GetType() != TacLabel {
+			continue
+		}
+		name := instr.(*Label).Name
+		if owner, ok := v.labels[name]; ok {
+			if owner == f.Ident {
+				v.addError(f.Ident, fmt.Sprintf("label %s is not unique", name))
+			} else {
+				v.addError(f.Ident, fmt.Sprintf("label %s is already used in function %s", name, owner))
+			}
+		}
+		v.labels[name] = f.Ident
+		ownLabels[name] = true
+	}
+
+	for _, instr := range f.Body {
+		var target string
+		switch instr.GetType() {
+		case TacJump:
+			target = instr.(*Jump).Target
+		case TacJumpIfZero:
+			target = instr.(*JumpIfZero).Target
+		case TacJumpIfNotZero:
+			target = instr.(*JumpIfNotZero).Target
+		case TacCompareAndJump:
+			target = instr.(*CompareAndJump).Target
+		default:
+			continue
+		}
+		if !ownLabels[target] {
+			v.addError(f.Ident, fmt.Sprintf("jump target %s has no matching label", target))
+		}
+	}
+}
+
+func (v *verifier) verifyCalls(f *Function) {
+	for _, instr := range f.Body {
+		if instr.GetType() != TacFunCall {
+			continue
+		}
+		call := instr.(*FunctionCall)
+		arity, ok := v.getArity(call.Name)
+		if !ok {
+			continue
+		}
+		if call.Variadic && len(call.Args) < arity {
+			v.addError(f.Ident, fmt.Sprintf("call of %s with %d arguments, expected at least %d",
+				call.Name, len(call.Args), arity))
+		} else if !call.Variadic && arity != len(call.Args) {
+			v.addError(f.Ident, fmt.Sprintf("call of %s with %d arguments, expected %d",
+				call.Name, len(call.Args), arity))
+		}
+	}
+}
+
+func (v *verifier) getArity(funcName string) (int, bool) {
+	arity, ok := v.arities[funcName]
+	if ok {
+		return arity, true
+	}
+	if v.globalEnv == nil {
+		return 0, false
+	}
+	entry, _ := v.globalEnv.Get(funcName)
+	if entry == nil || entry.GetTypeInfo() == nil || entry.GetTypeInfo().GetTypeId() != frontend.TypeFunc {
+		return 0, false
+	}
+	funcInfo := entry.GetTypeInfo().(*frontend.FuncInfo)
+	if funcInfo.Unprototyped {
+		return 0, false
+	}
+	return funcInfo.NumParams(), true
+}
+
+// verifyDefinitions checks that on every reachable use of a temporary
+// there is at least one path from the function entry on which the
+// temporary is defined
+func (v *verifier) verifyDefinitions(f *Function) {
+	cfg := BuildCfg(f)
+	reachable := cfg.Reachable()
+
+	params := make(map[string]bool)
+	for _, param := range f.Parameters {
+		params[param.Ident] = true
+	}
+
+	defsIn := make([]map[string]bool, len(cfg.Blocks))
+	defsOut := make([]map[string]bool, len(cfg.Blocks))
+	for i := range cfg.Blocks {
+		defsOut[i] = make(map[string]bool)
+	}
+
+	changed := true
+	for changed {
+		changed = false
+		for i, block := range cfg.Blocks {
+			in := make(map[string]bool)
+			if i == 0 {
+				for param := range params {
+					in[param] = true
+				}
+				for name := range v.staticVars {
+					in[name] = true
+				}
+			}
+			for _, pred := range block.Predecessors {
+				for name := range defsOut[pred] {
+					in[name] = true
+				}
+			}
+			defsIn[i] = in
+			for _, instr := range block.Instructions {
+				for _, name := range definedVars(instr) {
+					in[name] = true
+				}
+			}
+			if len(in) != len(defsOut[i]) {
+				defsOut[i] = in
+				changed = true
+			}
+		}
+	}
+
+	reported := make(map[string]bool)
+	for i, block := range cfg.Blocks {
+		if !reachable[i] {
+			continue
+		}
+		defined := make(map[string]bool)
+		for name := range defsIn[i] {
+			defined[name] = true
+		}
+		for _, instr := range block.Instructions {
+			for _, name := range usedVars(instr) {
+				if frontend.IsTempName(name) && !defined[name] && !reported[name] {
+					v.addError(f.Ident, fmt.Sprintf("temporary %s is used before it is defined", name))
+					reported[name] = true
+				}
+			}
+			for _, name := range definedVars(instr) {
+				defined[name] = true
+			}
+			if dst := destination(instr); dst != nil && dst.GetType() != TacVar {
+				v.addError(f.Ident, "destination of instruction must be a variable")
+			}
+		}
+	}
+}
+
+func (v *verifier) addError(funcName, message string) {
+	v.errorList = append(v.errorList, errors.New(fmt.Sprintf("%s: %s", funcName, message)))
+}
+
+func destination(instr Instruction) Value {
+	switch instr.GetType() {
+	case TacUnary:
+		return instr.(*Unary).Dst
+	case TacBinary:
+		return instr.(*Binary).Dst
+	case TacCopy:
+		return instr.(*Copy).Dst
+	case TacFunCall:
+		return instr.(*FunctionCall).Dst
+	case TacIndirectCall:
+		return instr.(*IndirectCall).Dst
+	case TacGetAddress:
+		return instr.(*GetAddress).Dst
+	case TacLoad:
+		return instr.(*Load).Dst
+	case TacAddOffset:
+		return instr.(*AddOffset).Dst
+	case TacSignExtend:
+		return instr.(*SignExtend).Dst
+	case TacTruncate:
+		return instr.(*Truncate).Dst
+	case TacVaArg:
+		return instr.(*VaArg).Dst
+	default:
+		return nil
+	}
+}
+
+func definedVars(instr Instruction) []string {
+	var names []string
+	// a variable whose address is taken may be defined through the pointer
+	if instr.GetType() == TacGetAddress {
+		if src := instr.(*GetAddress).Src; src.GetType() == TacVar {
+			names = append(names, src.(*Var).Ident)
+		}
+	}
+	dst := destination(instr)
+	if dst == nil || dst.GetType() != TacVar {
+		return names
+	}
+	return append(names, dst.(*Var).Ident)
+}
+
+func usedVars(instr Instruction) []string {
+	var values []Value
+	switch instr.GetType() {
+	case TacReturn:
+		values = []Value{instr.(*Return).Val}
+	case TacUnary:
+		values = []Value{instr.(*Unary).Src}
+	case TacBinary:
+		binary := instr.(*Binary)
+		values = []Value{binary.Src1, binary.Src2}
+	case TacCopy:
+		values = []Value{instr.(*Copy).Src}
+	case TacJumpIfZero:
+		values = []Value{instr.(*JumpIfZero).Condition}
+	case TacJumpIfNotZero:
+		values = []Value{instr.(*JumpIfNotZero).Condition}
+	case TacCompareAndJump:
+		jump := instr.(*CompareAndJump)
+		values = []Value{jump.Src1, jump.Src2}
+	case TacFunCall:
+		values = instr.(*FunctionCall).Args
+	case TacIndirectCall:
+		call := instr.(*IndirectCall)
+		values = append([]Value{call.FunPtr}, call.Args...)
+	case TacLoad:
+		values = []Value{instr.(*Load).SrcPtr}
+	case TacStore:
+		store := instr.(*Store)
+		values = []Value{store.Src, store.DstPtr}
+	case TacAddOffset:
+		values = []Value{instr.(*AddOffset).Ptr}
+	case TacSignExtend:
+		values = []Value{instr.(*SignExtend).Src}
+	case TacTruncate:
+		values = []Value{instr.(*Truncate).Src}
+	case TacVaStart:
+		values = []Value{instr.(*VaStart).VaList}
+	case TacVaArg:
+		values = []Value{instr.(*VaArg).VaList}
+	default:
+	}
+
+	var names []string
+	for _, value := range values {
+		if value != nil && value.GetType() == TacVar {
+			names = append(names, value.(*Var).Ident)
+		}
+	}
+	return names
+}
@@ -0,0 +1,106 @@
+package tacky
+
+import (
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	code := `
+	int add(int a, int b) {
+		return a + b;
+	}
+
+	int main(void) {
+		int sum = 0;
+		int x;
+		for (int i = 0; i < 10; i++) {
+			if (i > 0)
+				sum = add(sum, x);
+			x = i;
+			switch (i) {
+				case 1: continue;
+				default: sum = sum + 1;
+			}
+		}
+		goto end;
+		sum = 0;
+	end:
+		return sum && x || !sum;
+	}`
+
+	program := translate(code)
+	err := Verify(program, nil)
+	if err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	// reading an uninitialized variable is valid C
+	program = translate(`int main(void) { int x; return x; }`)
+	if err = Verify(program, nil); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestVerify_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		program *Program
+	}{
+		{
+			"missing label",
+			&Program{Funs: []Function{{
+				Ident: "main",
+				Body: []Instruction{
+					&Jump{"nowhere"},
+					&Return{&IntConstant{0}},
+				},
+			}}},
+		},
+		{
+			"duplicate label",
+			&Program{Funs: []Function{{
+				Ident: "main",
+				Body: []Instruction{
+					&Label{"here"},
+					&Label{"here"},
+					&Return{&IntConstant{0}},
+				},
+			}}},
+		},
+		{
+			"use before definition",
+			&Program{Funs: []Function{{
+				Ident: "main",
+				Body: []Instruction{
+					&Copy{&Var{".t0", intType}, &Var{"b", intType}},
+					&Return{&Var{"b", intType}},
+				},
+			}}},
+		},
+		{
+			"wrong arity",
+			&Program{Funs: []Function{
+				{
+					Ident:      "id",
+					Parameters: []*Var{{"x", intType}},
+					Body:       []Instruction{&Return{&Var{"x", intType}}},
+				},
+				{
+					Ident: "main",
+					Body: []Instruction{
+						&FunctionCall{"id", []Value{&IntConstant{1}, &IntConstant{2}}, &Var{"r", intType}, false},
+						&Return{&Var{"r", intType}},
+					},
+				},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.program, nil)
+			if err == nil {
+				t.Errorf("Verify() should have returned an error")
+			}
+		})
+	}
+}